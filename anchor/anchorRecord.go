@@ -16,12 +16,25 @@ import (
 	"github.com/FactomProject/factomd/common/primitives"
 )
 
+// Anchor record versions.  A single block record anchors the directory block
+// KeyMR.  A window record anchors the directory blocks from DBHeightMin to
+// DBHeight through WindowMR, the Merkle root of their KeyMRs in height order,
+// so one anchor transaction covers many blocks.  A window record still has the
+// KeyMR of the block at DBHeight, so it reads as that block's anchor to nodes
+// that don't know windows.
+const (
+	AnchorRecordVerSingle = 1
+	AnchorRecordVerWindow = 2
+)
+
 //AnchorRecord is used to construct anchor chain
 type AnchorRecord struct {
 	AnchorRecordVer int
 	DBHeight        uint32
 	KeyMR           string
 	RecordHeight    uint32 //the block height we intended to put the anchorrecod into
+	DBHeightMin     uint32 `json:",omitempty"` //the first block of a window
+	WindowMR        string `json:",omitempty"` //the Merkle root of the KeyMRs of a window
 
 	Bitcoin  *BitcoinStruct  `json:",omitempty"`
 	Ethereum *EthereumStruct `json:",omitempty"`
@@ -100,6 +113,60 @@ func (ar *AnchorRecord) Unmarshal(data []byte) error {
 		return err
 	}
 
+	return ar.validateWindow()
+}
+
+// validateWindow checks a window record has a window
+func (ar *AnchorRecord) validateWindow() error {
+	if ar.IsWindow() == false {
+		return nil
+	}
+	if ar.DBHeightMin > ar.DBHeight {
+		return fmt.Errorf("Anchor window starts at %v, after it ends at %v", ar.DBHeightMin, ar.DBHeight)
+	}
+	if ar.WindowMR == "" {
+		return fmt.Errorf("Anchor window has no WindowMR")
+	}
+	_, err := primitives.NewShaHashFromStr(ar.WindowMR)
+	if err != nil {
+		return fmt.Errorf("Anchor window has an invalid WindowMR: %v", err)
+	}
+	return nil
+}
+
+// IsWindow returns true if the record anchors a window of directory blocks
+func (ar *AnchorRecord) IsWindow() bool {
+	return ar.AnchorRecordVer == AnchorRecordVerWindow
+}
+
+// AnchoredMR returns what the anchor transaction commits to, the WindowMR of
+// a window record or the KeyMR of a single block record
+func (ar *AnchorRecord) AnchoredMR() string {
+	if ar.IsWindow() {
+		return ar.WindowMR
+	}
+	return ar.KeyMR
+}
+
+// ValidateWindow checks the directory block KeyMRs, in height order from
+// DBHeightMin, are those the record anchors
+func (ar *AnchorRecord) ValidateWindow(keyMRs []interfaces.IHash) error {
+	if ar.IsWindow() == false {
+		if len(keyMRs) != 1 || keyMRs[0].String() != ar.KeyMR {
+			return fmt.Errorf("Anchor record does not anchor the KeyMRs")
+		}
+		return nil
+	}
+	if uint32(len(keyMRs)) != ar.DBHeight-ar.DBHeightMin+1 {
+		return fmt.Errorf("Anchor window has %v blocks, not %v", ar.DBHeight-ar.DBHeightMin+1, len(keyMRs))
+	}
+	if keyMRs[len(keyMRs)-1].String() != ar.KeyMR {
+		return fmt.Errorf("Anchor window ends at %v, not %v", ar.KeyMR, keyMRs[len(keyMRs)-1])
+	}
+	root := ComputeWindowMR(keyMRs)
+	if root.String() != ar.WindowMR {
+		return fmt.Errorf("Anchor window has WindowMR %v, not %v", ar.WindowMR, root)
+	}
 	return nil
 }
 
@@ -196,6 +263,17 @@ func UnmarshalAndValidateAnchorEntryAnyVersion(entry interfaces.IEBEntry, public
 	return ar, valid, err
 }
 
+// ComputeWindowMR returns the Merkle root of a window of directory block KeyMRs
+func ComputeWindowMR(keyMRs []interfaces.IHash) interfaces.IHash {
+	return primitives.ComputeMerkleRoot(append([]interfaces.IHash{}, keyMRs...))
+}
+
+// WindowMerkleBranch returns the Merkle branch from a directory block KeyMR to
+// the WindowMR of the window holding it
+func WindowMerkleBranch(keyMRs []interfaces.IHash, keyMR interfaces.IHash, fullDetail bool) []*primitives.MerkleNode {
+	return primitives.BuildMerkleBranchForEntryHash(append([]interfaces.IHash{}, keyMRs...), keyMR, fullDetail)
+}
+
 func CreateAnchorRecordFromDBlock(dBlock interfaces.IDirectoryBlock) *AnchorRecord {
 	ar := new(AnchorRecord)
 	ar.AnchorRecordVer = 1
@@ -204,3 +282,23 @@ func CreateAnchorRecordFromDBlock(dBlock interfaces.IDirectoryBlock) *AnchorReco
 	ar.RecordHeight = ar.DBHeight
 	return ar
 }
+
+// CreateAnchorRecordFromDBlocks creates a window record for consecutive
+// directory blocks, in height order
+func CreateAnchorRecordFromDBlocks(dBlocks []interfaces.IDirectoryBlock) (*AnchorRecord, error) {
+	if len(dBlocks) == 0 {
+		return nil, fmt.Errorf("No directory blocks passed")
+	}
+	keyMRs := []interfaces.IHash{}
+	for i, dBlock := range dBlocks {
+		if i > 0 && dBlock.GetHeader().GetDBHeight() != dBlocks[i-1].GetHeader().GetDBHeight()+1 {
+			return nil, fmt.Errorf("Directory block %v does not follow %v", dBlock.GetHeader().GetDBHeight(), dBlocks[i-1].GetHeader().GetDBHeight())
+		}
+		keyMRs = append(keyMRs, dBlock.DatabasePrimaryIndex())
+	}
+	ar := CreateAnchorRecordFromDBlock(dBlocks[len(dBlocks)-1])
+	ar.AnchorRecordVer = AnchorRecordVerWindow
+	ar.DBHeightMin = dBlocks[0].GetHeader().GetDBHeight()
+	ar.WindowMR = ComputeWindowMR(keyMRs).String()
+	return ar, nil
+}
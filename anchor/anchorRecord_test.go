@@ -191,3 +191,73 @@ func TestCreateAndValidateAnchorRecordV2(t *testing.T) {
 		t.Errorf("No anchor record unmarshalled.")
 	}
 }
+
+func TestCreateAndValidateWindowAnchorRecord(t *testing.T) {
+	dBlocks := []interfaces.IDirectoryBlock{}
+	keyMRs := []interfaces.IHash{}
+	for _, block := range CreateFullTestBlockSet()[:5] {
+		dBlocks = append(dBlocks, block.DBlock)
+		keyMRs = append(keyMRs, block.DBlock.DatabasePrimaryIndex())
+	}
+
+	ar, err := CreateAnchorRecordFromDBlocks(dBlocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ar.IsWindow() == false || ar.DBHeightMin != 0 || ar.DBHeight != 4 {
+		t.Errorf("Wrong window %v-%v", ar.DBHeightMin, ar.DBHeight)
+	}
+	if ar.KeyMR != keyMRs[4].String() || ar.AnchoredMR() != ar.WindowMR {
+		t.Errorf("Window anchors %v and %v", ar.KeyMR, ar.AnchoredMR())
+	}
+	if err = ar.ValidateWindow(keyMRs); err != nil {
+		t.Error(err)
+	}
+	if ar.ValidateWindow(keyMRs[1:]) == nil {
+		t.Error("Window validated with a block missing")
+	}
+	if ar.ValidateWindow(append(keyMRs[:4:4], primitives.Sha([]byte("other")))) == nil {
+		t.Error("Window validated with another block")
+	}
+	for i, keyMR := range keyMRs {
+		branch := WindowMerkleBranch(keyMRs, keyMR, true)
+		if branch[len(branch)-1].Top.String() != ar.WindowMR {
+			t.Errorf("Branch of block %v ends at %v", i, branch[len(branch)-1].Top)
+		}
+	}
+
+	ar.Bitcoin = new(BitcoinStruct)
+	ar.Bitcoin.TXID = fmt.Sprintf("%x", IntToByteSlice(int(ar.DBHeight)))
+	ar.Bitcoin.BlockHash = fmt.Sprintf("%x", IntToByteSlice(255-int(ar.DBHeight)))
+	data, exIDs, err := ar.MarshalAndSignV2(NewPrimitivesPrivateKey(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubs := []interfaces.Verifier{NewPrimitivesPrivateKey(0).Pub}
+	ar2, ok, err := UnmarshalAndValidateAnchorRecordV2(data, [][]byte{exIDs}, pubs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok == false {
+		t.Errorf("Invalid anchor signatures")
+	}
+	if ar2.IsWindow() == false || ar2.WindowMR != ar.WindowMR || ar2.DBHeightMin != ar.DBHeightMin {
+		t.Errorf("Window not unmarshalled - %v", ar2)
+	}
+
+	_, err = CreateAnchorRecordFromDBlocks([]interfaces.IDirectoryBlock{dBlocks[0], dBlocks[2]})
+	if err == nil {
+		t.Error("Window created from blocks that don't follow each other")
+	}
+}
+
+func TestUnmarshalBadWindowAnchorRecord(t *testing.T) {
+	for _, record := range []string{
+		`{"AnchorRecordVer":2,"DBHeight":5,"KeyMR":"980ab6d50d9fad574ad4df6dba06a8c02b1c67288ee5beab3fbfde2723f73ef6","RecordHeight":6,"DBHeightMin":6,"WindowMR":"980ab6d50d9fad574ad4df6dba06a8c02b1c67288ee5beab3fbfde2723f73ef6","Bitcoin":{"TXID":"e2ac71c9c0fd8edc0be8c0ba7098b77fb7d90dcca755d5b9348116f3f9d9f951"}}`,
+		`{"AnchorRecordVer":2,"DBHeight":5,"KeyMR":"980ab6d50d9fad574ad4df6dba06a8c02b1c67288ee5beab3fbfde2723f73ef6","RecordHeight":6,"DBHeightMin":1,"Bitcoin":{"TXID":"e2ac71c9c0fd8edc0be8c0ba7098b77fb7d90dcca755d5b9348116f3f9d9f951"}}`,
+	} {
+		if _, err := UnmarshalAnchorRecord([]byte(record)); err == nil {
+			t.Errorf("Bad window unmarshalled - %v", record)
+		}
+	}
+}
@@ -120,6 +120,27 @@ const (
 	NETWORK_CUSTOM            // 3
 )
 
+// RCD_2_NOT_SCHEDULED is the activation height of a network that has not yet
+// agreed on a height from which to accept multisig (RCD type 2) inputs
+const RCD_2_NOT_SCHEDULED = ^uint32(0)
+
+// RCD2ActivationHeights holds, by network ID, the directory block height from
+// which multisig (RCD type 2) inputs are valid.  The main network height has to
+// be coordinated with the authority set before it is scheduled.  Networks not
+// listed here accept multisig inputs at any height.
+var RCD2ActivationHeights = map[uint32]uint32{
+	MAIN_NETWORK_ID: RCD_2_NOT_SCHEDULED,
+}
+
+// RCD2ActivationHeight returns the directory block height from which multisig
+// inputs are valid on the given network
+func RCD2ActivationHeight(networkID uint32) uint32 {
+	if height, ok := RCD2ActivationHeights[networkID]; ok {
+		return height
+	}
+	return 0
+}
+
 // Slices and arrays that should not ever be modified:
 //===================================================
 // Used as a key in the wallet to find the current seed value.
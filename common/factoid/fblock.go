@@ -425,23 +425,30 @@ func (b *FBlock) GetLedgerMR() interfaces.IHash {
 	return lmr
 }
 
-func (b *FBlock) GetBodyMR() interfaces.IHash {
-	hashes := make([]interfaces.IHash, 0, len(b.Transactions))
+// BodyLeafHashes returns the hashes the body Merkle root of a factoid block is
+// built from, which are the transaction hashes with the minute markers between them
+func BodyLeafHashes(b interfaces.IFBlock) []interfaces.IHash {
+	txs := b.GetTransactions()
+	endOfPeriod := b.GetEndOfPeriod()
+	hashes := make([]interfaces.IHash, 0, len(txs))
 	marker := 0
-	for i, trans := range b.Transactions {
-		for marker < len(b.endOfPeriod) && i != 0 && i == b.endOfPeriod[marker] {
+	for i, trans := range txs {
+		for marker < len(endOfPeriod) && i != 0 && i == endOfPeriod[marker] {
 			marker++
 			hashes = append(hashes, primitives.Sha(constants.ZERO))
 		}
 		hashes = append(hashes, trans.GetHash())
 	}
 	// Add any lagging markers
-	for marker < len(b.endOfPeriod) {
+	for marker < len(endOfPeriod) {
 		marker++
 		hashes = append(hashes, primitives.Sha(constants.ZERO))
 	}
+	return hashes
+}
 
-	b.BodyMR = primitives.ComputeMerkleRoot(hashes)
+func (b *FBlock) GetBodyMR() interfaces.IHash {
+	b.BodyMR = primitives.ComputeMerkleRoot(BodyLeafHashes(b))
 
 	return b.BodyMR
 }
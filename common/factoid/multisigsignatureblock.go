@@ -0,0 +1,228 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"fmt"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+/**************************************
+ * Multisig Signature Block
+ *
+ * The signature block for an RCD_2.  Since the addresses in an RCD_2 are
+ * hashes of other RCDs, each signature reveals the RCD it satisfies, and the
+ * index of its address in the RCD_2.  The signature block for the revealed
+ * RCD follows, which is itself a MultisigSignatureBlock if the revealed RCD
+ * is also an RCD_2.
+ *
+ * Binary format:
+ *   uint16  number of signatures
+ *   for each signature:
+ *     uint16  index of the address in the RCD_2
+ *     RCD     the RCD whose hash is that address
+ *     block   the signature block for that RCD
+ **************************************/
+
+type MultisigSignature struct {
+	Index    int                        `json:"index"`    // Index of the address in the RCD_2
+	RCD      interfaces.IRCD            `json:"rcd"`      // RCD behind that address
+	SigBlock interfaces.ISignatureBlock `json:"sigblock"` // Signatures satisfying the RCD
+}
+
+type MultisigSignatureBlock struct {
+	Signatures []*MultisigSignature `json:"signatures"`
+}
+
+var _ interfaces.ISignatureBlock = (*MultisigSignatureBlock)(nil)
+
+func (b *MultisigSignatureBlock) IsSameAs(s interfaces.ISignatureBlock) bool {
+	if s == nil {
+		return b == nil
+	}
+	m, ok := s.(*MultisigSignatureBlock)
+	if !ok {
+		return false
+	}
+	d1, err := b.MarshalBinary()
+	if err != nil {
+		return false
+	}
+	d2, err := m.MarshalBinary()
+	if err != nil {
+		return false
+	}
+	return primitives.AreBytesEqual(d1, d2)
+}
+
+func (b *MultisigSignatureBlock) UnmarshalBinary(data []byte) error {
+	_, err := b.UnmarshalBinaryData(data)
+	return err
+}
+
+func (e *MultisigSignatureBlock) JSONByte() ([]byte, error) {
+	return primitives.EncodeJSON(e)
+}
+
+func (e *MultisigSignatureBlock) JSONString() (string, error) {
+	return primitives.EncodeJSONString(e)
+}
+
+func (b MultisigSignatureBlock) String() string {
+	txt, err := b.CustomMarshalText()
+	if err != nil {
+		return "<error>"
+	}
+	return string(txt)
+}
+
+// AddRCDSignature adds the signature block satisfying the RCD at the given
+// index of the RCD_2 this block signs for.
+func (b *MultisigSignatureBlock) AddRCDSignature(index int, rcd interfaces.IRCD, sigblk interfaces.ISignatureBlock) {
+	sig := new(MultisigSignature)
+	sig.Index = index
+	sig.RCD = rcd
+	sig.SigBlock = sigblk
+	b.Signatures = append(b.Signatures, sig)
+}
+
+// AddSignature fails for a multisig, as a signature has to be tied to the RCD
+// it satisfies, and a bare signature doesn't say which.  Use AddRCDSignature.
+func (b *MultisigSignatureBlock) AddSignature(sig interfaces.ISignature) error {
+	return fmt.Errorf("A multisig signature block needs the RCD a signature satisfies.  Use AddRCDSignature")
+}
+
+// GetSignature returns the index'th of the signatures found in the block,
+// including those in nested signature blocks.
+func (b MultisigSignatureBlock) GetSignature(index int) interfaces.ISignature {
+	sigs := b.GetSignatures()
+	if index < 0 || len(sigs) <= index {
+		return nil
+	}
+	return sigs[index]
+}
+
+// GetSignatures returns all the signatures found in the block, including
+// those in nested signature blocks.
+func (b MultisigSignatureBlock) GetSignatures() []interfaces.ISignature {
+	var sigs []interfaces.ISignature
+	for _, sig := range b.Signatures {
+		if sig == nil || sig.SigBlock == nil {
+			continue
+		}
+		sigs = append(sigs, sig.SigBlock.GetSignatures()...)
+	}
+	return sigs
+}
+
+// NumberOfSignatures returns the number of signatures that have to be checked
+// to validate this block, which is what the transaction pays for.
+func (b MultisigSignatureBlock) NumberOfSignatures() int {
+	cnt := 0
+	for _, sig := range b.Signatures {
+		if sig == nil || sig.RCD == nil {
+			continue
+		}
+		if m, ok := sig.SigBlock.(*MultisigSignatureBlock); ok {
+			cnt += m.NumberOfSignatures()
+		} else {
+			cnt += sig.RCD.NumberOfSignatures()
+		}
+	}
+	return cnt
+}
+
+func (b MultisigSignatureBlock) MarshalBinary() ([]byte, error) {
+	buf := primitives.NewBuffer(nil)
+
+	err := buf.PushUInt16(uint16(len(b.Signatures)))
+	if err != nil {
+		return nil, err
+	}
+	for _, sig := range b.Signatures {
+		if sig == nil || sig.RCD == nil || sig.SigBlock == nil {
+			return nil, fmt.Errorf("Incomplete multisig signature")
+		}
+		err = buf.PushUInt16(uint16(sig.Index))
+		if err != nil {
+			return nil, err
+		}
+		err = buf.PushBinaryMarshallable(sig.RCD)
+		if err != nil {
+			return nil, err
+		}
+		err = buf.PushBinaryMarshallable(sig.SigBlock)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.DeepCopyBytes(), nil
+}
+
+func (b MultisigSignatureBlock) CustomMarshalText() ([]byte, error) {
+	var out primitives.Buffer
+
+	out.WriteString("Multisig Signature Block: \n")
+	for _, sig := range b.Signatures {
+		if sig == nil || sig.RCD == nil || sig.SigBlock == nil {
+			return nil, fmt.Errorf("Incomplete multisig signature")
+		}
+		out.WriteString(" index: ")
+		primitives.WriteNumber16(&out, uint16(sig.Index))
+		out.WriteString("\n ")
+		txt, err := sig.RCD.CustomMarshalText()
+		if err != nil {
+			return nil, err
+		}
+		out.Write(txt)
+		txt, err = sig.SigBlock.CustomMarshalText()
+		if err != nil {
+			return nil, err
+		}
+		out.Write(txt)
+		out.WriteString("\n ")
+	}
+
+	return out.DeepCopyBytes(), nil
+}
+
+func (b *MultisigSignatureBlock) UnmarshalBinaryData(data []byte) ([]byte, error) {
+	buf := primitives.NewBuffer(data)
+
+	cnt, err := buf.PopUInt16()
+	if err != nil {
+		return nil, err
+	}
+
+	b.Signatures = make([]*MultisigSignature, 0, int(cnt))
+	for i := 0; i < int(cnt); i++ {
+		sig := new(MultisigSignature)
+
+		index, err := buf.PopUInt16()
+		if err != nil {
+			return nil, err
+		}
+		sig.Index = int(index)
+
+		rcd, rest, err := UnmarshalBinaryAuth(buf.DeepCopyBytes())
+		if err != nil {
+			return nil, err
+		}
+		sig.RCD = rcd
+
+		sig.SigBlock = CreateSignatureBlock(rcd)
+		rest, err = sig.SigBlock.UnmarshalBinaryData(rest)
+		if err != nil {
+			return nil, err
+		}
+		buf = primitives.NewBuffer(rest)
+
+		b.Signatures = append(b.Signatures, sig)
+	}
+
+	return buf.DeepCopyBytes(), nil
+}
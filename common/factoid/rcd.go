@@ -72,3 +72,14 @@ func CreateRCD(data []byte) interfaces.IRCD {
 		panic("Bad Data encountered by CreateRCD.  Should never happen")
 	}
 }
+
+// CreateSignatureBlock returns an empty signature block of the kind that
+// the given RCD expects.
+func CreateSignatureBlock(rcd interfaces.IRCD) interfaces.ISignatureBlock {
+	switch rcd.(type) {
+	case *RCD_2:
+		return new(MultisigSignatureBlock)
+	default:
+		return new(SignatureBlock)
+	}
+}
@@ -7,8 +7,10 @@ package factoid
 import (
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 
+	"github.com/FactomProject/factomd/common/constants"
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/primitives"
 )
@@ -18,59 +20,111 @@ import (
  ************************/
 
 // Type 2 RCD implement multisig
-// m of n
+// n of m
 // Must have m addresses from which to choose, no fewer, no more
-// Must have n RCD, no fewer no more.
+// Must have n valid signatures, no fewer no more.
 // NOTE: This does mean you can have a multisig nested in a
 // multisig.  It just works.
+//
+// Each of the m addresses is the address (hash) of another RCD.  To spend
+// from an RCD_2, the signature block has to reveal n of those RCDs, each
+// with the signatures that satisfy it.  See MultisigSignatureBlock.
 
 type RCD_2 struct {
-	M           int                   // Number signatures required
-	N           int                   // Total sigatures possible
-	N_Addresses []interfaces.IAddress // n addresses
+	N           int                   // Number signatures required
+	M           int                   // Total sigatures possible
+	N_Addresses []interfaces.IAddress // m addresses
 }
 
 var _ interfaces.IRCD = (*RCD_2)(nil)
 
-/*************************************
- *       Stubs
- *************************************/
+/***************************************
+ *       Methods
+ ***************************************/
 
+// The address of a multisig RCD is the double sha256 of the RCD, the same
+// as it is for an RCD_1.
 func (b RCD_2) GetAddress() (interfaces.IAddress, error) {
-	return nil, nil
+	if err := b.validateStructure(); err != nil {
+		return nil, err
+	}
+	data, err := b.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return CreateAddress(primitives.Shad(data)), nil
 }
 
+// NumberOfSignatures is the minimum number of signatures needed to satisfy
+// the RCD.  Nested RCDs may require more; the exact count is only known from
+// the signature block (see MultisigSignatureBlock.NumberOfSignatures).
 func (b RCD_2) NumberOfSignatures() int {
-	return 1
+	return b.N
 }
 
-/***************************************
- *       Methods
- ***************************************/
-
 func (b RCD_2) IsSameAs(rcd interfaces.IRCD) bool {
 	return b.String() == rcd.String()
 }
 
-func (b RCD_2) UnmarshalBinary(data []byte) error {
+func (b *RCD_2) UnmarshalBinary(data []byte) error {
 	_, err := b.UnmarshalBinaryData(data)
 	return err
 }
 
+// CheckSig validates the signature block given for this RCD.  It must be a
+// MultisigSignatureBlock holding exactly N entries, each of which refers to
+// a different address of the RCD, reveals the RCD behind that address, and
+// carries valid signatures for that RCD.
 func (b RCD_2) CheckSig(trans interfaces.ITransaction, sigblk interfaces.ISignatureBlock) bool {
-	return false
+	if sigblk == nil || b.validateStructure() != nil {
+		return false
+	}
+	msb, ok := sigblk.(*MultisigSignatureBlock)
+	if !ok || len(msb.Signatures) != b.N {
+		return false
+	}
+
+	used := make(map[int]bool, b.N)
+	for _, sig := range msb.Signatures {
+		if sig == nil || sig.RCD == nil {
+			return false
+		}
+		if sig.Index < 0 || sig.Index >= b.M || used[sig.Index] {
+			return false
+		}
+		used[sig.Index] = true
+
+		address, err := sig.RCD.GetAddress()
+		if err != nil {
+			return false
+		}
+		if b.N_Addresses[sig.Index].IsSameAs(address) == false {
+			return false
+		}
+		if sig.RCD.CheckSig(trans, sig.SigBlock) == false {
+			return false
+		}
+	}
+	return true
 }
 
 func (e *RCD_2) JSONByte() ([]byte, error) {
 	return primitives.EncodeJSON(e)
 }
 
-// TODO: Fix Json marshaling of RCD_2. Right now the RCD type
-// is not included in the json marshal.
 func (e *RCD_2) JSONString() (string, error) {
 	return primitives.EncodeJSONString(e)
 }
 
+// MarshalJSON will include the RCD type, the same way RCD_1 does.
+func (e *RCD_2) MarshalJSON() ([]byte, error) {
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fmt.Sprintf("%x", data))
+}
+
 func (b RCD_2) String() string {
 	txt, err := b.CustomMarshalText()
 	if err != nil {
@@ -79,6 +133,23 @@ func (b RCD_2) String() string {
 	return string(txt)
 }
 
+// validateStructure checks that n of m makes sense, and that we have
+// exactly m addresses.
+func (b RCD_2) validateStructure() error {
+	if b.N < 1 || b.N > b.M {
+		return fmt.Errorf("Invalid multisig RCD.  n = %d m = %d", b.N, b.M)
+	}
+	if len(b.N_Addresses) != b.M {
+		return fmt.Errorf("Improper number of addresses.  m = %d #addresses = %d", b.M, len(b.N_Addresses))
+	}
+	for _, address := range b.N_Addresses {
+		if address == nil {
+			return fmt.Errorf("Invalid multisig RCD.  Missing an address")
+		}
+	}
+	return nil
+}
+
 func (w RCD_2) Clone() interfaces.IRCD {
 	c := new(RCD_2)
 	c.M = w.M
@@ -103,6 +174,10 @@ func (t *RCD_2) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
 	t.N, data = int(binary.BigEndian.Uint16(data[0:2])), data[2:]
 	t.M, data = int(binary.BigEndian.Uint16(data[0:2])), data[2:]
 
+	if len(data) < t.M*constants.ADDRESS_LENGTH {
+		return nil, fmt.Errorf("Data source too short to unmarshal %d addresses: %d", t.M, len(data))
+	}
+
 	t.N_Addresses = make([]interfaces.IAddress, t.M, t.M)
 
 	for i, _ := range t.N_Addresses {
@@ -119,6 +194,10 @@ func (t *RCD_2) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
 func (a RCD_2) MarshalBinary() ([]byte, error) {
 	var out primitives.Buffer
 
+	if len(a.N_Addresses) != a.M {
+		return nil, fmt.Errorf("Improper number of addresses.  m = %d #addresses = %d", a.M, len(a.N_Addresses))
+	}
+
 	binary.Write(&out, binary.BigEndian, uint8(2))
 	binary.Write(&out, binary.BigEndian, uint16(a.N))
 	binary.Write(&out, binary.BigEndian, uint16(a.M))
@@ -142,9 +221,9 @@ func (a RCD_2) CustomMarshalText() ([]byte, error) {
 	out.WriteString(" m: ")
 	primitives.WriteNumber16(&out, uint16(a.M))
 	out.WriteString("\n")
-	for i := 0; i < a.M; i++ {
+	for _, address := range a.N_Addresses {
 		out.WriteString("  m: ")
-		out.WriteString(hex.EncodeToString(a.N_Addresses[i].Bytes()))
+		out.WriteString(hex.EncodeToString(address.Bytes()))
 		out.WriteString("\n")
 	}
 
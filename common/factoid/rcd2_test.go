@@ -5,11 +5,13 @@
 package factoid_test
 
 import (
+	"encoding/json"
 	"math/rand"
 	"testing"
 
 	. "github.com/FactomProject/factomd/common/factoid"
 	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/testHelper"
 )
 
 func TestUnmarshalNilRCD_2(t *testing.T) {
@@ -108,3 +110,232 @@ func nextAuth2_rcd2() *RCD_2 {
 	rcd, _ := NewRCD_2(n, m, addresses)
 	return rcd.(*RCD_2)
 }
+
+// newMultisigRCD makes an n of m RCD_2 over the RCD_1 addresses of keys
+// start to start+m-1.
+func newMultisigRCD(n, m int, start uint64) *RCD_2 {
+	addresses := make([]interfaces.IAddress, m)
+	for i := 0; i < m; i++ {
+		addresses[i], _ = testHelper.NewFactoidRCDAddress(start + uint64(i)).GetAddress()
+	}
+	rcd, err := NewRCD_2(n, m, addresses)
+	if err != nil {
+		panic(err)
+	}
+	return rcd.(*RCD_2)
+}
+
+func newMultisigTransaction(rcd interfaces.IRCD) *Transaction {
+	tx := new(Transaction)
+	address, err := rcd.GetAddress()
+	if err != nil {
+		panic(err)
+	}
+	tx.AddInput(address, 1000)
+	tx.AddOutput(testHelper.NewFactoidAddress(20), 900)
+	tx.AddAuthorization(rcd)
+	return tx
+}
+
+// signMultisig signs the transaction with the keys at the given indexes of an
+// RCD_2 made by newMultisigRCD(n, m, start).
+func signMultisig(tx *Transaction, start uint64, indexes ...int) *MultisigSignatureBlock {
+	data, err := tx.MarshalBinarySig()
+	if err != nil {
+		panic(err)
+	}
+	sigblk := new(MultisigSignatureBlock)
+	for _, i := range indexes {
+		key := start + uint64(i)
+		sigblk.AddRCDSignature(i, testHelper.NewFactoidRCDAddress(key), NewSingleSignatureBlock(testHelper.NewPrivKey(key), data))
+	}
+	return sigblk
+}
+
+func TestRCD2GetAddress(t *testing.T) {
+	rcd := newMultisigRCD(2, 3, 1)
+	a1, err := rcd.GetAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, err := rcd.Clone().GetAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a1.IsSameAs(a2) == false {
+		t.Error("Clone should have the same address")
+	}
+
+	other := newMultisigRCD(3, 3, 1)
+	a3, err := other.GetAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a1.IsSameAs(a3) {
+		t.Error("Different RCDs should not have the same address")
+	}
+
+	bad := newMultisigRCD(2, 3, 1)
+	bad.N = 4
+	if _, err := bad.GetAddress(); err == nil {
+		t.Error("Expected an error for n > m")
+	}
+	bad.N = 0
+	if _, err := bad.GetAddress(); err == nil {
+		t.Error("Expected an error for n == 0")
+	}
+}
+
+func TestRCD2CheckSig(t *testing.T) {
+	rcd := newMultisigRCD(2, 3, 1)
+	tx := newMultisigTransaction(rcd)
+
+	if err := tx.Validate(1); err != nil {
+		t.Fatal(err)
+	}
+
+	tx.SetSignatureBlock(0, signMultisig(tx, 1, 0, 2))
+	if err := tx.ValidateSignatures(); err != nil {
+		t.Errorf("Expected valid signatures, got %v", err)
+	}
+
+	// Marshal and unmarshal, and make sure it is still valid
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx2 := new(Transaction)
+	if err := tx2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if tx.IsSameAs(tx2) == false {
+		t.Error("Transactions are not the same after unmarshal")
+	}
+	if err := tx2.ValidateSignatures(); err != nil {
+		t.Errorf("Expected valid signatures after unmarshal, got %v", err)
+	}
+
+	// Too few signatures
+	tx.SetSignatureBlock(0, signMultisig(tx, 1, 1))
+	if tx.ValidateSignatures() == nil {
+		t.Error("Expected 1 of 2 signatures to fail")
+	}
+
+	// The same address twice
+	tx.SetSignatureBlock(0, signMultisig(tx, 1, 1, 1))
+	if tx.ValidateSignatures() == nil {
+		t.Error("Expected a duplicated signature to fail")
+	}
+
+	// Index out of range
+	tx.SetSignatureBlock(0, signMultisig(tx, 1, 0, 3))
+	if tx.ValidateSignatures() == nil {
+		t.Error("Expected an index out of range to fail")
+	}
+
+	// Signed by a key not in the RCD
+	tx.SetSignatureBlock(0, signMultisig(tx, 2, 0, 2))
+	if tx.ValidateSignatures() == nil {
+		t.Error("Expected signatures by the wrong keys to fail")
+	}
+
+	// A single signature block is not good enough
+	tx.SetSignatureBlock(0, NewSingleSignatureBlock(testHelper.NewPrivKey(1), data))
+	if tx.ValidateSignatures() == nil {
+		t.Error("Expected a single signature block to fail")
+	}
+
+	// A bare signature can't be added to a multisig block
+	sig := NewED25519Signature(testHelper.NewPrivKey(1), data)
+	if new(MultisigSignatureBlock).AddSignature(sig) == nil {
+		t.Error("Expected adding a bare signature to a multisig block to fail")
+	}
+}
+
+func TestRCD2Nested(t *testing.T) {
+	inner := newMultisigRCD(2, 2, 10)
+	innerAddress, err := inner.GetAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outerAddress, err := testHelper.NewFactoidRCDAddress(1).GetAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcd, err := NewRCD_2(2, 2, []interfaces.IAddress{outerAddress, innerAddress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := newMultisigTransaction(rcd)
+
+	data, err := tx.MarshalBinarySig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigblk := new(MultisigSignatureBlock)
+	sigblk.AddRCDSignature(0, testHelper.NewFactoidRCDAddress(1), NewSingleSignatureBlock(testHelper.NewPrivKey(1), data))
+	sigblk.AddRCDSignature(1, inner, signMultisig(tx, 10, 0, 1))
+	tx.SetSignatureBlock(0, sigblk)
+
+	if err := tx.ValidateSignatures(); err != nil {
+		t.Errorf("Expected valid signatures, got %v", err)
+	}
+	if sigblk.NumberOfSignatures() != 3 {
+		t.Errorf("Expected 3 signatures, found %d", sigblk.NumberOfSignatures())
+	}
+	if len(sigblk.GetSignatures()) != 3 {
+		t.Errorf("Expected 3 signatures, found %d", len(sigblk.GetSignatures()))
+	}
+
+	bin, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx2 := new(Transaction)
+	if err := tx2.UnmarshalBinary(bin); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx2.ValidateSignatures(); err != nil {
+		t.Errorf("Expected valid signatures after unmarshal, got %v", err)
+	}
+}
+
+func TestRCD2Fee(t *testing.T) {
+	rcd := newMultisigRCD(3, 4, 1)
+	tx := newMultisigTransaction(rcd)
+	tx.SetSignatureBlock(0, signMultisig(tx, 1, 0, 1, 3))
+
+	single := new(Transaction)
+	single.AddInput(testHelper.NewFactoidAddress(1), 1000)
+	single.AddOutput(testHelper.NewFactoidAddress(20), 900)
+	single.AddAuthorization(testHelper.NewFactoidRCDAddress(1))
+
+	fee, err := tx.CalculateFee(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	singleFee, err := single.CalculateFee(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both transactions are under 1K, so the only difference is the two
+	// extra signatures.
+	if fee != singleFee+2000 {
+		t.Errorf("Expected a fee of %d, got %d", singleFee+2000, fee)
+	}
+}
+
+func TestRCD2JSONMarshal(t *testing.T) {
+	rcd := newMultisigRCD(2, 3, 1)
+	js, err := json.Marshal(rcd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var str string
+	if err := json.Unmarshal(js, &str); err != nil {
+		t.Fatal(err)
+	}
+	if str[:2] != "02" {
+		t.Errorf("Expected the RCD type to lead the JSON, got %s", str)
+	}
+}
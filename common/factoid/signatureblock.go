@@ -64,12 +64,13 @@ func (b SignatureBlock) String() string {
 	return string(txt)
 }
 
-func (s *SignatureBlock) AddSignature(sig interfaces.ISignature) {
+func (s *SignatureBlock) AddSignature(sig interfaces.ISignature) error {
 	if len(s.Signatures) > 0 {
 		s.Signatures[0] = sig
 	} else {
 		s.Signatures = append(s.Signatures, sig)
 	}
+	return nil
 }
 
 func (s SignatureBlock) GetSignature(index int) interfaces.ISignature {
@@ -215,8 +215,16 @@ func (t Transaction) CalculateFee(factoshisPerEC uint64) (uint64, error) {
 
 	fee += factoshisPerEC * 10 * uint64(len(t.Outputs)+len(t.OutECs))
 
-	for _, rcd := range t.RCDs {
-		fee += factoshisPerEC * uint64(rcd.NumberOfSignatures())
+	for i, rcd := range t.RCDs {
+		sigs := rcd.NumberOfSignatures()
+		// A multisig pays for every signature it actually carries, including
+		// those of nested RCDs, which only the signature block can tell us.
+		if i < len(t.SigBlocks) {
+			if msb, ok := t.SigBlocks[i].(*MultisigSignatureBlock); ok && msb.NumberOfSignatures() > sigs {
+				sigs = msb.NumberOfSignatures()
+			}
+		}
+		fee += factoshisPerEC * uint64(sigs)
 	}
 
 	return fee, nil
@@ -391,11 +399,20 @@ func (t *Transaction) GetSignatureBlocks() []interfaces.ISignatureBlock {
 		return t.SigBlocks
 	}
 	for i := len(t.SigBlocks); i < len(t.Inputs); i++ { // If too short, then
-		t.SigBlocks = append(t.SigBlocks, new(SignatureBlock)) // pad it with
+		t.SigBlocks = append(t.SigBlocks, t.newSignatureBlock(i)) // pad it with
 	} // signature blocks.
 	return t.SigBlocks
 }
 
+// newSignatureBlock returns an empty signature block of the kind the i'th
+// RCD expects.
+func (t *Transaction) newSignatureBlock(i int) interfaces.ISignatureBlock {
+	if i < len(t.RCDs) && t.RCDs[i] != nil {
+		return CreateSignatureBlock(t.RCDs[i])
+	}
+	return new(SignatureBlock)
+}
+
 func (t *Transaction) GetInput(i int) (interfaces.ITransAddress, error) {
 	if i > len(t.Inputs) {
 		return nil, fmt.Errorf("Index out of Range")
@@ -502,7 +519,7 @@ func (t *Transaction) UnmarshalBinaryData(data []byte) ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		t.SigBlocks[i] = new(SignatureBlock)
+		t.SigBlocks[i] = CreateSignatureBlock(t.RCDs[i])
 		err = buf.PopBinaryMarshallable(t.SigBlocks[i])
 		if err != nil {
 			return nil, err
@@ -597,7 +614,7 @@ func (t Transaction) MarshalBinary() ([]byte, error) {
 		// we don't want to restrict what might be required to
 		// sign an input.
 		if len(t.SigBlocks) <= i {
-			t.SigBlocks = append(t.SigBlocks, new(SignatureBlock))
+			t.SigBlocks = append(t.SigBlocks, t.newSignatureBlock(i))
 		}
 		err = buf.PushBinaryMarshallable(t.SigBlocks[i])
 		if err != nil {
@@ -687,7 +704,7 @@ func (t *Transaction) CustomMarshalText() (text []byte, err error) {
 		out.Write(text)
 
 		for len(t.SigBlocks) <= i {
-			t.SigBlocks = append(t.SigBlocks, new(SignatureBlock))
+			t.SigBlocks = append(t.SigBlocks, t.newSignatureBlock(len(t.SigBlocks)))
 		}
 		text, err := t.SigBlocks[i].CustomMarshalText()
 		if err != nil {
@@ -12,6 +12,7 @@ type IDatabase interface {
 	Get(bucket, key []byte, destination BinaryMarshallable) (BinaryMarshallable, error)
 	Delete(bucket, key []byte) error
 	ListAllKeys(bucket []byte) ([][]byte, error)
+	ListKeysWithPrefix(bucket, prefix []byte) ([][]byte, error)
 	GetAll(bucket []byte, sample BinaryMarshallableAndCopyable) ([]BinaryMarshallableAndCopyable, [][]byte, error)
 	Clear(bucket []byte) error
 	PutInBatch(records []Record) error
@@ -20,6 +21,16 @@ type IDatabase interface {
 	DoesKeyExist(bucket, key []byte) (bool, error)
 }
 
+// IIterableDatabase is a database that can walk the keys of a bucket in order
+// without reading them all into memory first
+type IIterableDatabase interface {
+	// IterateKeysWithPrefix calls f with each key of the bucket that starts
+	// with prefix, in order, until f returns false.  Keys before start are
+	// skipped.  The key is only valid until f returns, and f must not write to
+	// the database.
+	IterateKeysWithPrefix(bucket, prefix, start []byte, f func(key []byte) bool) error
+}
+
 type Record struct {
 	Bucket []byte
 	Key    []byte
@@ -21,6 +21,7 @@ type DBOverlaySimple interface {
 	FetchDBlock(IHash) (IDirectoryBlock, error)
 	FetchDBlockByHeight(uint32) (IDirectoryBlock, error)
 	FetchDBlockHead() (IDirectoryBlock, error)
+	FetchDBlockHeightRange(startHeight, endHeight int64) ([]IHash, error)
 	FetchEBlock(IHash) (IEntryBlock, error)
 	FetchEBlockHead(chainID IHash) (IEntryBlock, error)
 	FetchECBlock(IHash) (IEntryCreditBlock, error)
@@ -43,7 +44,15 @@ type DBOverlaySimple interface {
 	ProcessECBlockMultiBatch(IEntryCreditBlock, bool) (err error)
 	ProcessFBlockMultiBatch(DatabaseBlockWithEntries) error
 	FetchDirBlockInfoByKeyMR(hash IHash) (IDirBlockInfo, error)
+	FetchAnchorEntryByKeyMR(keyMR IHash) (IEBEntry, error)
 	SetExportData(path string)
+	SetAddressIndex()
+	BackfillAddressIndex() error
+	SetExtIDIndex()
+	BackfillExtIDIndex() error
+	BackfillAnchorEntryIndex() error
+	SaveBalanceCheckpoint(dbheight uint32, factoidBalances, ecBalances map[[32]byte]int64) error
+	BackfillBalanceCheckpoints() error
 	StartMultiBatch()
 	Trim()
 	FetchAllEntriesByChainID(chainID IHash) ([]IEBEntry, error)
@@ -56,6 +65,13 @@ type DBOverlay interface {
 
 	FetchHeadIndexByChainID(chainID IHash) (IHash, error)
 	SetExportData(path string)
+	SetAddressIndex()
+	BackfillAddressIndex() error
+	SetExtIDIndex()
+	BackfillExtIDIndex() error
+	BackfillAnchorEntryIndex() error
+	SaveBalanceCheckpoint(dbheight uint32, factoidBalances, ecBalances map[[32]byte]int64) error
+	BackfillBalanceCheckpoints() error
 
 	StartMultiBatch()
 	PutInMultiBatch(records []Record)
@@ -250,6 +266,10 @@ type DBOverlay interface {
 	FetchIncludedIn(hash IHash) (IHash, error)
 	RebuildDirBlockInfo() error
 
+	// FetchAnchorEntryByKeyMR gets the anchor chain entry that anchors a directory block.
+	// It is an error to ask before the index of anchor entries has been built.
+	FetchAnchorEntryByKeyMR(keyMR IHash) (IEBEntry, error)
+
 	FetchPaidFor(hash IHash) (IHash, error)
 
 	FetchFactoidTransaction(hash IHash) (ITransaction, error)
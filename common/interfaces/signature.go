@@ -62,7 +62,7 @@ type ISignatureBlock interface {
 	BinaryMarshallable
 	Printable
 
-	AddSignature(sig ISignature)
+	AddSignature(sig ISignature) error
 	CustomMarshalText() ([]byte, error)
 	GetSignature(int) ISignature
 	GetSignatures() []ISignature
@@ -48,7 +48,7 @@ function searchBarSubmit() {
       if (obj.Type == "dblockHeight") {
         window.location = "search?input=" + obj.item + "&type=dblock"
       } else if (obj.Type != "None") {
-        window.location = "search?input=" + $("#factom-search").val() + "&type=" + obj.Type
+        window.location = "search?input=" + encodeURIComponent($("#factom-search").val()) + "&type=" + obj.Type
        //redirect("search?input=" + $("#factom-search").val() + "&type=" + obj.Type, "post", x.response) // Something found
       } else {
         $(".factom-search-error").slideDown(300)
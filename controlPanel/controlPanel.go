@@ -809,18 +809,15 @@ func checkAuthHeader(r *http.Request) bool {
 		return true
 	}
 
-	authhdr := r.Header["Authorization"]
-	if len(authhdr) == 0 {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
 		return false
 	}
 
-	correctAuth := StatePointer.GetRpcAuthHash()
+	correctAuth := sha256.Sum256([]byte(StatePointer.GetRpcUser() + ":" + StatePointer.GetRpcPass()))
+	presentedAuth := sha256.Sum256([]byte(user + ":" + pass))
 
-	h := sha256.New()
-	h.Write([]byte(authhdr[0]))
-	presentedPassHash := h.Sum(nil)
-
-	cmp := subtle.ConstantTimeCompare(presentedPassHash, correctAuth) //compare hashes because ConstantTimeCompare takes a constant time based on the slice size.  hashing gives a constant slice size.
+	cmp := subtle.ConstantTimeCompare(presentedAuth[:], correctAuth[:]) //compare hashes because ConstantTimeCompare takes a constant time based on the slice size.  hashing gives a constant slice size.
 	if cmp != 1 {
 		return false
 	}
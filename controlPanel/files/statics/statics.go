@@ -150,11 +150,11 @@ var staticFiles = map[string]*staticFilesFile{
 		size:  19022,
 	},
 	"js/factomd-ajax.js": {
-		data:  "\x1f\x8b\b\x00\x00\tn\x88\x02\xff\xdcW]o\xdb6\x14}\u05ef\xb8劅Be)[\xf6\xd4T\r\xd0u[1t\xe9Vw\xc0^i\xe9:b,\x93\nI\xc56V\xff\xf7\x81\x1f\xb2$\xc7N\xe3\x15\xd8\xc3\x1e\x02$\xe2\xe1\xb9_\xe7\x1e)\xf3V\x14\x86K\x01w-\xaa\xcd\xd40\x83\x94\x1b\\&p\xcf\xea\x16\x13\xb0\x80\x18\xfe\x8e\x00\xee\x99\x02\x85w\x90\x83\xc0\x15\xfc\xf5\xdb\xfbw\xc64\x1f\xf1\xaeEmh\x1cE`OS)\x14\xb2r\xa3-SQ1q\x83\x90C\x17\x85z&\x00>\xa7\x16\xec\xa0.(\xe49\xfcН\x02dY!\x85\x965\xa6\xb5\xbcq\t\xc1\v 0\x01\x02/\xc0\xdfԍ\x14\x1a\xe3p\xc1F\xa0\x0f\x0f\xb6\x91\xffq\x995((\xf9\xe5\xa7O$\x01\x92fsV\x18\xb9,\xaf,yni\xbb(ߺ\xcaݣ\xd0\x03\xa3Z\xc7gY4\x8a\x92\xc6\xd16\x8av\xad\x9b1ST\u007f\xec\xf7\xef\xff\u07b87\xb6\xea+W\xfb\xae}\xc7Z\xf5\x9c\x92o\xfc\xb5\x89F\xa6\x8a\x8a\xc4iQ\xf3bA\xf7\n|NI:\x02NP)\xa9H\x9cꚗ\xf8gC\xe1\xe2\xfc\x1c\xe2h\x1b\x1f`\x9d\xe8v\xb6\xe4\xe6\x18\xb9\a\xbdaj\xea`Ա<\x8cXHa\x18\x17h\xa3.p\xd3(Ժ\xa7\xc2~\xa6\v\xdc@\x0e\x98\xae*^T\xf0\xf93\xa0\xc5\xff(K\xbc\x8c준>\xa3\x0e\x93\xc3w\x17q7#\x85\xa6U\"\xb4\xf7`J\xbd\xb2\x1e\x1c\xefb\xaf\x8f\xa9\t`\xfdt)\xad\x8f\vi(\xa3\xf5\x03\xd5\xc8\xd9-\xe4\xf0\xeb\xf4\xc3u\xda0\xa5\xf1\x00\xc4\xd6/g\xb7\xe9\xa7M\xe3\xb8I9\xabe\xb1x\x87\xfc\xa62\xa4\x0f\x04\xb0⢔\xab\xb4\x96\x05sU\xe7@|\xe1W\\4\xadq\xea\xb2L\xbb\x055\x9b\x06sOG\x02\xcb\x16\xb0\xd68\x0e\xfa,\ar-\x05\x9e\x1c\xec\x90\\\xefYM\xe3>z\x97\x93\r\xd4qg\x99\u0092+,\f\xfdj\xce\x04H#\xb5!\t\f:\vY\x06S\xb9DSqq\x03sيr\\~_\xe6\x17\x16\xe9\xad\\\tzq~\x1e\xef.<>\xef\xed\xc8\x14\xac\x00\xe7R-\xdf2Â\x0e\u007f\x0e\u007f\xd2\xd8j\xbf;LY\xd3X\x13 6gYZ\xff\xe8\x8a?\x84\ng\xc9\xf1f9\xb7\\\aG\xfa\xfd\xc34X\x92k\x95\u05fe3\x9d\x8e\xb93\x9f\x99,7$N\xa5\xa0gK\xd9jl\x9b\xb3\x84h\xf4K\xb6\xe7!5\x17\v\x92\xec\xef\xbbq*\x86[g\xf3\xd4T\\\xc7)3FQbO\\\xec\x8a\xe9j\x1fbp\xed\x97\xf2?\xd9\xd9S\xb7\xf2\xe0\x82\xf09\xed,\xcd\x1aWܟ<my\\\x1bF\x9a6\x83\x1d\xe9\x17u\x18\xe5\xfba\x02\xbb0~\xca\xd9\x13#8\xe1\r\xd5\xfaŕ<\xcc\xf3\xef6\x8f\xcf\xc7f\xa7\x1b,8\xab'\xcc\xcdo2głħ\xb9У\x8d\xfc\xfa\x85\x1f\u007f)\x9c\xb2\xf2\xef\xb9X<\xba\xf6\x16\xf0\xb4\xd5\x1f!w\xebo+?\x8aZ\b\xb9\x12$\xf13?\xcd\x0e,\x8f\u007f\xc3f\x19|\f\u0080\x157\x15\xd8+\xd6\x03\r\nӿ\u007fw\xe2iU\x9d\x80\xaf$\xe9`\xfd\xcb\xd8\xcd\fr;\x83W\xee\xf7\xd7d\xe4\x0e\t\x90\x8a\x97%\x8a`c\x1dA\xc0\b\xb6t\x98\xf0\x98\f\xfd\xe29={e\xd3\u007f}\x96\xec\x86\xed\xf3x\xd9\xe5\x13\x9ez\xa5\xbd\x84V\xd5vf\xbe\xfc\xd04\x97ThH\xf8\x92\xb8\x8c\xb6\x97\xd1\xe0SC\xe0\xda\\\xcb\x12\x83\xd5X5@>\xfc\xaf\x80t\b\x92\x90\x81?Z`\x10\xb6u\xed\xa2U\n\x85\x99\bY\xe2D\xb4˙\xfb\x8cr6\xe8\x90>\xb5m\xf4O\x00\x00\x00\xff\xff\xe0\xe4EHx\f\x00\x00",
-		hash:  "234eb2a1d1707c7445dd034c84421b37eb90e6d0f91eb6579a5fd8331a021c02",
+		data:  "\x1f\x8b\b\x00\x00\tn\x88\x02\xff\xdcW]o\xdb6\x14}ׯ\xb8劅De)[\xf6\xd4T\r\xd0v[7t\xe9\x16\xb7\xc0^i\xe9:b,\x93\nI\xc56V\xff\xf7\x81\x14e\xf9CN\xe3\r\xd8\xc3\x1e\x02$\xe2\xe1\xfd<\xe7H\x9962\xb7BI\xb8oP\xafƖ[\xa4\xc2\xe2<\x86\a^5\x18\x83\x030\xf8+\x02x\xe0\x1a4\xdeC\x06\x12\x17\xf0\xe7o\x1f\xde[[\xdf\xe0}\x83\xc6R\x16E\xe0N\x13%5\xf2be\\\xa4\xbc\xe4\xf2\x16!\x83.\vm#\x01\x88)u`\x0f\xf5I!\xcb\xe0\x87\xee\x14 Ms%\x8d\xaa0\xa9ԭ/\b^\x00\x81\x11\x10x\x01\xedMS+i\x90\x85\v.\x03=<XG폯\xacFI\xc9\xcf?~\"1\x90$\x9d\xf2ܪyq\xe5\x82g.l\x97\xe5[߹\x7f\x14f`u\x83,D1(\vʢu\x14mF7\xe16/\xff؟\xdf\xff}po\\\xd7W\xbe\xf7\xcd\xf8\x8e\x8d\xea9%ߴ\xd7F\x06\xb9\xceK\u0092\xbc\x12\xf9\x8c\xee5\xf8\x9c\x92d\a8B\xad\x95&,1\x95(\xf0sM\xe1\xe2\xfc\x1cX\xb4f\x03QG\xa6\x99̅=\x16\xbc\x05\xbd\xe1z\xeca\xd4G9̘+i\xb9\x90\xe8\xb2\xcepUk4\xa6\x0f\x85\xfdNg\xb8\x82\f0Y\x94\"/\xe1\xcb\x17@\x87\x7f\xab\n\xbc\x8cܦ\x80>\xa3\x1e\x93\xc1w\x17\xacۑF\xdbh\x19\xc6;XRϬ\x83\xe3M\xee\xe516\x01,\x9fN\xa5\xe5q\"m\xd3hy\xc0\x1a5\xb9\x83\f~\x1d\x7f\xbcNj\xae\r\x0e@\\\xffjr\x97|Z\xd5>6)&\x95\xcag\xefQܖ\x96\xf4\x89\x00\x16B\x16j\x91T*\xe7\xbe\xeb\fH\xdb\xf8\x95\x90uc=\xbb\\\xa4\x8d@\xed\xaaƬ\rGB\x945`ep7\xe9\xb3\fȵ\x92xr2\x94\xb9*\xf0\xf3\xcd/oռV\x12\xa5\xa5C\f~\xe0\x15e\xac\xaf\xa8\xab\xd3%\xef\xf2\xa5\xa9\xc6Bh\xcc-=\xccs4\xe8p\xcc\x18H\xad\x8c%1lM\x1b\xd2\x14\xc6j\x8e\xb6\x14\xf2\x16\xa6\xaa\x91\xc5\xeeH\xfaֿ\"\xaewj!\xe9\xc5\xf99\xdb\\x\x9c\x03\xeb\x1d\xa3p\xa4\x9c*=\x7f\xc7-\x0f\xdc\xfc)\xfcI\x99\xd3Cw\x98\xf0\xbav\xc6@\\ͪp\x9e\xd25?\x84\ng\xf1\xf1ay\a]\x06\x97\xfa\xfd\xe38ؔ\x1fU\xab\aoD]\xe4ΐ&\xaaX\x11\x96(I\xcf\xe6\xaa1\xd8\xd4g11\xd8\no\xcfW*!g$\xde\xf7\x00\xeb\x99\rw\xde\xfa\xa9-\x85a\t\xb7VS\xe2N|\ue49br\x1fbq\xd9\n\xf5?\xd1\xf1\xa9J\x1d\x14\x8d\x98\xd2\xce朙\xb1\xfe\xe4i\x82\xf2c\xd8\xe1\xb4\xdd\xd2H/\xde\xed,\xdf3\x18H\xd3n9}b\x06O\xbcm\xb6~U\x92\xc3q\xfe\x99\xf2\xc4t\xd7\x00M\x8d\xb9\xe0Ո\xfb\xfd\x8d\xa6<\x9f\x11v\x9a3=:\xc8\x7f/\xf8ݯ\x87S$\xffA\xc8٣\xb2w\x80\xa7I\x7f\a\xb9\x91\xbf\xeb\xfc(j&\xd5B\x92\xb8\xdd\xf9iv\xe0\xe2\xb4o\xdd4\x85\x9b@\fX\b[\x82\xbb\x02\xb9\x92\x16\xa5\xed\xdf\xc9\x1b\xf24\xba\x8a\xa1\xed$\xee`\xfd\v\xda\xef\f2\xb7\x83W\xfe\xf7\xd7d\xc7\x1db \xa5(\n\x94\xc1ƺ\x00\x01#\xf9\xdcc\xc2c\xb2\xed\x17\xcf\xe9\xd9+W\xfe\xeb\xb3x\xb3춎\x97]=\xe1i˴\x97\xd0\xe8\xca\xed\xacm?\f\xcd\x17\x15\x06\x12\xbe..\xa3\xf5e\xb4\xf5\xf9!qi\xafU\x81\xc1j\x1c\x1b \xdb\xfeO\x81t\b\x12\x93-\x7ft\xc0@l\xe7\xday\xa35J;\x92\xaa\xc0\x91l\xe6\x13\xffi\xe5m\xd0#\xdb\xd2\xd6\xd1\xdf\x03\x00\xb46A%\x8c\f\x00\x00",
+		hash:  "cdb4943f3f7b83f6546d212b92b361b1f067f3b4d7e2a843829e01606cd0facb",
 		mime:  "application/javascript",
-		mtime: time.Unix(1483995492, 0),
-		size:  3192,
+		mtime: time.Unix(1792286086, 0),
+		size:  3212,
 	},
 	"js/searches/tools.js": {
 		data:  "\x1f\x8b\b\x00\x00\tn\x88\x02\xff\xb4S\xcbn\xdb0\x10<[_\xb1\x90\x03\x84\x84b\xd9\xce!\x87:2\x10\xa4(\xdcSQ\xb4?\xa0\x88+k[\x9b\f\x96\xebDF\xe1\u007f/\xa8\x87\x1d'qR\xa0\b\x0f\x82D\xcd\xcc\xce,\xb9g*\x1e\xa2\x15ގ\xb0\x16d\x9b\xafFd`\x0eC\xb4\x853d\x97\xb1N\x8b\x15\x15\xbfU\xb9\xb1\x85\x90\xb3Jß\b\xa0\xff\x0f\x19\xfc\xfa\xbeA\xde*\xa9\xc8\xebT\xb0\x16\xa5#\x00*U\x8fI\xc9\x1a\xac\xbf\x95*^`\x1dk\x98\xc3h\xaa\x83\xc8\xe0\x88Z\x925*\xce\xe3N$\xbe\xf1\x05\xd1'\x88\x83\xda\xc0\vC\x06\x85\xb3\x0f\xc8\xf2\x85\xddz\x81\xb5:\xa2\xdf\xe7\x8cVT\xaf34\xb9쵴\x8e\x06\xff\f\xf6¡\xe4\x0ep\xe5\x11\xa8\x84W\x824\xde\x0eQ\xde\x0e\xb2\xc0\x1a\x9a\x1c\xc7)~\xba\x8f\xcf\x10\xedt\x14\xf5G\xf7\xbc}\x15\xd6\xeda\x02<\xe4\f\x15\u0590\x85g*\xee\x870٥ҳ\xf1\xb8t\\`G\xf5\xe4\xec\x1e߆9?\x9f5;\xa5cPa\x9b \x83\xc9\f\b\xae\x1b\xad\x15ڥT\xe1;\xc9\xe0R7ذ\x02;ɠ-\x94\x96\xecַUηΠ\xba\xcf\xd9\xe3W+\xc1`\xea7w^X\xd1\x05\\\xea\v\x98^i\xdd\xd6c\x94\r\xdb 3\x8bv/3\xb6\xcd\rmx\x91\xf0\x89\xe3\xd6p6\x99ѵ\x17\xee\xbdR\x92\xf4\xac\xb0\x02+\t\xb4$`\x8a\xce\xe5\x8d(҇NM\xaf:_\xbb\xa7\xee*\xac\x1bwg*\x96n\xac¬\x15\xce\nZ\x19\xf9\xcdz\x9d\xf3\x16搟\x9a31\xcf'l\u007f\xec\xfdK\x83\xea/\xc1\xab\x05b\x9dVd\xf0M\xe8\x9d3\x01\xe7+\xf7\xa8\xf4x\xecWd\xf0\xb3{\xb4j:\x99\xe8\xe6\x1a\x9d\b\x11\x88\xff\x9f\xe0]c\xef\x068d=\x99\xe1o\x00\x00\x00\xff\xff+jE\xfe\xee\x04\x00\x00",
@@ -163,6 +163,13 @@ var staticFiles = map[string]*staticFilesFile{
 		mtime: time.Unix(1479232354, 0),
 		size:  1149,
 	},
+	"searchresults/type/extid.html": {
+		data:  "\x1f\x8b\b\x00\x00\tn\x88\x02\xff\x94S\xc1\x8e\xdb \x10=;_1E=\xb4\xaa\x1ck\xafфC\x9bH͡R\xa5~\x01k\xc6kT\x02\x11\xccn\x13!\xfe\xbd\x02;]\xa7\xd1\x1e6\xa7a&\xbc\xf7Ƽ\x97\x92\xa6\xc18\x02Ag6Z\xe4\xbcjRb:\x9e\xacb\x021\x92\xd2\x14j\x1b?\xb4-|\xf5\xfa\x02m+W\rF\xea\xd9x\aFo\x05\x9dO\xd6\a\nB\xae\x9a\x06\xb5y\x81ު\x18\xb7\"\xf8?\xb5w\xd3\xec\xbd}>\xba8\r\x1a\x1c\x1f\xe4\xfė\x1d\xfc\"\x15\xfa\x110\x1e\x95\xb5\xf2g\xa0\xc1\x9c7\x9fRZOeΟ\xb1\x9bf\x18O\xcaA䋥\xad\x18\xacW\xbc\t\xe6id!!%K\x0e\xd6{\xc7\xc1P\xcc9%3\xc0\xfa\x87\x0f\x94\xf3\x97\x94\xc8\xe9\x9ca\x9ebWp$v\xe3ä%\xa5\xa0\xdc\x13\xc1G\xb2\x04\x9b\xed\x02f\x92\xca\xea\xd1R\xdd8V\xadmm̋4ȏ^_\xe6C\x83\x1c\xaee\x83\xace\x81\xba\xc0w\x15\xc7\rv\xacof\xa8*\xe8\xa0z\xf6\xc7vƶ\xc6\xfd\x16\xc0\x97\x13m\x05\x95\xcbB\xa6T\x94\xad\vH\xce\xd8)\xb9D\u008e\xc3[\xe4\xdfFe\x1c\x1cv\xefg\xee\xcb\xcdb\x83\x7f\xec\x15\xeb\xb0{\x9f\x80\xfd\x99)8eᰋ\xf7\xfb_\xeb\x06\x9f\xed\xeb\x01\x00 %\x98\x9f\xe4\xb0+/R\x15T\xbbD\xc8\xf9\xe6\xaf\xe5\x87\xd6L\x86,߫\xa5\x99\xb45\x93\xfaI\xb45\x12\xfe\xe7 \xa7\x97p\xd8-t\xbc\xb1\"v\x8b\xe7Ʈ:\xe1\xea\xa2\xea\xb2U\xedk\xf3\"W\xaf\x05vsn䜨\xbdӋT-\xb3\x17\xfb`N\x1c\xef2\xc9\xde\xdb\xfb\xee\xe0=OI\xbd\xd2\xff\x1d\x00\n\xc5\xed\xe6\xdc\x03\x00\x00",
+		hash:  "613e7bc214e59bbad7bb071ceec525bdde429e4e1592856a20385a0918b1a88e",
+		mime:  "text/html; charset=utf-8",
+		mtime: time.Unix(1792286086, 0),
+		size:  988,
+	},
 	"searchresults/type/factoidack.html": {
 		data:  "\x1f\x8b\b\x00\x00\tn\x88\x02\xff\x9c\x92Mn\xc20\x10\x85\xd7\xce)\\\xef\x83Ŷ\x1a\xbc\xa8h%\xd6\xe5\x02&\x1e\x14\vcG\xf6@AV\xee^\xe5\xa7j\x10)\xad\x9aU4Oy\xf9<\xfer6\xb8\xb7\x1e\xb9\xd8늂5\xba:\x88\xb6-X΄\xc7\xc6iB.j\xd4\x06c?\x86\xa7\xb2\xe4/\xc1\\yY\xaa\x82A\u008al\xf0ܚ\x95\xc0K\xe3B\xc4(T\xc1\x18\x18{\xe6\x95\xd3)\xadD\f\x1f\xfd\xecfX\x05w:\xfa4\x04\f\xea\xa5z\x1b\b\xf86j\x9f\xf4\xd0\xfbN\x9aN\td\xbdT\x05\x9fy\x80\xf4\xce\xe1|ƀv\xc1\\\u007f\b\x19P\xbc\x8fz\x162jʰY?\x83$3\xdfs\vc\x14\xe8~\x17\xfd6\x8feB\x1d\xab\xbat\xd6\x1f\x04\xa7k\x83CB\xdf\xedB\xe5\xbc\xd8^6\xeb\xb6\x05\xa9\xd5\xef?\x029\xc7}\x8b\xf1\xe0`_\v\xfd\xebyr^\f\x9ft|\xffgc \x1f\\\x06\xc8\xf1\x1a;Hi\xec\xb97h|\x019J\xa6F\xfd^\xbd\x99(8\x155U\xd16\x94:S\xbb\xdaiD!\xb8tg\xf6>\x04\x1a\xcc\xce\x19\xbdi\xdb\xcf\x00\x00\x00\xff\xff}\xcag\xb0\x10\x03\x00\x00",
 		hash:  "d3778c57993f99c57a010e02aaf2088588c9f9e59abce76a0219877b96a1faf4",
@@ -3,9 +3,12 @@ package controlPanel
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/FactomProject/btcutil/base58"
+	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/database/databaseOverlay"
 	"github.com/FactomProject/factomd/state"
 	//"github.com/FactomProject/factomd/wsapi"
 )
@@ -29,7 +32,42 @@ func newSearchResponse(ftype string, found foundItemInterface) string {
 	return searchJson
 }
 
+// Searches starting with this look for entries by ExtID prefix, using the
+// ExtID index.  The rest of the search is the prefix, as text.
+const ExtIDSearchPrefix = "extid:"
+
+type extIDSearcher interface {
+	SearchEntriesByExtID(prefix []byte, chainID interfaces.IHash, cursor []byte, limit uint32) ([]*databaseOverlay.ExtIDMatch, []byte, error)
+}
+
+// searchExtID returns up to limit entries with an ExtID starting with the text
+// after the ExtID search prefix, and whether there may be more.
+func searchExtID(searchitem string, limit uint32, st *state.State) ([]*databaseOverlay.ExtIDMatch, bool, error) {
+	prefix := strings.TrimPrefix(searchitem, ExtIDSearchPrefix)
+	if len(prefix) < databaseOverlay.MinExtIDSearchPrefix {
+		return nil, false, fmt.Errorf("The ExtID to search for is too short")
+	}
+
+	dbase := st.GetAndLockDB()
+	defer st.UnlockDB()
+
+	searcher, ok := dbase.(extIDSearcher)
+	if !ok {
+		return nil, false, fmt.Errorf("Database can't search by ExtID")
+	}
+	matches, next, err := searcher.SearchEntriesByExtID([]byte(prefix), nil, nil, limit)
+	return matches, next != nil, err
+}
+
 func searchDB(searchitem string, st state.State) (bool, string) {
+	if strings.HasPrefix(searchitem, ExtIDSearchPrefix) {
+		// Only look for one; the results page lists them
+		matches, _, err := searchExtID(searchitem, 1, &st)
+		if err != nil || len(matches) == 0 {
+			return false, ""
+		}
+		return true, `{"Type":"extid","item":"` + matches[0].EntryHash.String() + `"}`
+	}
 	if len(searchitem) < 32 {
 		heightInt, err := strconv.Atoi(searchitem)
 		if err != nil {
@@ -8,6 +8,7 @@ import (
 	htemp "html/template"
 	"net/http"
 	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/FactomProject/btcutil/base58"
@@ -183,6 +184,15 @@ func HandleSearchResult(content *SearchedStruct, w http.ResponseWriter) {
 		err = templates.ExecuteTemplate(w, content.Type, transaction)
 		TemplateMutex.Unlock()
 		return
+	case "extid":
+		results := getExtIDResults(content.Input)
+		if results == nil {
+			break
+		}
+		TemplateMutex.Lock()
+		err = templates.ExecuteTemplate(w, content.Type, results)
+		TemplateMutex.Unlock()
+		return
 	case "EC":
 		hash := base58.Decode(content.Input)
 		if len(hash) < 34 {
@@ -704,6 +714,33 @@ type EntryHolder struct {
 	Time string
 }
 
+// Most entries shown for an ExtID search
+const MaxExtIDResults = 100
+
+type ExtIDResults struct {
+	Prefix  string
+	More    bool // More entries match than are shown
+	Entries []*EntryHolder
+}
+
+func getExtIDResults(searchitem string) *ExtIDResults {
+	matches, more, err := searchExtID(searchitem, MaxExtIDResults, StatePointer)
+	if err != nil || len(matches) == 0 {
+		return nil
+	}
+
+	results := new(ExtIDResults)
+	results.Prefix = htemp.HTMLEscaper(strings.TrimPrefix(searchitem, ExtIDSearchPrefix))
+	results.More = more
+	for _, m := range matches {
+		entry := getEntry(m.EntryHash.String())
+		if entry != nil {
+			results.Entries = append(results.Entries, entry)
+		}
+	}
+	return results
+}
+
 func getEntry(hash string) *EntryHolder {
 	entryHash, err := primitives.HexToHash(hash)
 	if err != nil {
@@ -5,11 +5,13 @@
 package boltdb
 
 import (
+	"bytes"
 	"fmt"
 	"sync"
 
 	"github.com/FactomProject/bolt"
 	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/database"
 )
 
 // This database stores and retrieves interfaces.IBlock instances.  To do that, it
@@ -34,6 +36,16 @@ type BoltDB struct {
 }
 
 var _ interfaces.IDatabase = (*BoltDB)(nil)
+var _ interfaces.IIterableDatabase = (*BoltDB)(nil)
+
+func init() {
+	database.RegisterEngine("Bolt", database.Engine{
+		FileName: "FactomBolt.db",
+		Open: func(path string) (interfaces.IDatabase, error) {
+			return NewBoltDB(nil, path), nil
+		},
+	})
+}
 
 func NewBoltDB(bucketList [][]byte, filename string) *BoltDB {
 	db := new(BoltDB)
@@ -204,6 +216,55 @@ func (db *BoltDB) ListAllKeys(bucket []byte) (keys [][]byte, err error) {
 	return
 }
 
+// ListKeysWithPrefix returns the keys of the bucket that start with prefix, in
+// order, seeking to the first rather than reading the whole bucket.
+func (db *BoltDB) ListKeysWithPrefix(bucket, prefix []byte) ([][]byte, error) {
+	db.Sem.RLock()
+	defer db.Sem.RUnlock()
+
+	keys := [][]byte{}
+	err := db.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// IterateKeysWithPrefix calls f with the keys of the bucket that start with
+// prefix, from start on, in order, until f returns false
+func (db *BoltDB) IterateKeysWithPrefix(bucket, prefix, start []byte, f func(key []byte) bool) error {
+	db.Sem.RLock()
+	defer db.Sem.RUnlock()
+
+	return db.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		from := prefix
+		if bytes.Compare(start, prefix) > 0 {
+			from = start
+		}
+		c := b.Cursor()
+		for k, _ := c.Seek(from); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			if f(k) == false {
+				break
+			}
+		}
+		return nil
+	})
+}
+
 func (db *BoltDB) GetAll(bucket []byte, sample interfaces.BinaryMarshallableAndCopyable) ([]interfaces.BinaryMarshallableAndCopyable, [][]byte, error) {
 	db.Sem.Lock()
 	defer db.Sem.Unlock()
@@ -0,0 +1,441 @@
+package databaseOverlay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/FactomProject/factomd/common/entryCreditBlock"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// The address index keeps, for every FCT and EC address, the list of the
+// transactions that touched it.  For FCT addresses that is any factoid
+// transaction with the address as an input or output.  For EC addresses it is
+// the factoid transactions buying EC for it, and the chain and entry commits
+// it paid for.
+//
+// The transactions of an address are stored under address + sequence number,
+// so a page of them can be read without loading the rest.  The count of
+// transactions per address gives the next sequence number.  For each of the
+// FBlock and ECBlock buckets, the next height to index is kept so the index
+// can be backfilled over an existing database, and catch up if it misses
+// blocks.  While a backfill runs, saving a block leaves the catching up to it.
+
+// Blocks indexed per batch when backfilling
+const addressIndexBackfillBatch = 1000
+
+type AddressTransaction struct {
+	TxID     interfaces.IHash
+	DBHeight uint32
+}
+
+var _ interfaces.BinaryMarshallable = (*AddressTransaction)(nil)
+
+func (e *AddressTransaction) MarshalBinary() ([]byte, error) {
+	buf := primitives.NewBuffer(nil)
+
+	err := buf.PushBinaryMarshallable(e.TxID)
+	if err != nil {
+		return nil, err
+	}
+	err = buf.PushUInt32(e.DBHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.DeepCopyBytes(), nil
+}
+
+func (e *AddressTransaction) UnmarshalBinaryData(data []byte) ([]byte, error) {
+	buf := primitives.NewBuffer(data)
+
+	e.TxID = new(primitives.Hash)
+	err := buf.PopBinaryMarshallable(e.TxID)
+	if err != nil {
+		return nil, err
+	}
+	e.DBHeight, err = buf.PopUInt32()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.DeepCopyBytes(), nil
+}
+
+func (e *AddressTransaction) UnmarshalBinary(data []byte) error {
+	_, err := e.UnmarshalBinaryData(data)
+	return err
+}
+
+// Transaction counts and index heights
+type addressIndexNumber uint32
+
+func (n *addressIndexNumber) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(*n))
+	return b, nil
+}
+
+func (n *addressIndexNumber) UnmarshalBinaryData(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("Not enough data to unmarshal")
+	}
+	*n = addressIndexNumber(binary.BigEndian.Uint32(data))
+	return data[4:], nil
+}
+
+func (n *addressIndexNumber) UnmarshalBinary(data []byte) error {
+	_, err := n.UnmarshalBinaryData(data)
+	return err
+}
+
+func (db *Overlay) SetAddressIndex() {
+	db.AddressIndex = true
+}
+
+// FetchAddressTransactions returns up to limit transactions of the address,
+// oldest first, skipping the first start ones.  It also returns how many
+// transactions the address has in all.
+func (db *Overlay) FetchAddressTransactions(address interfaces.IHash, start, limit uint32) ([]*AddressTransaction, uint32, error) {
+	if !db.AddressIndex {
+		return nil, 0, fmt.Errorf("The address index is not enabled")
+	}
+
+	count := new(addressIndexNumber)
+	loaded, err := db.Get(ADDRESS_TRANSACTION_COUNT, address.Bytes(), count)
+	if err != nil {
+		return nil, 0, err
+	}
+	if loaded == nil {
+		return []*AddressTransaction{}, 0, nil
+	}
+	total := uint32(*count)
+
+	answer := []*AddressTransaction{}
+	for i := start; i < total && uint32(len(answer)) < limit; i++ {
+		tx := new(AddressTransaction)
+		loaded, err := db.Get(ADDRESS_TRANSACTIONS, addressTransactionKey(address.Bytes(), i), tx)
+		if err != nil {
+			return nil, 0, err
+		}
+		if loaded == nil {
+			return nil, 0, fmt.Errorf("Address transaction %v of %v is missing", i, address.String())
+		}
+		answer = append(answer, tx)
+	}
+	return answer, total, nil
+}
+
+// BackfillAddressIndex indexes the blocks already in the database that the
+// address index hasn't seen yet.  Heights are indexed in order, the FBlock
+// then the ECBlock of each, as they are when saved.  It can run alongside
+// block processing, as it indexes in batches that blocks are saved between,
+// and indexes the blocks saved meanwhile before it returns.
+func (db *Overlay) BackfillAddressIndex() error {
+	if !db.AddressIndex {
+		return nil
+	}
+
+	db.addressIndexMutex.Lock()
+	db.addressIndexBackfilling = true
+	db.addressIndexMutex.Unlock()
+
+	for {
+		done, err := db.backfillAddressIndexBatch()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// backfillAddressIndexBatch indexes the next addressIndexBackfillBatch
+// heights, and returns true once it runs out of blocks.  It holds the batch
+// semaphore so no multibatch is in progress while it reads the index.
+func (db *Overlay) backfillAddressIndexBatch() (done bool, err error) {
+	db.BatchSemaphore.Lock()
+	defer db.BatchSemaphore.Unlock()
+	db.addressIndexMutex.Lock()
+	defer db.addressIndexMutex.Unlock()
+	defer func() {
+		if done || err != nil {
+			db.addressIndexBackfilling = false
+		}
+	}()
+
+	ai := newAddressIndexer(db, false)
+	start, err := ai.nextHeight(FACTOIDBLOCK)
+	if err != nil {
+		return false, err
+	}
+	ecStart, err := ai.nextHeight(ENTRYCREDITBLOCK)
+	if err != nil {
+		return false, err
+	}
+	if ecStart < start {
+		start = ecStart
+	}
+
+	for h := start; h < start+addressIndexBackfillBatch && !done; h++ {
+		fDone, err := ai.catchUp(FACTOIDBLOCK, h+1)
+		if err != nil {
+			return false, err
+		}
+		ecDone, err := ai.catchUp(ENTRYCREDITBLOCK, h+1)
+		if err != nil {
+			return false, err
+		}
+		done = fDone && ecDone
+	}
+
+	if len(ai.records) > 0 {
+		err = db.PutInBatch(ai.records)
+		if err != nil {
+			return false, err
+		}
+	}
+	return done, nil
+}
+
+// SaveAddressTransactionsMultiBatch adds the records indexing the addresses
+// of a factoid or entry credit block to the multibatch.
+func (db *Overlay) SaveAddressTransactionsMultiBatch(block interfaces.DatabaseBatchable) error {
+	if !db.AddressIndex {
+		return nil
+	}
+	db.addressIndexMutex.Lock()
+	defer db.addressIndexMutex.Unlock()
+
+	ai := newAddressIndexer(db, true)
+	err := ai.addWithCatchUp(block)
+	if err != nil {
+		return err
+	}
+	db.PutInMultiBatch(ai.records)
+	for id, n := range ai.numbers {
+		db.pendingAddressNumbers[id] = n
+	}
+	return nil
+}
+
+func (db *Overlay) SaveAddressTransactions(block interfaces.DatabaseBatchable) error {
+	if !db.AddressIndex {
+		return nil
+	}
+	db.addressIndexMutex.Lock()
+	defer db.addressIndexMutex.Unlock()
+
+	ai := newAddressIndexer(db, false)
+	err := ai.addWithCatchUp(block)
+	if err != nil {
+		return err
+	}
+	if len(ai.records) == 0 {
+		return nil
+	}
+	return db.PutInBatch(ai.records)
+}
+
+func addressTransactionKey(address []byte, n uint32) []byte {
+	key := make([]byte, len(address)+4)
+	copy(key, address)
+	binary.BigEndian.PutUint32(key[len(address):], n)
+	return key
+}
+
+// addressIndexer builds the records indexing a run of blocks, keeping track
+// of the counts it changed so far.
+type addressIndexer struct {
+	db *Overlay
+	// Look in the overlay's pending numbers for what isn't written yet
+	pending bool
+
+	numbers map[string]uint32
+	records []interfaces.Record
+}
+
+func newAddressIndexer(db *Overlay, pending bool) *addressIndexer {
+	ai := new(addressIndexer)
+	ai.db = db
+	ai.pending = pending
+	ai.numbers = map[string]uint32{}
+	return ai
+}
+
+func (ai *addressIndexer) getNumber(bucket, key []byte) (uint32, error) {
+	id := string(bucket) + ":" + string(key)
+	if n, ok := ai.numbers[id]; ok {
+		return n, nil
+	}
+
+	if ai.pending {
+		if n, ok := ai.db.pendingAddressNumbers[id]; ok {
+			return n, nil
+		}
+	}
+
+	n := new(addressIndexNumber)
+	loaded, err := ai.db.Get(bucket, key, n)
+	if err != nil {
+		return 0, err
+	}
+	if loaded == nil {
+		return 0, nil
+	}
+	return uint32(*n), nil
+}
+
+func (ai *addressIndexer) setNumber(bucket, key []byte, n uint32) {
+	ai.numbers[string(bucket)+":"+string(key)] = n
+	v := addressIndexNumber(n)
+	ai.records = append(ai.records, interfaces.Record{bucket, key, &v})
+}
+
+func (ai *addressIndexer) nextHeight(bucket []byte) (uint32, error) {
+	return ai.getNumber(ADDRESS_INDEX_HEIGHT, bucket)
+}
+
+// catchUp indexes the blocks of the bucket found in the database, from the
+// next height to index up to, but not including, end.  It returns true if it
+// ran out of blocks before end.
+func (ai *addressIndexer) catchUp(bucket []byte, end uint32) (bool, error) {
+	next, err := ai.nextHeight(bucket)
+	if err != nil {
+		return false, err
+	}
+	for h := next; h < end; h++ {
+		var block interfaces.DatabaseBatchable
+		if bytes.Equal(bucket, FACTOIDBLOCK) {
+			fblock, err := ai.db.FetchFBlockByHeight(h)
+			if err != nil {
+				return false, err
+			}
+			if fblock == nil {
+				return true, nil
+			}
+			block = fblock
+		} else {
+			ecblock, err := ai.db.FetchECBlockByHeight(h)
+			if err != nil {
+				return false, err
+			}
+			if ecblock == nil {
+				return true, nil
+			}
+			block = ecblock
+		}
+		err := ai.add(block)
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// addWithCatchUp indexes any blocks missed before this one, then this one.
+// While a backfill runs, the blocks missed are left to it.
+func (ai *addressIndexer) addWithCatchUp(block interfaces.DatabaseBatchable) error {
+	bucket, _ := addressTransactionsInBlock(block)
+	if bucket == nil {
+		return nil
+	}
+	if ai.db.addressIndexBackfilling {
+		return ai.add(block)
+	}
+	_, err := ai.catchUp(bucket, block.GetDatabaseHeight())
+	if err != nil {
+		return err
+	}
+	return ai.add(block)
+}
+
+// add indexes the block if it is the next one to be indexed.  Blocks already
+// indexed are skipped, as are blocks past a gap, which are left to the next
+// catch up.
+func (ai *addressIndexer) add(block interfaces.DatabaseBatchable) error {
+	bucket, txs := addressTransactionsInBlock(block)
+	if bucket == nil {
+		return nil
+	}
+
+	height := block.GetDatabaseHeight()
+	next, err := ai.nextHeight(bucket)
+	if err != nil {
+		return err
+	}
+	if height != next {
+		return nil
+	}
+
+	for _, tx := range txs {
+		for _, address := range tx.addresses {
+			n, err := ai.getNumber(ADDRESS_TRANSACTION_COUNT, address)
+			if err != nil {
+				return err
+			}
+			at := new(AddressTransaction)
+			at.TxID = tx.txid
+			at.DBHeight = height
+			ai.records = append(ai.records, interfaces.Record{ADDRESS_TRANSACTIONS, addressTransactionKey(address, n), at})
+			ai.setNumber(ADDRESS_TRANSACTION_COUNT, address, n+1)
+		}
+	}
+	ai.setNumber(ADDRESS_INDEX_HEIGHT, bucket, height+1)
+
+	return nil
+}
+
+type addressTransactions struct {
+	txid      interfaces.IHash
+	addresses [][]byte
+}
+
+// addressTransactionsInBlock returns the block bucket the block is indexed
+// under, and the addresses each of its transactions touches.  Blocks that
+// aren't indexed return a nil bucket.
+func addressTransactionsInBlock(block interfaces.DatabaseBatchable) ([]byte, []*addressTransactions) {
+	var answer []*addressTransactions
+
+	switch b := block.(type) {
+	case interfaces.IFBlock:
+		for _, tx := range b.GetTransactions() {
+			t := new(addressTransactions)
+			t.txid = tx.GetSigHash()
+			seen := map[string]bool{}
+			for _, list := range [][]interfaces.ITransAddress{tx.GetInputs(), tx.GetOutputs(), tx.GetECOutputs()} {
+				for _, a := range list {
+					address := a.GetAddress().Bytes()
+					if seen[string(address)] {
+						continue
+					}
+					seen[string(address)] = true
+					t.addresses = append(t.addresses, address)
+				}
+			}
+			answer = append(answer, t)
+		}
+		return FACTOIDBLOCK, answer
+
+	case interfaces.IEntryCreditBlock:
+		for _, entry := range b.GetBody().GetEntries() {
+			var address []byte
+			switch e := entry.(type) {
+			case *entryCreditBlock.CommitChain:
+				address = e.ECPubKey[:]
+			case *entryCreditBlock.CommitEntry:
+				address = e.ECPubKey[:]
+			default:
+				// Balance increases are indexed with the factoid transaction
+				continue
+			}
+			t := new(addressTransactions)
+			t.txid = entry.GetSigHash()
+			t.addresses = [][]byte{address}
+			answer = append(answer, t)
+		}
+		return ENTRYCREDITBLOCK, answer
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,136 @@
+package databaseOverlay_test
+
+import (
+	"testing"
+
+	"github.com/FactomProject/factomd/common/entryCreditBlock"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/database/databaseOverlay"
+	. "github.com/FactomProject/factomd/testHelper"
+)
+
+// expectedAddressTransactions reads the blocks of the database and returns the
+// transactions of every address.
+func expectedAddressTransactions(t *testing.T, dbo *databaseOverlay.Overlay) map[string][]string {
+	answer := map[string][]string{}
+	for h := uint32(0); ; h++ {
+		fblock, err := dbo.FetchFBlockByHeight(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fblock == nil {
+			break
+		}
+		for _, tx := range fblock.GetTransactions() {
+			seen := map[string]bool{}
+			for _, list := range [][]interfaces.ITransAddress{tx.GetInputs(), tx.GetOutputs(), tx.GetECOutputs()} {
+				for _, a := range list {
+					adr := a.GetAddress().String()
+					if !seen[adr] {
+						seen[adr] = true
+						answer[adr] = append(answer[adr], tx.GetSigHash().String())
+					}
+				}
+			}
+		}
+	}
+	for h := uint32(0); ; h++ {
+		ecblock, err := dbo.FetchECBlockByHeight(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ecblock == nil {
+			break
+		}
+		for _, entry := range ecblock.GetBody().GetEntries() {
+			var adr string
+			switch e := entry.(type) {
+			case *entryCreditBlock.CommitChain:
+				adr = primitives.NewHash(e.ECPubKey[:]).String()
+			case *entryCreditBlock.CommitEntry:
+				adr = primitives.NewHash(e.ECPubKey[:]).String()
+			default:
+				continue
+			}
+			answer[adr] = append(answer[adr], entry.GetSigHash().String())
+		}
+	}
+	return answer
+}
+
+func checkAddressTransactions(t *testing.T, dbo *databaseOverlay.Overlay, expected map[string][]string) {
+	for adr, txids := range expected {
+		h, err := primitives.NewShaHashFromStr(adr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Page through two at a time
+		found := map[string]bool{}
+		height := uint32(0)
+		for start := uint32(0); ; start += 2 {
+			txs, total, err := dbo.FetchAddressTransactions(h, start, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(total) != len(txids) {
+				t.Errorf("Wrong total for %v - %v vs %v", adr, total, len(txids))
+			}
+			if len(txs) == 0 {
+				break
+			}
+			for _, tx := range txs {
+				if tx.DBHeight < height {
+					t.Errorf("Transactions of %v out of order", adr)
+				}
+				height = tx.DBHeight
+				found[tx.TxID.String()] = true
+			}
+		}
+		if len(found) != len(txids) {
+			t.Errorf("Wrong number of transactions for %v - %v vs %v", adr, len(found), len(txids))
+		}
+		for _, txid := range txids {
+			if !found[txid] {
+				t.Errorf("Transaction %v of %v not found", txid, adr)
+			}
+		}
+	}
+}
+
+func TestAddressTransactionsIndex(t *testing.T) {
+	dbo := CreateEmptyTestDatabaseOverlay()
+	dbo.SetAddressIndex()
+	PopulateTestDatabaseOverlay(dbo)
+
+	expected := expectedAddressTransactions(t, dbo)
+	if len(expected) == 0 {
+		t.Fatal("No addresses in the test blocks")
+	}
+	checkAddressTransactions(t, dbo, expected)
+}
+
+func TestAddressTransactionsBackfill(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+
+	h := primitives.NewZeroHash()
+	_, _, err := dbo.FetchAddressTransactions(h, 0, 10)
+	if err == nil {
+		t.Error("Fetched address transactions with the index disabled")
+	}
+
+	dbo.SetAddressIndex()
+	err = dbo.BackfillAddressIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := expectedAddressTransactions(t, dbo)
+	checkAddressTransactions(t, dbo, expected)
+
+	// Running it again doesn't index anything twice
+	err = dbo.BackfillAddressIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAddressTransactions(t, dbo, expected)
+}
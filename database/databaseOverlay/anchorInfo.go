@@ -5,12 +5,13 @@
 package databaseOverlay
 
 import (
-	//"fmt"
+	"fmt"
+	"sort"
+
 	"github.com/FactomProject/factomd/anchor"
 	"github.com/FactomProject/factomd/common/directoryBlock/dbInfo"
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/primitives"
-	"sort"
 )
 
 var AnchorBlockID string = "df3ade9eec4b08d5379cc64270c30ea7315d8a8a1a69efe2b98a60ecdd69e604"
@@ -20,6 +21,19 @@ var AnchorSigKeys []string = []string{
 }
 var AnchorSigPublicKeys []interfaces.Verifier
 
+// Key under ANCHOR_ENTRY_STATE present once every anchor entry is indexed,
+// either because the database was built with the index from the first block,
+// or because the index was backfilled
+var anchorEntryIndexedKey = []byte("Indexed")
+
+// Key under ANCHOR_ENTRY_STATE of the KeyMR of the next entry block of the
+// anchor chain the backfill indexes
+var anchorEntryNextKey = []byte("Next")
+
+// Entry blocks of the anchor chain the backfill indexes before it writes what
+// it has found
+const anchorEntryIndexBackfillBatch = 100
+
 func init() {
 	for _, v := range AnchorSigKeys {
 		pubKey := new(primitives.PublicKey)
@@ -40,10 +54,208 @@ func (dbo *Overlay) RebuildDirBlockInfo() error {
 	if err != nil {
 		return err
 	}
+	err = dbo.RebuildAnchorEntryIndex()
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// RebuildAnchorEntryIndex indexes the entries of the anchor chain by the KeyMR
+// of the directory blocks they anchor, from the head of the chain back
+func (dbo *Overlay) RebuildAnchorEntryIndex() error {
+	err := dbo.DB.Delete(ANCHOR_ENTRY_STATE, anchorEntryNextKey)
+	if err != nil {
+		return err
+	}
+	return dbo.backfillAnchorEntryIndex()
+}
+
+// BackfillAnchorEntryIndex builds the index of anchor entries in a database
+// that was started before it existed.  The anchor entries saved since are
+// already indexed.  It carries on from where a previous run stopped, and does
+// nothing once the index is complete.
+func (dbo *Overlay) BackfillAnchorEntryIndex() error {
+	indexed, err := dbo.anchorEntryIndexed()
+	if err != nil || indexed {
+		return err
+	}
+	return dbo.backfillAnchorEntryIndex()
+}
+
+func (dbo *Overlay) backfillAnchorEntryIndex() error {
+	for {
+		done, err := dbo.backfillAnchorEntryIndexBatch()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// backfillAnchorEntryIndexBatch indexes the entries of the next
+// anchorEntryIndexBackfillBatch entry blocks of the anchor chain, walking back
+// from its head, and saves the entry block to carry on from.  It returns true,
+// and marks the index as complete, once it reaches the start of the chain.
+func (dbo *Overlay) backfillAnchorEntryIndexBatch() (done bool, err error) {
+	next, err := dbo.fetchAnchorEntryNext()
+	if err != nil {
+		return false, err
+	}
+
+	var records []interfaces.Record
+	for i := 0; i < anchorEntryIndexBackfillBatch; i++ {
+		if next == nil || next.IsZero() {
+			done = true
+			break
+		}
+		eblock, err := dbo.FetchEBlock(next)
+		if err != nil {
+			return false, err
+		}
+		if eblock == nil {
+			done = true
+			break
+		}
+		for _, hash := range eblock.GetEntryHashes() {
+			entry, err := dbo.FetchEntry(hash)
+			if err != nil {
+				return false, err
+			}
+			// Entries not synced yet are indexed when they are saved
+			if entry == nil {
+				continue
+			}
+			ar, err := anchor.UnmarshalAnchorRecord(entry.GetContent())
+			if err != nil {
+				continue
+			}
+			keyMRs, err := dbo.FetchAnchoredKeyMRs(ar)
+			if err != nil {
+				continue
+			}
+			records = append(records, anchorEntryRecords(keyMRs, entry)...)
+		}
+		next = eblock.GetHeader().GetPrevKeyMR()
+	}
+	if done {
+		records = append(records, anchorEntryIndexedRecord())
+	} else {
+		records = append(records, interfaces.Record{Bucket: ANCHOR_ENTRY_STATE, Key: anchorEntryNextKey, Data: next})
+	}
+	return done, dbo.DB.PutInBatch(records)
+}
+
+// fetchAnchorEntryNext returns the KeyMR of the next entry block of the anchor
+// chain to index, which is the head of the chain if the backfill hasn't started
+func (dbo *Overlay) fetchAnchorEntryNext() (interfaces.IHash, error) {
+	next, err := dbo.DB.Get(ANCHOR_ENTRY_STATE, anchorEntryNextKey, new(primitives.Hash))
+	if err != nil {
+		return nil, err
+	}
+	if next != nil {
+		return next.(interfaces.IHash), nil
+	}
+	chainID, err := primitives.NewShaHashFromStr(AnchorBlockID)
+	if err != nil {
+		return nil, err
+	}
+	return dbo.FetchHeadIndexByChainID(chainID)
+}
+
+func (dbo *Overlay) anchorEntryIndexed() (bool, error) {
+	n := new(addressIndexNumber)
+	loaded, err := dbo.DB.Get(ANCHOR_ENTRY_STATE, anchorEntryIndexedKey, n)
+	if err != nil {
+		return false, err
+	}
+	return loaded != nil, nil
+}
+
+func anchorEntryIndexedRecord() interfaces.Record {
+	n := addressIndexNumber(1)
+	return interfaces.Record{Bucket: ANCHOR_ENTRY_STATE, Key: anchorEntryIndexedKey, Data: &n}
+}
+
+// anchorEntryIndexedRecords returns the record marking the index of anchor
+// entries as complete if the directory block is the first one, as the anchor
+// entries of a database built from there are all indexed as they are saved
+func anchorEntryIndexedRecords(dblock interfaces.DatabaseBatchable) []interfaces.Record {
+	if dblock.GetDatabaseHeight() != 0 {
+		return nil
+	}
+	return []interfaces.Record{anchorEntryIndexedRecord()}
+}
+
+func (dbo *Overlay) saveAnchorEntryIndexed(dblock interfaces.DatabaseBatchable) error {
+	records := anchorEntryIndexedRecords(dblock)
+	if len(records) == 0 {
+		return nil
+	}
+	return dbo.DB.PutInBatch(records)
+}
+
+// FetchAnchoredKeyMRs returns the KeyMRs of the directory blocks an anchor
+// record anchors, in height order.  The KeyMRs of a window are checked against
+// its WindowMR.
+func (dbo *Overlay) FetchAnchoredKeyMRs(ar *anchor.AnchorRecord) ([]interfaces.IHash, error) {
+	if ar.IsWindow() == false {
+		keyMR, err := primitives.NewShaHashFromStr(ar.KeyMR)
+		if err != nil {
+			return nil, err
+		}
+		return []interfaces.IHash{keyMR}, nil
+	}
+	keyMRs := []interfaces.IHash{}
+	for height := ar.DBHeightMin; height <= ar.DBHeight; height++ {
+		keyMR, err := dbo.FetchDBKeyMRByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		if keyMR == nil {
+			return nil, fmt.Errorf("Directory block %v of the anchor window not found", height)
+		}
+		keyMRs = append(keyMRs, keyMR)
+	}
+	err := ar.ValidateWindow(keyMRs)
+	if err != nil {
+		return nil, err
+	}
+	return keyMRs, nil
+}
+
+// anchorEntryRecords returns the records that index an anchor entry by the
+// KeyMRs of the directory blocks it anchors
+func anchorEntryRecords(keyMRs []interfaces.IHash, entry interfaces.IEBEntry) []interfaces.Record {
+	records := []interfaces.Record{}
+	for _, keyMR := range keyMRs {
+		records = append(records, interfaces.Record{Bucket: ANCHOR_ENTRY, Key: keyMR.Bytes(), Data: entry.DatabasePrimaryIndex()})
+	}
+	return records
+}
+
+// FetchAnchorEntryByKeyMR returns the anchor chain entry that anchors a
+// directory block, or nil if we don't know of one.  Until the index of anchor
+// entries is built, not knowing of one is an error, as the block may well be
+// anchored.
+func (dbo *Overlay) FetchAnchorEntryByKeyMR(keyMR interfaces.IHash) (interfaces.IEBEntry, error) {
+	hash, err := dbo.DB.Get(ANCHOR_ENTRY, keyMR.Bytes(), new(primitives.Hash))
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil {
+		indexed, err := dbo.anchorEntryIndexed()
+		if err != nil {
+			return nil, err
+		}
+		if !indexed {
+			return nil, fmt.Errorf("Anchor not indexed: the index of anchor entries is still being built")
+		}
+		return nil, nil
+	}
+	return dbo.FetchEntry(hash.(interfaces.IHash))
+}
+
 func (dbo *Overlay) SaveAnchorInfoFromEntry(entry interfaces.IEBEntry) error {
 	if entry.DatabasePrimaryIndex().String() == "24674e6bc3094eb773297de955ee095a05830e431da13a37382dcdc89d73c7d7" {
 		return nil
@@ -58,11 +270,29 @@ func (dbo *Overlay) SaveAnchorInfoFromEntry(entry interfaces.IEBEntry) error {
 	if ar == nil {
 		return nil
 	}
-	dbi, err := AnchorRecordToDirBlockInfo(ar)
+	keyMRs, err := dbo.FetchAnchoredKeyMRs(ar)
 	if err != nil {
+		if ar.IsWindow() {
+			// A window that isn't of our directory blocks anchors nothing
+			return nil
+		}
 		return err
 	}
-	return dbo.ProcessDirBlockInfoBatch(dbi)
+	err = dbo.DB.PutInBatch(anchorEntryRecords(keyMRs, entry))
+	if err != nil {
+		return err
+	}
+	dbis, err := AnchorRecordToDirBlockInfos(ar, keyMRs)
+	if err != nil {
+		return err
+	}
+	for _, dbi := range dbis {
+		err = dbo.ProcessDirBlockInfoBatch(dbi)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (dbo *Overlay) SaveAnchorInfoFromEntryMultiBatch(entry interfaces.IEBEntry) error {
@@ -79,11 +309,26 @@ func (dbo *Overlay) SaveAnchorInfoFromEntryMultiBatch(entry interfaces.IEBEntry)
 	if ar == nil {
 		return nil
 	}
-	dbi, err := AnchorRecordToDirBlockInfo(ar)
+	keyMRs, err := dbo.FetchAnchoredKeyMRs(ar)
+	if err != nil {
+		if ar.IsWindow() {
+			// A window that isn't of our directory blocks anchors nothing
+			return nil
+		}
+		return err
+	}
+	dbo.PutInMultiBatch(anchorEntryRecords(keyMRs, entry))
+	dbis, err := AnchorRecordToDirBlockInfos(ar, keyMRs)
 	if err != nil {
 		return err
 	}
-	return dbo.ProcessDirBlockInfoMultiBatch(dbi)
+	for _, dbi := range dbis {
+		err = dbo.ProcessDirBlockInfoMultiBatch(dbi)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (dbo *Overlay) FetchAllAnchorInfo() ([]*anchor.AnchorRecord, error) {
@@ -118,6 +363,23 @@ func (dbo *Overlay) SaveAnchorInfoAsDirBlockInfo(ars []*anchor.AnchorRecord) err
 	sort.Sort(ByAnchorDBHeightAccending(ars))
 
 	for _, v := range ars {
+		if v.IsWindow() {
+			keyMRs, err := dbo.FetchAnchoredKeyMRs(v)
+			if err != nil {
+				continue
+			}
+			dbis, err := AnchorRecordToDirBlockInfos(v, keyMRs)
+			if err != nil {
+				return err
+			}
+			for _, dbi := range dbis {
+				err = dbo.SaveDirBlockInfo(dbi)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
 		dbi, err := AnchorRecordToDirBlockInfo(v)
 		if err != nil {
 			return err
@@ -162,6 +424,23 @@ func AnchorRecordToDirBlockInfo(ar *anchor.AnchorRecord) (*dbInfo.DirBlockInfo,
 	return dbi, nil
 }
 
+// AnchorRecordToDirBlockInfos returns the DirBlockInfo of each directory block
+// an anchor record anchors, given their KeyMRs in height order
+func AnchorRecordToDirBlockInfos(ar *anchor.AnchorRecord, keyMRs []interfaces.IHash) ([]*dbInfo.DirBlockInfo, error) {
+	dbis := []*dbInfo.DirBlockInfo{}
+	for i, keyMR := range keyMRs {
+		dbi, err := AnchorRecordToDirBlockInfo(ar)
+		if err != nil {
+			return nil, err
+		}
+		dbi.DBHash = keyMR
+		dbi.DBMerkleRoot = keyMR
+		dbi.DBHeight = ar.DBHeight - uint32(len(keyMRs)-1-i)
+		dbis = append(dbis, dbi)
+	}
+	return dbis, nil
+}
+
 // AnchorRecord array sorting implementation - accending
 type ByAnchorDBHeightAccending []*anchor.AnchorRecord
 
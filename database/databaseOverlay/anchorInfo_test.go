@@ -6,6 +6,9 @@ package databaseOverlay_test
 
 import (
 	"github.com/FactomProject/factomd/anchor"
+	"github.com/FactomProject/factomd/common/directoryBlock"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/database/databaseOverlay"
 	"github.com/FactomProject/factomd/testHelper"
 	"testing"
 )
@@ -19,6 +22,128 @@ func TestRebuildDirBlockInfo(t *testing.T) {
 	}
 }
 
+func TestFetchAnchorEntryByKeyMR(t *testing.T) {
+	dbo := testHelper.CreateAndPopulateTestDatabaseOverlay()
+	blocks := testHelper.CreateFullTestBlockSet()
+	for _, block := range blocks[:len(blocks)-2] {
+		keyMR := block.DBlock.DatabasePrimaryIndex()
+		entry, err := dbo.FetchAnchorEntryByKeyMR(keyMR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil {
+			t.Fatalf("No anchor entry for %v", keyMR)
+		}
+		ar, err := anchor.UnmarshalAnchorRecord(entry.GetContent())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ar.KeyMR != keyMR.String() {
+			t.Errorf("Anchor entry for %v anchors %v", keyMR, ar.KeyMR)
+		}
+	}
+
+	entry, err := dbo.FetchAnchorEntryByKeyMR(primitives.NewZeroHash())
+	if err != nil {
+		t.Error(err)
+	}
+	if entry != nil {
+		t.Errorf("Found an anchor entry for the zero hash")
+	}
+}
+
+func TestBackfillAnchorEntryIndex(t *testing.T) {
+	dbo := testHelper.CreateAndPopulateTestDatabaseOverlay()
+	blocks := testHelper.CreateFullTestBlockSet()
+	keyMR := blocks[0].DBlock.DatabasePrimaryIndex()
+
+	// A database from before the index doesn't know which entries anchor
+	// which blocks, and says so
+	keys, err := dbo.ListAllKeys(databaseOverlay.ANCHOR_ENTRY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		err = dbo.Delete(databaseOverlay.ANCHOR_ENTRY, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = dbo.Delete(databaseOverlay.ANCHOR_ENTRY_STATE, []byte("Indexed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := dbo.FetchAnchorEntryByKeyMR(keyMR)
+	if err == nil || entry != nil {
+		t.Errorf("Unindexed anchor gave %v, %v", entry, err)
+	}
+
+	err = dbo.BackfillAnchorEntryIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err = dbo.FetchAnchorEntryByKeyMR(keyMR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil {
+		t.Errorf("No anchor entry for %v after the backfill", keyMR)
+	}
+	entry, err = dbo.FetchAnchorEntryByKeyMR(primitives.NewZeroHash())
+	if err != nil || entry != nil {
+		t.Errorf("Zero hash gave %v, %v", entry, err)
+	}
+}
+
+func TestBackfillAnchorEntryIndexCarriesOn(t *testing.T) {
+	dbo := testHelper.CreateAndPopulateTestDatabaseOverlay()
+	blocks := testHelper.CreateFullTestBlockSet()
+	keyMR := blocks[0].DBlock.DatabasePrimaryIndex()
+
+	keys, err := dbo.ListAllKeys(databaseOverlay.ANCHOR_ENTRY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		err = dbo.Delete(databaseOverlay.ANCHOR_ENTRY, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = dbo.Delete(databaseOverlay.ANCHOR_ENTRY_STATE, []byte("Indexed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A backfill that stopped at the start of the chain has nothing left to
+	// index, so it doesn't go back over the chain
+	err = dbo.Put(databaseOverlay.ANCHOR_ENTRY_STATE, []byte("Next"), primitives.NewZeroHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbo.BackfillAnchorEntryIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := dbo.FetchAnchorEntryByKeyMR(keyMR)
+	if err != nil || entry != nil {
+		t.Errorf("Backfill from the start of the chain gave %v, %v", entry, err)
+	}
+
+	// A rebuild starts again from the head
+	err = dbo.RebuildAnchorEntryIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err = dbo.FetchAnchorEntryByKeyMR(keyMR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil {
+		t.Errorf("No anchor entry for %v after the rebuild", keyMR)
+	}
+}
+
 func CreateAnchors() []*anchor.AnchorRecord {
 	answer := []*anchor.AnchorRecord{}
 
@@ -119,3 +244,53 @@ func CreateAnchors() []*anchor.AnchorRecord {
 
 	return answer
 }
+
+func TestWindowAnchorEntry(t *testing.T) {
+	dbo := testHelper.CreateAndPopulateTestDatabaseOverlay()
+	blocks := testHelper.CreateFullTestBlockSet()
+	window := []*directoryBlock.DirectoryBlock{}
+	for _, block := range blocks[len(blocks)-3:] {
+		window = append(window, block.DBlock)
+	}
+	entry := testHelper.CreateTestWindowAnchorEntry(window)
+	err := dbo.InsertEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dBlock := range window {
+		keyMR := dBlock.DatabasePrimaryIndex()
+		anchorEntry, err := dbo.FetchAnchorEntryByKeyMR(keyMR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if anchorEntry == nil || anchorEntry.DatabasePrimaryIndex().IsSameAs(entry.DatabasePrimaryIndex()) == false {
+			t.Errorf("Block %v is not anchored by the window", dBlock.GetDatabaseHeight())
+		}
+		dbi, err := dbo.FetchDirBlockInfoByKeyMR(keyMR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dbi == nil {
+			t.Fatalf("No DirBlockInfo for block %v", dBlock.GetDatabaseHeight())
+		}
+		if dbi.GetDBHeight() != dBlock.GetDatabaseHeight() {
+			t.Errorf("DirBlockInfo of block %v has height %v", dBlock.GetDatabaseHeight(), dbi.GetDBHeight())
+		}
+	}
+
+	// A window of blocks we don't have anchors nothing
+	other := testHelper.CreateTestDirectoryBlock(window[len(window)-1])
+	entry = testHelper.CreateTestWindowAnchorEntry([]*directoryBlock.DirectoryBlock{window[len(window)-1], other})
+	err = dbo.InsertEntry(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchorEntry, err := dbo.FetchAnchorEntryByKeyMR(other.DatabasePrimaryIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anchorEntry != nil {
+		t.Error("Block not in the database was anchored")
+	}
+}
@@ -0,0 +1,323 @@
+package databaseOverlay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/FactomProject/factomd/common/entryCreditBlock"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// Balances at past heights are rebuilt by replaying the FBlocks and ECBlocks
+// on top of the closest checkpoint below.  Checkpoints hold every FCT and EC
+// balance at a height.  When enabled, the node saves one every
+// BalanceCheckpointInterval heights with the block, from the balances it
+// holds, and BackfillBalanceCheckpoints fills in the ones missing, so a lookup
+// never replays more than an interval of blocks.  A lookup only reads
+// checkpoints, it never writes them.
+//
+// The balances at a height are those after its FBlock and ECBlock.
+
+const BalanceCheckpointInterval = 1000
+
+type BalanceCheckpoint struct {
+	DBHeight        uint32
+	FactoidBalances map[[32]byte]int64
+	ECBalances      map[[32]byte]int64
+}
+
+var _ interfaces.BinaryMarshallable = (*BalanceCheckpoint)(nil)
+
+func NewBalanceCheckpoint() *BalanceCheckpoint {
+	c := new(BalanceCheckpoint)
+	c.FactoidBalances = map[[32]byte]int64{}
+	c.ECBalances = map[[32]byte]int64{}
+	return c
+}
+
+func (c *BalanceCheckpoint) MarshalBinary() ([]byte, error) {
+	buf := primitives.NewBuffer(nil)
+
+	err := buf.PushUInt32(c.DBHeight)
+	if err != nil {
+		return nil, err
+	}
+	err = pushBalances(buf, c.FactoidBalances)
+	if err != nil {
+		return nil, err
+	}
+	err = pushBalances(buf, c.ECBalances)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.DeepCopyBytes(), nil
+}
+
+func (c *BalanceCheckpoint) UnmarshalBinaryData(data []byte) ([]byte, error) {
+	buf := primitives.NewBuffer(data)
+
+	var err error
+	c.DBHeight, err = buf.PopUInt32()
+	if err != nil {
+		return nil, err
+	}
+	c.FactoidBalances, err = popBalances(buf)
+	if err != nil {
+		return nil, err
+	}
+	c.ECBalances, err = popBalances(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.DeepCopyBytes(), nil
+}
+
+func (c *BalanceCheckpoint) UnmarshalBinary(data []byte) error {
+	_, err := c.UnmarshalBinaryData(data)
+	return err
+}
+
+// Balances are written sorted by address, so a checkpoint always marshals the
+// same way.
+func pushBalances(buf *primitives.Buffer, m map[[32]byte]int64) error {
+	err := buf.PushVarInt(uint64(len(m)))
+	if err != nil {
+		return err
+	}
+
+	keys := make([][32]byte, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Sort(byBalanceAddress(keys))
+
+	for _, k := range keys {
+		err = buf.Push(k[:])
+		if err != nil {
+			return err
+		}
+		err = buf.PushInt64(m[k])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type byBalanceAddress [][32]byte
+
+func (f byBalanceAddress) Len() int {
+	return len(f)
+}
+func (f byBalanceAddress) Less(i, j int) bool {
+	return bytes.Compare(f[i][:], f[j][:]) < 0
+}
+func (f byBalanceAddress) Swap(i, j int) {
+	f[i], f[j] = f[j], f[i]
+}
+
+func popBalances(buf *primitives.Buffer) (map[[32]byte]int64, error) {
+	l, err := buf.PopVarInt()
+	if err != nil {
+		return nil, err
+	}
+	if l > uint64(buf.Len()) {
+		return nil, fmt.Errorf("Too many balances for the data - %v", l)
+	}
+
+	m := map[[32]byte]int64{}
+	k := make([]byte, 32)
+	for i := uint64(0); i < l; i++ {
+		err = buf.Pop(k)
+		if err != nil {
+			return nil, err
+		}
+		var adr [32]byte
+		copy(adr[:], k)
+		v, err := buf.PopInt64()
+		if err != nil {
+			return nil, err
+		}
+		m[adr] = v
+	}
+	return m, nil
+}
+
+func balanceCheckpointKey(dbheight uint32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, dbheight)
+	return key
+}
+
+// SaveBalanceCheckpoint saves the FCT and EC balances as of the given
+// directory block height
+func (db *Overlay) SaveBalanceCheckpoint(dbheight uint32, factoidBalances, ecBalances map[[32]byte]int64) error {
+	c := new(BalanceCheckpoint)
+	c.DBHeight = dbheight
+	c.FactoidBalances = factoidBalances
+	c.ECBalances = ecBalances
+	return db.saveBalanceCheckpoint(c)
+}
+
+func (db *Overlay) saveBalanceCheckpoint(c *BalanceCheckpoint) error {
+	return db.Put(BALANCE_CHECKPOINT, balanceCheckpointKey(c.DBHeight), c)
+}
+
+func (db *Overlay) FetchBalanceCheckpoint(dbheight uint32) (*BalanceCheckpoint, error) {
+	c := NewBalanceCheckpoint()
+	loaded, err := db.Get(BALANCE_CHECKPOINT, balanceCheckpointKey(dbheight), c)
+	if err != nil {
+		return nil, err
+	}
+	if loaded == nil {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// FetchBalancesAtHeight returns every FCT and EC balance as of the given
+// directory block height.
+func (db *Overlay) FetchBalancesAtHeight(dbheight uint32) (*BalanceCheckpoint, error) {
+	dblock, err := db.FetchDBlockByHeight(dbheight)
+	if err != nil {
+		return nil, err
+	}
+	if dblock == nil {
+		return nil, fmt.Errorf("No directory block at height %v", dbheight)
+	}
+
+	c, next, err := db.closestBalanceCheckpoint(dbheight)
+	if err != nil {
+		return nil, err
+	}
+	for h := next; h <= dbheight; h++ {
+		err = db.replayBalances(c, h)
+		if err != nil {
+			return nil, err
+		}
+		c.DBHeight = h
+	}
+
+	return c, nil
+}
+
+// BackfillBalanceCheckpoints saves the checkpoints missing below the top of
+// the chain, replaying the blocks from the checkpoint before each.  It carries
+// on from the checkpoints already saved, so over a database saved without
+// checkpoints only the first run replays from the first block.
+func (db *Overlay) BackfillBalanceCheckpoints() error {
+	var c *BalanceCheckpoint
+	// The last checkpoint found, loaded only when the next one is missing
+	last := int64(-1)
+	for h := uint32(0); ; h += BalanceCheckpointInterval {
+		saved, err := db.DoesKeyExist(BALANCE_CHECKPOINT, balanceCheckpointKey(h))
+		if err != nil {
+			return err
+		}
+		if saved {
+			c = nil
+			last = int64(h)
+			continue
+		}
+		dblock, err := db.FetchDBlockByHeight(h)
+		if err != nil {
+			return err
+		}
+		if dblock == nil {
+			return nil
+		}
+
+		next := uint32(0)
+		if c != nil {
+			next = c.DBHeight + 1
+		} else if last >= 0 {
+			c, err = db.FetchBalanceCheckpoint(uint32(last))
+			if err != nil {
+				return err
+			}
+			if c == nil {
+				return fmt.Errorf("Balance checkpoint at %v not found", last)
+			}
+			next = uint32(last) + 1
+		} else {
+			c = NewBalanceCheckpoint()
+		}
+		for ; next <= h; next++ {
+			err = db.replayBalances(c, next)
+			if err != nil {
+				return err
+			}
+			c.DBHeight = next
+		}
+		err = db.saveBalanceCheckpoint(c)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// closestBalanceCheckpoint returns the closest checkpoint at or below the
+// height, or empty balances from before the first block, and the height to
+// replay from.
+func (db *Overlay) closestBalanceCheckpoint(dbheight uint32) (*BalanceCheckpoint, uint32, error) {
+	for h := dbheight - dbheight%BalanceCheckpointInterval; ; h -= BalanceCheckpointInterval {
+		c, err := db.FetchBalanceCheckpoint(h)
+		if err != nil {
+			return nil, 0, err
+		}
+		if c != nil {
+			return c, h + 1, nil
+		}
+		if h == 0 {
+			return NewBalanceCheckpoint(), 0, nil
+		}
+	}
+}
+
+// replayBalances applies the FBlock and ECBlock at the height to the
+// balances, the same way the factoid state does as it processes them.
+func (db *Overlay) replayBalances(c *BalanceCheckpoint, dbheight uint32) error {
+	fblock, err := db.FetchFBlockByHeight(dbheight)
+	if err != nil {
+		return err
+	}
+	if fblock != nil {
+		rate := int64(fblock.GetExchRate())
+		for _, tx := range fblock.GetTransactions() {
+			for _, input := range tx.GetInputs() {
+				c.FactoidBalances[input.GetAddress().Fixed()] -= int64(input.GetAmount())
+			}
+			for _, output := range tx.GetOutputs() {
+				c.FactoidBalances[output.GetAddress().Fixed()] += int64(output.GetAmount())
+			}
+			if rate == 0 {
+				continue
+			}
+			for _, ecOut := range tx.GetECOutputs() {
+				c.ECBalances[ecOut.GetAddress().Fixed()] += int64(ecOut.GetAmount()) / rate
+			}
+		}
+	}
+
+	ecblock, err := db.FetchECBlockByHeight(dbheight)
+	if err != nil {
+		return err
+	}
+	if ecblock != nil {
+		for _, entry := range ecblock.GetBody().GetEntries() {
+			switch e := entry.(type) {
+			case *entryCreditBlock.CommitChain:
+				c.ECBalances[e.ECPubKey.Fixed()] -= int64(e.Credits)
+			case *entryCreditBlock.CommitEntry:
+				c.ECBalances[e.ECPubKey.Fixed()] -= int64(e.Credits)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package databaseOverlay_test
+
+import (
+	"testing"
+
+	"github.com/FactomProject/factomd/common/primitives/random"
+	"github.com/FactomProject/factomd/database/databaseOverlay"
+	. "github.com/FactomProject/factomd/testHelper"
+)
+
+func TestBalanceCheckpointMarshal(t *testing.T) {
+	c := databaseOverlay.NewBalanceCheckpoint()
+	c.DBHeight = 1234
+	for i := 0; i < 100; i++ {
+		var adr [32]byte
+		copy(adr[:], random.RandByteSliceOfLen(32))
+		c.FactoidBalances[adr] = random.RandInt64()
+		copy(adr[:], random.RandByteSliceOfLen(32))
+		c.ECBalances[adr] = random.RandInt64()
+	}
+
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2 := databaseOverlay.NewBalanceCheckpoint()
+	rest, err := c2.UnmarshalBinaryData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) > 0 {
+		t.Errorf("Returned extra data - %x", rest)
+	}
+	data2, err := c2.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(data2) {
+		t.Errorf("Checkpoints don't match")
+	}
+
+	_, err = c2.UnmarshalBinaryData(data[:len(data)-1])
+	if err == nil {
+		t.Errorf("Unmarshalled a truncated checkpoint")
+	}
+}
+
+func TestFetchBalancesAtHeight(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+
+	_, err := dbo.FetchBalancesAtHeight(uint32(BlockCount) + 1)
+	if err == nil {
+		t.Errorf("Got balances past the top of the chain")
+	}
+
+	// Coinbases to address 0 make its balance grow each block
+	adr := NewFactoidAddress(0).Fixed()
+	last := int64(-1)
+	for h := 0; h < BlockCount; h++ {
+		c, err := dbo.FetchBalancesAtHeight(uint32(h))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.DBHeight != uint32(h) {
+			t.Errorf("Wrong height - %v vs %v", c.DBHeight, h)
+		}
+		if c.FactoidBalances[adr] < last {
+			t.Errorf("Balance went down at %v - %v vs %v", h, c.FactoidBalances[adr], last)
+		}
+		last = c.FactoidBalances[adr]
+	}
+	if last <= 0 {
+		t.Errorf("No balance for the coinbase address")
+	}
+
+	// Lookups don't save checkpoints
+	c0, err := dbo.FetchBalanceCheckpoint(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c0 != nil {
+		t.Fatal("Checkpoint saved by a lookup")
+	}
+
+	// The backfill does, and the answers are the same from it
+	err = dbo.BackfillBalanceCheckpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c0, err = dbo.FetchBalanceCheckpoint(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c0 == nil {
+		t.Fatal("Checkpoint not saved")
+	}
+	c, err := dbo.FetchBalancesAtHeight(uint32(BlockCount - 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.FactoidBalances[adr] != last {
+		t.Errorf("Balance from the checkpoint does not match - %v vs %v", c.FactoidBalances[adr], last)
+	}
+}
+
+func TestSaveBalanceCheckpoint(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+	adr := NewFactoidAddress(0).Fixed()
+
+	// Lookups start from the balances the node saved rather than replaying
+	err := dbo.SaveBalanceCheckpoint(0, map[[32]byte]int64{adr: 1000000}, map[[32]byte]int64{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := dbo.FetchBalancesAtHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.FactoidBalances[adr] != 1000000 {
+		t.Errorf("Balance not from the checkpoint - %v", c.FactoidBalances[adr])
+	}
+
+	// And the backfill leaves them alone
+	err = dbo.BackfillBalanceCheckpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = dbo.FetchBalanceCheckpoint(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.FactoidBalances[adr] != 1000000 {
+		t.Errorf("Checkpoint overwritten by the backfill - %v", c.FactoidBalances[adr])
+	}
+}
@@ -25,6 +25,14 @@ func (db *Overlay) ProcessDBlockBatch(dblock interfaces.DatabaseBlockWithEntries
 	if err != nil {
 		return err
 	}
+	err = db.saveExtIDIndexHeight(dblock)
+	if err != nil {
+		return err
+	}
+	err = db.saveAnchorEntryIndexed(dblock)
+	if err != nil {
+		return err
+	}
 
 	return db.SaveIncludedInMultiFromBlock(dblock, false)
 }
@@ -36,6 +44,14 @@ func (db *Overlay) ProcessDBlockBatchWithoutHead(dblock interfaces.DatabaseBlock
 	if err != nil {
 		return err
 	}
+	err = db.saveExtIDIndexHeight(dblock)
+	if err != nil {
+		return err
+	}
+	err = db.saveAnchorEntryIndexed(dblock)
+	if err != nil {
+		return err
+	}
 
 	return db.SaveIncludedInMultiFromBlock(dblock, false)
 }
@@ -47,6 +63,12 @@ func (db *Overlay) ProcessDBlockMultiBatch(dblock interfaces.DatabaseBlockWithEn
 	if err != nil {
 		return err
 	}
+	records, err := db.extIDIndexHeightRecords(dblock)
+	if err != nil {
+		return err
+	}
+	db.PutInMultiBatch(records)
+	db.PutInMultiBatch(anchorEntryIndexedRecords(dblock))
 
 	return db.SaveIncludedInMultiFromBlockMultiBatch(dblock, true)
 }
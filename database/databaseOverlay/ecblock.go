@@ -20,7 +20,11 @@ func (db *Overlay) ProcessECBlockBatch(block interfaces.IEntryCreditBlock, check
 	if err != nil {
 		return err
 	}
-	return db.SavePaidForMultiFromBlock(block, checkForDuplicateEntries)
+	err = db.SavePaidForMultiFromBlock(block, checkForDuplicateEntries)
+	if err != nil {
+		return err
+	}
+	return db.SaveAddressTransactions(block)
 }
 
 func (db *Overlay) ProcessECBlockBatchWithoutHead(block interfaces.IEntryCreditBlock, checkForDuplicateEntries bool) error {
@@ -34,7 +38,11 @@ func (db *Overlay) ProcessECBlockBatchWithoutHead(block interfaces.IEntryCreditB
 	if err != nil {
 		return err
 	}
-	return db.SavePaidForMultiFromBlock(block, checkForDuplicateEntries)
+	err = db.SavePaidForMultiFromBlock(block, checkForDuplicateEntries)
+	if err != nil {
+		return err
+	}
+	return db.SaveAddressTransactions(block)
 }
 
 func (db *Overlay) ProcessECBlockMultiBatch(block interfaces.IEntryCreditBlock, checkForDuplicateEntries bool) error {
@@ -48,7 +56,11 @@ func (db *Overlay) ProcessECBlockMultiBatch(block interfaces.IEntryCreditBlock,
 	if err != nil {
 		return err
 	}
-	return db.SavePaidForMultiFromBlockMultiBatch(block, checkForDuplicateEntries)
+	err = db.SavePaidForMultiFromBlockMultiBatch(block, checkForDuplicateEntries)
+	if err != nil {
+		return err
+	}
+	return db.SaveAddressTransactionsMultiBatch(block)
 }
 
 func (db *Overlay) FetchECBlock(hash interfaces.IHash) (interfaces.IEntryCreditBlock, error) {
@@ -19,6 +19,9 @@ func (db *Overlay) InsertEntry(entry interfaces.IEBEntry) error {
 	batch := []interfaces.Record{}
 	batch = append(batch, interfaces.Record{entry.GetChainID().Bytes(), entry.DatabasePrimaryIndex().Bytes(), entry})
 	batch = append(batch, interfaces.Record{ENTRY, entry.DatabasePrimaryIndex().Bytes(), entry.GetChainIDHash()})
+	if db.ExtIDIndex {
+		batch = append(batch, extIDIndexRecords(entry)...)
+	}
 
 	err := db.PutInBatch(batch)
 	if err != nil {
@@ -42,6 +45,9 @@ func (db *Overlay) InsertEntryMultiBatch(entry interfaces.IEBEntry) error {
 	batch := []interfaces.Record{}
 	batch = append(batch, interfaces.Record{entry.GetChainID().Bytes(), entry.DatabasePrimaryIndex().Bytes(), entry})
 	batch = append(batch, interfaces.Record{ENTRY, entry.DatabasePrimaryIndex().Bytes(), entry.GetChainIDHash()})
+	if db.ExtIDIndex {
+		batch = append(batch, extIDIndexRecords(entry)...)
+	}
 
 	db.PutInMultiBatch(batch)
 	if entry.GetChainID().String() == AnchorBlockID {
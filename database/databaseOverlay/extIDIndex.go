@@ -0,0 +1,298 @@
+package databaseOverlay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// The ExtID index maps every ExtID of every entry to the entry.  Each ExtID
+// is stored under the key
+//
+//   ExtID + ChainID + EntryHash + length of the ExtID (2 bytes, big endian)
+//
+// so keys sort by ExtID, and the chain and entry can be read back from the end
+// of the key without confusing an ExtID with another one it is a prefix of.
+// A search walks the keys starting with the prefix it looks for, a page at a
+// time.
+//
+// Entries are indexed as they are saved while the index is enabled.  The next
+// directory block height to index is kept as well, and only moves on as
+// directory blocks are saved with the index enabled, so a backfill from it
+// picks up any entries saved while the index was disabled.
+
+// Key under EXTID_INDEX_STATE of the next directory block height to index
+var extIDIndexHeightKey = []byte("NextHeight")
+
+type ExtIDMatch struct {
+	ChainID   interfaces.IHash
+	EntryHash interfaces.IHash
+}
+
+func (db *Overlay) SetExtIDIndex() {
+	db.ExtIDIndex = true
+}
+
+func extIDIndexKey(extID []byte, chainID, entryHash interfaces.IHash) []byte {
+	key := make([]byte, 0, len(extID)+66)
+	key = append(key, extID...)
+	key = append(key, chainID.Bytes()...)
+	key = append(key, entryHash.Bytes()...)
+	l := make([]byte, 2)
+	binary.BigEndian.PutUint16(l, uint16(len(extID)))
+	return append(key, l...)
+}
+
+// parseExtIDIndexKey returns the ExtID, ChainID and EntryHash of a key, or
+// an error if the key isn't one.
+func parseExtIDIndexKey(key []byte) ([]byte, []byte, []byte, error) {
+	if len(key) < 66 {
+		return nil, nil, nil, fmt.Errorf("ExtID index key too short - %x", key)
+	}
+	l := int(binary.BigEndian.Uint16(key[len(key)-2:]))
+	if l != len(key)-66 {
+		return nil, nil, nil, fmt.Errorf("Bad ExtID length in ExtID index key - %x", key)
+	}
+	return key[:l], key[l : l+32], key[l+32 : l+64], nil
+}
+
+func extIDIndexRecords(entry interfaces.IEBEntry) []interfaces.Record {
+	var records []interfaces.Record
+	seen := map[string]bool{}
+	for _, extID := range entry.ExternalIDs() {
+		// ExtIDs are limited by the entry size, but make sure the length fits
+		if len(extID) > 0xFFFF || seen[string(extID)] {
+			continue
+		}
+		seen[string(extID)] = true
+		key := extIDIndexKey(extID, entry.GetChainID(), entry.GetHash())
+		records = append(records, interfaces.Record{EXTID_INDEX, key, entry.GetHash()})
+	}
+	return records
+}
+
+// MinExtIDSearchPrefix is the shortest prefix SearchEntriesByExtID takes, as
+// a shorter one matches most of the index
+const MinExtIDSearchPrefix = 4
+
+// Most index keys one SearchEntriesByExtID looks through, so a search that
+// finds little, such as one limited to a chain, stays cheap.  The cursor it
+// returns carries on from where it stopped.
+const maxExtIDSearchKeys = 10000
+
+// Directory blocks BackfillExtIDIndex indexes before it writes what it has
+// found and lets other batches in
+const extIDIndexBackfillBatch = 1000
+
+// SearchEntriesByExtID returns up to limit entries with an ExtID starting with
+// the prefix, in ExtID order.  If chainID isn't nil, only entries of that chain
+// are returned.  The search carries on after the index key cursor, or starts
+// at the beginning if it is nil, and returns the cursor to carry on from, which
+// is nil once there is nothing left to look through.  An entry is returned
+// once, under the first of its ExtIDs with the prefix.
+func (db *Overlay) SearchEntriesByExtID(prefix []byte, chainID interfaces.IHash, cursor []byte, limit uint32) ([]*ExtIDMatch, []byte, error) {
+	if !db.ExtIDIndex {
+		return nil, nil, fmt.Errorf("The ExtID index is not enabled")
+	}
+	if len(prefix) < MinExtIDSearchPrefix {
+		return nil, nil, fmt.Errorf("The ExtID prefix must be at least %d bytes", MinExtIDSearchPrefix)
+	}
+	if cursor != nil && !bytes.HasPrefix(cursor, prefix) {
+		return nil, nil, fmt.Errorf("The cursor is not from a search for this prefix")
+	}
+
+	answer := []*ExtIDMatch{}
+	scanned := 0
+	for uint32(len(answer)) < limit && scanned < maxExtIDSearchKeys {
+		var start []byte
+		if cursor != nil {
+			// The first key after the cursor
+			start = append(append([]byte{}, cursor...), 0)
+		}
+
+		// The index is read first, then the entries, as the database can't
+		// be used while iterating
+		candidates := [][]byte{}
+		more := false
+		var perr error
+		err := db.IterateKeysWithPrefix(EXTID_INDEX, prefix, start, func(key []byte) bool {
+			if uint32(len(answer)+len(candidates)) >= limit || scanned >= maxExtIDSearchKeys {
+				more = true
+				return false
+			}
+			scanned++
+			cursor = append([]byte{}, key...)
+			extID, chain, _, err := parseExtIDIndexKey(key)
+			if err != nil {
+				perr = err
+				return false
+			}
+			if !bytes.HasPrefix(extID, prefix) {
+				return true
+			}
+			if chainID != nil && !bytes.Equal(chain, chainID.Bytes()) {
+				return true
+			}
+			candidates = append(candidates, cursor)
+			return true
+		})
+		if err == nil {
+			err = perr
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, key := range candidates {
+			extID, chain, entryHash, _ := parseExtIDIndexKey(key)
+			first, err := db.isFirstExtIDMatch(entryHash, extID, prefix)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !first {
+				continue
+			}
+			m := new(ExtIDMatch)
+			m.ChainID = primitives.NewHash(chain)
+			m.EntryHash = primitives.NewHash(entryHash)
+			answer = append(answer, m)
+		}
+
+		if !more {
+			return answer, nil, nil
+		}
+	}
+	return answer, cursor, nil
+}
+
+// isFirstExtIDMatch returns whether extID is the first of the ExtIDs of the
+// entry starting with the prefix, which is the one the entry is listed under.
+func (db *Overlay) isFirstExtIDMatch(entryHash, extID, prefix []byte) (bool, error) {
+	entry, err := db.FetchEntry(primitives.NewHash(entryHash))
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return true, nil
+	}
+	for _, e := range entry.ExternalIDs() {
+		if bytes.HasPrefix(e, prefix) && bytes.Compare(e, extID) < 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// BackfillExtIDIndex indexes the entries of the directory blocks the ExtID
+// index hasn't seen yet, from the next height to index up to the top of the
+// chain.  It works in batches, so it can run alongside blocks being saved.
+func (db *Overlay) BackfillExtIDIndex() error {
+	if !db.ExtIDIndex {
+		return nil
+	}
+	for {
+		done, err := db.backfillExtIDIndexBatch()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// backfillExtIDIndexBatch indexes the next extIDIndexBackfillBatch heights,
+// and returns true once it runs out of blocks.  It holds the batch semaphore
+// so no multibatch moves the next height to index while it does.
+func (db *Overlay) backfillExtIDIndexBatch() (done bool, err error) {
+	db.BatchSemaphore.Lock()
+	defer db.BatchSemaphore.Unlock()
+	db.extIDIndexMutex.Lock()
+	defer db.extIDIndexMutex.Unlock()
+
+	next, err := db.fetchExtIDIndexHeight()
+	if err != nil {
+		return false, err
+	}
+
+	var records []interfaces.Record
+	h := next
+	for ; h < next+extIDIndexBackfillBatch; h++ {
+		dblock, err := db.FetchDBlockByHeight(h)
+		if err != nil {
+			return false, err
+		}
+		if dblock == nil {
+			done = true
+			break
+		}
+		for _, dbEntry := range dblock.GetEBlockDBEntries() {
+			eblock, err := db.FetchEBlock(dbEntry.GetKeyMR())
+			if err != nil {
+				return false, err
+			}
+			if eblock == nil {
+				continue
+			}
+			for _, hash := range eblock.GetEntryHashes() {
+				entry, err := db.FetchEntry(hash)
+				if err != nil {
+					return false, err
+				}
+				// Minute markers, and entries not synced yet, which are
+				// indexed when they are saved
+				if entry == nil {
+					continue
+				}
+				records = append(records, extIDIndexRecords(entry)...)
+			}
+		}
+	}
+	records = append(records, extIDIndexHeightRecord(h))
+	return done, db.PutInBatch(records)
+}
+
+// extIDIndexHeightRecords returns the record moving the next height to index
+// past the directory block, if the index is enabled and up to it.
+func (db *Overlay) extIDIndexHeightRecords(dblock interfaces.DatabaseBatchable) ([]interfaces.Record, error) {
+	if !db.ExtIDIndex {
+		return nil, nil
+	}
+	next, err := db.fetchExtIDIndexHeight()
+	if err != nil {
+		return nil, err
+	}
+	height := dblock.GetDatabaseHeight()
+	if height != next {
+		return nil, nil
+	}
+	return []interfaces.Record{extIDIndexHeightRecord(height + 1)}, nil
+}
+
+func (db *Overlay) saveExtIDIndexHeight(dblock interfaces.DatabaseBatchable) error {
+	db.extIDIndexMutex.Lock()
+	defer db.extIDIndexMutex.Unlock()
+
+	records, err := db.extIDIndexHeightRecords(dblock)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	return db.PutInBatch(records)
+}
+
+func (db *Overlay) fetchExtIDIndexHeight() (uint32, error) {
+	n := new(addressIndexNumber)
+	loaded, err := db.Get(EXTID_INDEX_STATE, extIDIndexHeightKey, n)
+	if err != nil {
+		return 0, err
+	}
+	if loaded == nil {
+		return 0, nil
+	}
+	return uint32(*n), nil
+}
+
+func extIDIndexHeightRecord(next uint32) interfaces.Record {
+	n := addressIndexNumber(next)
+	return interfaces.Record{Bucket: EXTID_INDEX_STATE, Key: extIDIndexHeightKey, Data: &n}
+}
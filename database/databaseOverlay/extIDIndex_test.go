@@ -0,0 +1,165 @@
+package databaseOverlay_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/database/databaseOverlay"
+	. "github.com/FactomProject/factomd/testHelper"
+)
+
+// expectedExtIDMatches reads every entry of the database and returns the
+// hashes of those with an ExtID starting with the prefix.
+func expectedExtIDMatches(t *testing.T, dbo *databaseOverlay.Overlay, prefix []byte, chainID interfaces.IHash) map[string]bool {
+	keys, err := dbo.ListAllKeys(databaseOverlay.ENTRY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer := map[string]bool{}
+	for _, k := range keys {
+		entry, err := dbo.FetchEntry(primitives.NewHash(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chainID != nil && !entry.GetChainID().IsSameAs(chainID) {
+			continue
+		}
+		for _, extID := range entry.ExternalIDs() {
+			if bytes.HasPrefix(extID, prefix) {
+				answer[entry.GetHash().String()] = true
+			}
+		}
+	}
+	return answer
+}
+
+func checkExtIDSearch(t *testing.T, dbo *databaseOverlay.Overlay, prefix []byte, chainID interfaces.IHash) {
+	// A page of one splits the ExtIDs of an entry over pages
+	for _, pageSize := range []uint32{1, 3} {
+		checkExtIDSearchPages(t, dbo, prefix, chainID, pageSize)
+	}
+}
+
+func checkExtIDSearchPages(t *testing.T, dbo *databaseOverlay.Overlay, prefix []byte, chainID interfaces.IHash, pageSize uint32) {
+	expected := expectedExtIDMatches(t, dbo, prefix, chainID)
+
+	found := map[string]bool{}
+	var cursor []byte
+	for {
+		matches, next, err := dbo.SearchEntriesByExtID(prefix, chainID, cursor, pageSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) > int(pageSize) {
+			t.Errorf("Too many entries in a page for %q - %v", prefix, len(matches))
+		}
+		for _, m := range matches {
+			if found[m.EntryHash.String()] {
+				t.Errorf("Entry %v returned twice", m.EntryHash.String())
+			}
+			found[m.EntryHash.String()] = true
+			if chainID != nil && !m.ChainID.IsSameAs(chainID) {
+				t.Errorf("Entry %v from the wrong chain", m.EntryHash.String())
+			}
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	if len(found) != len(expected) {
+		t.Errorf("Wrong number of entries for %q - %v vs %v", prefix, len(found), len(expected))
+	}
+	for h := range expected {
+		if !found[h] {
+			t.Errorf("Entry %v not found for %q", h, prefix)
+		}
+	}
+}
+
+func TestExtIDIndex(t *testing.T) {
+	dbo := CreateEmptyTestDatabaseOverlay()
+	dbo.SetExtIDIndex()
+	PopulateTestDatabaseOverlay(dbo)
+
+	if len(expectedExtIDMatches(t, dbo, []byte("ExtID"), nil)) < 4 {
+		t.Fatal("Not enough matching entries in the test blocks")
+	}
+	checkExtIDSearch(t, dbo, []byte("ExtID"), nil)
+	checkExtIDSearch(t, dbo, []byte("ExtID 1"), nil)
+	checkExtIDSearch(t, dbo, []byte("Test"), nil)
+	checkExtIDSearch(t, dbo, []byte("ExtID"), GetChainID())
+	checkExtIDSearch(t, dbo, []byte("ExtID"), GetAnchorChainID())
+	checkExtIDSearch(t, dbo, []byte("Nothing"), nil)
+
+	// Short prefixes match too much
+	_, _, err := dbo.SearchEntriesByExtID([]byte("Ext"), nil, nil, 10)
+	if err == nil {
+		t.Error("Searched with a prefix shorter than the minimum")
+	}
+	// A cursor has to be from the same search
+	_, _, err = dbo.SearchEntriesByExtID([]byte("ExtID"), nil, []byte("Test"), 10)
+	if err == nil {
+		t.Error("Searched with a cursor for another prefix")
+	}
+}
+
+func TestExtIDIndexBackfill(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+
+	_, _, err := dbo.SearchEntriesByExtID([]byte("ExtID"), nil, nil, 10)
+	if err == nil {
+		t.Error("Searched by ExtID with the index disabled")
+	}
+
+	dbo.SetExtIDIndex()
+	err = dbo.BackfillExtIDIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExtIDSearch(t, dbo, []byte("ExtID"), nil)
+
+	err = dbo.BackfillExtIDIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExtIDSearch(t, dbo, []byte("ExtID 2"), nil)
+}
+
+func TestExtIDIndexBackfillAfterDisabled(t *testing.T) {
+	dbo := CreateEmptyTestDatabaseOverlay()
+	MakeSureAnchorValidationKeyIsPresent()
+
+	// The first half of the blocks are saved with the index enabled, the rest
+	// with it disabled
+	sets := CreateFullTestBlockSet()
+	for i, set := range sets {
+		dbo.ExtIDIndex = i < len(sets)/2
+		dbo.StartMultiBatch()
+		for _, eblock := range []interfaces.DatabaseBlockWithEntries{set.EBlock, set.AnchorEBlock} {
+			if err := dbo.ProcessEBlockMultiBatch(eblock, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := dbo.ProcessDBlockMultiBatch(set.DBlock); err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range set.Entries {
+			if err := dbo.InsertEntryMultiBatch(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := dbo.ExecuteMultiBatch(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbo.SetExtIDIndex()
+	err := dbo.BackfillExtIDIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExtIDSearch(t, dbo, []byte("ExtID"), nil)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/FactomProject/factomd/common/constants"
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/database"
 	"github.com/FactomProject/factomd/database/blockExtractor"
 )
 
@@ -64,8 +65,24 @@ var (
 	//IncludedIn
 	INCLUDED_IN = []byte("IncludedIn")
 
+	//Anchor chain entry anchoring a directory block, by its KeyMR
+	ANCHOR_ENTRY       = []byte("AnchorEntry")
+	ANCHOR_ENTRY_STATE = []byte("AnchorEntryState")
+
 	//Which EC transaction paid for this Entry
 	PAID_FOR = []byte("PaidFor")
+
+	//Address index
+	ADDRESS_TRANSACTIONS      = []byte("AddressTransactions")
+	ADDRESS_TRANSACTION_COUNT = []byte("AddressTransactionCount")
+	ADDRESS_INDEX_HEIGHT      = []byte("AddressIndexHeight")
+
+	//Balances at past heights
+	BALANCE_CHECKPOINT = []byte("BalanceCheckpoint")
+
+	//ExtID index
+	EXTID_INDEX       = []byte("ExtIDIndex")
+	EXTID_INDEX_STATE = []byte("ExtIDIndexState")
 )
 
 var ConstantNamesMap map[string]string
@@ -103,8 +120,20 @@ func init() {
 
 	ConstantNamesMap[string(INCLUDED_IN)] = "IncludedIn"
 
+	ConstantNamesMap[string(ANCHOR_ENTRY)] = "AnchorEntry"
+	ConstantNamesMap[string(ANCHOR_ENTRY_STATE)] = "AnchorEntryState"
+
 	ConstantNamesMap[string(PAID_FOR)] = "PaidFor"
 
+	ConstantNamesMap[string(ADDRESS_TRANSACTIONS)] = "AddressTransactions"
+	ConstantNamesMap[string(ADDRESS_TRANSACTION_COUNT)] = "AddressTransactionCount"
+	ConstantNamesMap[string(ADDRESS_INDEX_HEIGHT)] = "AddressIndexHeight"
+
+	ConstantNamesMap[string(BALANCE_CHECKPOINT)] = "BalanceCheckpoint"
+
+	ConstantNamesMap[string(EXTID_INDEX)] = "ExtIDIndex"
+	ConstantNamesMap[string(EXTID_INDEX_STATE)] = "ExtIDIndexState"
+
 	RegisterPrometheus()
 }
 
@@ -114,12 +143,27 @@ type Overlay struct {
 	ExportData     bool
 	ExportDataPath string
 
+	// Index the transactions of every FCT and EC address
+	AddressIndex bool
+	// Serializes the writers of the address index
+	addressIndexMutex sync.Mutex
+	// Set while BackfillAddressIndex runs, so saving a block doesn't try to
+	// catch the index up itself
+	addressIndexBackfilling bool
+	// Address index counts and heights put in the multibatch, by bucket and key
+	pendingAddressNumbers map[string]uint32
+	// Index the ExtIDs of every entry
+	ExtIDIndex bool
+	// Serializes the writers of the next height the ExtID index is up to
+	extIDIndexMutex sync.Mutex
+
 	BatchSemaphore sync.Mutex
 	MultiBatch     []interfaces.Record
 	BlockExtractor blockExtractor.BlockExtractor
 }
 
 var _ interfaces.IDatabase = (*Overlay)(nil)
+var _ interfaces.IIterableDatabase = (*Overlay)(nil)
 var _ interfaces.DBOverlay = (*Overlay)(nil)
 
 func (db *Overlay) ListAllBuckets() ([][]byte, error) {
@@ -135,6 +179,7 @@ func (db *Overlay) SetExportData(path string) {
 func (db *Overlay) StartMultiBatch() {
 	db.BatchSemaphore.Lock()
 	db.MultiBatch = make([]interfaces.Record, 0, 128)
+	db.pendingAddressNumbers = map[string]uint32{}
 }
 
 func (db *Overlay) PutInMultiBatch(records []interfaces.Record) {
@@ -144,6 +189,7 @@ func (db *Overlay) PutInMultiBatch(records []interfaces.Record) {
 func (db *Overlay) ExecuteMultiBatch() error {
 	defer func() {
 		db.MultiBatch = nil
+		db.pendingAddressNumbers = nil
 		db.BatchSemaphore.Unlock()
 	}()
 	return db.PutInBatch(db.MultiBatch)
@@ -161,6 +207,14 @@ func (db *Overlay) ListAllKeys(bucket []byte) ([][]byte, error) {
 	return db.DB.ListAllKeys(bucket)
 }
 
+func (db *Overlay) ListKeysWithPrefix(bucket, prefix []byte) ([][]byte, error) {
+	return db.DB.ListKeysWithPrefix(bucket, prefix)
+}
+
+func (db *Overlay) IterateKeysWithPrefix(bucket, prefix, start []byte, f func(key []byte) bool) error {
+	return database.IterateKeysWithPrefix(db.DB, bucket, prefix, start, f)
+}
+
 func (db *Overlay) GetAll(bucket []byte, sample interfaces.BinaryMarshallableAndCopyable) ([]interfaces.BinaryMarshallableAndCopyable, [][]byte, error) {
 	return db.DB.GetAll(bucket, sample)
 }
@@ -0,0 +1,77 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// An Engine is a storage engine a database can be kept in.  Engines register
+// themselves by name, the name used for DBType in the config file and for the
+// -db flag, from the init function of their package.
+type Engine struct {
+	// FileName is the file or directory the engine keeps a database in, under
+	// the database directory of the network.  It is empty for engines that
+	// keep nothing on disk.
+	FileName string
+	// Open opens the database at path, creating it if it doesn't exist.  The
+	// path is empty for engines that keep nothing on disk.
+	Open func(path string) (interfaces.IDatabase, error)
+}
+
+var enginesMutex sync.RWMutex
+var engines = map[string]Engine{}
+
+// RegisterEngine makes a storage engine available by name.  It panics if an
+// engine is registered twice under the same name.
+func RegisterEngine(name string, engine Engine) {
+	enginesMutex.Lock()
+	defer enginesMutex.Unlock()
+
+	if engine.Open == nil {
+		panic(fmt.Sprintf("Database engine %s has no Open function", name))
+	}
+	if _, ok := engines[name]; ok {
+		panic(fmt.Sprintf("Database engine %s registered twice", name))
+	}
+	engines[name] = engine
+}
+
+// GetEngine returns the storage engine registered under a name
+func GetEngine(name string) (Engine, bool) {
+	enginesMutex.RLock()
+	defer enginesMutex.RUnlock()
+
+	engine, ok := engines[name]
+	return engine, ok
+}
+
+// EngineNames returns the names of the registered storage engines, sorted
+func EngineNames() []string {
+	enginesMutex.RLock()
+	defer enginesMutex.RUnlock()
+
+	names := []string{}
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenEngine opens a database at path with the storage engine registered
+// under a name
+func OpenEngine(name string, path string) (interfaces.IDatabase, error) {
+	engine, ok := GetEngine(name)
+	if ok == false {
+		return nil, fmt.Errorf("%s is not a valid database type.  Expect one of %s", name, strings.Join(EngineNames(), ", "))
+	}
+	return engine.Open(path)
+}
@@ -4,7 +4,7 @@ import (
 	"sync"
 
 	"github.com/FactomProject/factomd/common/interfaces"
-
+	"github.com/FactomProject/factomd/database"
 	"github.com/FactomProject/factomd/database/boltdb"
 	"github.com/FactomProject/factomd/database/leveldb"
 	"github.com/FactomProject/factomd/database/mapdb"
@@ -17,6 +17,7 @@ type HybridDB struct {
 }
 
 var _ interfaces.IDatabase = (*HybridDB)(nil)
+var _ interfaces.IIterableDatabase = (*HybridDB)(nil)
 
 func (db *HybridDB) ListAllBuckets() ([][]byte, error) {
 	db.Sem.RLock()
@@ -151,6 +152,20 @@ func (db *HybridDB) ListAllKeys(bucket []byte) ([][]byte, error) {
 	return db.persistentStorage.ListAllKeys(bucket)
 }
 
+func (db *HybridDB) ListKeysWithPrefix(bucket, prefix []byte) ([][]byte, error) {
+	db.Sem.RLock()
+	defer db.Sem.RUnlock()
+
+	return db.persistentStorage.ListKeysWithPrefix(bucket, prefix)
+}
+
+func (db *HybridDB) IterateKeysWithPrefix(bucket, prefix, start []byte, f func(key []byte) bool) error {
+	db.Sem.RLock()
+	defer db.Sem.RUnlock()
+
+	return database.IterateKeysWithPrefix(db.persistentStorage, bucket, prefix, start, f)
+}
+
 func (db *HybridDB) GetAll(bucket []byte, sample interfaces.BinaryMarshallableAndCopyable) ([]interfaces.BinaryMarshallableAndCopyable, [][]byte, error) {
 	db.Sem.RLock()
 	defer db.Sem.RUnlock()
@@ -0,0 +1,34 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"bytes"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// IterateKeysWithPrefix calls f with the keys of the bucket that start with
+// prefix, from start on, in order, until f returns false.  Databases that can
+// iterate walk the keys as they go; the keys of any other database are listed
+// first.
+func IterateKeysWithPrefix(db interfaces.IDatabase, bucket, prefix, start []byte, f func(key []byte) bool) error {
+	if it, ok := db.(interfaces.IIterableDatabase); ok {
+		return it.IterateKeysWithPrefix(bucket, prefix, start, f)
+	}
+	keys, err := db.ListKeysWithPrefix(bucket, prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if bytes.Compare(key, start) < 0 {
+			continue
+		}
+		if f(key) == false {
+			break
+		}
+	}
+	return nil
+}
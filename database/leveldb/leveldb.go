@@ -5,12 +5,14 @@
 package leveldb
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"strings"
 	"sync"
 
 	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/database"
 	"github.com/FactomProject/goleveldb/leveldb"
 	"github.com/FactomProject/goleveldb/leveldb/opt"
 	"github.com/FactomProject/goleveldb/leveldb/util"
@@ -27,6 +29,20 @@ type LevelDB struct {
 }
 
 var _ interfaces.IDatabase = (*LevelDB)(nil)
+var _ interfaces.IIterableDatabase = (*LevelDB)(nil)
+
+func init() {
+	database.RegisterEngine("LDB", database.Engine{
+		FileName: "factoid_level.db",
+		Open: func(path string) (interfaces.IDatabase, error) {
+			db, err := NewLevelDB(path, false)
+			if err != nil || db == nil {
+				return NewLevelDB(path, true)
+			}
+			return db, nil
+		},
+	})
+}
 
 func (db *LevelDB) ListAllBuckets() ([][]byte, error) {
 	//TODO: fix Level to solve this issue
@@ -220,6 +236,52 @@ func (db *LevelDB) ListAllKeys(bucket []byte) (keys [][]byte, err error) {
 	return answer, nil
 }
 
+// ListKeysWithPrefix returns the keys of the bucket that start with prefix, in
+// order, seeking to the first rather than reading the whole bucket.
+func (db *LevelDB) ListKeysWithPrefix(bucket, prefix []byte) ([][]byte, error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	ldbKey := ExtendBucket(append([]byte{}, bucket...))
+	iter := db.lDB.NewIterator(util.BytesPrefix(append(ldbKey, prefix...)), db.ro)
+
+	answer := [][]byte{}
+	for iter.Next() {
+		key := iter.Key()
+		tmp := make([]byte, len(key[len(ldbKey):]))
+		copy(tmp, key[len(ldbKey):])
+		answer = append(answer, tmp)
+	}
+	iter.Release()
+	err := iter.Error()
+	if err != nil {
+		return nil, err
+	}
+
+	return answer, nil
+}
+
+// IterateKeysWithPrefix calls f with the keys of the bucket that start with
+// prefix, from start on, in order, until f returns false
+func (db *LevelDB) IterateKeysWithPrefix(bucket, prefix, start []byte, f func(key []byte) bool) error {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	ldbKey := ExtendBucket(append([]byte{}, bucket...))
+	r := util.BytesPrefix(append(append([]byte{}, ldbKey...), prefix...))
+	if bytes.Compare(start, prefix) > 0 {
+		r.Start = append(append([]byte{}, ldbKey...), start...)
+	}
+	iter := db.lDB.NewIterator(r, db.ro)
+	for iter.Next() {
+		if f(iter.Key()[len(ldbKey):]) == false {
+			break
+		}
+	}
+	iter.Release()
+	return iter.Error()
+}
+
 func (db *LevelDB) GetAll(bucket []byte, sample interfaces.BinaryMarshallableAndCopyable) ([]interfaces.BinaryMarshallableAndCopyable, [][]byte, error) {
 	db.dbLock.RLock()
 	defer db.dbLock.RUnlock()
@@ -0,0 +1,94 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package lsmdb
+
+import (
+	"bytes"
+)
+
+// source is a sorted run of entries, the memTable or a table
+type source interface {
+	valid() bool
+	key() []byte
+	value() []byte
+	deleted() bool
+	next()
+	seek(key []byte)
+	error() error
+}
+
+// mergeIterator merges sources, newest first, into one sorted run.  Where
+// sources hold the same key, the newest wins.  Tombstones are skipped unless
+// keepDeleted is set, which merging tables that aren't the oldest needs, as
+// the keys may still be in older tables.
+type mergeIterator struct {
+	sources     []source
+	cur         source
+	keepDeleted bool
+}
+
+func newMergeIterator(sources []source, keepDeleted bool) *mergeIterator {
+	m := &mergeIterator{sources: sources, keepDeleted: keepDeleted}
+	m.findNext()
+	return m
+}
+
+func (m *mergeIterator) valid() bool   { return m.cur != nil }
+func (m *mergeIterator) key() []byte   { return m.cur.key() }
+func (m *mergeIterator) value() []byte { return m.cur.value() }
+func (m *mergeIterator) deleted() bool { return m.cur.deleted() }
+
+func (m *mergeIterator) error() error {
+	for _, s := range m.sources {
+		if err := s.error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mergeIterator) next() {
+	m.skip()
+	m.findNext()
+}
+
+func (m *mergeIterator) seek(key []byte) {
+	for _, s := range m.sources {
+		s.seek(key)
+	}
+	m.findNext()
+}
+
+// findNext makes the source with the smallest key current, skipping deleted
+// keys
+func (m *mergeIterator) findNext() {
+	for {
+		m.cur = nil
+		for _, s := range m.sources {
+			if s.valid() == false {
+				continue
+			}
+			// Only a smaller key replaces cur, so the newest source wins ties
+			if m.cur == nil || bytes.Compare(s.key(), m.cur.key()) < 0 {
+				m.cur = s
+			}
+		}
+		if m.cur == nil || m.keepDeleted || m.cur.deleted() == false {
+			return
+		}
+		m.skip()
+	}
+}
+
+// skip moves every source past the current key
+func (m *mergeIterator) skip() {
+	key := m.cur.key()
+	for _, s := range m.sources {
+		if s != m.cur && s.valid() && bytes.Equal(s.key(), key) {
+			s.next()
+		}
+	}
+	m.cur.next()
+}
@@ -0,0 +1,554 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package lsmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/database"
+)
+
+// LSMDB is a log-structured merge tree database in pure Go, in the style of
+// Badger or Pebble.  Writes go to a write-ahead log and a memTable sorted by
+// key.  Once the memTable holds MemTableSize bytes it is written out as an
+// immutable table, and once there are more than MaxTables tables the newest
+// are merged into one.  Nothing is updated in place: reads merge the memTable
+// and the tables, newest first, and deletes are tombstones until a merge
+// reaches the oldest table.
+//
+// Keys are the bucket, preceded by its length, followed by the key, so the keys
+// of a bucket are together and in order.  Reads of a bucket seek to it and
+// then stream the entries from the tables through a small buffer, so
+// IterateKeysWithPrefix never holds more than the memTable in memory.
+// ListAllKeys, ListKeysWithPrefix and GetAll walk the bucket the same way, but
+// return what they find as slices, as IDatabase requires, so their answer is
+// all in memory.  Callers walking a big bucket should iterate instead.
+type LSMDB struct {
+	// MemTableSize is how big the memTable gets before it is written out
+	MemTableSize int
+	// MaxTables is how many tables there can be before they are merged
+	MaxTables int
+
+	dbLock  sync.RWMutex
+	dir     string
+	mem     *memTable
+	log     *wal
+	tables  []*table // Oldest first
+	nextNum uint64
+	closed  bool
+}
+
+var _ interfaces.IDatabase = (*LSMDB)(nil)
+var _ interfaces.IIterableDatabase = (*LSMDB)(nil)
+
+const logName = "LOG"
+
+func init() {
+	database.RegisterEngine("LSM", database.Engine{
+		FileName: "factoid_lsm.db",
+		Open: func(path string) (interfaces.IDatabase, error) {
+			return NewLSMDB(path)
+		},
+	})
+}
+
+// NewLSMDB opens the database in the directory dir, creating it if needed
+func NewLSMDB(dir string) (*LSMDB, error) {
+	err := os.MkdirAll(dir, 0750)
+	if err != nil {
+		return nil, err
+	}
+
+	db := new(LSMDB)
+	db.MemTableSize = 4 << 20
+	db.MaxTables = 8
+	db.dir = dir
+	db.mem = newMemTable()
+	db.nextNum = 1
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		name := file.Name()
+		path := filepath.Join(dir, name)
+		if strings.HasSuffix(name, ".tmp") {
+			os.Remove(path)
+			continue
+		}
+		if !strings.HasSuffix(name, ".sst") {
+			continue
+		}
+		num, err := strconv.ParseUint(strings.TrimSuffix(name, ".sst"), 10, 64)
+		if err != nil {
+			continue
+		}
+		t, err := openTable(path, num)
+		if err != nil {
+			db.closeTables()
+			return nil, err
+		}
+		db.tables = append(db.tables, t)
+		if num >= db.nextNum {
+			db.nextNum = num + 1
+		}
+	}
+	sort.Sort(byNum(db.tables))
+	db.dropReplacedTables()
+
+	db.log, err = openWAL(filepath.Join(dir, logName), db.mem)
+	if err != nil {
+		db.closeTables()
+		return nil, err
+	}
+	return db, nil
+}
+
+// dropReplacedTables removes the tables a merge replaced, if it didn't get to
+// remove them itself
+func (db *LSMDB) dropReplacedTables() {
+	keep := []*table{}
+	for _, t := range db.tables {
+		replaced := false
+		for _, u := range db.tables {
+			if u != t && t.num >= u.replaces && t.num < u.num {
+				replaced = true
+			}
+		}
+		if replaced {
+			t.close()
+			os.Remove(t.path)
+			continue
+		}
+		keep = append(keep, t)
+	}
+	db.tables = keep
+}
+
+func (db *LSMDB) closeTables() {
+	for _, t := range db.tables {
+		t.close()
+	}
+}
+
+/***************************************
+ *       Methods
+ ***************************************/
+
+func (db *LSMDB) Put(bucket []byte, key []byte, data interfaces.BinaryMarshallable) error {
+	value, err := data.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	return db.write([]op{{key: dbKey(bucket, key), value: value}})
+}
+
+func (db *LSMDB) PutInBatch(records []interfaces.Record) error {
+	ops := []op{}
+	for _, v := range records {
+		value, err := v.Data.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		ops = append(ops, op{key: dbKey(v.Bucket, v.Key), value: value})
+	}
+
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	return db.write(ops)
+}
+
+func (db *LSMDB) Delete(bucket []byte, key []byte) error {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	return db.write([]op{{key: dbKey(bucket, key), deleted: true}})
+}
+
+func (db *LSMDB) Clear(bucket []byte) error {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	if db.closed {
+		return fmt.Errorf("Database is closed")
+	}
+	ops := []op{}
+	err := db.iterate(bucketPrefix(bucket), nil, func(key, value []byte) bool {
+		ops = append(ops, op{key: append([]byte{}, key...), deleted: true})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	return db.write(ops)
+}
+
+func (db *LSMDB) Get(bucket []byte, key []byte, destination interfaces.BinaryMarshallable) (interfaces.BinaryMarshallable, error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	value, found, err := db.get(dbKey(bucket, key))
+	if err != nil || found == false {
+		return nil, err
+	}
+	_, err = destination.UnmarshalBinaryData(value)
+	if err != nil {
+		return nil, err
+	}
+	return destination, nil
+}
+
+func (db *LSMDB) DoesKeyExist(bucket, key []byte) (bool, error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	_, found, err := db.get(dbKey(bucket, key))
+	return found, err
+}
+
+func (db *LSMDB) ListAllKeys(bucket []byte) ([][]byte, error) {
+	return db.ListKeysWithPrefix(bucket, nil)
+}
+
+// ListKeysWithPrefix returns the keys of the bucket that start with prefix, in
+// order, seeking to the first rather than reading the whole bucket.
+func (db *LSMDB) ListKeysWithPrefix(bucket, prefix []byte) ([][]byte, error) {
+	keys := [][]byte{}
+	err := db.IterateKeysWithPrefix(bucket, prefix, nil, func(key []byte) bool {
+		keys = append(keys, append([]byte{}, key...))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// IterateKeysWithPrefix calls f with the keys of the bucket that start with
+// prefix, from start on, in order, until f returns false.  Writes wait until
+// it is done.
+func (db *LSMDB) IterateKeysWithPrefix(bucket, prefix, start []byte, f func(key []byte) bool) error {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	bp := bucketPrefix(bucket)
+	p := append(append([]byte{}, bp...), prefix...)
+	var from []byte
+	if bytes.Compare(start, prefix) > 0 {
+		from = append(append([]byte{}, bp...), start...)
+	}
+	return db.iterate(p, from, func(key, value []byte) bool {
+		return f(key[len(bp):])
+	})
+}
+
+func (db *LSMDB) GetAll(bucket []byte, sample interfaces.BinaryMarshallableAndCopyable) ([]interfaces.BinaryMarshallableAndCopyable, [][]byte, error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	prefix := bucketPrefix(bucket)
+	answer := []interfaces.BinaryMarshallableAndCopyable{}
+	keys := [][]byte{}
+	var uerr error
+	err := db.iterate(prefix, nil, func(key, value []byte) bool {
+		tmp := sample.New()
+		uerr = tmp.UnmarshalBinary(append([]byte{}, value...))
+		if uerr != nil {
+			return false
+		}
+		answer = append(answer, tmp)
+		keys = append(keys, append([]byte{}, key[len(prefix):]...))
+		return true
+	})
+	if err == nil {
+		err = uerr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return answer, keys, nil
+}
+
+func (db *LSMDB) ListAllBuckets() ([][]byte, error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	if db.closed {
+		return nil, fmt.Errorf("Database is closed")
+	}
+	buckets := [][]byte{}
+	it := db.iterator()
+	for it.seek(nil); it.valid(); {
+		length, n := binary.Uvarint(it.key())
+		if n <= 0 || uint64(len(it.key())-n) < length {
+			return nil, fmt.Errorf("Bad key %x", it.key())
+		}
+		prefix := it.key()[:n+int(length)]
+		buckets = append(buckets, append([]byte{}, prefix[n:]...))
+		// Skip the rest of the bucket
+		end := prefixEnd(prefix)
+		if end == nil {
+			break
+		}
+		it.seek(end)
+	}
+	if err := it.error(); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// Can't trim a real database
+func (db *LSMDB) Trim() {
+}
+
+func (db *LSMDB) Close() error {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	if db.closed {
+		return nil
+	}
+	err := db.flush()
+	db.closed = true
+	db.closeTables()
+	if e := db.log.close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+/***************************************
+ *       Internals, called with the lock held
+ ***************************************/
+
+func (db *LSMDB) write(ops []op) error {
+	if db.closed {
+		return fmt.Errorf("Database is closed")
+	}
+	err := db.log.append(ops)
+	if err != nil {
+		return err
+	}
+	for _, o := range ops {
+		db.mem.put(o.key, o.value, o.deleted)
+	}
+	if db.mem.size >= db.MemTableSize {
+		return db.flush()
+	}
+	return nil
+}
+
+// get looks a key up in the memTable, then the tables, newest first
+func (db *LSMDB) get(key []byte) ([]byte, bool, error) {
+	if db.closed {
+		return nil, false, fmt.Errorf("Database is closed")
+	}
+	value, deleted, found := db.mem.get(key)
+	for i := len(db.tables) - 1; found == false && i >= 0; i-- {
+		var err error
+		value, deleted, found, err = db.tables[i].get(key)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if found == false || deleted {
+		return nil, false, nil
+	}
+	return value, true, nil
+}
+
+// iterate calls f with each key and value starting with prefix, in order,
+// until f returns false.  If from is after the prefix, the keys before it are
+// skipped.  The key and value are only valid until f returns.
+func (db *LSMDB) iterate(prefix, from []byte, f func(key, value []byte) bool) error {
+	if db.closed {
+		return fmt.Errorf("Database is closed")
+	}
+	if bytes.Compare(from, prefix) < 0 {
+		from = prefix
+	}
+	it := db.iterator()
+	for it.seek(from); it.valid() && bytes.HasPrefix(it.key(), prefix); it.next() {
+		if f(it.key(), it.value()) == false {
+			break
+		}
+	}
+	return it.error()
+}
+
+// iterator merges the memTable and the tables, skipping deleted keys
+func (db *LSMDB) iterator() *mergeIterator {
+	sources := []source{db.mem.iterator()}
+	for i := len(db.tables) - 1; i >= 0; i-- {
+		sources = append(sources, db.tables[i].iterator())
+	}
+	return newMergeIterator(sources, false)
+}
+
+// flush writes the memTable out as a table, empties the log, and merges tables
+// if there are too many
+func (db *LSMDB) flush() error {
+	if db.mem.count == 0 {
+		return nil
+	}
+	num := db.nextNum
+	t, err := db.writeTable(db.mem.iterator(), num, num)
+	if err != nil {
+		return err
+	}
+	db.nextNum++
+	db.tables = append(db.tables, t)
+	db.mem = newMemTable()
+	err = db.log.reset()
+	if err != nil {
+		return err
+	}
+	return db.compact()
+}
+
+// compact merges the newest tables while there are more than MaxTables.  It
+// merges the newest two and any older tables no bigger than twice what is
+// being merged, so tables grow in size with age and data is rewritten a
+// bounded number of times.
+func (db *LSMDB) compact() error {
+	for len(db.tables) > db.MaxTables && len(db.tables) > 1 {
+		start := len(db.tables) - 2
+		size := db.tables[start].size + db.tables[start+1].size
+		for start > 0 && db.tables[start-1].size <= 2*size {
+			start--
+			size += db.tables[start].size
+		}
+
+		inputs := db.tables[start:]
+		sources := []source{}
+		for i := len(inputs) - 1; i >= 0; i-- {
+			sources = append(sources, inputs[i].iterator())
+		}
+		// Tombstones can go once nothing older is left
+		it := newMergeIterator(sources, start > 0)
+
+		num := db.nextNum
+		t, err := db.writeTable(it, num, inputs[0].num)
+		if err != nil {
+			return err
+		}
+		db.nextNum++
+		for _, input := range inputs {
+			input.close()
+			os.Remove(input.path)
+		}
+		db.tables = append(db.tables[:start], t)
+	}
+	return nil
+}
+
+// writeTable writes the entries of a source out to table num, and opens it
+func (db *LSMDB) writeTable(it source, num uint64, replaces uint64) (*table, error) {
+	path := filepath.Join(db.dir, tableName(num))
+	tmp := path + ".tmp"
+	tw, err := createTable(tmp)
+	if err != nil {
+		return nil, err
+	}
+	for ; it.valid(); it.next() {
+		err = tw.add(it.key(), it.value(), it.deleted())
+		if err != nil {
+			tw.abort()
+			return nil, err
+		}
+	}
+	if err = it.error(); err != nil {
+		tw.abort()
+		return nil, err
+	}
+	err = tw.finish(replaces)
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	// The rename has to be on disk before the log it replaces is emptied
+	err = syncDir(db.dir)
+	if err != nil {
+		return nil, err
+	}
+	return openTable(path, num)
+}
+
+// syncDir flushes the directory's entries, such as a rename, to disk.
+// Windows can't sync a directory, and doesn't need to.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	d.Close()
+	return err
+}
+
+// dbKey is the bucket, preceded by its length, followed by the key
+func dbKey(bucket []byte, key []byte) []byte {
+	return append(bucketPrefix(bucket), key...)
+}
+
+func bucketPrefix(bucket []byte) []byte {
+	prefix := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(bucket))
+	n := binary.PutUvarint(prefix, uint64(len(bucket)))
+	return append(prefix[:n], bucket...)
+}
+
+// prefixEnd returns the first key after all those starting with prefix, or nil
+// if there is none
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+type byNum []*table
+
+func (f byNum) Len() int {
+	return len(f)
+}
+func (f byNum) Less(i, j int) bool {
+	return f[i].num < f[j].num
+}
+func (f byNum) Swap(i, j int) {
+	f[i], f[j] = f[j], f[i]
+}
@@ -0,0 +1,357 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package lsmdb_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/database/databaseOverlay"
+	. "github.com/FactomProject/factomd/database/lsmdb"
+	"github.com/FactomProject/factomd/testHelper"
+)
+
+type TestData struct {
+	Str string
+}
+
+func (t *TestData) New() interfaces.BinaryMarshallableAndCopyable {
+	return new(TestData)
+}
+
+func (t *TestData) MarshalBinary() ([]byte, error) {
+	return []byte(t.Str), nil
+}
+
+func (t *TestData) UnmarshalBinaryData(data []byte) ([]byte, error) {
+	t.Str = string(data)
+	return nil, nil
+}
+
+func (t *TestData) UnmarshalBinary(data []byte) (err error) {
+	_, err = t.UnmarshalBinaryData(data)
+	return
+}
+
+var _ interfaces.BinaryMarshallable = (*TestData)(nil)
+
+var dbFilename string = "lsmTest.db"
+
+func openTestDB(t *testing.T) *LSMDB {
+	m, err := NewLSMDB(dbFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Small enough to write and merge plenty of tables
+	m.MemTableSize = 2048
+	m.MaxTables = 4
+	return m
+}
+
+func CleanupTest(t *testing.T, m interfaces.IDatabase) {
+	m.Close()
+	os.RemoveAll(dbFilename)
+}
+
+// checkDB checks the database holds what the model does
+func checkDB(t *testing.T, m interfaces.IDatabase, model map[string]map[string]string) {
+	buckets, err := m.ListAllBuckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := []string{}
+	for _, bucket := range buckets {
+		found = append(found, string(bucket))
+	}
+	sort.Strings(found)
+	names := []string{}
+	for bucket, keys := range model {
+		if len(keys) > 0 {
+			names = append(names, bucket)
+		}
+	}
+	sort.Strings(names)
+	if strings.Join(found, ",") != strings.Join(names, ",") {
+		t.Fatalf("Found buckets %q, expected %q", found, names)
+	}
+
+	for bucket, values := range model {
+		keys := []string{}
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		found, err := m.ListAllKeys([]byte(bucket))
+		if err != nil {
+			t.Fatal(err)
+		}
+		all, allKeys, err := m.GetAll([]byte(bucket), new(TestData))
+		if err != nil {
+			t.Fatal(err)
+		}
+		iterated := []string{}
+		err = m.(interfaces.IIterableDatabase).IterateKeysWithPrefix([]byte(bucket), nil, nil, func(key []byte) bool {
+			iterated = append(iterated, string(key))
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != len(keys) || len(all) != len(keys) || len(allKeys) != len(keys) || len(iterated) != len(keys) {
+			t.Fatalf("Found %v/%v/%v/%v keys in bucket %v, expected %v", len(found), len(all), len(allKeys), len(iterated), bucket, len(keys))
+		}
+		for i, key := range keys {
+			if string(found[i]) != key || string(allKeys[i]) != key || iterated[i] != key {
+				t.Errorf("Found key %s, expected %s", found[i], key)
+			}
+			if all[i].(*TestData).Str != values[key] {
+				t.Errorf("Found %v for key %v, expected %v", all[i].(*TestData).Str, key, values[key])
+			}
+			resp, err := m.Get([]byte(bucket), []byte(key), new(TestData))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp == nil || resp.(*TestData).Str != values[key] {
+				t.Errorf("Got %v for key %v, expected %v", resp, key, values[key])
+			}
+		}
+	}
+}
+
+func TestPutGetDelete(t *testing.T) {
+	m := openTestDB(t)
+	defer CleanupTest(t, m)
+
+	key := []byte("key")
+	bucket := []byte("bucket")
+
+	test := new(TestData)
+	test.Str = "testtest"
+
+	err := m.Put(bucket, key, test)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+
+	resp, err := m.Get(bucket, key, new(TestData))
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if resp == nil || resp.(*TestData).Str != test.Str {
+		t.Errorf("data mismatch")
+	}
+
+	err = m.Delete(bucket, key)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+
+	resp, err = m.Get(bucket, key, new(TestData))
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if resp != nil {
+		t.Errorf("resp is not nil while it should be")
+	}
+}
+
+func TestRandomWritesAndReopen(t *testing.T) {
+	m := openTestDB(t)
+	defer CleanupTest(t, m)
+
+	model := map[string]map[string]string{}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 3000; i++ {
+		// Buckets that are prefixes of each other must not mix
+		bucket := []string{"a", "ab", "b", ""}[r.Intn(4)]
+		key := fmt.Sprintf("%v", r.Intn(300))
+		if model[bucket] == nil {
+			model[bucket] = map[string]string{}
+		}
+		var err error
+		switch r.Intn(10) {
+		case 0:
+			err = m.Delete([]byte(bucket), []byte(key))
+			delete(model[bucket], key)
+		case 1:
+			records := []interfaces.Record{}
+			for j := 0; j < 5; j++ {
+				key = fmt.Sprintf("%v", r.Intn(300))
+				value := fmt.Sprintf("batch %v %v", i, j)
+				records = append(records, interfaces.Record{Bucket: []byte(bucket), Key: []byte(key), Data: &TestData{value}})
+				model[bucket][key] = value
+			}
+			err = m.PutInBatch(records)
+		default:
+			value := fmt.Sprintf("value %v", i)
+			err = m.Put([]byte(bucket), []byte(key), &TestData{value})
+			model[bucket][key] = value
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkDB(t, m, model)
+
+	err := m.Clear([]byte("ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	model["ab"] = map[string]string{}
+	checkDB(t, m, model)
+
+	m.Close()
+	m = openTestDB(t)
+	checkDB(t, m, model)
+
+	tables, _ := filepath.Glob(filepath.Join(dbFilename, "*.sst"))
+	if len(tables) > m.MaxTables {
+		t.Errorf("%v tables left, expected no more than %v", len(tables), m.MaxTables)
+	}
+}
+
+func TestRecoverFromLog(t *testing.T) {
+	m := openTestDB(t)
+	defer CleanupTest(t, m)
+	m.MemTableSize = 1 << 20
+
+	model := map[string]map[string]string{"bucket": {}}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("%03d", i)
+		model["bucket"][key] = key
+		err := m.Put([]byte("bucket"), []byte(key), &TestData{key})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Open it again without closing it, as after a crash, with a torn
+	// record at the end of the log
+	f, err := os.OpenFile(filepath.Join(dbFilename, "LOG"), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 2, 3, 4, 0, 0, 0, 99, 5})
+	f.Close()
+
+	m2 := openTestDB(t)
+	defer m2.Close()
+	checkDB(t, m2, model)
+}
+
+func TestDropReplacedTables(t *testing.T) {
+	m := openTestDB(t)
+	defer CleanupTest(t, m)
+
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("%03d", i)
+		err := m.Put([]byte("bucket"), []byte(key), &TestData{strings.Repeat(key, 20)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 200; i++ {
+		err := m.Delete([]byte("bucket"), []byte(fmt.Sprintf("%03d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Close()
+
+	// A table from before the merge that removed it, as if the merge
+	// didn't get to remove it
+	if _, err := os.Stat(filepath.Join(dbFilename, "00000001.sst")); err == nil {
+		t.Fatal("First table was not merged")
+	}
+	tables, _ := filepath.Glob(filepath.Join(dbFilename, "*.sst"))
+	sort.Strings(tables)
+	data, err := ioutil.ReadFile(tables[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dbFilename, "00000001.sst"), data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m = openTestDB(t)
+	keys, err := m.ListAllKeys([]byte("bucket"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("Found %v deleted keys", len(keys))
+	}
+	if _, err = os.Stat(filepath.Join(dbFilename, "00000001.sst")); err == nil {
+		t.Errorf("Replaced table was not dropped")
+	}
+}
+
+func TestGetAll(t *testing.T) {
+	m := openTestDB(t)
+	defer CleanupTest(t, m)
+
+	dbo := databaseOverlay.NewOverlay(m)
+	testHelper.PopulateTestDatabaseOverlay(dbo)
+
+	_, keys, err := dbo.GetAll(databaseOverlay.INCLUDED_IN, primitives.NewZeroHash())
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if len(keys) != 150 {
+		t.Errorf("Invalid amount of keys returned - expected 150, got %v", len(keys))
+	}
+	for i := range keys {
+		if len(keys[i]) != 32 {
+			t.Errorf("Wrong key length at index %v - %v", i, len(keys[i]))
+		}
+	}
+}
+
+func TestIterateKeysWithPrefix(t *testing.T) {
+	m := openTestDB(t)
+	defer CleanupTest(t, m)
+
+	// Spread the keys over the tables and the memTable, with some deleted
+	for i := 0; i < 500; i++ {
+		err := m.Put([]byte("bucket"), []byte(fmt.Sprintf("key%03d", i)), &TestData{fmt.Sprintf("value %v", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 500; i += 7 {
+		err := m.Delete([]byte("bucket"), []byte(fmt.Sprintf("key%03d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys := []string{}
+	err := m.IterateKeysWithPrefix([]byte("bucket"), []byte("key1"), []byte("key150"), func(key []byte) bool {
+		keys = append(keys, string(key))
+		return len(keys) < 10
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{}
+	for i := 150; len(expected) < 10; i++ {
+		if i%7 != 0 {
+			expected = append(expected, fmt.Sprintf("key%03d", i))
+		}
+	}
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Errorf("Iterated over %v, expected %v", keys, expected)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package lsmdb
+
+import (
+	"bytes"
+	"math/rand"
+)
+
+const maxLevel = 16
+
+type memNode struct {
+	key     []byte
+	value   []byte
+	deleted bool
+	next    []*memNode
+}
+
+// memTable holds the latest writes in a skip list sorted by key, until it gets
+// big enough to be written out as a table.  Deletes are kept as tombstones, as
+// the key may still be in an older table.
+type memTable struct {
+	head  *memNode
+	level int
+	size  int
+	count int
+	rand  *rand.Rand
+}
+
+func newMemTable() *memTable {
+	m := new(memTable)
+	m.head = &memNode{next: make([]*memNode, maxLevel)}
+	m.level = 1
+	m.rand = rand.New(rand.NewSource(1))
+	return m
+}
+
+// seek returns the first node with a key no less than key.  If prev isn't nil,
+// it is filled with the last node before key at each level.
+func (m *memTable) seek(key []byte, prev []*memNode) *memNode {
+	x := m.head
+	for i := m.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && bytes.Compare(x.next[i].key, key) < 0 {
+			x = x.next[i]
+		}
+		if prev != nil {
+			prev[i] = x
+		}
+	}
+	return x.next[0]
+}
+
+func (m *memTable) put(key, value []byte, deleted bool) {
+	prev := make([]*memNode, maxLevel)
+	x := m.seek(key, prev)
+	if x != nil && bytes.Equal(x.key, key) {
+		m.size += len(value) - len(x.value)
+		x.value = value
+		x.deleted = deleted
+		return
+	}
+
+	level := 1
+	for level < maxLevel && m.rand.Intn(4) == 0 {
+		level++
+	}
+	if level > m.level {
+		for i := m.level; i < level; i++ {
+			prev[i] = m.head
+		}
+		m.level = level
+	}
+	x = &memNode{key: key, value: value, deleted: deleted, next: make([]*memNode, level)}
+	for i := 0; i < level; i++ {
+		x.next[i] = prev[i].next[i]
+		prev[i].next[i] = x
+	}
+	m.size += len(key) + len(value)
+	m.count++
+}
+
+// get returns the value of a key, whether it was deleted, and whether the
+// memTable knows of the key at all
+func (m *memTable) get(key []byte) (value []byte, deleted bool, found bool) {
+	x := m.seek(key, nil)
+	if x == nil || !bytes.Equal(x.key, key) {
+		return nil, false, false
+	}
+	return x.value, x.deleted, true
+}
+
+type memIterator struct {
+	m    *memTable
+	node *memNode
+}
+
+func (m *memTable) iterator() *memIterator {
+	return &memIterator{m: m, node: m.head.next[0]}
+}
+
+func (it *memIterator) valid() bool     { return it.node != nil }
+func (it *memIterator) key() []byte     { return it.node.key }
+func (it *memIterator) value() []byte   { return it.node.value }
+func (it *memIterator) deleted() bool   { return it.node.deleted }
+func (it *memIterator) next()           { it.node = it.node.next[0] }
+func (it *memIterator) seek(key []byte) { it.node = it.m.seek(key, nil) }
+func (it *memIterator) error() error    { return nil }
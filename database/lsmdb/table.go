@@ -0,0 +1,324 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package lsmdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// A table is an immutable file of entries sorted by key, written out from the
+// memTable or merged from other tables.  Each entry is a flag byte, set for a
+// tombstone, then the key and value, each preceded by its length as a uvarint.
+// After the entries comes a sparse index holding the key and offset of every
+// indexInterval'th entry, and then the footer.
+//
+// The footer holds the offset of the index, the number of entries, and the
+// lowest number of the tables a merge replaced, so that tables left behind by
+// a merge that didn't finish can be dropped when the database is opened.
+type table struct {
+	num      uint64
+	replaces uint64 // Tables numbered from replaces up to num are obsolete
+	path     string
+	file     *os.File
+	size     int64
+	dataEnd  int64
+	count    uint64
+	index    []indexEntry
+}
+
+type indexEntry struct {
+	key    []byte
+	offset int64
+}
+
+const (
+	indexInterval = 16
+	footerSize    = 32
+	tableMagic    = 0x46616374534d4c31 // "FactSML1"
+)
+
+func tableName(num uint64) string {
+	return fmt.Sprintf("%08d.sst", num)
+}
+
+func openTable(path string, num uint64) (*table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := readTable(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	t.num = num
+	t.path = path
+	return t, nil
+}
+
+func readTable(file *os.File) (*table, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	t := new(table)
+	t.file = file
+	t.size = info.Size()
+	if t.size < footerSize {
+		return nil, fmt.Errorf("Table is too short")
+	}
+
+	footer := make([]byte, footerSize)
+	_, err = file.ReadAt(footer, t.size-footerSize)
+	if err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint64(footer[24:]) != tableMagic {
+		return nil, fmt.Errorf("Table has a bad footer")
+	}
+	t.dataEnd = int64(binary.BigEndian.Uint64(footer))
+	t.count = binary.BigEndian.Uint64(footer[8:])
+	t.replaces = binary.BigEndian.Uint64(footer[16:])
+	if t.dataEnd > t.size-footerSize {
+		return nil, fmt.Errorf("Table index is past the footer")
+	}
+
+	index := make([]byte, t.size-footerSize-t.dataEnd)
+	_, err = file.ReadAt(index, t.dataEnd)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(index)
+	for r.Len() > 0 {
+		key, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		offset, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		t.index = append(t.index, indexEntry{key, int64(offset)})
+	}
+	return t, nil
+}
+
+func (t *table) close() error {
+	return t.file.Close()
+}
+
+// get returns the value of a key, whether it was deleted, and whether the
+// table holds the key at all
+func (t *table) get(key []byte) (value []byte, deleted bool, found bool, err error) {
+	it := &tableIterator{t: t}
+	it.seek(key)
+	if it.err != nil {
+		return nil, false, false, it.err
+	}
+	if !it.valid() || !bytes.Equal(it.key(), key) {
+		return nil, false, false, nil
+	}
+	return it.value(), it.deleted(), true, nil
+}
+
+// tableIterator reads the entries of a table in order, through a buffer, so a
+// table is never read into memory whole
+type tableIterator struct {
+	t      *table
+	r      *bufio.Reader
+	offset int64
+	ok     bool
+	k      []byte
+	v      []byte
+	tomb   bool
+	err    error
+}
+
+func (t *table) iterator() *tableIterator {
+	it := &tableIterator{t: t}
+	it.start(0)
+	return it
+}
+
+func (it *tableIterator) start(offset int64) {
+	it.offset = offset
+	it.r = bufio.NewReaderSize(io.NewSectionReader(it.t.file, offset, it.t.dataEnd-offset), 4096)
+	it.next()
+}
+
+func (it *tableIterator) valid() bool   { return it.ok }
+func (it *tableIterator) key() []byte   { return it.k }
+func (it *tableIterator) value() []byte { return it.v }
+func (it *tableIterator) deleted() bool { return it.tomb }
+func (it *tableIterator) error() error  { return it.err }
+
+func (it *tableIterator) next() {
+	it.ok = false
+	if it.err != nil || it.offset >= it.t.dataEnd {
+		return
+	}
+	flag, err := it.r.ReadByte()
+	if err == nil {
+		it.k, err = readBytes(it.r)
+	}
+	if err == nil {
+		it.v, err = readBytes(it.r)
+	}
+	if err != nil {
+		it.err = fmt.Errorf("%v: %v", it.t.path, err)
+		return
+	}
+	it.tomb = flag != 0
+	it.offset += int64(1 + uvarintLen(len(it.k)) + len(it.k) + uvarintLen(len(it.v)) + len(it.v))
+	it.ok = true
+}
+
+// seek moves to the first entry with a key no less than key, starting from the
+// index entry before it
+func (it *tableIterator) seek(key []byte) {
+	index := it.t.index
+	i := sort.Search(len(index), func(i int) bool {
+		return bytes.Compare(index[i].key, key) > 0
+	}) - 1
+	if i < 0 {
+		i = 0
+	}
+	offset := int64(0)
+	if len(index) > 0 {
+		offset = index[i].offset
+	}
+	it.err = nil
+	it.start(offset)
+	for it.ok && bytes.Compare(it.k, key) < 0 {
+		it.next()
+	}
+}
+
+// tableWriter writes a table out, entries in key order
+type tableWriter struct {
+	file   *os.File
+	w      *bufio.Writer
+	offset int64
+	count  uint64
+	index  []indexEntry
+}
+
+func createTable(path string) (*tableWriter, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &tableWriter{file: file, w: bufio.NewWriterSize(file, 64*1024)}, nil
+}
+
+func (tw *tableWriter) add(key, value []byte, deleted bool) error {
+	if tw.count%indexInterval == 0 {
+		tw.index = append(tw.index, indexEntry{key, tw.offset})
+	}
+	flag := byte(0)
+	if deleted {
+		flag = 1
+	}
+	err := tw.w.WriteByte(flag)
+	if err != nil {
+		return err
+	}
+	n, err := writeBytes(tw.w, key)
+	if err != nil {
+		return err
+	}
+	m, err := writeBytes(tw.w, value)
+	if err != nil {
+		return err
+	}
+	tw.offset += int64(1 + n + m)
+	tw.count++
+	return nil
+}
+
+// finish writes the index and footer and syncs the table to disk
+func (tw *tableWriter) finish(replaces uint64) error {
+	for _, e := range tw.index {
+		_, err := writeBytes(tw.w, e.key)
+		if err != nil {
+			return err
+		}
+		_, err = writeUvarint(tw.w, uint64(e.offset))
+		if err != nil {
+			return err
+		}
+	}
+	footer := make([]byte, footerSize)
+	binary.BigEndian.PutUint64(footer, uint64(tw.offset))
+	binary.BigEndian.PutUint64(footer[8:], tw.count)
+	binary.BigEndian.PutUint64(footer[16:], replaces)
+	binary.BigEndian.PutUint64(footer[24:], tableMagic)
+	_, err := tw.w.Write(footer)
+	if err != nil {
+		return err
+	}
+	err = tw.w.Flush()
+	if err != nil {
+		return err
+	}
+	err = tw.file.Sync()
+	if err != nil {
+		return err
+	}
+	return tw.file.Close()
+}
+
+// abort gives up on the table and removes it
+func (tw *tableWriter) abort() {
+	tw.file.Close()
+	os.Remove(tw.file.Name())
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func readBytes(r byteReader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
+}
+
+func writeBytes(w io.Writer, b []byte) (int, error) {
+	n, err := writeUvarint(w, uint64(len(b)))
+	if err != nil {
+		return 0, err
+	}
+	m, err := w.Write(b)
+	return n + m, err
+}
+
+func writeUvarint(w io.Writer, x uint64) (int, error) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, x)
+	return w.Write(buf[:n])
+}
+
+func uvarintLen(x int) int {
+	n := 1
+	for ; x >= 0x80; x >>= 7 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package lsmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+)
+
+// The write-ahead log holds the writes in the memTable, so they survive a
+// crash until the memTable is written out as a table.  Each batch of writes is
+// one record: the CRC32 and length of the payload, then the payload, which is
+// an op byte for each write, set for a delete, followed by the key and, for a
+// put, the value.  A torn record at the end of the log is dropped.
+type wal struct {
+	file *os.File
+}
+
+type op struct {
+	key     []byte
+	value   []byte
+	deleted bool
+}
+
+// openWAL replays the log at path into a memTable and opens it for appending
+func openWAL(path string, mem *memTable) (*wal, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	good := 0
+	for len(data)-good >= 8 {
+		sum := binary.BigEndian.Uint32(data[good:])
+		length := int(binary.BigEndian.Uint32(data[good+4:]))
+		if len(data)-good-8 < length {
+			break
+		}
+		payload := data[good+8 : good+8+length]
+		if crc32.ChecksumIEEE(payload) != sum {
+			break
+		}
+		ops, ok := decodeOps(payload)
+		if ok == false {
+			break
+		}
+		for _, o := range ops {
+			mem.put(o.key, o.value, o.deleted)
+		}
+		good += 8 + length
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = file.Truncate(int64(good))
+	if err == nil {
+		_, err = file.Seek(int64(good), 0)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &wal{file: file}, nil
+}
+
+func (w *wal) append(ops []op) error {
+	payload := new(bytes.Buffer)
+	for _, o := range ops {
+		if o.deleted {
+			payload.WriteByte(1)
+			writeBytes(payload, o.key)
+		} else {
+			payload.WriteByte(0)
+			writeBytes(payload, o.key)
+			writeBytes(payload, o.value)
+		}
+	}
+	record := make([]byte, 8, 8+payload.Len())
+	binary.BigEndian.PutUint32(record, crc32.ChecksumIEEE(payload.Bytes()))
+	binary.BigEndian.PutUint32(record[4:], uint32(payload.Len()))
+	record = append(record, payload.Bytes()...)
+	_, err := w.file.Write(record)
+	return err
+}
+
+// reset empties the log once the memTable is safely in a table
+func (w *wal) reset() error {
+	err := w.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = w.file.Seek(0, 0)
+	return err
+}
+
+func (w *wal) close() error {
+	return w.file.Close()
+}
+
+func decodeOps(payload []byte) ([]op, bool) {
+	r := bytes.NewReader(payload)
+	ops := []op{}
+	for r.Len() > 0 {
+		flag, _ := r.ReadByte()
+		o := op{deleted: flag != 0}
+		var err error
+		o.key, err = readBytes(r)
+		if err != nil {
+			return nil, false
+		}
+		if o.deleted == false {
+			o.value, err = readBytes(r)
+			if err != nil {
+				return nil, false
+			}
+		}
+		ops = append(ops, o)
+	}
+	return ops, true
+}
@@ -6,9 +6,11 @@ package mapdb
 
 import (
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/database"
 	"github.com/FactomProject/factomd/util"
 )
 
@@ -19,6 +21,16 @@ type MapDB struct {
 
 var _ interfaces.IDatabase = (*MapDB)(nil)
 
+func init() {
+	database.RegisterEngine("Map", database.Engine{
+		Open: func(path string) (interfaces.IDatabase, error) {
+			db := new(MapDB)
+			db.Init(nil)
+			return db, nil
+		},
+	})
+}
+
 func (MapDB) Close() error {
 	return nil
 }
@@ -183,6 +195,24 @@ func (db *MapDB) ListAllKeys(bucket []byte) ([][]byte, error) {
 	return answer, nil
 }
 
+func (db *MapDB) ListKeysWithPrefix(bucket, prefix []byte) ([][]byte, error) {
+	db.createCache(bucket)
+
+	db.Sem.RLock()
+	defer db.Sem.RUnlock()
+
+	answer := [][]byte{}
+	for k, _ := range db.Cache[string(bucket)] {
+		if strings.HasPrefix(k, string(prefix)) {
+			answer = append(answer, []byte(k))
+		}
+	}
+
+	sort.Sort(util.ByByteArray(answer))
+
+	return answer, nil
+}
+
 func (db *MapDB) GetAll(bucket []byte, sample interfaces.BinaryMarshallableAndCopyable) ([]interfaces.BinaryMarshallableAndCopyable, [][]byte, error) {
 	db.createCache(bucket)
 
@@ -9,9 +9,11 @@ import (
 	"crypto/rand"
 	"fmt"
 
-	"github.com/FactomProject/factomd/database/boltdb"
-	"github.com/FactomProject/factomd/database/leveldb"
-	"github.com/FactomProject/factomd/database/mapdb"
+	"github.com/FactomProject/factomd/database"
+	_ "github.com/FactomProject/factomd/database/boltdb"
+	_ "github.com/FactomProject/factomd/database/leveldb"
+	_ "github.com/FactomProject/factomd/database/lsmdb"
+	_ "github.com/FactomProject/factomd/database/mapdb"
 
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/primitives"
@@ -37,10 +39,11 @@ type EncryptedDB struct {
 }
 
 // NewEncryptedDB takes the filename, dbtype, and password.
-//		Dbtype :
+//		Dbtype is the name of a registered database engine :
 //			Map
 //			Bolt
-//			LevelDB
+//			LDB
+//			LSM
 func NewEncryptedDB(filename, dbtype, password string) (*EncryptedDB, error) {
 	e := new(EncryptedDB)
 	e.Init(filename, dbtype)
@@ -182,6 +185,10 @@ func (db *EncryptedDB) ListAllKeys(bucket []byte) (keys [][]byte, err error) {
 	return keys, nil
 }
 
+func (db *EncryptedDB) ListKeysWithPrefix(bucket, prefix []byte) ([][]byte, error) {
+	return db.db.ListKeysWithPrefix(bucket, prefix)
+}
+
 func (db *EncryptedDB) GetAll(bucket []byte, sample interfaces.BinaryMarshallableAndCopyable) ([]interfaces.BinaryMarshallableAndCopyable, [][]byte, error) {
 	s := NewEncryptedMarshaler(db.encryptionkey, sample.(interfaces.BinaryMarshallable))
 
@@ -200,18 +207,9 @@ func (db *EncryptedDB) GetAll(bucket []byte, sample interfaces.BinaryMarshallabl
 
 func (db *EncryptedDB) Init(filename string, dbtype string) {
 	var err error
-	switch dbtype {
-	case "Map":
-		db.db = new(mapdb.MapDB)
-	case "LDB":
-		db.db, err = leveldb.NewLevelDB(filename, true)
-		if err != nil {
-			panic(err)
-		}
-	case "Bolt":
-		db.db = boltdb.NewBoltDB(nil, filename)
-	default:
-		panic(fmt.Sprintf("%s is not a valid option. Expect 'Map', 'LDB', or 'Bolt'", dbtype))
+	db.db, err = database.OpenEngine(dbtype, filename)
+	if err != nil {
+		panic(err)
 	}
 }
 
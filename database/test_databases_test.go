@@ -7,14 +7,17 @@ package database_test
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/primitives"
 	"github.com/FactomProject/factomd/common/primitives/random"
+	. "github.com/FactomProject/factomd/database"
 	"github.com/FactomProject/factomd/database/boltdb"
 	"github.com/FactomProject/factomd/database/databaseOverlay"
 	"github.com/FactomProject/factomd/database/leveldb"
+	"github.com/FactomProject/factomd/database/lsmdb"
 	"github.com/FactomProject/factomd/database/mapdb"
 	"github.com/FactomProject/factomd/database/securedb"
 	"github.com/FactomProject/factomd/testHelper"
@@ -67,6 +70,16 @@ func TestAllDatabases(t *testing.T) {
 		CleanupTest(t, m)
 	}
 
+	// Secure LSM
+	for i := 0; i < 5; i++ {
+		m, err := securedb.NewEncryptedDB(dbFilename, "LSM", random.RandomString())
+		if err != nil {
+			t.Error(err)
+		}
+		testDB(t, m, i)
+		CleanupTest(t, m)
+	}
+
 	// Secure Map
 	for i := 0; i < 5; i++ {
 		m, err := securedb.NewEncryptedDB(dbFilename, "Map", random.RandomString())
@@ -94,6 +107,16 @@ func TestAllDatabases(t *testing.T) {
 		CleanupTest(t, m)
 	}
 
+	// LSM
+	for i := 0; i < 5; i++ {
+		m, err := lsmdb.NewLSMDB(dbFilename)
+		if err != nil {
+			t.Error(err)
+		}
+		testDB(t, m, i)
+		CleanupTest(t, m)
+	}
+
 	// Map
 	for i := 0; i < 5; i++ {
 		m := new(mapdb.MapDB)
@@ -102,6 +125,30 @@ func TestAllDatabases(t *testing.T) {
 	}
 }
 
+func TestAllEngines(t *testing.T) {
+	names := EngineNames()
+	for _, name := range []string{"Bolt", "LDB", "LSM", "Map"} {
+		if _, ok := GetEngine(name); ok == false {
+			t.Errorf("Engine %v is not registered - %v", name, names)
+		}
+	}
+
+	for _, name := range names {
+		for i := 0; i < 5; i++ {
+			m, err := OpenEngine(name, dbFilename)
+			if err != nil {
+				t.Fatalf("%v: %v", name, err)
+			}
+			testDB(t, m, i)
+			CleanupTest(t, m)
+		}
+	}
+
+	if _, err := OpenEngine("Bogus", dbFilename); err == nil {
+		t.Error("Opened an engine that isn't registered")
+	}
+}
+
 func testDB(t *testing.T, m interfaces.IDatabase, i int) {
 	switch i {
 	case 0:
@@ -112,6 +159,8 @@ func testDB(t *testing.T, m interfaces.IDatabase, i int) {
 		testDoesKeyExist(t, m)
 	case 3:
 		testGetAll(t, m)
+	case 4:
+		testListKeysWithPrefix(t, m)
 	}
 }
 
@@ -286,3 +335,72 @@ func testGetAll(t *testing.T, m interfaces.IDatabase) {
 		}
 	}
 }
+
+func testListKeysWithPrefix(t *testing.T, m interfaces.IDatabase) {
+	defer CleanupTest(t, m)
+
+	bucket := []byte("bucket")
+	keys := []string{"a", "ab", "abc", "abd", "b", "ba"}
+	for _, k := range keys {
+		err := m.Put(bucket, []byte(k), &TestData{k})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Keys of a bucket the prefix matches the name of don't count
+	err := m.Put([]byte("bucketa"), []byte("a"), &TestData{"other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for prefix, expected := range map[string][]string{
+		"":   keys,
+		"a":  {"a", "ab", "abc", "abd"},
+		"ab": {"ab", "abc", "abd"},
+		"b":  {"b", "ba"},
+		"c":  {},
+	} {
+		found, err := m.ListKeysWithPrefix(bucket, []byte(prefix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != len(expected) {
+			t.Errorf("Found %v keys with prefix %q, expected %v", len(found), prefix, len(expected))
+			continue
+		}
+		for i := range found {
+			if string(found[i]) != expected[i] {
+				t.Errorf("Found key %q with prefix %q, expected %q", found[i], prefix, expected[i])
+			}
+		}
+
+		// Iterating stops when told to
+		iterated := []string{}
+		err = IterateKeysWithPrefix(m, bucket, []byte(prefix), nil, func(key []byte) bool {
+			iterated = append(iterated, string(key))
+			return len(iterated) < 2
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(expected) > 2 {
+			expected = expected[:2]
+		}
+		if strings.Join(iterated, ",") != strings.Join(expected, ",") {
+			t.Errorf("Iterated over %q with prefix %q, expected %q", iterated, prefix, expected)
+		}
+	}
+
+	// Iterating from a key skips those before it
+	iterated := []string{}
+	err = IterateKeysWithPrefix(m, bucket, []byte("a"), []byte("abc"), func(key []byte) bool {
+		iterated = append(iterated, string(key))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(iterated, ",") != "abc,abd" {
+		t.Errorf("Iterated over %q from abc, expected abc and abd", iterated)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"time"
 
 	"math"
@@ -21,6 +22,7 @@ import (
 	"github.com/FactomProject/factomd/common/messages"
 	"github.com/FactomProject/factomd/common/primitives"
 	"github.com/FactomProject/factomd/controlPanel"
+	"github.com/FactomProject/factomd/database"
 	"github.com/FactomProject/factomd/database/leveldb"
 	"github.com/FactomProject/factomd/p2p"
 	"github.com/FactomProject/factomd/state"
@@ -53,6 +55,7 @@ func NetStart(s *state.State, p *FactomParams, listenToStdin bool) {
 
 	s.PortNumber = 8088
 	s.ControlPanelPort = 8090
+	s.MetricsPort = 9876
 	logPort = p.LogPort
 
 	messages.AckBalanceHash = p.AckbalanceHash
@@ -101,6 +104,11 @@ func NetStart(s *state.State, p *FactomParams, listenToStdin bool) {
 	} else {
 		p.ControlPanelPortOverride = s.ControlPanelPort
 	}
+	if 999 < p.MetricsPortOverride { // The command line flag exists and seems reasonable.
+		s.MetricsPort = p.MetricsPortOverride
+	} else {
+		p.MetricsPortOverride = s.MetricsPort
+	}
 
 	if p.BlkTime > 0 {
 		s.DirectoryBlockInSeconds = p.BlkTime
@@ -201,6 +209,12 @@ func NetStart(s *state.State, p *FactomParams, listenToStdin bool) {
 		s.CloneDBType = p.Db
 	}
 
+	for _, dbType := range []string{s.DBType, s.CloneDBType} {
+		if _, ok := database.GetEngine(dbType); ok == false {
+			panic(fmt.Sprintf("%s is not a valid database type.  Expect one of %s", dbType, strings.Join(database.EngineNames(), ", ")))
+		}
+	}
+
 	pnet := p.Net
 	if len(p.Fnet) > 0 {
 		pnet = p.Fnet
@@ -244,6 +258,8 @@ func NetStart(s *state.State, p *FactomParams, listenToStdin bool) {
 	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "Network", s.Network))
 	os.Stderr.WriteString(fmt.Sprintf("%20s %x\n", "customnet", p.customNet))
 	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "deadline (ms)", p.deadline))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "p2p encryption", s.P2PEncryption))
+	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "p2p broadcast", s.P2PBroadcast))
 	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "tls", s.FactomdTLSEnable))
 	os.Stderr.WriteString(fmt.Sprintf("%20s %v\n", "selfaddr", s.FactomdLocations))
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\"\n", "rpcuser", s.RpcUser))
@@ -255,6 +271,7 @@ func NetStart(s *state.State, p *FactomParams, listenToStdin bool) {
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%d\"\n", "TCP port", s.PortNumber))
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%s\"\n", "pprof port", logPort))
 	os.Stderr.WriteString(fmt.Sprintf("%20s \"%d\"\n", "Control Panel port", s.ControlPanelPort))
+	os.Stderr.WriteString(fmt.Sprintf("%20s \"%d\"\n", "Metrics port", s.MetricsPort))
 
 	//************************************************
 	// Actually setup the Network
@@ -318,6 +335,15 @@ func NetStart(s *state.State, p *FactomParams, listenToStdin bool) {
 			networkPort = fmt.Sprintf("%d", p.NetworkPortOverride)
 		}
 
+		encryption, err := p2p.ParseEncryptionMode(s.P2PEncryption)
+		if err != nil {
+			panic(err)
+		}
+		broadcast, err := p2p.ParseBroadcastMode(s.P2PBroadcast)
+		if err != nil {
+			panic(err)
+		}
+
 		ci := p2p.ControllerInit{
 			Port:                     networkPort,
 			PeersFile:                s.PeersFile,
@@ -326,6 +352,14 @@ func NetStart(s *state.State, p *FactomParams, listenToStdin bool) {
 			SeedURL:                  seedURL,
 			SpecialPeers:             specialPeers,
 			ConnectionMetricsChannel: connectionMetricsChannel,
+			Encryption:               encryption,
+			NodeKey:                  fnodes[0].State.GetServerPrivateKey(),
+			TrustedNodeKeys:          s.P2PTrustedNodeKeys,
+			SeedKeys:                 s.P2PSeedKeys,
+			BanScore:                 s.PeerBanScore,
+			BanDuration:              s.PeerBanDuration,
+			Scoring:                  s.PeerScoring,
+			Broadcast:                broadcast,
 		}
 		p2pNetwork = new(p2p.Controller).Init(ci)
 		fnodes[0].State.NetworkControler = p2pNetwork
@@ -354,6 +388,13 @@ func NetStart(s *state.State, p *FactomParams, listenToStdin bool) {
 		go networkHousekeeping() // This goroutine executes once a second to keep the proxy apprised of the network status.
 	}
 
+	var names []string
+	for _, fnode := range fnodes {
+		names = append(names, fnode.State.FactomNodeName)
+	}
+	SimNet.SetNodes(names)
+	SimNet.SetLog(func(s string) { os.Stderr.WriteString(s) })
+
 	switch p.Net {
 	case "file":
 		file, err := os.Open(p.Fnet)
@@ -362,14 +403,25 @@ func NetStart(s *state.State, p *FactomParams, listenToStdin bool) {
 		} else if file == nil {
 			panic(fmt.Sprint("File network.txt failed to open, and we got a file of <nil>"))
 		}
+		// Lines are links (a -- b), or directives for the network conditions
 		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
+		for line := 1; scanner.Scan(); line++ {
 			var a, b int
 			var s string
 			fmt.Sscanf(scanner.Text(), "%d %s %d", &a, &s, &b)
 			if s == "--" {
 				AddSimPeer(fnodes, a, b)
+				continue
+			}
+			words := strings.Fields(scanner.Text())
+			if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+				continue
+			}
+			msg, err := SimNet.Command(words)
+			if err != nil {
+				panic(fmt.Sprintf("%s line %d: %s", p.Fnet, line, err.Error()))
 			}
+			os.Stderr.WriteString(fmt.Sprintf("SimNet %s\n", msg))
 		}
 	case "square":
 		side := int(math.Sqrt(float64(p.Cnt)))
@@ -486,7 +538,7 @@ func NetStart(s *state.State, p *FactomParams, listenToStdin bool) {
 	go wsapi.Start(fnodes[0].State)
 
 	// Start prometheus on port
-	launchPrometheus(9876)
+	launchPrometheus(s.MetricsPort)
 	// Start Package's prometheus
 	state.RegisterPrometheus()
 	p2p.RegisterPrometheus()
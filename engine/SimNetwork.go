@@ -0,0 +1,456 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SimNet holds the conditions of the simulated network.  SimPeers ask it when
+// each packet they send is to arrive, or if it is lost on the way.  The
+// conditions are set by directives, one per line in the -fnet file after the
+// "a -- b" links, or after N in simControl:
+//
+//	group <name> <nodes>...                    name a group of nodes
+//	link <nodes> <nodes> [oneway] <options>    set the conditions of the links
+//	                                           between them, both ways unless oneway
+//	partition <nodes> <nodes> [oneway]         lose everything sent between them
+//	heal [<nodes> <nodes> [oneway]]            end a partition, or all of them
+//	at <seconds> <directive>                   run the directive that many seconds from now
+//	seed <n>                                   seed the random numbers, to repeat a run
+//	clear                                      drop all groups, conditions, partitions and events
+//	show                                       print the conditions
+//
+// Nodes are a node index (3), a range of indexes (0-4), a node name (FNode3),
+// a group name, or all.  Link options are given as key=value or key value:
+//
+//	delay   fixed delay in milliseconds
+//	jitter  milliseconds added to the delay: uniform over 0 to jitter, the
+//	        absolute value of a normal with jitter as standard deviation, or
+//	        an exponential with jitter as mean
+//	dist    the jitter distribution, uniform (the default), normal or exp
+//	bw      bytes per second the link carries, 0 for no limit
+//	drop    packets lost per thousand
+//
+// Packets on a link arrive in the order they were sent, as they would on a
+// TCP connection, so a packet with a short delay can wait behind one with a
+// long delay.  Packets in flight when a partition starts are lost.  All of
+// this is on top of the DropRate and Delay set by the S, O, D and F commands.
+var SimNet = NewSimNetwork()
+
+// Jitter distributions
+const (
+	JitterUniform = "uniform"
+	JitterNormal  = "normal"
+	JitterExp     = "exp"
+)
+
+// SimLinkConditions are the conditions of one direction of a link between
+// two nodes
+type SimLinkConditions struct {
+	Delay     int64  // Fixed delay in milliseconds
+	Jitter    int64  // Scale of the random delay added, in milliseconds
+	Dist      string // Distribution of the jitter
+	Bandwidth int64  // Bytes per second, 0 is no limit
+	DropRate  int    // Packets lost per thousand
+}
+
+func (c *SimLinkConditions) String() string {
+	return fmt.Sprintf("delay=%d jitter=%d dist=%s bw=%d drop=%d", c.Delay, c.Jitter, c.Dist, c.Bandwidth, c.DropRate)
+}
+
+// simLink is one direction of a link, by node name
+type simLink struct {
+	from string
+	to   string
+}
+
+type simEvent struct {
+	at    time.Time
+	words []string
+}
+
+// SimNetwork is the topology and conditions of a simulated network
+type SimNetwork struct {
+	mutex  sync.Mutex
+	nodes  []string                       // Node names, by index
+	groups map[string][]string            // Node names, by group
+	links  map[simLink]*SimLinkConditions // Conditions of links that have any
+	cuts   map[simLink]bool               // Links lost to a partition
+	busy   map[simLink]int64              // When each capped link has sent what it was given (ms)
+	events []*simEvent                    // Scheduled directives, soonest first
+	rand   *rand.Rand
+	now    func() time.Time
+	log    func(string)
+}
+
+// NewSimNetwork returns a network with no conditions
+func NewSimNetwork() *SimNetwork {
+	n := new(SimNetwork)
+	n.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	n.now = time.Now
+	n.log = func(string) {}
+	n.clear()
+	return n
+}
+
+func (n *SimNetwork) clear() {
+	n.groups = map[string][]string{}
+	n.links = map[simLink]*SimLinkConditions{}
+	n.cuts = map[simLink]bool{}
+	n.busy = map[simLink]int64{}
+	n.events = nil
+}
+
+// SetNodes sets the node names that node indexes refer to
+func (n *SimNetwork) SetNodes(names []string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.nodes = append([]string{}, names...)
+}
+
+// SetLog sets where scheduled directives report what they did
+func (n *SimNetwork) SetLog(log func(string)) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.log = log
+}
+
+// Command runs a directive, and returns what it has to say
+func (n *SimNetwork) Command(words []string) (string, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.runDue()
+	return n.command(words)
+}
+
+func (n *SimNetwork) command(words []string) (string, error) {
+	if len(words) == 0 {
+		return n.show(), nil
+	}
+	args := words[1:]
+	switch strings.ToLower(words[0]) {
+	case "group":
+		if len(args) < 2 {
+			return "", fmt.Errorf("group needs a name and nodes")
+		}
+		if _, err := strconv.Atoi(args[0]); err == nil || args[0] == "all" {
+			return "", fmt.Errorf("group name %s would hide a node", args[0])
+		}
+		var names []string
+		for _, a := range args[1:] {
+			nodes, err := n.resolve(a)
+			if err != nil {
+				return "", err
+			}
+			names = append(names, nodes...)
+		}
+		n.groups[args[0]] = names
+		return fmt.Sprintf("group %s is %s", args[0], strings.Join(names, " ")), nil
+
+	case "link":
+		links, rest, err := n.linksBetween(args)
+		if err != nil {
+			return "", err
+		}
+		c, err := parseLinkConditions(rest)
+		if err != nil {
+			return "", err
+		}
+		for _, l := range links {
+			cc := *c
+			n.links[l] = &cc
+			delete(n.busy, l)
+		}
+		return fmt.Sprintf("%d links set to %s", len(links), c), nil
+
+	case "partition":
+		links, rest, err := n.linksBetween(args)
+		if err != nil {
+			return "", err
+		}
+		if len(rest) > 0 {
+			return "", fmt.Errorf("partition doesn't take %s", strings.Join(rest, " "))
+		}
+		for _, l := range links {
+			n.cuts[l] = true
+		}
+		return fmt.Sprintf("%d links cut", len(links)), nil
+
+	case "heal":
+		if len(args) == 0 {
+			cnt := len(n.cuts)
+			n.cuts = map[simLink]bool{}
+			return fmt.Sprintf("%d links healed", cnt), nil
+		}
+		links, rest, err := n.linksBetween(args)
+		if err != nil {
+			return "", err
+		}
+		if len(rest) > 0 {
+			return "", fmt.Errorf("heal doesn't take %s", strings.Join(rest, " "))
+		}
+		cnt := 0
+		for _, l := range links {
+			if n.cuts[l] {
+				delete(n.cuts, l)
+				cnt++
+			}
+		}
+		return fmt.Sprintf("%d links healed", cnt), nil
+
+	case "at":
+		if len(args) < 2 {
+			return "", fmt.Errorf("at needs seconds and a directive")
+		}
+		secs, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || secs < 0 {
+			return "", fmt.Errorf("at needs a number of seconds, not %s", args[0])
+		}
+		if strings.ToLower(args[1]) == "at" {
+			return "", fmt.Errorf("at can't schedule another at")
+		}
+		e := &simEvent{at: n.now().Add(time.Duration(secs * float64(time.Second))), words: args[1:]}
+		i := sort.Search(len(n.events), func(i int) bool { return n.events[i].at.After(e.at) })
+		n.events = append(n.events, nil)
+		copy(n.events[i+1:], n.events[i:])
+		n.events[i] = e
+		return fmt.Sprintf("in %gs: %s", secs, strings.Join(e.words, " ")), nil
+
+	case "seed":
+		if len(args) != 1 {
+			return "", fmt.Errorf("seed needs a number")
+		}
+		seed, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("seed needs a number, not %s", args[0])
+		}
+		n.rand.Seed(seed)
+		return fmt.Sprintf("seeded with %d", seed), nil
+
+	case "clear":
+		n.clear()
+		return "network conditions cleared", nil
+
+	case "show":
+		return n.show(), nil
+	}
+	return "", fmt.Errorf("unknown network directive %s", words[0])
+}
+
+// runDue runs the scheduled directives whose time has come
+func (n *SimNetwork) runDue() {
+	now := n.now()
+	for len(n.events) > 0 && !n.events[0].at.After(now) {
+		e := n.events[0]
+		n.events = n.events[1:]
+		msg, err := n.command(e.words)
+		if err != nil {
+			msg = err.Error()
+		}
+		n.log(fmt.Sprintf("SimNet %s: %s\n", strings.Join(e.words, " "), msg))
+	}
+}
+
+// resolve returns the node names a node index, range, name or group refers to
+func (n *SimNetwork) resolve(s string) ([]string, error) {
+	if names, ok := n.groups[s]; ok {
+		return names, nil
+	}
+	if s == "all" {
+		return n.nodes, nil
+	}
+	for _, name := range n.nodes {
+		if name == s {
+			return []string{s}, nil
+		}
+	}
+	first, last := s, s
+	if i := strings.Index(s, "-"); i > 0 {
+		first, last = s[:i], s[i+1:]
+	}
+	a, err1 := strconv.Atoi(first)
+	b, err2 := strconv.Atoi(last)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("%s is not a node or a group", s)
+	}
+	if a < 0 || b < a || b >= len(n.nodes) {
+		return nil, fmt.Errorf("nodes %s are not all in the network of %d nodes", s, len(n.nodes))
+	}
+	return n.nodes[a : b+1], nil
+}
+
+// linksBetween reads two sets of nodes, and an optional oneway, and returns the
+// links between them and the words that follow
+func (n *SimNetwork) linksBetween(args []string) ([]simLink, []string, error) {
+	if len(args) < 2 {
+		return nil, nil, fmt.Errorf("two sets of nodes are needed")
+	}
+	from, err := n.resolve(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := n.resolve(args[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	rest := args[2:]
+	oneway := len(rest) > 0 && strings.ToLower(rest[0]) == "oneway"
+	if oneway {
+		rest = rest[1:]
+	}
+	var links []simLink
+	for _, a := range from {
+		for _, b := range to {
+			if a == b {
+				continue
+			}
+			links = append(links, simLink{a, b})
+			if !oneway {
+				links = append(links, simLink{b, a})
+			}
+		}
+	}
+	return links, rest, nil
+}
+
+func parseLinkConditions(words []string) (*SimLinkConditions, error) {
+	var kv []string
+	for _, w := range words {
+		for _, s := range strings.Split(w, "=") {
+			if s != "" {
+				kv = append(kv, s)
+			}
+		}
+	}
+	if len(kv)%2 != 0 {
+		return nil, fmt.Errorf("link options are key=value pairs")
+	}
+	c := &SimLinkConditions{Dist: JitterUniform}
+	for i := 0; i < len(kv); i += 2 {
+		key, value := strings.ToLower(kv[i]), kv[i+1]
+		if key == "dist" {
+			switch strings.ToLower(value) {
+			case JitterUniform, JitterNormal, JitterExp:
+				c.Dist = strings.ToLower(value)
+			default:
+				return nil, fmt.Errorf("unknown jitter distribution %s, use uniform, normal or exp", value)
+			}
+			continue
+		}
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("%s needs a number that isn't negative, not %s", key, value)
+		}
+		switch key {
+		case "delay":
+			c.Delay = v
+		case "jitter":
+			c.Jitter = v
+		case "bw":
+			c.Bandwidth = v
+		case "drop":
+			if v > 1000 {
+				return nil, fmt.Errorf("drop is per thousand, not %d", v)
+			}
+			c.DropRate = int(v)
+		default:
+			return nil, fmt.Errorf("unknown link option %s", key)
+		}
+	}
+	return c, nil
+}
+
+// jitter returns a random delay in milliseconds from the link's distribution
+func (n *SimNetwork) jitter(c *SimLinkConditions) int64 {
+	if c.Jitter <= 0 {
+		return 0
+	}
+	switch c.Dist {
+	case JitterNormal:
+		return int64(math.Abs(n.rand.NormFloat64()) * float64(c.Jitter))
+	case JitterExp:
+		return int64(n.rand.ExpFloat64() * float64(c.Jitter))
+	default:
+		return n.rand.Int63n(c.Jitter)
+	}
+}
+
+// Transit returns when a packet of size bytes sent from one node to another at
+// sent (ms) arrives, or false if it is lost
+func (n *SimNetwork) Transit(from, to string, size int, sent int64) (int64, bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.runDue()
+	l := simLink{from, to}
+	if n.cuts[l] {
+		return 0, false
+	}
+	c, ok := n.links[l]
+	if !ok {
+		return sent, true
+	}
+	if c.DropRate > 0 && n.rand.Intn(1000) < c.DropRate {
+		return 0, false
+	}
+	done := sent
+	if c.Bandwidth > 0 {
+		// The packet waits for those ahead of it on the link, then takes its
+		// own time to send
+		if n.busy[l] > done {
+			done = n.busy[l]
+		}
+		done += int64(size) * 1000 / c.Bandwidth
+		n.busy[l] = done
+	}
+	return done + c.Delay + n.jitter(c), true
+}
+
+// IsCut returns true if a partition loses what is sent from one node to another
+func (n *SimNetwork) IsCut(from, to string) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.runDue()
+	return n.cuts[simLink{from, to}]
+}
+
+func (n *SimNetwork) show() string {
+	var out []string
+	var names []string
+	for name := range n.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out = append(out, fmt.Sprintf("group %s: %s", name, strings.Join(n.groups[name], " ")))
+	}
+	var links []string
+	for l, c := range n.links {
+		links = append(links, fmt.Sprintf("link %s -> %s: %s", l.from, l.to, c))
+	}
+	sort.Strings(links)
+	out = append(out, links...)
+	var cuts []string
+	for l := range n.cuts {
+		cuts = append(cuts, fmt.Sprintf("cut %s -> %s", l.from, l.to))
+	}
+	sort.Strings(cuts)
+	out = append(out, cuts...)
+	now := n.now()
+	for _, e := range n.events {
+		out = append(out, fmt.Sprintf("in %.1fs: %s", e.at.Sub(now).Seconds(), strings.Join(e.words, " ")))
+	}
+	if len(out) == 0 {
+		return "no network conditions"
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,116 @@
+package engine_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/FactomProject/factomd/engine"
+)
+
+func newTestSimNetwork(t *testing.T, directives ...[]string) *SimNetwork {
+	n := NewSimNetwork()
+	n.SetNodes([]string{"FNode0", "FNode1", "FNode2", "FNode3"})
+	for _, d := range directives {
+		if _, err := n.Command(d); err != nil {
+			t.Fatalf("%v: %v", d, err)
+		}
+	}
+	return n
+}
+
+func TestSimNetworkPartition(t *testing.T) {
+	n := newTestSimNetwork(t,
+		[]string{"group", "east", "0-1"},
+		[]string{"group", "west", "FNode2", "3"},
+		[]string{"partition", "east", "west"})
+
+	if !n.IsCut("FNode0", "FNode3") || !n.IsCut("FNode3", "FNode1") {
+		t.Error("partition should cut both ways")
+	}
+	if n.IsCut("FNode0", "FNode1") || n.IsCut("FNode2", "FNode3") {
+		t.Error("partition should not cut links inside a group")
+	}
+	if _, ok := n.Transit("FNode1", "FNode2", 100, 0); ok {
+		t.Error("packet should be lost across a partition")
+	}
+
+	n.Command([]string{"heal", "east", "west", "oneway"})
+	if n.IsCut("FNode0", "FNode3") || !n.IsCut("FNode3", "FNode0") {
+		t.Error("oneway heal should only heal east to west")
+	}
+	n.Command([]string{"heal"})
+	if n.IsCut("FNode3", "FNode0") {
+		t.Error("heal should heal everything")
+	}
+}
+
+func TestSimNetworkLinkConditions(t *testing.T) {
+	n := newTestSimNetwork(t,
+		[]string{"link", "0", "1", "oneway", "delay=100", "bw", "1000"})
+
+	if at, ok := n.Transit("FNode0", "FNode1", 500, 1000); !ok || at != 1600 {
+		t.Errorf("first packet should arrive at 1600, got %d %v", at, ok)
+	}
+	// The second waits for the first to be sent
+	if at, _ := n.Transit("FNode0", "FNode1", 500, 1000); at != 2100 {
+		t.Errorf("second packet should arrive at 2100, got %d", at)
+	}
+	if at, _ := n.Transit("FNode1", "FNode0", 500, 1000); at != 1000 {
+		t.Errorf("the other way has no conditions, got %d", at)
+	}
+
+	n.Command([]string{"link", "all", "all", "drop=1000"})
+	if _, ok := n.Transit("FNode2", "FNode3", 1, 0); ok {
+		t.Error("drop=1000 should lose every packet")
+	}
+}
+
+func TestSimNetworkJitter(t *testing.T) {
+	for _, dist := range []string{"uniform", "normal", "exp"} {
+		n := newTestSimNetwork(t,
+			[]string{"seed", "1"},
+			[]string{"link", "0", "1", "delay", "10", "jitter", "50", "dist", dist})
+		varied := false
+		for i := 0; i < 100; i++ {
+			at, _ := n.Transit("FNode0", "FNode1", 1, 0)
+			if at < 10 {
+				t.Errorf("%s jitter should not shorten the delay, got %d", dist, at)
+			}
+			varied = varied || at != 10
+		}
+		if !varied {
+			t.Errorf("%s jitter should vary the delay", dist)
+		}
+	}
+}
+
+func TestSimNetworkSchedule(t *testing.T) {
+	n := newTestSimNetwork(t,
+		[]string{"partition", "0", "1"},
+		[]string{"at", "0.05", "heal"})
+	if !n.IsCut("FNode0", "FNode1") {
+		t.Error("partition should start now")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n.IsCut("FNode0", "FNode1") {
+		t.Error("scheduled heal should have run")
+	}
+}
+
+func TestSimNetworkBadDirectives(t *testing.T) {
+	n := newTestSimNetwork(t)
+	for _, d := range [][]string{
+		{"bogus"},
+		{"partition", "0"},
+		{"partition", "0", "9"},
+		{"link", "0", "1", "delay"},
+		{"link", "0", "1", "speed=5"},
+		{"link", "0", "1", "dist=pareto"},
+		{"group", "2", "0"},
+		{"at", "soon", "heal"},
+	} {
+		if _, err := n.Command(d); err == nil {
+			t.Errorf("%v should fail", d)
+		}
+	}
+}
@@ -17,8 +17,9 @@ var _ = fmt.Print
 var _ = bytes.Compare
 
 type SimPacket struct {
-	data []byte
-	sent int64 // Time in milliseconds
+	data    []byte
+	sent    int64 // Time in milliseconds
+	arrives int64 // Time in milliseconds the network conditions deliver it
 }
 
 type SimPeer struct {
@@ -120,8 +121,10 @@ func (f *SimPeer) Send(msg interfaces.IMsg) error {
 		fmt.Println("ERROR on Send: ", err)
 		return err
 	}
-	if len(f.BroadcastOut) < 9000 {
-		packet := SimPacket{data: data, sent: time.Now().UnixNano() / 1000000}
+	sent := time.Now().UnixNano() / 1000000
+	arrives, ok := SimNet.Transit(f.FromName, f.ToName, len(data), sent)
+	if ok && len(f.BroadcastOut) < 9000 {
+		packet := SimPacket{data: data, sent: sent, arrives: arrives}
 		f.BroadcastOut <- &packet
 	}
 	return nil
@@ -148,9 +151,13 @@ func (f *SimPeer) Recieve() (interfaces.IMsg, error) {
 
 	now := time.Now().UnixNano() / 1000000
 
-	if f.Delayed != nil && now-f.Delayed.sent > f.DelayUse {
+	if f.Delayed != nil && now-f.Delayed.sent > f.DelayUse && now >= f.Delayed.arrives {
 		data := f.Delayed.data
 		f.Delayed = nil
+		// A partition loses the packets still in flight
+		if SimNet.IsCut(f.ToName, f.FromName) {
+			return nil, nil
+		}
 		msg, err := messages.UnmarshalMessage(data)
 		if err != nil {
 			fmt.Printf("SimPeer ERROR: %s %x %s\n", err.Error(), data[:8], messages.MessageName(data[0]))
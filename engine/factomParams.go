@@ -3,8 +3,10 @@ package engine
 import (
 	"flag"
 	"os"
+	"strings"
 
 	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/database"
 )
 
 type FactomParams struct {
@@ -27,6 +29,7 @@ type FactomParams struct {
 	NetworkName              string
 	NetworkPortOverride      int
 	ControlPanelPortOverride int
+	MetricsPortOverride      int
 	LogPort                  string
 	BlkTime                  int
 	FaultTimeout             int
@@ -66,13 +69,13 @@ func ParseCmdLine(args []string) *FactomParams {
 	listenToPtr := flag.Int("node", 0, "Node Number the simulator will set as the focus")
 	cntPtr := flag.Int("count", 1, "The number of nodes to generate")
 	netPtr := flag.String("net", "tree", "The default algorithm to build the network connections")
-	fnetPtr := flag.String("fnet", "", "Read the given file to build the network connections")
+	fnetPtr := flag.String("fnet", "", "Read the given file to build the network connections, and set their conditions (see engine/SimNetwork.go)")
 	dropPtr := flag.Int("drop", 0, "Number of messages to drop out of every thousand")
 	journalPtr := flag.String("journal", "", "Rerun a Journal of messages")
 	journalingPtr := flag.Bool("journaling", false, "Write a journal of all messages recieved. Default is off.")
 	followerPtr := flag.Bool("follower", false, "If true, force node to be a follower.  Only used when replaying a journal.")
 	leaderPtr := flag.Bool("leader", true, "If true, force node to be a leader.  Only used when replaying a journal.")
-	dbPtr := flag.String("db", "", "Override the Database in the Config file and use this Database implementation. Options Map, LDB, or Bolt")
+	dbPtr := flag.String("db", "", "Override the Database in the Config file and use this Database implementation. Options "+strings.Join(database.EngineNames(), ", "))
 	cloneDBPtr := flag.String("clonedb", "", "Override the main node and use this database for the clones in a Network.")
 	networkNamePtr := flag.String("network", "", "Network to join: MAIN, TEST or LOCAL")
 	peersPtr := flag.String("peers", "", "Array of peer addresses. ")
@@ -99,6 +102,7 @@ func ParseCmdLine(args []string) *FactomParams {
 	logportPtr := flag.String("logPort", "6060", "Port for pprof logging")
 	portOverridePtr := flag.Int("port", 0, "Port where we serve WSAPI;  default 8088")
 	ControlPanelPortOverridePtr := flag.Int("ControlPanelPort", 0, "Port for control panel webserver;  Default 8090")
+	metricsPortOverridePtr := flag.Int("metricsPort", 0, "Port serving the Prometheus metrics; Default 9876")
 	networkPortOverridePtr := flag.Int("networkPort", 0, "Port for p2p network; default 8110")
 
 	fastPtr := flag.Bool("fast", true, "If true, factomd will fast-boot from a file.")
@@ -139,6 +143,7 @@ func ParseCmdLine(args []string) *FactomParams {
 	p.NetworkName = *networkNamePtr
 	p.NetworkPortOverride = *networkPortOverridePtr
 	p.ControlPanelPortOverride = *ControlPanelPortOverridePtr
+	p.MetricsPortOverride = *metricsPortOverridePtr
 	p.LogPort = *logportPtr
 	p.BlkTime = *blkTimePtr
 	p.FaultTimeout = *faultTimeoutPtr
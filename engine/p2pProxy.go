@@ -11,8 +11,7 @@ import (
 	"os"
 	"time"
 
-	// "github.com/FactomProject/factomd/common/constants"
-
+	"github.com/FactomProject/factomd/common/constants"
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/messages"
 	"github.com/FactomProject/factomd/common/primitives"
@@ -21,18 +20,39 @@ import (
 
 var _ = fmt.Print
 
-var ()
+// messagePriorities are the priorities of message types in the p2p queues.
+// Consensus messages go ahead of commits and transactions, and missing data
+// responses, which are large and plentiful while a node catches up, go last.
+// Types not listed are p2p.PriorityNormal.
+var messagePriorities = map[byte]p2p.Priority{
+	constants.EOM_MSG:                       p2p.PriorityConsensus,
+	constants.ACK_MSG:                       p2p.PriorityConsensus,
+	constants.DIRECTORY_BLOCK_SIGNATURE_MSG: p2p.PriorityConsensus,
+	constants.FED_SERVER_FAULT_MSG:          p2p.PriorityConsensus,
+	constants.FULL_SERVER_FAULT_MSG:         p2p.PriorityConsensus,
+	constants.HEARTBEAT_MSG:                 p2p.PriorityConsensus,
+	constants.MISSING_MSG_RESPONSE:          p2p.PriorityData,
+	constants.DATA_RESPONSE:                 p2p.PriorityData,
+	constants.DBSTATE_MSG:                   p2p.PriorityData,
+	constants.ENTRY_BLOCK_RESPONSE:          p2p.PriorityData,
+}
+
+func init() {
+	for msgType, priority := range messagePriorities {
+		p2p.SetAppTypePriority(fmt.Sprintf("%d", msgType), priority)
+	}
+}
 
 type P2PProxy struct {
 	// A connection to this node:
 	ToName   string
 	FromName string
-	// Channels that define the connection:
-	BroadcastOut chan interface{} // FactomMessage ToNetwork from factomd
-	BroadcastIn  chan interface{} // FactomMessage FromNetwork for Factomd
+	// Queues that define the connection:
+	BroadcastOut *p2p.PriorityQueue // FactomMessage ToNetwork from factomd
+	BroadcastIn  *p2p.PriorityQueue // FactomMessage FromNetwork for Factomd
 
-	ToNetwork   chan interface{} // p2p.Parcel From p2pProxy to the p2p Controller
-	FromNetwork chan interface{} // p2p.Parcel Parcels from the network for the application
+	ToNetwork   *p2p.PriorityQueue // p2p.Parcel From p2pProxy to the p2p Controller
+	FromNetwork *p2p.PriorityQueue // p2p.Parcel Parcels from the network for the application
 
 	logFile   os.File
 	logWriter bufio.Writer
@@ -88,8 +108,8 @@ func (f *P2PProxy) BytesIn() int {
 func (f *P2PProxy) Init(fromName, toName string) interfaces.IPeer {
 	f.ToName = toName
 	f.FromName = fromName
-	f.BroadcastOut = make(chan interface{}, p2p.StandardChannelSize)
-	f.BroadcastIn = make(chan interface{}, p2p.StandardChannelSize)
+	f.BroadcastOut = p2p.NewPriorityQueue("broadcast_out", p2p.StandardChannelSize)
+	f.BroadcastIn = p2p.NewPriorityQueue("broadcast_in", p2p.StandardChannelSize)
 	f.logging = make(chan interface{}, p2p.StandardChannelSize)
 
 	return f
@@ -133,45 +153,44 @@ func (f *P2PProxy) Send(msg interfaces.IMsg) error {
 	if msg.IsPeer2Peer() && 1 < f.debugMode {
 		log.Printf("%s Sending directed to: %s message: %+v\n", time.Now().String(), message.PeerHash, msg.String())
 	}
-	p2p.BlockFreeChannelSend(f.BroadcastOut, message)
+	// Wait for room rather than drop, which slows the node's network output
+	// down to what the network can take
+	f.BroadcastOut.SendWait(message, p2p.AppTypePriority(appType), p2p.BackpressureTimeout)
 
 	return nil
 }
 
-// Non-blocking return value from channel.
+// Non-blocking return value from the queue.
 func (f *P2PProxy) Recieve() (interfaces.IMsg, error) {
-	select {
-	case data, ok := <-f.BroadcastIn:
-		if ok {
-			BroadInCastQueue.Dec()
-
-			switch data.(type) {
-			case FactomMessage:
-				fmessage := data.(FactomMessage)
-				f.trace(fmessage.AppHash, fmessage.AppType, "P2PProxy.Recieve()", "N")
-				msg, err := messages.UnmarshalMessage(fmessage.Message)
-
-				if f.SuperVerboseMessages {
-					if err != nil {
-						log.Println("SVM err:", err.Error())
-					} else {
-						log.Println("SVM Receive:", msg.String())
-					}
-				}
-				if nil == err {
-					msg.SetNetworkOrigin(fmessage.PeerHash)
+	data, ok := f.BroadcastIn.Receive()
+	if ok {
+		BroadInCastQueue.Dec()
+
+		switch data.(type) {
+		case FactomMessage:
+			fmessage := data.(FactomMessage)
+			f.trace(fmessage.AppHash, fmessage.AppType, "P2PProxy.Recieve()", "N")
+			msg, err := messages.UnmarshalMessage(fmessage.Message)
+
+			if f.SuperVerboseMessages {
+				if err != nil {
+					log.Println("SVM err:", err.Error())
+				} else {
+					log.Println("SVM Receive:", msg.String())
 				}
-				//if 1 < f.debugMode {
-				//	f.logMessage(msg, true) // NODE_TALK_FIX
-				//	fmt.Printf(".")
-				//}
-				f.bytesIn += len(fmessage.Message)
-				return msg, err
-			default:
-				//fmt.Printf("Garbage on f.BroadcastIn. %+v", data)
 			}
+			if nil == err {
+				msg.SetNetworkOrigin(fmessage.PeerHash)
+			}
+			//if 1 < f.debugMode {
+			//	f.logMessage(msg, true) // NODE_TALK_FIX
+			//	fmt.Printf(".")
+			//}
+			f.bytesIn += len(fmessage.Message)
+			return msg, err
+		default:
+			//fmt.Printf("Garbage on f.BroadcastIn. %+v", data)
 		}
-	default:
 	}
 	return nil, nil
 }
@@ -195,7 +214,7 @@ func (f *P2PProxy) Equals(ff interfaces.IPeer) bool {
 
 // Returns the number of messages waiting to be read
 func (f *P2PProxy) Len() int {
-	return len(f.BroadcastIn)
+	return f.BroadcastIn.Len()
 }
 
 //////////////////////////////////////////////////////////////////////////////////////////////////
@@ -288,7 +307,8 @@ func (p *P2PProxy) ManageLogging() {
 
 // manageOutChannel takes messages from the f.broadcastOut channel and sends them to the network.
 func (f *P2PProxy) ManageOutChannel() {
-	for data := range f.BroadcastOut {
+	for {
+		data := f.BroadcastOut.Next()
 		switch data.(type) {
 		case FactomMessage:
 			fmessage := data.(FactomMessage)
@@ -302,7 +322,7 @@ func (f *P2PProxy) ManageOutChannel() {
 				parcel.Header.AppHash = fmessage.AppHash
 				parcel.Header.AppType = fmessage.AppType
 				parcel.Trace("P2PProxy.ManageOutChannel()", "b")
-				p2p.BlockFreeChannelSend(f.ToNetwork, parcel)
+				f.ToNetwork.SendWait(parcel, p2p.ParcelPriority(&parcel), p2p.BackpressureTimeout)
 			}
 		default:
 			fmt.Printf("Garbage on f.BrodcastOut. %+v", data)
@@ -310,15 +330,16 @@ func (f *P2PProxy) ManageOutChannel() {
 	}
 }
 
-// manageInChannel takes messages from the network and stuffs it in the f.BroadcastIn channel
+// manageInChannel takes messages from the network and stuffs it in the f.BroadcastIn queue
 func (f *P2PProxy) ManageInChannel() {
-	for data := range f.FromNetwork {
+	for {
+		data := f.FromNetwork.Next()
 		switch data.(type) {
 		case p2p.Parcel:
 			parcel := data.(p2p.Parcel)
 			f.trace(parcel.Header.AppHash, parcel.Header.AppType, "P2PProxy.ManageInChannel()", "M")
 			message := FactomMessage{Message: parcel.Payload, PeerHash: parcel.Header.TargetPeer, AppHash: parcel.Header.AppHash, AppType: parcel.Header.AppType}
-			removed := p2p.BlockFreeChannelSend(f.BroadcastIn, message)
+			removed := f.BroadcastIn.SendWait(message, p2p.ParcelPriority(&parcel), p2p.BackpressureTimeout)
 			BroadInCastQueue.Inc()
 			BroadInCastQueue.Add(float64(-1 * removed))
 			BroadCastInQueueDrop.Add(float64(removed))
@@ -367,10 +388,10 @@ func (f *P2PProxy) InstantaneousStatusReport(fnodes []*FactomNode) {
 		fmt.Printf("      NetworkInvalidMsgQueue %d\n", len(fnodes[listenTo].State.NetworkInvalidMsgQueue()))
 		fmt.Printf("      HoldingQueue           %d\n", len(fnodes[listenTo].State.Holding))
 	}
-	fmt.Printf("      ToNetwork Queue:       %d\n", len(f.ToNetwork))
-	fmt.Printf("      FromNetwork Queue:     %d\n", len(f.FromNetwork))
-	fmt.Printf("      BroadcastOut Queue:    %d\n", len(f.BroadcastOut))
-	fmt.Printf("      BroadcastIn Queue:     %d\n", len(f.BroadcastIn))
+	fmt.Printf("      ToNetwork Queue:       %d\n", f.ToNetwork.Len())
+	fmt.Printf("      FromNetwork Queue:     %d\n", f.FromNetwork.Len())
+	fmt.Printf("      BroadcastOut Queue:    %d\n", f.BroadcastOut.Len())
+	fmt.Printf("      BroadcastIn Queue:     %d\n", f.BroadcastIn.Len())
 	fmt.Printf("      Weight:                %d\n", f.NumPeers)
 	fmt.Println("-------------------------------------------------------------------------------")
 	fmt.Println("-------------------------------------------------------------------------------")
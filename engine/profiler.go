@@ -28,7 +28,15 @@ func StartProfiler(mpr int, expose bool) {
 	//runtime.SetBlockProfileRate(100000)
 }
 
+// launchPrometheus serves the metrics on their own port, apart from the
+// profiler, the API and the control panel.  A port of 0 turns them off.
 func launchPrometheus(port int) {
-	http.Handle("/metrics", prometheus.Handler())
-	go http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+	if port == 0 {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prometheus.Handler())
+	go func() {
+		log.Println(http.ListenAndServe(fmt.Sprintf(":%d", port), mux))
+	}()
 }
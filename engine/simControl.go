@@ -1075,6 +1075,19 @@ func SimControl(listenTo int, listenStdin bool) {
 					}
 				}
 
+			case 'N' == b[0]:
+				// Network conditions, e.g. "N partition 0-2 3-5" or "N at 60 heal"
+				words := cmd[1:]
+				if len(b) > 1 {
+					words = append([]string{b[1:]}, words...)
+				}
+				msg, err := SimNet.Command(words)
+				if err != nil {
+					os.Stderr.WriteString(fmt.Sprintf("SimNet: %s\n", err.Error()))
+					break
+				}
+				os.Stderr.WriteString(msg + "\n")
+
 			case 'h' == b[0]:
 				os.Stderr.WriteString("-------------------------------------------------------------------------------\n")
 				os.Stderr.WriteString("<enter>       Running Enter with nothing repeats the previous command.\n\n")
@@ -1119,6 +1132,9 @@ func SimControl(listenTo int, listenStdin bool) {
 				os.Stderr.WriteString("Onnn          Set Drop Rate to nnn on this node\n")
 				os.Stderr.WriteString("Dnnn          Set the Delay on messages from the current node to nnn milliseconds\n")
 				os.Stderr.WriteString("Fnnn          Set the Delay on messages from all nodes to nnn milliseconds\n")
+				os.Stderr.WriteString("N             Show the network conditions set for the simulated network\n")
+				os.Stderr.WriteString("N directive   Set network conditions, e.g. N group east 0-2, N link east 3 delay 200 jitter 50,\n")
+				os.Stderr.WriteString("                 N partition east west, N at 30 heal.  See engine/SimNetwork.go for them all.\n")
 				os.Stderr.WriteString("/             Toggle the sort order between ChainID and Factom Node Name\n")
 
 				//os.Stderr.WriteString("i[m/b/a][N]   Shows only the Mhash, block signing key, or anchor key up to the Nth identity\n")
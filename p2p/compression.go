@@ -0,0 +1,100 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/FactomProject/snappy-go"
+)
+
+// From ProtocolVersionCompression on, binary frames (see framing.go) with a
+// large payload may be compressed with snappy.  A compressed frame sets the
+// top bit of the frame length, and the rest of the frame is the snappy block
+// of the uncompressed frame.  We only compress frames to a peer that has sent
+// us a parcel with a version that can read them.
+
+// CompressionThreshold is the smallest payload we try to compress.  Smaller
+// parcels rarely shrink enough to be worth it.
+var CompressionThreshold = 1024
+
+// compressedFrameFlag marks a compressed frame in the frame length.  Frames
+// are never anywhere near this large.
+const compressedFrameFlag = 1 << 31
+
+// WriteCompressedParcelFrame writes the parcel as a frame, compressed if the
+// payload is at least CompressionThreshold bytes and compressing makes it
+// smaller.  It returns the number of bytes compression saved.
+func WriteCompressedParcelFrame(w io.Writer, p *Parcel) (int, error) {
+	return writeParcelFrame(w, p, true)
+}
+
+func writeParcelFrame(w io.Writer, p *Parcel, compress bool) (int, error) {
+	data, err := p.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	var flag uint32
+	saved := 0
+	if compress && len(p.Payload) >= CompressionThreshold {
+		compressed := snappy.Encode(nil, data)
+		if len(compressed) < len(data) {
+			saved = len(data) - len(compressed)
+			data = compressed
+			flag = compressedFrameFlag
+		}
+	}
+	frame := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data))|flag)
+	frame = append(frame, data...)
+	_, err = w.Write(frame)
+	return saved, err
+}
+
+// readParcelFrame reads a frame, compressed or not, and returns the number of
+// bytes compression saved.
+func readParcelFrame(r io.Reader, p *Parcel) (int, error) {
+	var l [4]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return 0, err
+	}
+	size := binary.BigEndian.Uint32(l[:])
+	compressed := size&compressedFrameFlag != 0
+	size &^= compressedFrameFlag
+	if size > MaxParcelFrameSize {
+		return 0, fmt.Errorf("parcel frame too large - %d bytes", size)
+	}
+	// Grow the buffer as the frame arrives, rather than trusting the length
+	// with a large allocation up front
+	buf := new(bytes.Buffer)
+	n, err := io.CopyN(buf, r, int64(size))
+	if err != nil {
+		if err == io.EOF && n < int64(size) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	if !compressed {
+		return 0, p.UnmarshalBinary(buf.Bytes())
+	}
+
+	// Check the size the block claims before decoding, so a small frame
+	// can't make us allocate a huge one
+	dlen, err := snappy.DecodedLen(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	if dlen > MaxParcelFrameSize {
+		return 0, fmt.Errorf("compressed parcel frame too large - %d bytes", dlen)
+	}
+	data, err := snappy.Decode(nil, buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(data) - buf.Len(), p.UnmarshalBinary(data)
+}
@@ -5,9 +5,11 @@
 package p2p
 
 import (
+	"bufio"
 	"encoding/gob"
 	"fmt"
 	"hash/crc32"
+	"io"
 	"net"
 	"os"
 	"time"
@@ -22,18 +24,23 @@ import (
 var conLogger = packageLogger.WithFields(log.Fields{"subpack": "connection"})
 
 // Connection represents a single connection to another peer over the network. It communicates with the application
-// via two channels, send and recieve.  These channels take structs of type ConnectionCommand or ConnectionParcel
+// via two queues, send and recieve.  These queues take structs of type ConnectionCommand or ConnectionParcel
 // (defined below).
 type Connection struct {
-	conn           net.Conn
-	Errors         chan error              // handle errors from connections.
-	Commands       chan *ConnectionCommand // handle connection commands
-	SendChannel    chan interface{}        // Send means "towards the network" Channel sends Parcels and ConnectionCommands
-	ReceiveChannel chan interface{}        // Recieve means "from the network" Channel recieves Parcels and ConnectionCommands
-	ReceiveParcel  chan *Parcel            // Parcels to be handled.
+	conn          net.Conn
+	Errors        chan error              // handle errors from connections.
+	Commands      chan *ConnectionCommand // handle connection commands
+	SendQueue     *PriorityQueue          // Send means "towards the network" Queue sends Parcels and ConnectionCommands
+	ReceiveQueue  *PriorityQueue          // Recieve means "from the network" Queue recieves Parcels and ConnectionCommands
+	ReceiveParcel chan *Parcel            // Parcels to be handled.
 	// and as "address" for sending messages to specific nodes.
-	encoder         *gob.Encoder      // Wire format is gobs in this version, may switch to binary
-	decoder         *gob.Decoder      // Wire format is gobs in this version, may switch to binary
+	encoder         *gob.Encoder      // Wire format starts as gobs, and may switch to binary frames (see framing.go)
+	decoder         *gob.Decoder      // Wire format starts as gobs, and may switch to binary frames (see framing.go)
+	reader          *bufio.Reader     // Buffers the connection for both the gob decoder and binary frames
+	binaryOut       bool              // We send binary frames. Only changed by processSends
+	binaryIn        bool              // The peer sends binary frames. Only changed by processReceives
+	binaryAsked     bool              // We have asked processSends to switch to binary frames
+	compressOut     bool              // We compress large binary frames. Set by processReceives before binaryAsked
 	peer            Peer              // the datastructure representing the peer we are talking to. defined in peer.go
 	attempts        int               // reconnection attempts
 	TimeLastpacket  time.Time         // Time we last successfully recieved a packet or command.
@@ -45,6 +52,8 @@ type Connection struct {
 	state           uint8             // Current state of the connection. Private. Only communication
 	isOutGoing      bool              // We keep track of outgoing dial() vs incomming accept() connections
 	isPersistent    bool              // Persistent connections we always redail.
+	isEncrypted     bool              // The connection is encrypted, see secure.go
+	isLegacyPeer    bool              // The peer didn't answer the encrypted handshake on the last dial, so it is connected without encryption
 	notes           string            // Notes about the connection, for debugging (eg: error)
 	metrics         ConnectionMetrics // Metrics about this connection
 	Logger          *log.Entry
@@ -100,6 +109,8 @@ type ConnectionMetrics struct {
 	BytesReceived    uint32    // Keeping track of the data sent/recieved for console
 	MessagesSent     uint32    // Keeping track of the data sent/recieved for console
 	MessagesReceived uint32    // Keeping track of the data sent/recieved for console
+	BytesSavedSent   uint32    // Bytes compression saved on parcels we sent, see compression.go
+	BytesSavedRecv   uint32    // Bytes compression saved on parcels we received
 	PeerAddress      string    // Peer IP Address
 	PeerQuality      int32     // Quality of the connection.
 	// Red: Below -50
@@ -152,6 +163,10 @@ func (c *Connection) InitWithConn(conn net.Conn, peer Peer) *Connection {
 	c.isOutGoing = false // InitWithConn is called by controller's accept() loop
 	c.commonInit(peer)
 	c.isPersistent = false
+	if secure, ok := conn.(*SecureConn); ok {
+		c.isEncrypted = true
+		c.setNotes("Encrypted connection, peer node key %x", secure.PeerKey)
+	}
 	c.goOnline()
 	return c
 }
@@ -180,6 +195,10 @@ func (c *Connection) StatusString() string {
 func (c *Connection) IsPersistent() bool {
 	return c.isPersistent
 }
+
+func (c *Connection) IsEncrypted() bool {
+	return c.isEncrypted
+}
 func (c *Connection) Notes() string {
 	return c.notes
 }
@@ -197,8 +216,8 @@ func (c *Connection) commonInit(peer Peer) {
 	c.setNotes("commonInit()")
 	c.Errors = make(chan error, StandardChannelSize)
 	c.Commands = make(chan *ConnectionCommand, StandardChannelSize)
-	c.SendChannel = make(chan interface{}, StandardChannelSize)
-	c.ReceiveChannel = make(chan interface{}, StandardChannelSize)
+	c.SendQueue = NewPriorityQueue("connection_send", StandardChannelSize)
+	c.ReceiveQueue = NewPriorityQueue("connection_receive", StandardChannelSize)
 	c.ReceiveParcel = make(chan *Parcel, StandardChannelSize)
 	c.metrics = ConnectionMetrics{MomentConnected: time.Now()}
 	c.timeLastMetrics = time.Now()
@@ -275,7 +294,7 @@ func (c *Connection) runLoop() {
 		case ConnectionShuttingDown:
 			p2pConnectionRunLoopShutdown.Inc()
 			c.state = ConnectionClosed
-			BlockFreeChannelSend(c.ReceiveChannel, ConnectionCommand{Command: ConnectionIsClosed})
+			enqueue(c.ReceiveQueue, ConnectionCommand{Command: ConnectionIsClosed})
 			return // ending runloop() goroutine
 		default:
 			logfatal(c.peer.PeerIdent(), "runLoop() unknown state?: %s ", connectionStateStrings[c.state])
@@ -323,11 +342,45 @@ func (c *Connection) dial() bool {
 	address := c.peer.AddressPort()
 	// conn, err := net.Dial("tcp", c.peer.Address)
 	conn, err := net.DialTimeout("tcp", address, time.Second*10)
-	if nil == err {
+	if nil != err {
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			PeerReputation.Record(c.peer.Address, EventTimeout)
+		}
+		return false
+	}
+	// Every dial tries encryption first, so a handshake that failed once
+	// doesn't leave the peer on plaintext for good
+	c.isLegacyPeer = false
+	if EncryptionDisabled == Encryption {
 		c.conn = conn
+		c.isEncrypted = false
 		return true
 	}
-	return false
+
+	secure, err := SecureDial(conn)
+	switch {
+	case nil == err:
+		c.conn = secure
+		c.isEncrypted = true
+		c.setNotes("Encrypted connection, peer node key %x", secure.PeerKey)
+		return true
+	case ErrNotSecure == err && PlaintextFallbackAllowed():
+		// The peer has seen our hello and dropped us, so dial it again
+		conn.Close()
+		conn, err = net.DialTimeout("tcp", address, time.Second*10)
+		if nil != err {
+			return false
+		}
+		c.conn = conn
+		c.isEncrypted = false
+		c.isLegacyPeer = true
+		c.setNotes("Connection(%s) is a legacy peer, dialed without encryption", address)
+		return true
+	default:
+		conn.Close()
+		c.setNotes("Connection(%s) encrypted handshake failed: %v", address, err)
+		return false
+	}
 }
 
 // Called when we are online and connected to the peer.
@@ -335,7 +388,14 @@ func (c *Connection) goOnline() {
 	p2pConnectionOnlineCall.Inc()
 	now := time.Now()
 	c.encoder = gob.NewEncoder(c.conn)
-	c.decoder = gob.NewDecoder(c.conn)
+	// The decoder reads through our own buffer, so it doesn't read past the
+	// gobs when the peer switches to binary frames
+	c.reader = bufio.NewReader(c.conn)
+	c.decoder = gob.NewDecoder(c.reader)
+	c.binaryOut = false
+	c.binaryIn = false
+	c.binaryAsked = false
+	c.compressOut = false
 	c.attempts = 0
 	c.timeLastPing = now
 	c.timeLastAttempt = now
@@ -351,7 +411,7 @@ func (c *Connection) goOnline() {
 	// Now ask the other side for the peers they know about.
 	parcel := NewParcel(CurrentNetwork, []byte("Peer Request"))
 	parcel.Header.Type = TypePeerRequest
-	BlockFreeChannelSend(c.SendChannel, ConnectionParcel{Parcel: *parcel})
+	enqueue(c.SendQueue, ConnectionParcel{Parcel: *parcel})
 }
 
 func (c *Connection) goOffline() {
@@ -369,6 +429,7 @@ func (c *Connection) goShutdown() {
 	}
 	c.decoder = nil
 	c.encoder = nil
+	c.reader = nil
 	c.state = ConnectionShuttingDown
 }
 
@@ -386,14 +447,14 @@ func (c *Connection) processSends() {
 	}()
 
 	for ConnectionClosed != c.state && c.state != ConnectionShuttingDown {
-		// note(c.peer.PeerIdent(), "Connection.processSends() called. Items in send channel: %d State: %s", len(c.SendChannel), c.ConnectionState())
+		// note(c.peer.PeerIdent(), "Connection.processSends() called. Items in send queue: %d State: %s", c.SendQueue.Len(), c.ConnectionState())
 	conloop:
-		for ConnectionOnline == c.state && len(c.SendChannel) > 0 {
-			// This was blocking. By checking the length of the channel before entering, this does not block.
-			// The problem was this routine was blocked on a closed connection. Idealling we do want to block
-			// on a 0 length channel, and this is still possible if use a select and close the channel when we
-			// close the connection.
-			message := <-c.SendChannel
+		for ConnectionOnline == c.state {
+			// Receive doesn't block, so we don't get stuck here on a closed connection.
+			message, ok := c.SendQueue.Receive()
+			if !ok {
+				break conloop
+			}
 			switch message.(type) {
 			case ConnectionParcel:
 				if nil == c.decoder || nil == c.conn {
@@ -456,13 +517,27 @@ func (c *Connection) sendParcel(parcel Parcel) {
 	//	deadline = time.Now().Add(time.Duration(ms)*time.Millisecond)
 	//}
 	//c.conn.SetWriteDeadline(deadline)
-	encode := c.encoder
-	err := encode.Encode(parcel)
+	var err error
+	saved := 0
+	if c.binaryOut {
+		saved, err = writeParcelFrame(c.conn, &parcel, c.compressOut)
+	} else {
+		err = c.encoder.Encode(parcel)
+		if nil == err && TypeBinaryFraming == parcel.Header.Type {
+			c.binaryOut = true
+		}
+	}
 	switch {
 	case nil == err:
 		c.metrics.BytesSent += parcel.Header.Length
 		c.metrics.MessagesSent += 1
+		c.metrics.BytesSavedSent += uint32(saved)
+		p2pCompressionBytesSaved.WithLabelValues("sent").Add(float64(saved))
 	default:
+		// Only a write that runs past its deadline is the peer's doing
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			PeerReputation.Record(c.peer.Address, EventTimeout)
+		}
 		c.Errors <- err
 	}
 }
@@ -488,15 +563,34 @@ func (c *Connection) processReceives() {
 			var message Parcel
 
 			// c.conn.SetReadDeadline(time.Now().Add(NetworkDeadline))
-			err := c.decoder.Decode(&message)
+			var err error
+			saved := 0
+			if c.binaryIn {
+				saved, err = readParcelFrame(c.reader, &message)
+			} else {
+				err = c.decoder.Decode(&message)
+			}
+			if nil == err && c.switchFraming(message) {
+				continue
+			}
 			switch {
 			case nil == err:
 				c.metrics.BytesReceived += message.Header.Length
 				c.metrics.MessagesReceived += 1
+				c.metrics.BytesSavedRecv += uint32(saved)
+				p2pCompressionBytesSaved.WithLabelValues("received").Add(float64(saved))
 				message.Header.PeerAddress = c.peer.Address
+				// Backpressure from the controller slows our reads from
+				// the peer here, rather than blocking the runloop
+				c.ReceiveQueue.WaitForRoom(BackpressureTimeout)
 				c.ReceiveParcel <- &message
 				c.TimeLastpacket = time.Now()
 			default:
+				// A stream we can't decode is the peer's doing, unlike
+				// the connection closing
+				if _, isNetError := err.(net.Error); !isNetError && io.EOF != err && io.ErrUnexpectedEOF != err {
+					PeerReputation.Record(c.peer.Address, EventInvalidMessage)
+				}
 				c.Errors <- err
 			}
 		}
@@ -505,7 +599,26 @@ func (c *Connection) processReceives() {
 	}
 }
 
-//handleNetErrors Reacts to errors we get from encoder or decoder
+// switchFraming switches to binary frames when the peer can do them, see
+// framing.go.  It returns true if the parcel was only about the switch.
+func (c *Connection) switchFraming(message Parcel) bool {
+	if !c.binaryAsked && ProtocolVersionBinary <= message.Header.Version {
+		c.binaryAsked = true
+		// Set before the switch parcel goes on the channel, so processSends
+		// sees it once it switches
+		c.compressOut = ProtocolVersionCompression <= message.Header.Version
+		parcel := NewParcel(CurrentNetwork, []byte("Binary Framing"))
+		parcel.Header.Type = TypeBinaryFraming
+		enqueue(c.SendQueue, ConnectionParcel{Parcel: *parcel})
+	}
+	if TypeBinaryFraming == message.Header.Type {
+		c.binaryIn = true
+		return true
+	}
+	return false
+}
+
+// handleNetErrors Reacts to errors we get from encoder or decoder
 func (c *Connection) handleNetErrors(toss bool) {
 	done := false
 	for {
@@ -538,6 +651,7 @@ func (c *Connection) handleParcel(parcel Parcel) {
 	defer func() {
 		if r := recover(); r != nil {
 			c.peer.demerit() /// so someone DDoS or just incompatible will eventually be cut off after 200+ panics
+			PeerReputation.Record(c.peer.Address, EventInvalidMessage)
 			fmt.Fprintf(os.Stdout, "Caught Exception in connection %s: %v\n", c.peer.PeerFixedIdent(), r)
 			return
 		}
@@ -558,6 +672,7 @@ func (c *Connection) handleParcel(parcel Parcel) {
 		debug(c.peer.PeerIdent(), "Connection.handleParcel() got invalid message")
 		parcel.Print()
 		c.peer.demerit()
+		PeerReputation.Record(c.peer.Address, EventInvalidMessage)
 		return
 	case ParcelValid:
 		parcel.Trace("Connection.handleParcel()-ParcelValid", "I")
@@ -622,25 +737,29 @@ func (c *Connection) handleParcelTypes(parcel Parcel) {
 		// Send Pong
 		pong := NewParcel(CurrentNetwork, []byte("Pong"))
 		pong.Header.Type = TypePong
-		BlockFreeChannelSend(c.SendChannel, ConnectionParcel{Parcel: *pong})
+		enqueue(c.SendQueue, ConnectionParcel{Parcel: *pong})
 	case TypePong: // all we need is the timestamp which is set already
 		return
 	case TypePeerRequest:
-		BlockFreeChannelSend(c.ReceiveChannel, ConnectionParcel{Parcel: parcel}) // Controller handles these.
+		enqueue(c.ReceiveQueue, ConnectionParcel{Parcel: parcel}) // Controller handles these.
 	case TypePeerResponse:
-		BlockFreeChannelSend(c.ReceiveChannel, ConnectionParcel{Parcel: parcel}) // Controller handles these.
+		enqueue(c.ReceiveQueue, ConnectionParcel{Parcel: parcel}) // Controller handles these.
+	case TypeInventory, TypeGetData:
+		enqueue(c.ReceiveQueue, ConnectionParcel{Parcel: parcel}) // Controller handles these.
 	case TypeMessage:
 		c.peer.QualityScore = c.peer.QualityScore + 1
+		PeerReputation.Record(c.peer.Address, EventUsefulData)
 		// Store our connection ID so the controller can direct response to us.
 		parcel.Header.TargetPeer = c.peer.Hash
 		parcel.Header.NodeID = NodeID
-		BlockFreeChannelSend(c.ReceiveChannel, ConnectionParcel{Parcel: parcel}) // Controller handles these.
+		enqueue(c.ReceiveQueue, ConnectionParcel{Parcel: parcel}) // Controller handles these.
 	case TypeMessagePart:
 		c.peer.QualityScore = c.peer.QualityScore + 1
+		PeerReputation.Record(c.peer.Address, EventUsefulData)
 		// Store our connection ID so the controller can direct response to us.
 		parcel.Header.TargetPeer = c.peer.Hash
 		parcel.Header.NodeID = NodeID
-		BlockFreeChannelSend(c.ReceiveChannel, ConnectionParcel{Parcel: parcel}) // Controller handles these.
+		enqueue(c.ReceiveQueue, ConnectionParcel{Parcel: parcel}) // Controller handles these.
 	default:
 		significant(c.peer.PeerIdent(), "!!!!!!!!!!!!!!!!!! Got message of unknown type?")
 	}
@@ -658,14 +777,14 @@ func (c *Connection) pingPeer() {
 			parcel.Header.Type = TypePing
 			c.timeLastPing = time.Now()
 			c.attempts++
-			BlockFreeChannelSend(c.SendChannel, ConnectionParcel{Parcel: *parcel})
+			enqueue(c.SendQueue, ConnectionParcel{Parcel: *parcel})
 		}
 	}
 }
 
 func (c *Connection) updatePeer() {
 	c.timeLastUpdate = time.Now()
-	BlockFreeChannelSend(c.ReceiveChannel, ConnectionCommand{Command: ConnectionUpdatingPeer, Peer: c.peer})
+	enqueue(c.ReceiveQueue, ConnectionCommand{Command: ConnectionUpdatingPeer, Peer: c.peer})
 }
 
 func (c *Connection) updateStats() {
@@ -676,7 +795,7 @@ func (c *Connection) updateStats() {
 		c.metrics.ConnectionState = connectionStateStrings[c.state]
 		c.metrics.ConnectionNotes = c.notes
 		verbose(c.peer.PeerIdent(), "updatePeer() SENDING ConnectionUpdateMetrics - Bytes Sent: %d Bytes Received: %d", c.metrics.BytesSent, c.metrics.BytesReceived)
-		BlockFreeChannelSend(c.ReceiveChannel, ConnectionCommand{Command: ConnectionUpdateMetrics, Metrics: c.metrics})
+		enqueue(c.ReceiveQueue, ConnectionCommand{Command: ConnectionUpdateMetrics, Metrics: c.metrics})
 	}
 }
 
@@ -688,6 +807,6 @@ func (c *Connection) connectionStatusReport() {
 	reportDuration := time.Since(c.timeLastStatus)
 	if reportDuration > ConnectionStatusInterval {
 		c.timeLastStatus = time.Now()
-		significant("connection-report", "\n\n===============================================================================\n     Connection: %s\n          State: %s\n          Notes: %s\n           Hash: %s\n     Persistent: %t\n       Outgoing: %t\n ReceiveChannel: %d\n    SendChannel: %d\n\tConnStatusInterval:\t%s\n\treportDuration:\t\t%s\n\tTime Online:\t\t%s \nMsgs/Bytes: %d / %d \n==============================================================================\n\n", c.peer.AddressPort(), c.ConnectionState(), c.Notes(), c.peer.Hash[0:12], c.IsPersistent(), c.IsOutGoing(), len(c.ReceiveChannel), len(c.SendChannel), ConnectionStatusInterval.String(), reportDuration.String(), time.Since(c.timeLastAttempt), c.metrics.MessagesReceived+c.metrics.MessagesSent, c.metrics.BytesSent+c.metrics.BytesReceived)
+		significant("connection-report", "\n\n===============================================================================\n     Connection: %s\n          State: %s\n          Notes: %s\n           Hash: %s\n     Persistent: %t\n       Outgoing: %t\n   ReceiveQueue: %d\n      SendQueue: %d\n\tConnStatusInterval:\t%s\n\treportDuration:\t\t%s\n\tTime Online:\t\t%s \nMsgs/Bytes: %d / %d \n==============================================================================\n\n", c.peer.AddressPort(), c.ConnectionState(), c.Notes(), c.peer.Hash[0:12], c.IsPersistent(), c.IsOutGoing(), c.ReceiveQueue.Len(), c.SendQueue.Len(), ConnectionStatusInterval.String(), reportDuration.String(), time.Since(c.timeLastAttempt), c.metrics.MessagesReceived+c.metrics.MessagesSent, c.metrics.BytesSent+c.metrics.BytesReceived)
 	}
 }
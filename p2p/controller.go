@@ -39,8 +39,8 @@ type Controller struct {
 	// After launching the network, the management is done via these channels.
 	commandChannel chan interface{} // Application use controller public API to send commands on this channel to controllers goroutines.
 
-	ToNetwork   chan interface{} // Parcels from the application for us to route
-	FromNetwork chan interface{} // Parcels from the network for the application
+	ToNetwork   *PriorityQueue // Parcels from the application for us to route
+	FromNetwork *PriorityQueue // Parcels from the network for the application
 
 	connectionMetricsChannel chan interface{} // Channel on which we put the connection metrics map, periodically.
 
@@ -57,19 +57,30 @@ type Controller struct {
 	lastStatusReport           time.Time
 	lastPeerRequest            time.Time       // Last time we asked peers about the peers they know about.
 	specialPeersString         string          // configuration set special peers
+	lastBanCheck               time.Time       // Last time we dropped connections to banned peers
 	partsAssembler             *PartsAssembler // a data structure that assembles full messages from received message parts
+	gossip                     *gossip         // Announce-then-fetch broadcasts, see gossip.go
+	handshakes                 chan struct{}   // A slot for each accepted connection in the encrypted handshake
 }
 
 type ControllerInit struct {
-	Port                     string           // Port to listen on
-	PeersFile                string           // Path to file to find / save peers
-	Network                  NetworkID        // Network - eg MainNet, TestNet etc.
-	Exclusive                bool             // flag to indicate we should only connect to trusted peers
-	SeedURL                  string           // URL to a source of peer info
-	SpecialPeers             string           // Peers to always connect to at startup, and stay persistent
-	ConnectionMetricsChannel chan interface{} // Channel on which we put the connection metrics map, periodically.
-	LogPath                  string           // Path for logs
-	LogLevel                 string           // Logging level
+	Port                     string                 // Port to listen on
+	PeersFile                string                 // Path to file to find / save peers
+	Network                  NetworkID              // Network - eg MainNet, TestNet etc.
+	Exclusive                bool                   // flag to indicate we should only connect to trusted peers
+	SeedURL                  string                 // Sources of peer info, tried in order, see seeds.go
+	SpecialPeers             string                 // Peers to always connect to at startup, and stay persistent
+	ConnectionMetricsChannel chan interface{}       // Channel on which we put the connection metrics map, periodically.
+	LogPath                  string                 // Path for logs
+	LogLevel                 string                 // Logging level
+	Encryption               EncryptionMode         // Whether connections are encrypted, see secure.go
+	NodeKey                  *primitives.PrivateKey // Key to sign encrypted handshakes with
+	TrustedNodeKeys          []string               // Node keys (hex) peers must have, any if empty
+	SeedKeys                 []string               // Keys (hex) seed lists must be signed with, unsigned lists are fine if empty
+	BanScore                 int32                  // Peers whose reputation falls to this are banned, see reputation.go
+	BanDuration              time.Duration          // How long bans last
+	Scoring                  []string               // Weights of the peer events, as event:weight
+	Broadcast                BroadcastMode          // Whether large broadcasts are flooded or gossiped, see gossip.go
 }
 
 // CommandDialPeer is used to instruct the Controller to dial a peer address
@@ -177,9 +188,9 @@ func (c *Controller) Init(ci ControllerInit) *Controller {
 	RandomGenerator = rand.New(rand.NewSource(time.Now().UnixNano()))
 	NodeID = uint64(RandomGenerator.Int63()) // This is a global used by all connections
 	c.keepRunning = true
-	c.commandChannel = make(chan interface{}, StandardChannelSize) // Commands from App
-	c.FromNetwork = make(chan interface{}, StandardChannelSize)    // Channel to the app for network data
-	c.ToNetwork = make(chan interface{}, StandardChannelSize)      // Parcels from the app for the network
+	c.commandChannel = make(chan interface{}, StandardChannelSize)        // Commands from App
+	c.FromNetwork = NewPriorityQueue("from_network", StandardChannelSize) // Queue to the app for network data
+	c.ToNetwork = NewPriorityQueue("to_network", StandardChannelSize)     // Parcels from the app for the network
 	c.connections = make(map[string]*Connection)
 	c.connectionsByAddress = make(map[string]*Connection)
 	c.connectionMetrics = make(map[string]ConnectionMetrics)
@@ -190,10 +201,31 @@ func (c *Controller) Init(ci ControllerInit) *Controller {
 	c.lastPeerRequest = time.Now()
 	CurrentNetwork = ci.Network
 	OnlySpecialPeers = ci.Exclusive
+	Encryption = ci.Encryption
+	Broadcast = ci.Broadcast
+	if nil != ci.NodeKey {
+		NodeKey = ci.NodeKey
+	}
+	if err := SetTrustedNodeKeys(ci.TrustedNodeKeys); nil != err {
+		logfatal("ctrlr", "Controller.Init() Error: %+v", err)
+	}
+	if err := SetSeedKeys(ci.SeedKeys); nil != err {
+		logfatal("ctrlr", "Controller.Init() Error: %+v", err)
+	}
+	weights, err := ParseWeightPolicy(ci.Scoring)
+	if nil != err {
+		logfatal("ctrlr", "Controller.Init() Error: %+v", err)
+	}
+	PeerReputation = NewReputation(bansFileFor(ci.PeersFile), ci.BanScore, ci.BanDuration, weights)
+	if err := PeerReputation.LoadBans(); nil != err {
+		logerror("ctrlr", "Controller.Init() could not load bans: %+v", err)
+	}
 	c.specialPeersString = ci.SpecialPeers
 	c.lastDiscoveryRequest = time.Now() // Discovery does its own on startup.
 	c.lastConnectionMetricsUpdate = time.Now()
 	c.partsAssembler = new(PartsAssembler).Init()
+	c.gossip = newGossip()
+	c.handshakes = make(chan struct{}, MaxConcurrentHandshakes)
 	discovery := new(Discovery).Init(ci.PeersFile, ci.SeedURL)
 	c.discovery = *discovery
 	// Set this to the past so we will do peer management almost right away after starting up.
@@ -220,13 +252,13 @@ func (c *Controller) DialSpecialPeersString(peersString string) {
 	}
 	peerAddresses := strings.FieldsFunc(peersString, parseFunc)
 	for _, peerAddress := range peerAddresses {
-		ipPort := strings.Split(peerAddress, ":")
-		if len(ipPort) == 2 {
-			peer := new(Peer).Init(ipPort[0], ipPort[1], 0, SpecialPeer, 0)
+		address, port, err := SplitAddressPort(peerAddress)
+		if nil == err {
+			peer := new(Peer).Init(address, port, 0, SpecialPeer, 0)
 			peer.Source["Local-Configuration"] = time.Now()
 			c.DialPeer(*peer, true) // these are persistent connections
 		} else {
-			logfatal("Controller", "Error: %s is not a valid peer, use format: 127.0.0.1:8999", peerAddress)
+			logfatal("Controller", "Error: %s is not a valid peer, use format: 127.0.0.1:8999 or [::1]:8999", peerAddress)
 		}
 	}
 }
@@ -305,6 +337,14 @@ func (c *Controller) acceptLoop(listener net.Listener) {
 		switch err {
 		case nil:
 			switch {
+			case c.numberIncommingConnections < MaxNumberIncommingConnections && EncryptionDisabled != Encryption:
+				select {
+				case c.handshakes <- struct{}{}:
+					go c.acceptHandshake(conn) // Adds the peer once we know if the connection is encrypted
+				default:
+					note("ctrlr", "Controller.acceptLoop() new peer, but too many handshakes in progress. %d", MaxConcurrentHandshakes)
+					conn.Close()
+				}
 			case c.numberIncommingConnections < MaxNumberIncommingConnections:
 				c.AddPeer(conn) // Sends command to add the peer to the peers list
 				note("ctrlr", "Controller.acceptLoop() new peer: %+v", conn)
@@ -318,6 +358,25 @@ func (c *Controller) acceptLoop(listener net.Listener) {
 	}
 }
 
+// acceptHandshake runs the encrypted handshake of an accepted connection, in
+// its own goroutine so a slow peer can't hold up the accept loop.  It holds
+// one of the handshake slots until it is done.
+func (c *Controller) acceptHandshake(conn net.Conn) {
+	defer func() { <-c.handshakes }()
+	secured, encrypted, err := SecureAccept(conn)
+	switch {
+	case nil != err:
+		note("ctrlr", "Controller.acceptHandshake() handshake with %s failed: %+v", conn.RemoteAddr(), err)
+		conn.Close()
+	case !encrypted && !PlaintextFallbackAllowed():
+		note("ctrlr", "Controller.acceptHandshake() refusing unencrypted connection from %s", conn.RemoteAddr())
+		conn.Close()
+	default:
+		c.AddPeer(secured) // Sends command to add the peer to the peers list
+		note("ctrlr", "Controller.acceptHandshake() new peer: %+v encrypted: %t", conn, encrypted)
+	}
+}
+
 //////////////////////////////////////////////////////////////////////
 // Operations
 //////////////////////////////////////////////////////////////////////
@@ -336,8 +395,8 @@ func (c *Controller) runloop() {
 		significant("ctrlr", "     # Connections: %d", len(c.connections))
 		significant("ctrlr", "Unique Connections: %d", len(c.connectionsByAddress))
 		significant("ctrlr", "     Command Queue: %d", len(c.commandChannel))
-		significant("ctrlr", "         ToNetwork: %d", len(c.ToNetwork))
-		significant("ctrlr", "       FromNetwork: %d", len(c.FromNetwork))
+		significant("ctrlr", "         ToNetwork: %d", c.ToNetwork.Len())
+		significant("ctrlr", "       FromNetwork: %d", c.FromNetwork.Len())
 		significant("ctrlr", "        Total RECV: %d", TotalMessagesRecieved)
 		significant("ctrlr", "  Application RECV: %d", ApplicationMessagesRecieved)
 		significant("ctrlr", "        Total XMIT: %d", TotalMessagesSent)
@@ -387,6 +446,7 @@ func (c *Controller) runloop() {
 			c.networkStatusReport()
 		}
 		dot("@@7\n")
+		c.enforceBans()
 		c.updateMetrics()
 		dot("@@11\n")
 	}
@@ -400,8 +460,11 @@ func (c *Controller) route() {
 	// Recieve messages from the peers & forward to application.
 	for peerHash, connection := range c.connections {
 		// Empty the recieve channel, stuff the application channel.
-		for 0 < len(connection.ReceiveChannel) { // effectively "While there are messages"
-			message := <-connection.ReceiveChannel
+		for { // effectively "While there are messages"
+			message, ok := connection.ReceiveQueue.Receive()
+			if !ok {
+				break
+			}
 			switch message.(type) {
 			case ConnectionCommand:
 				c.handleConnectionCommand(message.(ConnectionCommand), *connection)
@@ -414,9 +477,12 @@ func (c *Controller) route() {
 	}
 	// For each message, see if it is directed, if so, send to the
 	// specific peer, otherwise, broadcast.
-	// significant("ctrlr", "Controller.route() size of ToNetwork channel: %d", len(c.ToNetwork))
-	for 0 < len(c.ToNetwork) { // effectively "While there are messages"
-		message := <-c.ToNetwork
+	// significant("ctrlr", "Controller.route() size of ToNetwork queue: %d", c.ToNetwork.Len())
+	for { // effectively "While there are messages"
+		message, ok := c.ToNetwork.Receive()
+		if !ok {
+			break
+		}
 		parcel := message.(Parcel)
 		TotalMessagesSent++
 		switch parcel.Header.TargetPeer {
@@ -440,6 +506,7 @@ func (c *Controller) route() {
 			// Note that if we run over the end of the connections, we wrap back to the start.  We don't assume
 			// an order of connections, but we do assume that if we range over a map twice, we get the keys in
 			// the same order both times.  (We do not modify the map)
+			hash := c.offerBroadcast(parcel)
 			cnt := 0
 			start := rand.Int() % clen
 			spot := start
@@ -448,7 +515,7 @@ func (c *Controller) route() {
 				loopcnt := 0
 				for _, connection := range c.connections {
 					if loopcnt == spot {
-						BlockFreeChannelSend(connection.SendChannel, ConnectionParcel{Parcel: parcel})
+						c.broadcastTo(connection, parcel, hash)
 						spot++
 						if spot >= clen {
 							spot = 0
@@ -489,12 +556,13 @@ func (c *Controller) route() {
 			c.doDirectedSend(parcel)
 		}
 	}
+	c.sendInventories()
 }
 
 func (c *Controller) doDirectedSend(parcel Parcel) {
 	connection, present := c.connections[parcel.Header.TargetPeer]
 	if present { // We're still connected to the target
-		BlockFreeChannelSend(connection.SendChannel, ConnectionParcel{Parcel: parcel})
+		enqueue(connection.SendQueue, ConnectionParcel{Parcel: parcel})
 	}
 }
 
@@ -504,25 +572,31 @@ func (c *Controller) handleParcelReceive(message interface{}, peerHash string, c
 	parameters := message.(ConnectionParcel)
 	parcel := parameters.Parcel
 	parcel.Header.TargetPeer = peerHash // Set the connection ID so the application knows which peer the message is from.
+	c.gossip.versions[peerHash] = parcel.Header.Version
 	switch parcel.Header.Type {
 	case TypeMessage: // Application message, send it on.
 		ApplicationMessagesRecieved++
-		BlockFreeChannelSend(c.FromNetwork, parcel)
+		c.receivedMessage(parcel, peerHash)
+		enqueue(c.FromNetwork, parcel)
 	case TypeMessagePart: // A part of the application message, handle by assembler and if we have the full message, send it on.
 		assembled := c.partsAssembler.handlePart(parcel)
 		if assembled != nil {
 			ApplicationMessagesRecieved++
-			BlockFreeChannelSend(c.FromNetwork, *assembled)
+			enqueue(c.FromNetwork, *assembled)
 		}
-	case TypePeerRequest: // send a response to the connection over its connection.SendChannel
+	case TypePeerRequest: // send a response to the connection over its connection.SendQueue
 		// Get selection of peers from discovery
 		response := NewParcel(CurrentNetwork, c.discovery.SharePeers())
 		response.Header.Type = TypePeerResponse
 		// Send them out to the network - on the connection that requested it!
-		BlockFreeChannelSend(connection.SendChannel, ConnectionParcel{Parcel: *response})
+		enqueue(connection.SendQueue, ConnectionParcel{Parcel: *response})
 	case TypePeerResponse:
 		// Add these peers to our known peers
 		c.discovery.LearnPeers(parcel)
+	case TypeInventory: // The peer announces messages, see gossip.go
+		c.handleInventory(parcel, connection)
+	case TypeGetData: // The peer asks for messages it saw announced
+		c.handleGetData(parcel, connection)
 	default:
 		logfatal("ctrlr", "handleParcelReceive() unknown parcel.Header.Type?: %+v ", parcel)
 	}
@@ -537,6 +611,7 @@ func (c *Controller) handleConnectionCommand(command ConnectionCommand, connecti
 		delete(c.connectionsByAddress, connection.peer.Address)
 		delete(c.connections, connection.peer.Hash)
 		delete(c.connectionMetrics, connection.peer.Hash)
+		c.gossipConnectionClosed(connection.peer.Hash)
 		go connection.goShutdown()
 	case ConnectionUpdatingPeer:
 		c.discovery.updatePeer(command.Peer)
@@ -549,6 +624,14 @@ func (c *Controller) handleCommand(command interface{}) {
 	switch commandType := command.(type) {
 	case CommandDialPeer: // parameter is the peer address
 		parameters := command.(CommandDialPeer)
+		// Special and persistent peers are always dialed, so they are never
+		// banned for timing out or misbehaving
+		if parameters.persistent {
+			PeerReputation.Exempt(parameters.peer.Address)
+		} else if PeerReputation.IsBanned(parameters.peer.Address) {
+			note("ctrlr", "Controller.handleCommand() not dialing banned peer %s", parameters.peer.AddressPort())
+			return
+		}
 		conn := new(Connection).Init(parameters.peer, parameters.persistent)
 		conn.Start()
 
@@ -558,9 +641,19 @@ func (c *Controller) handleCommand(command interface{}) {
 
 		parameters := command.(CommandAddPeer)
 		conn := parameters.conn // net.Conn
-		addPort := strings.Split(conn.RemoteAddr().String(), ":")
+		address, port, err := SplitAddressPort(conn.RemoteAddr().String())
+		if nil != err {
+			logerror("ctrlr", "Controller.handleCommand() bad remote address %s: %+v", conn.RemoteAddr(), err)
+			conn.Close()
+			return
+		}
+		if PeerReputation.IsBanned(address) {
+			note("ctrlr", "Controller.handleCommand() refusing banned peer %s", conn.RemoteAddr())
+			conn.Close()
+			return
+		}
 		// Port initially stored will be the connection port (not the listen port), but peer will update it on first message.
-		peer := new(Peer).Init(addPort[0], addPort[1], 0, RegularPeer, 0)
+		peer := new(Peer).Init(address, port, 0, RegularPeer, 0)
 		peer.Source["Accept()"] = time.Now()
 		connection := new(Connection).InitWithConn(conn, *peer)
 		connection.Start()
@@ -579,13 +672,16 @@ func (c *Controller) handleCommand(command interface{}) {
 	case CommandBan:
 		parameters := command.(CommandBan)
 		peerHash := parameters.PeerHash
+		if connection, present := c.connections[peerHash]; present {
+			PeerReputation.Ban(connection.peer.Address, "banned by the application", 0)
+		}
 		c.applicationPeerUpdate(BannedQualityScore, peerHash)
 	case CommandDisconnect:
 		parameters := command.(CommandDisconnect)
 		peerHash := parameters.PeerHash
 		connection, present := c.connections[peerHash]
 		if present {
-			BlockFreeChannelSend(connection.SendChannel, ConnectionCommand{Command: ConnectionShutdownNow})
+			enqueue(connection.SendQueue, ConnectionCommand{Command: ConnectionShutdownNow})
 		}
 	default:
 		logfatal("ctrlr", "Unkown p2p.Controller command recieved: %+v", commandType)
@@ -595,7 +691,22 @@ func (c *Controller) handleCommand(command interface{}) {
 func (c *Controller) applicationPeerUpdate(qualityDelta int32, peerHash string) {
 	connection, present := c.connections[peerHash]
 	if present {
-		BlockFreeChannelSend(connection.SendChannel, ConnectionCommand{Command: ConnectionAdjustPeerQuality, Delta: qualityDelta})
+		enqueue(connection.SendQueue, ConnectionCommand{Command: ConnectionAdjustPeerQuality, Delta: qualityDelta})
+	}
+}
+
+// enforceBans disconnects from banned peers, including ones banned through
+// the API.  Runs once a second.
+func (c *Controller) enforceBans() {
+	if time.Second > time.Since(c.lastBanCheck) {
+		return
+	}
+	c.lastBanCheck = time.Now()
+	for _, connection := range c.connections {
+		if PeerReputation.IsBanned(connection.peer.Address) {
+			note("ctrlr", "Controller.enforceBans() disconnecting banned peer %s", connection.peer.PeerIdent())
+			enqueue(connection.SendQueue, ConnectionCommand{Command: ConnectionShutdownNow})
+		}
 	}
 }
 
@@ -634,7 +745,7 @@ func (c *Controller) managePeers() {
 			parcel := *parcelp
 			parcel.Header.Type = TypePeerRequest
 			for _, connection := range c.connections {
-				BlockFreeChannelSend(connection.SendChannel, ConnectionParcel{Parcel: parcel})
+				enqueue(connection.SendQueue, ConnectionParcel{Parcel: parcel})
 			}
 		}
 	}
@@ -704,6 +815,8 @@ func (c *Controller) updateMetrics() {
 					BytesReceived:    metrics.BytesReceived,
 					MessagesSent:     metrics.MessagesSent,
 					MessagesReceived: metrics.MessagesReceived,
+					BytesSavedSent:   metrics.BytesSavedSent,
+					BytesSavedRecv:   metrics.BytesSavedRecv,
 					PeerAddress:      metrics.PeerAddress,
 					PeerQuality:      metrics.PeerQuality,
 					ConnectionState:  metrics.ConnectionState,
@@ -721,7 +834,7 @@ func (c *Controller) shutdown() {
 	debug("ctrlr", "Controller.shutdown() ")
 	// Go thru peer list and shut down connections.
 	for _, connection := range c.connections {
-		BlockFreeChannelSend(connection.SendChannel, ConnectionCommand{Command: ConnectionShutdownNow})
+		enqueue(connection.SendQueue, ConnectionCommand{Command: ConnectionShutdownNow})
 	}
 	c.keepRunning = false
 }
@@ -755,13 +868,13 @@ func (c *Controller) networkStatusReport() {
 			silence("ctrlr", "Location: %d", v.peer.Location)
 			silence("ctrlr", "%s\t%s\t%s\t%s", v.peer.PeerFixedIdent(), time.Since(metrics.MomentConnected), metrics.ConnectionState, metrics.ConnectionNotes)
 			silence("ctrlr", "IsOutgoing: %t\tIsOnline: %t\tStatus: %s Quality: %d", v.IsOutGoing(), v.IsOnline(), v.StatusString(), metrics.PeerQuality)
-			silence("ctrlr", "Sent/Recv: %d / %d\t\t Chan Send/Recv: %d / %d", metrics.MessagesSent, metrics.MessagesReceived, len(v.SendChannel), len(v.ReceiveChannel))
+			silence("ctrlr", "Sent/Recv: %d / %d\t\t Chan Send/Recv: %d / %d", metrics.MessagesSent, metrics.MessagesReceived, v.SendQueue.Len(), v.ReceiveQueue.Len())
 			silence("ctrlr", ".")
 		}
 		silence("ctrlr", "\tChannels:")
 		silence("ctrlr", "          commandChannel: %d", len(c.commandChannel))
-		silence("ctrlr", "               ToNetwork: %d", len(c.ToNetwork))
-		silence("ctrlr", "             FromNetwork: %d", len(c.FromNetwork))
+		silence("ctrlr", "               ToNetwork: %d", c.ToNetwork.Len())
+		silence("ctrlr", "             FromNetwork: %d", c.FromNetwork.Len())
 		silence("ctrlr", "connectionMetricsChannel: %d", len(c.connectionMetricsChannel))
 		silence("ctrlr", "===================================")
 		silence("ctrlr", "###################################\n\n\n")
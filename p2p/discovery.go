@@ -9,11 +9,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"math/rand"
-	"net/http"
 	"os"
 	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 )
@@ -84,12 +82,17 @@ func (d *Discovery) LoadPeers() {
 	dec := json.NewDecoder(bufio.NewReader(file))
 	UpdateKnownPeers.Lock()
 	dec.Decode(&d.knownPeers)
-	// since this is run at startup, reset quality scores.
+	// since this is run at startup, reset quality scores.  The peers are
+	// keyed again by canonical address in a new map, as changing a map while
+	// ranging over it may visit a peer twice or not at all.
+	knownPeers := map[string]Peer{}
 	for _, peer := range d.knownPeers {
 		peer.QualityScore = 0
+		peer.Address = CanonicalAddress(peer.Address)
 		peer.Location = peer.LocationFromAddress()
-		d.knownPeers[peer.Address] = peer
+		knownPeers[peer.Address] = peer
 	}
+	d.knownPeers = knownPeers
 	UpdateKnownPeers.Unlock()
 	note("discovery", "LoadPeers() found %d peers in peers.josn", len(d.knownPeers))
 	file.Close()
@@ -145,6 +148,8 @@ func (d *Discovery) LearnPeers(parcel Parcel) {
 	filteredArray := d.filterPeersFromOtherNetworks(peerArray)
 	for _, value := range filteredArray {
 		value.QualityScore = 0
+		value.Address = CanonicalAddress(value.Address)
+		value.Location = value.LocationFromAddress()
 		switch d.isPeerPresent(value) {
 		case true:
 			alreadyKnownPeer := d.getPeer(value.Address)
@@ -182,10 +187,11 @@ func (d *Discovery) filterPeersFromOtherNetworks(peers []Peer) (filtered []Peer)
 func (d *Discovery) filterForUniqueIPAdresses(peers []Peer) (filtered []Peer) {
 	unique := map[string]Peer{}
 	for _, peer := range peers {
-		_, present := unique[peer.Address]
+		address := CanonicalAddress(peer.Address)
+		_, present := unique[address]
 		if !present {
 			filtered = append(filtered, peer)
-			unique[peer.Address] = peer
+			unique[address] = peer
 		}
 	}
 	return
@@ -263,7 +269,7 @@ func (d *Discovery) getPeerSelection() []byte {
 	// var currentBestDistance float64
 	selectedPeers := []Peer{}
 	firstPassPeers := []Peer{}
-	specialPeersByLocation := map[uint32]Peer{}
+	specialPeersByAddress := map[string]Peer{}
 	UpdateKnownPeers.Lock()
 	for _, peer := range d.knownPeers {
 		if peer.QualityScore > MinumumSharingQualityScore { // Only share peers that have earned positive reputation
@@ -273,16 +279,16 @@ func (d *Discovery) getPeerSelection() []byte {
 	UpdateKnownPeers.Unlock()
 	peerPool := d.filterPeersFromOtherNetworks(firstPassPeers)
 	sort.Sort(PeerQualitySort(peerPool))
-	// Pull out special peers by location.  Use location because it should more accurately reflect IP address.
-	// we check by location to keep from sharing special peers when they dial into us (in which case we wouldn't realize
+	// Pull out special peers by address.  Addresses are canonical, so an IPv4 or IPv6 address is written one way.
+	// we check by address to keep from sharing special peers when they dial into us (in which case we wouldn't realize
 	// they were special by the flag.)
 	for _, peer := range peerPool {
 		if peer.Type == SpecialPeer {
-			specialPeersByLocation[peer.Location] = peer
+			specialPeersByAddress[CanonicalAddress(peer.Address)] = peer
 		}
 	}
 	for _, peer := range peerPool {
-		_, present := specialPeersByLocation[peer.Location]
+		_, present := specialPeersByAddress[CanonicalAddress(peer.Address)]
 		switch {
 		case SpecialPeer == peer.Type:
 			break
@@ -304,29 +310,24 @@ func (d *Discovery) getPeerSelection() []byte {
 	return json
 }
 
-// DiscoverPeers gets a set of peers from a DNS Seed
+// DiscoverPeersFromSeed gets a set of peers from the seed sources (see seeds.go)
 func (d *Discovery) DiscoverPeersFromSeed() {
-	resp, err := http.Get(d.seedURL)
+	peers, source, err := FetchSeeds(d.seedURL)
 	if nil != err {
 		logerror("discovery", "DiscoverPeersFromSeed getting peers from %s produced error %+v", d.seedURL, err)
 		return
 	}
-	defer resp.Body.Close()
-	var lines []string
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
-	for _, line := range lines {
-		ipAndPort := strings.Split(line, ":")
-		if 2 == len(ipAndPort) {
-			peerp := new(Peer).Init(ipAndPort[0], ipAndPort[1], 0, RegularPeer, 0)
-			peer := *peerp
-			peer.LastContact = time.Now()
-			d.updatePeer(d.updatePeerSource(peer, "DNS-Seed"))
+	for _, address := range peers {
+		host, port, err := SplitAddressPort(address)
+		if nil != err {
+			continue
 		}
+		peerp := new(Peer).Init(host, port, 0, RegularPeer, 0)
+		peer := *peerp
+		peer.LastContact = time.Now()
+		d.updatePeer(d.updatePeerSource(peer, "DNS-Seed"))
 	}
-	note("discovery", "DiscoverPeers got peers: %+v", lines)
+	note("discovery", "DiscoverPeers got peers from %s: %+v", source, peers)
 }
 
 // PrintPeers Print details about the known peers
@@ -0,0 +1,137 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// From ProtocolVersionBinary on, peers can send parcels in binary frames
+// instead of gobs.  Connections start out with gobs.  Once a peer has sent us
+// a parcel with a version that can do binary, we send it a TypeBinaryFraming
+// parcel (as a gob), and binary frames after that.  When we get a
+// TypeBinaryFraming parcel, we read binary frames after it.  So each direction
+// switches on its own, and a peer that only knows gobs never sees a frame.
+//
+// A frame is
+//
+//   frame length (4 bytes)            length of everything after this field
+//   Network (4 bytes)
+//   Version (2 bytes)
+//   Type (2 bytes)
+//   Length (4 bytes)                  length of the payload
+//   Crc32 (4 bytes)
+//   PartNo (2 bytes)
+//   PartsTotal (2 bytes)
+//   NodeID (8 bytes)
+//   TargetPeer, PeerAddress, PeerPort, AppHash, AppType
+//                                     each a 2 byte length and the string
+//   payload (Length bytes)
+//
+// All numbers are big endian.
+
+// ParcelFrameFixedSize is the size of the fields of the frame header that
+// don't change size, after the frame length
+const ParcelFrameFixedSize = 28
+
+// MaxParcelFrameSize is the largest frame we read: the largest payload plus
+// the largest header
+const MaxParcelFrameSize = MaxPayloadSize + ParcelFrameFixedSize + 5*(2+math.MaxUint16)
+
+func writeFrameString(buf *bytes.Buffer, s string) error {
+	if len(s) > math.MaxUint16 {
+		return fmt.Errorf("parcel header string too long - %d bytes", len(s))
+	}
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+	return nil
+}
+
+func readFrameString(data []byte) (string, []byte, error) {
+	if len(data) < 2 {
+		return "", nil, fmt.Errorf("parcel frame too short for a string length")
+	}
+	l := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < l {
+		return "", nil, fmt.Errorf("parcel frame too short for a %d byte string", l)
+	}
+	return string(data[:l]), data[l:], nil
+}
+
+// MarshalBinary returns the parcel as a frame, without the frame length.
+func (p *Parcel) MarshalBinary() ([]byte, error) {
+	if uint64(len(p.Payload)) > MaxPayloadSize {
+		return nil, fmt.Errorf("parcel payload too large - %d bytes", len(p.Payload))
+	}
+	buf := new(bytes.Buffer)
+	h := &p.Header
+	binary.Write(buf, binary.BigEndian, uint32(h.Network))
+	binary.Write(buf, binary.BigEndian, h.Version)
+	binary.Write(buf, binary.BigEndian, uint16(h.Type))
+	binary.Write(buf, binary.BigEndian, uint32(len(p.Payload)))
+	binary.Write(buf, binary.BigEndian, h.Crc32)
+	binary.Write(buf, binary.BigEndian, h.PartNo)
+	binary.Write(buf, binary.BigEndian, h.PartsTotal)
+	binary.Write(buf, binary.BigEndian, h.NodeID)
+	for _, s := range []string{h.TargetPeer, h.PeerAddress, h.PeerPort, h.AppHash, h.AppType} {
+		if err := writeFrameString(buf, s); err != nil {
+			return nil, err
+		}
+	}
+	buf.Write(p.Payload)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary reads a frame without its frame length.  The frame must
+// hold exactly one parcel.
+func (p *Parcel) UnmarshalBinary(data []byte) error {
+	if len(data) < ParcelFrameFixedSize {
+		return fmt.Errorf("parcel frame too short - %d bytes", len(data))
+	}
+	h := new(ParcelHeader)
+	h.Network = NetworkID(binary.BigEndian.Uint32(data[0:4]))
+	h.Version = binary.BigEndian.Uint16(data[4:6])
+	h.Type = ParcelCommandType(binary.BigEndian.Uint16(data[6:8]))
+	h.Length = binary.BigEndian.Uint32(data[8:12])
+	h.Crc32 = binary.BigEndian.Uint32(data[12:16])
+	h.PartNo = binary.BigEndian.Uint16(data[16:18])
+	h.PartsTotal = binary.BigEndian.Uint16(data[18:20])
+	h.NodeID = binary.BigEndian.Uint64(data[20:28])
+	data = data[ParcelFrameFixedSize:]
+
+	var err error
+	for _, s := range []*string{&h.TargetPeer, &h.PeerAddress, &h.PeerPort, &h.AppHash, &h.AppType} {
+		*s, data, err = readFrameString(data)
+		if err != nil {
+			return err
+		}
+	}
+	if uint64(len(data)) != uint64(h.Length) {
+		return fmt.Errorf("parcel frame has %d bytes of payload, header says %d", len(data), h.Length)
+	}
+
+	p.Header = *h
+	p.Payload = make([]byte, len(data))
+	copy(p.Payload, data)
+	return nil
+}
+
+// WriteParcelFrame writes the parcel as a frame, with its frame length.
+func WriteParcelFrame(w io.Writer, p *Parcel) error {
+	_, err := writeParcelFrame(w, p, false)
+	return err
+}
+
+// ReadParcelFrame reads a frame written by WriteParcelFrame or
+// WriteCompressedParcelFrame.
+func ReadParcelFrame(r io.Reader, p *Parcel) error {
+	_, err := readParcelFrame(r, p)
+	return err
+}
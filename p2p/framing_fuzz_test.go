@@ -0,0 +1,25 @@
+//go:build go1.18
+// +build go1.18
+
+package p2p_test
+
+import (
+	"bytes"
+	"testing"
+)
+
+// FuzzParcelFrame runs the frame decoder under the go fuzzer, with
+// go test -fuzz FuzzParcelFrame ./p2p/
+func FuzzParcelFrame(f *testing.F) {
+	for _, p := range testParcels() {
+		data, err := p.MarshalBinary()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add(bytes.Repeat([]byte{0xFF}, 40))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkParcelFrameDecoder(t, data)
+	})
+}
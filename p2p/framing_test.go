@@ -0,0 +1,218 @@
+package p2p_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	. "github.com/FactomProject/factomd/p2p"
+)
+
+func testParcels() []*Parcel {
+	empty := NewParcel(TestNet, []byte{})
+	ping := NewParcel(MainNet, []byte("Ping"))
+	ping.Header.Type = TypePing
+	ping.Header.NodeID = 0x0102030405060708
+	message := NewParcel(LocalNet, bytes.Repeat([]byte{0xAB}, 100000))
+	message.Header.TargetPeer = "1234567890abcdef"
+	message.Header.PeerAddress = "10.1.2.3"
+	message.Header.AppHash = "abcdef"
+	message.Header.AppType = "EOM"
+	message.Header.PartNo = 2
+	message.Header.PartsTotal = 3
+	return []*Parcel{empty, ping, message}
+}
+
+func TestParcelFrameRoundTrip(t *testing.T) {
+	buf := new(bytes.Buffer)
+	parcels := testParcels()
+	for _, p := range parcels {
+		if err := WriteParcelFrame(buf, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, p := range parcels {
+		got := new(Parcel)
+		if err := ReadParcelFrame(buf, got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(p.Header, got.Header) || !bytes.Equal(p.Payload, got.Payload) {
+			t.Errorf("Parcel %d changed on the way - %+v vs %+v", i, p.Header, got.Header)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes left over", buf.Len())
+	}
+}
+
+func TestParcelFrameTruncated(t *testing.T) {
+	buf := new(bytes.Buffer)
+	p := testParcels()[2]
+	if err := WriteParcelFrame(buf, p); err != nil {
+		t.Fatal(err)
+	}
+	frame := buf.Bytes()
+	for _, l := range []int{0, 3, 4, 20, 40, len(frame) - 1} {
+		err := ReadParcelFrame(bytes.NewReader(frame[:l]), new(Parcel))
+		if err == nil {
+			t.Errorf("Frame cut to %d bytes was read", l)
+		}
+	}
+
+	data, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A payload longer than the header says
+	if err := new(Parcel).UnmarshalBinary(append(data, 0)); err == nil {
+		t.Errorf("Frame with extra payload was read")
+	}
+}
+
+// The connection sends gobs until it switches, then frames, all read through
+// one buffered reader.
+func TestParcelFrameAfterGobs(t *testing.T) {
+	buf := new(bytes.Buffer)
+	encoder := gob.NewEncoder(buf)
+	parcels := testParcels()
+	if err := encoder.Encode(parcels[1]); err != nil {
+		t.Fatal(err)
+	}
+	switchParcel := NewParcel(TestNet, []byte("Binary Framing"))
+	switchParcel.Header.Type = TypeBinaryFraming
+	if err := encoder.Encode(switchParcel); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range parcels {
+		if err := WriteParcelFrame(buf, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader := bufio.NewReader(buf)
+	decoder := gob.NewDecoder(reader)
+	var got Parcel
+	for _, want := range []*Parcel{parcels[1], switchParcel} {
+		if err := decoder.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Header.Type != want.Header.Type {
+			t.Errorf("Wrong gob parcel %v", got.Header.Type)
+		}
+	}
+	for i, p := range parcels {
+		got := new(Parcel)
+		if err := ReadParcelFrame(reader, got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p.Payload, got.Payload) {
+			t.Errorf("Parcel %d changed on the way", i)
+		}
+	}
+}
+
+// checkParcelFrameDecoder feeds data to the decoder, which must not panic, and
+// anything it reads must marshal back to the same data.
+func checkParcelFrameDecoder(t *testing.T, data []byte) {
+	p := new(Parcel)
+	if err := p.UnmarshalBinary(data); err != nil {
+		return
+	}
+	again, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Decoded parcel doesn't marshal - %v", err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Fatalf("Decoded parcel marshals differently\n%x\n%x", data, again)
+	}
+}
+
+// TestParcelFrameRandom fuzzes the decoder with random and mutated frames.
+func TestParcelFrameRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var seeds [][]byte
+	for _, p := range testParcels() {
+		data, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeds = append(seeds, data[:len(data)%2000])
+		seeds = append(seeds, data)
+	}
+
+	for i := 0; i < 20000; i++ {
+		var data []byte
+		if i%4 == 0 {
+			data = make([]byte, r.Intn(200))
+			r.Read(data)
+		} else {
+			seed := seeds[r.Intn(len(seeds))]
+			data = append([]byte{}, seed[:r.Intn(len(seed)+1)]...)
+			for m := r.Intn(4); m >= 0 && len(data) > 0; m-- {
+				data[r.Intn(len(data))] = byte(r.Intn(256))
+			}
+		}
+		checkParcelFrameDecoder(t, data)
+
+		frame := append([]byte{byte(len(data) >> 24), byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}, data...)
+		if i%3 == 0 {
+			frame[r.Intn(4)] = byte(r.Intn(256))
+		}
+		ReadParcelFrame(bytes.NewReader(frame), new(Parcel))
+	}
+}
+
+func TestCompressedParcelFrame(t *testing.T) {
+	buf := new(bytes.Buffer)
+	parcels := testParcels()
+	for i, p := range parcels {
+		saved, err := WriteCompressedParcelFrame(buf, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Only the big, repetitive payload is worth compressing
+		if (i == 2) != (saved > 0) {
+			t.Errorf("Parcel %d saved %d bytes", i, saved)
+		}
+	}
+	if buf.Len() > 10000 {
+		t.Errorf("Compressed frames take %d bytes", buf.Len())
+	}
+	for i, p := range parcels {
+		got := new(Parcel)
+		if err := ReadParcelFrame(buf, got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(p.Header, got.Header) || !bytes.Equal(p.Payload, got.Payload) {
+			t.Errorf("Parcel %d changed on the way - %+v vs %+v", i, p.Header, got.Header)
+		}
+	}
+
+	// Random payloads barely shrink, but must still get through
+	random := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(random)
+	saved, err := WriteCompressedParcelFrame(buf, NewParcel(TestNet, random))
+	if err != nil || saved > 100 {
+		t.Errorf("Random payload saved %d bytes, %v", saved, err)
+	}
+	got := new(Parcel)
+	if err := ReadParcelFrame(buf, got); err != nil || !bytes.Equal(got.Payload, random) {
+		t.Errorf("Random payload changed on the way, %v", err)
+	}
+}
+
+func TestCompressedParcelFrameTooLarge(t *testing.T) {
+	// A tiny compressed frame that claims to decode to more than a frame can be
+	frame := []byte{0x80, 0, 0, 5, 0xFF, 0xFF, 0xFF, 0xFF, 0x0F}
+	if err := ReadParcelFrame(bytes.NewReader(frame), new(Parcel)); err == nil {
+		t.Errorf("Oversized compressed frame was read")
+	}
+	// And one that isn't snappy at all
+	frame = []byte{0x80, 0, 0, 3, 0x05, 0xFF, 0xFF}
+	if err := ReadParcelFrame(bytes.NewReader(frame), new(Parcel)); err == nil {
+		t.Errorf("Corrupt compressed frame was read")
+	}
+}
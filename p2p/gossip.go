@@ -0,0 +1,379 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Broadcasts are flooded by default: every peer picked for a broadcast gets
+// the whole parcel, and the duplicates are thrown away by the application.
+// In gossip mode, a large application message is only announced.  Peers on
+// ProtocolVersionGossip or later get an Inventory parcel with the sha256
+// hashes of the messages, and ask for the ones they don't have with a GetData
+// parcel.  Peers that have announced or sent us a message aren't told about
+// it again.  If a peer doesn't answer a GetData in GossipFetchTimeout, it is
+// counted as a timeout against the peer, and the message is asked for from
+// the next peer that announced it.  If the peer disconnects, the next one is
+// asked straight away.  Older peers, and small messages, still get the whole
+// parcel.
+//
+// Each peer may only announce so many messages we haven't seen in each
+// gossipInventoryWindow, and so may all the peers together, so a flood of
+// Inventory parcels can't push the messages we are fetching out of the list.
+//
+// Both parcels have a payload of one or more 32 byte hashes.  Every node
+// answers Inventory and GetData parcels, whatever its own broadcast mode.
+
+type BroadcastMode int
+
+const (
+	BroadcastFlood  BroadcastMode = iota // Send the whole parcel to every peer picked
+	BroadcastGossip                      // Announce large messages, and send them to peers that ask
+)
+
+var broadcastModeNames = map[BroadcastMode]string{
+	BroadcastFlood:  "flood",
+	BroadcastGossip: "gossip",
+}
+
+func (m BroadcastMode) String() string {
+	if name, ok := broadcastModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("BroadcastMode(%d)", int(m))
+}
+
+// ParseBroadcastMode reads flood or gossip.  An empty string is flood.
+func ParseBroadcastMode(s string) (BroadcastMode, error) {
+	if s == "" {
+		return BroadcastFlood, nil
+	}
+	for m, name := range broadcastModeNames {
+		if strings.EqualFold(s, name) {
+			return m, nil
+		}
+	}
+	return BroadcastFlood, fmt.Errorf("Unknown p2p broadcast mode %q, use flood or gossip", s)
+}
+
+var (
+	Broadcast          = BroadcastFlood   // Set by the controller's Init
+	GossipThreshold    = 1024             // Smallest payload that is announced rather than sent
+	GossipFetchTimeout = time.Second * 5  // How long we wait for a peer to answer a GetData
+	maxGossipItems     = 20000            // Messages we remember, oldest forgotten first
+	maxInventoryHashes = 1000             // Most hashes in one Inventory or GetData parcel
+	gossipHashSize     = sha256.Size      // Bytes in a message hash
+	gossipRetryCheck   = time.Second * 1  // How often we look for GetData that went unanswered
+	gossipItemExpiry   = time.Minute * 10 // How long we remember a message
+	gossipParcelExpiry = time.Minute * 1  // How long we keep the messages we announced, for peers to fetch
+
+	gossipInventoryWindow  = time.Minute // The window new announcements are counted in
+	maxInventoryNewPerPeer = 1000        // New messages one peer may announce in a window
+	maxInventoryNew        = 10000       // New messages all peers together may announce in a window
+)
+
+// gossipItem is what we know about one message
+type gossipItem struct {
+	parcel     *Parcel         // The message, once we have announced it
+	received   bool            // We have the message
+	have       map[string]bool // Peers that announced or sent us the message, or that we sent it to
+	requested  time.Time       // When we last asked for it
+	askedPeer  string          // Who we last asked
+	announcers []string        // Peers that announced it, to ask next
+	created    time.Time
+}
+
+// gossip keeps the state of announce-then-fetch broadcasts.  It belongs to the
+// controller and is only used from its runloop.
+type gossip struct {
+	items       map[string]*gossipItem // By message hash
+	order       []string               // Hashes, oldest first
+	versions    map[string]uint16      // Protocol version of each connection, by peer hash
+	inventories map[string][]byte      // Hashes to announce at the end of route(), by peer hash
+	lastRetry   time.Time
+
+	windowStart time.Time      // When the current announcement window started
+	newByPeer   map[string]int // New messages announced in the window, by peer hash
+	newInWindow int            // New messages announced in the window by all peers
+}
+
+func newGossip() *gossip {
+	g := new(gossip)
+	g.items = map[string]*gossipItem{}
+	g.versions = map[string]uint16{}
+	g.inventories = map[string][]byte{}
+	g.newByPeer = map[string]int{}
+	return g
+}
+
+func gossipHash(payload []byte) string {
+	hash := sha256.Sum256(payload)
+	return string(hash[:])
+}
+
+// isGossiped returns true if the parcel is announced rather than sent
+func isGossiped(parcel *Parcel) bool {
+	return BroadcastGossip == Broadcast && TypeMessage == parcel.Header.Type && GossipThreshold <= len(parcel.Payload)
+}
+
+func (g *gossip) item(hash string) *gossipItem {
+	item, ok := g.items[hash]
+	if !ok {
+		item = &gossipItem{have: map[string]bool{}, created: time.Now()}
+		g.items[hash] = item
+		g.order = append(g.order, hash)
+		g.forget()
+	}
+	return item
+}
+
+// allowNew returns true if the peer may announce another message we haven't
+// seen in this window, and counts it
+func (g *gossip) allowNew(peerHash string) bool {
+	if gossipInventoryWindow < time.Since(g.windowStart) {
+		g.windowStart = time.Now()
+		g.newByPeer = map[string]int{}
+		g.newInWindow = 0
+	}
+	if maxInventoryNewPerPeer <= g.newByPeer[peerHash] || maxInventoryNew <= g.newInWindow {
+		return false
+	}
+	g.newByPeer[peerHash]++
+	g.newInWindow++
+	return true
+}
+
+// forget drops the oldest messages beyond maxGossipItems, and those older
+// than gossipItemExpiry
+func (g *gossip) forget() {
+	for 0 < len(g.order) {
+		item := g.items[g.order[0]]
+		if len(g.order) <= maxGossipItems && (nil == item || time.Since(item.created) < gossipItemExpiry) {
+			return
+		}
+		delete(g.items, g.order[0])
+		g.order[0] = ""
+		g.order = g.order[1:]
+	}
+}
+
+// splitHashes splits the payload of an Inventory or GetData parcel
+func splitHashes(payload []byte) ([]string, error) {
+	if 0 == len(payload) || 0 != len(payload)%gossipHashSize || maxInventoryHashes*gossipHashSize < len(payload) {
+		return nil, fmt.Errorf("bad hash list of %d bytes", len(payload))
+	}
+	hashes := []string{}
+	for i := 0; i < len(payload); i += gossipHashSize {
+		hashes = append(hashes, string(payload[i:i+gossipHashSize]))
+	}
+	return hashes, nil
+}
+
+func newHashesParcel(parcelType ParcelCommandType, hashes []byte) *Parcel {
+	parcel := NewParcel(CurrentNetwork, hashes)
+	parcel.Header.Type = parcelType
+	return parcel
+}
+
+// offerBroadcast remembers a parcel we are going to announce, and returns its
+// hash, or "" if the parcel is to be flooded
+func (c *Controller) offerBroadcast(parcel Parcel) string {
+	if !isGossiped(&parcel) {
+		return ""
+	}
+	hash := gossipHash(parcel.Payload)
+	item := c.gossip.item(hash)
+	item.parcel = &parcel
+	item.received = true
+	return hash
+}
+
+// broadcastTo sends a broadcast parcel to one connection, or announces it if
+// it has a hash and the peer can fetch it
+func (c *Controller) broadcastTo(connection *Connection, parcel Parcel, hash string) {
+	if "" == hash {
+		enqueue(connection.SendQueue, ConnectionParcel{Parcel: parcel})
+		return
+	}
+	item := c.gossip.item(hash)
+	peerHash := connection.peer.Hash
+	switch {
+	case item.have[peerHash]:
+		p2pGossip.WithLabelValues("skipped").Inc()
+	case c.gossip.versions[peerHash] < ProtocolVersionGossip:
+		item.have[peerHash] = true
+		enqueue(connection.SendQueue, ConnectionParcel{Parcel: parcel})
+		p2pGossip.WithLabelValues("flooded").Inc()
+	default:
+		item.have[peerHash] = true
+		c.gossip.inventories[peerHash] = append(c.gossip.inventories[peerHash], hash...)
+		p2pGossip.WithLabelValues("announced").Inc()
+	}
+}
+
+// sendInventories sends the announcements collected during route(), and asks
+// again for messages that a peer didn't send us
+func (c *Controller) sendInventories() {
+	for peerHash, hashes := range c.gossip.inventories {
+		delete(c.gossip.inventories, peerHash)
+		connection, present := c.connections[peerHash]
+		if !present {
+			continue
+		}
+		for 0 < len(hashes) {
+			n := len(hashes)
+			if maxInventoryHashes*gossipHashSize < n {
+				n = maxInventoryHashes * gossipHashSize
+			}
+			enqueue(connection.SendQueue, ConnectionParcel{Parcel: *newHashesParcel(TypeInventory, hashes[:n])})
+			hashes = hashes[n:]
+		}
+	}
+	if gossipRetryCheck < time.Since(c.gossip.lastRetry) {
+		c.gossip.lastRetry = time.Now()
+		c.retryFetches()
+	}
+}
+
+// retryFetches asks the next announcer for messages the last one didn't send,
+// or that we asked a peer that has since gone, and drops the messages we
+// announced a while ago
+func (c *Controller) retryFetches() {
+	requests := map[string][]byte{}
+	timedOut := map[string]bool{}
+	for hash, item := range c.gossip.items {
+		if nil != item.parcel && gossipParcelExpiry < time.Since(item.created) {
+			item.parcel = nil
+		}
+		if item.received || "" == item.askedPeer {
+			continue
+		}
+		if _, present := c.connections[item.askedPeer]; present {
+			if time.Since(item.requested) < GossipFetchTimeout {
+				continue
+			}
+			timedOut[item.askedPeer] = true
+		}
+		item.askedPeer = ""
+		for 0 < len(item.announcers) && "" == item.askedPeer {
+			next := item.announcers[0]
+			item.announcers = item.announcers[1:]
+			if _, present := c.connections[next]; present {
+				item.askedPeer = next
+				item.requested = time.Now()
+				requests[next] = append(requests[next], hash...)
+			}
+		}
+	}
+	for peerHash := range timedOut {
+		note("ctrlr", "retryFetches() %s didn't answer a GetData", c.connections[peerHash].peer.PeerIdent())
+		PeerReputation.Record(c.connections[peerHash].peer.Address, EventTimeout)
+	}
+	for peerHash, hashes := range requests {
+		p2pGossip.WithLabelValues("retried").Add(float64(len(hashes) / gossipHashSize))
+		enqueue(c.connections[peerHash].SendQueue, ConnectionParcel{Parcel: *newHashesParcel(TypeGetData, hashes)})
+	}
+}
+
+// handleInventory asks the peer for the messages it announced that we don't
+// have, and haven't asked someone else for.  Messages we haven't seen past the
+// peer's share of the window are ignored.
+func (c *Controller) handleInventory(parcel Parcel, connection Connection) {
+	hashes, err := splitHashes(parcel.Payload)
+	if nil != err {
+		note("ctrlr", "handleInventory() from %s: %v", connection.peer.PeerIdent(), err)
+		PeerReputation.Record(connection.peer.Address, EventInvalidMessage)
+		return
+	}
+	peerHash := connection.peer.Hash
+	request := []byte{}
+	ignored := 0
+	for _, hash := range hashes {
+		item, known := c.gossip.items[hash]
+		if !known {
+			if !c.gossip.allowNew(peerHash) {
+				ignored++
+				continue
+			}
+			item = c.gossip.item(hash)
+		}
+		item.have[peerHash] = true
+		_, asking := c.connections[item.askedPeer]
+		switch {
+		case item.received:
+		case asking && time.Since(item.requested) < GossipFetchTimeout:
+			item.announcers = append(item.announcers, peerHash)
+		default:
+			item.askedPeer = peerHash
+			item.requested = time.Now()
+			request = append(request, hash...)
+		}
+	}
+	if 0 < ignored {
+		note("ctrlr", "handleInventory() ignored %d new messages from %s over its limit", ignored, connection.peer.PeerIdent())
+		p2pGossip.WithLabelValues("ignored").Add(float64(ignored))
+	}
+	if 0 < len(request) {
+		p2pGossip.WithLabelValues("requested").Add(float64(len(request) / gossipHashSize))
+		enqueue(connection.SendQueue, ConnectionParcel{Parcel: *newHashesParcel(TypeGetData, request)})
+	}
+}
+
+// handleGetData sends the peer the messages it asked for that we still have
+func (c *Controller) handleGetData(parcel Parcel, connection Connection) {
+	hashes, err := splitHashes(parcel.Payload)
+	if nil != err {
+		note("ctrlr", "handleGetData() from %s: %v", connection.peer.PeerIdent(), err)
+		PeerReputation.Record(connection.peer.Address, EventInvalidMessage)
+		return
+	}
+	for _, hash := range hashes {
+		item, ok := c.gossip.items[hash]
+		if !ok || nil == item.parcel {
+			continue
+		}
+		item.have[connection.peer.Hash] = true
+		enqueue(connection.SendQueue, ConnectionParcel{Parcel: *item.parcel})
+		p2pGossip.WithLabelValues("served").Inc()
+	}
+}
+
+// receivedMessage notes that a peer sent us a message, so we don't announce
+// it back, and stop waiting for it if we asked
+func (c *Controller) receivedMessage(parcel Parcel, peerHash string) {
+	if len(parcel.Payload) < GossipThreshold {
+		return
+	}
+	hash := gossipHash(parcel.Payload)
+	item, ok := c.gossip.items[hash]
+	if !ok && BroadcastGossip != Broadcast {
+		// Only remember messages we might announce, or that we asked for
+		return
+	}
+	if !ok {
+		item = c.gossip.item(hash)
+	}
+	if "" != item.askedPeer && !item.received {
+		p2pGossip.WithLabelValues("fetched").Inc()
+	}
+	item.received = true
+	item.askedPeer = ""
+	item.announcers = nil
+	item.have[peerHash] = true
+}
+
+// gossipConnectionClosed forgets what we knew about a connection, and asks
+// other peers for what we were waiting on from it.  The connection is already
+// gone from c.connections.
+func (c *Controller) gossipConnectionClosed(peerHash string) {
+	delete(c.gossip.versions, peerHash)
+	delete(c.gossip.inventories, peerHash)
+	delete(c.gossip.newByPeer, peerHash)
+	c.retryFetches()
+}
@@ -0,0 +1,184 @@
+package p2p
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// gossipNode is a controller with only what gossip needs, and a connection
+// to each of its peers
+type gossipNode struct {
+	controller *Controller
+	to         map[string]*Connection // By the name of the peer
+}
+
+func newGossipNode(peers map[string]uint16) *gossipNode {
+	n := &gossipNode{controller: new(Controller), to: map[string]*Connection{}}
+	n.controller.connections = map[string]*Connection{}
+	n.controller.gossip = newGossip()
+	for name, version := range peers {
+		peer := new(Peer).Init("10.0.0.1", "8108", 0, RegularPeer, 0)
+		peer.Hash = name + "-connection"
+		connection := new(Connection).Init(*peer, false)
+		n.controller.connections[peer.Hash] = connection
+		n.controller.gossip.versions[peer.Hash] = version
+		n.to[name] = connection
+	}
+	return n
+}
+
+// sent returns the parcels queued for a peer
+func (n *gossipNode) sent(name string) []Parcel {
+	parcels := []Parcel{}
+	for {
+		item, ok := n.to[name].SendQueue.Receive()
+		if !ok {
+			return parcels
+		}
+		parcels = append(parcels, item.(ConnectionParcel).Parcel)
+	}
+}
+
+func (n *gossipNode) broadcast(parcel Parcel) {
+	hash := n.controller.offerBroadcast(parcel)
+	for _, name := range []string{"a", "b", "c", "legacy"} {
+		if connection, ok := n.to[name]; ok {
+			n.controller.broadcastTo(connection, parcel, hash)
+		}
+	}
+	n.controller.sendInventories()
+}
+
+func onlyParcel(t *testing.T, parcels []Parcel, parcelType ParcelCommandType) Parcel {
+	if len(parcels) != 1 || parcels[0].Header.Type != parcelType {
+		t.Fatalf("Sent %d parcels, expected one %s", len(parcels), CommandStrings[parcelType])
+	}
+	return parcels[0]
+}
+
+func TestGossipBroadcast(t *testing.T) {
+	defer func() { Broadcast = BroadcastFlood }()
+	Broadcast = BroadcastGossip
+
+	large := *NewParcel(CurrentNetwork, bytes.Repeat([]byte{1}, GossipThreshold))
+	small := *NewParcel(CurrentNetwork, []byte{1})
+
+	// A announces the large message to B, floods it to the legacy peer, and
+	// floods the small message to both
+	a := newGossipNode(map[string]uint16{"b": ProtocolVersionGossip, "legacy": ProtocolVersionGossip - 1})
+	a.broadcast(large)
+	inventory := onlyParcel(t, a.sent("b"), TypeInventory)
+	if !bytes.Equal(onlyParcel(t, a.sent("legacy"), TypeMessage).Payload, large.Payload) {
+		t.Errorf("Legacy peer didn't get the message")
+	}
+	a.broadcast(small)
+	onlyParcel(t, a.sent("b"), TypeMessage)
+	onlyParcel(t, a.sent("legacy"), TypeMessage)
+
+	// B asks A for it, and A sends it
+	b := newGossipNode(map[string]uint16{"a": ProtocolVersionGossip, "c": ProtocolVersionGossip})
+	b.controller.handleInventory(inventory, *b.to["a"])
+	getData := onlyParcel(t, b.sent("a"), TypeGetData)
+	a.controller.handleGetData(getData, *a.to["b"])
+	message := onlyParcel(t, a.sent("b"), TypeMessage)
+	if !bytes.Equal(message.Payload, large.Payload) {
+		t.Errorf("A sent the wrong message")
+	}
+
+	// B doesn't announce it back to A, only to C, and asks no one again
+	b.controller.receivedMessage(message, b.to["a"].peer.Hash)
+	b.broadcast(message)
+	if sent := b.sent("a"); len(sent) != 0 {
+		t.Errorf("B sent A %d parcels", len(sent))
+	}
+	onlyParcel(t, b.sent("c"), TypeInventory)
+	b.controller.handleInventory(inventory, *b.to["c"])
+	if sent := b.sent("c"); len(sent) != 0 {
+		t.Errorf("B asked C for a message it has")
+	}
+}
+
+func TestGossipRetry(t *testing.T) {
+	defer func() { Broadcast = BroadcastFlood }()
+	Broadcast = BroadcastGossip
+
+	large := *NewParcel(CurrentNetwork, bytes.Repeat([]byte{2}, GossipThreshold))
+	a := newGossipNode(map[string]uint16{"b": ProtocolVersionGossip})
+	a.broadcast(large)
+	inventory := onlyParcel(t, a.sent("b"), TypeInventory)
+
+	// B asks A, and C's announcement waits
+	b := newGossipNode(map[string]uint16{"a": ProtocolVersionGossip, "c": ProtocolVersionGossip})
+	b.controller.handleInventory(inventory, *b.to["a"])
+	b.controller.handleInventory(inventory, *b.to["c"])
+	onlyParcel(t, b.sent("a"), TypeGetData)
+	if sent := b.sent("c"); len(sent) != 0 {
+		t.Errorf("B asked C while waiting on A")
+	}
+
+	// A never answers, so B asks C
+	for _, item := range b.controller.gossip.items {
+		item.requested = time.Now().Add(-GossipFetchTimeout)
+	}
+	b.controller.retryFetches()
+	onlyParcel(t, b.sent("c"), TypeGetData)
+	if sent := b.sent("a"); len(sent) != 0 {
+		t.Errorf("B asked A again")
+	}
+}
+
+func TestGossipClosedPeer(t *testing.T) {
+	hash := []byte(gossipHash([]byte{3}))
+	b := newGossipNode(map[string]uint16{"a": ProtocolVersionGossip, "c": ProtocolVersionGossip})
+	b.controller.handleInventory(*newHashesParcel(TypeInventory, hash), *b.to["a"])
+	b.controller.handleInventory(*newHashesParcel(TypeInventory, hash), *b.to["c"])
+	onlyParcel(t, b.sent("a"), TypeGetData)
+
+	// A goes away, so B asks C without waiting out the timeout
+	delete(b.controller.connections, b.to["a"].peer.Hash)
+	b.controller.gossipConnectionClosed(b.to["a"].peer.Hash)
+	onlyParcel(t, b.sent("c"), TypeGetData)
+}
+
+func TestGossipInventoryLimit(t *testing.T) {
+	b := newGossipNode(map[string]uint16{"a": ProtocolVersionGossip, "c": ProtocolVersionGossip})
+	inventory := func(first, count int) Parcel {
+		hashes := []byte{}
+		for i := first; i < first+count; i++ {
+			hashes = append(hashes, gossipHash([]byte{byte(i), byte(i >> 8)})...)
+		}
+		return *newHashesParcel(TypeInventory, hashes)
+	}
+	// A floods us, and only gets its share of new messages
+	for i := 0; i < 3; i++ {
+		b.controller.handleInventory(inventory(i*maxInventoryHashes, maxInventoryHashes), *b.to["a"])
+	}
+	if len(b.controller.gossip.items) != maxInventoryNewPerPeer {
+		t.Errorf("A made %d items", len(b.controller.gossip.items))
+	}
+	// C still gets its announcement through
+	b.controller.handleInventory(inventory(5*maxInventoryHashes, 1), *b.to["c"])
+	onlyParcel(t, b.sent("c"), TypeGetData)
+}
+
+func TestGossipBadInventory(t *testing.T) {
+	b := newGossipNode(map[string]uint16{"a": ProtocolVersionGossip})
+	for _, payload := range [][]byte{{}, make([]byte, gossipHashSize+1), make([]byte, (maxInventoryHashes+1)*gossipHashSize)} {
+		b.controller.handleInventory(*newHashesParcel(TypeInventory, payload), *b.to["a"])
+		if sent := b.sent("a"); len(sent) != 0 {
+			t.Errorf("Inventory of %d bytes got a GetData", len(payload))
+		}
+	}
+}
+
+func TestParseBroadcastMode(t *testing.T) {
+	for s, mode := range map[string]BroadcastMode{"": BroadcastFlood, "flood": BroadcastFlood, "Gossip": BroadcastGossip} {
+		if m, err := ParseBroadcastMode(s); err != nil || m != mode {
+			t.Errorf("%q parsed to %s %v", s, m, err)
+		}
+	}
+	if _, err := ParseBroadcastMode("epidemic"); err == nil {
+		t.Errorf("Unknown mode parsed")
+	}
+}
@@ -91,6 +91,21 @@ var (
 		Name: "factomd_p2p_goOffline_total",
 		Help: "Number of times we call goOffline()",
 	})
+
+	p2pCompressionBytesSaved = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "factomd_p2p_compression_bytes_saved_total",
+		Help: "Bytes saved by compressing parcels, by direction",
+	}, []string{"direction"})
+
+	p2pGossip = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "factomd_p2p_gossip_total",
+		Help: "Messages announced, skipped, flooded, requested, retried, served, fetched and ignored in gossip broadcasts",
+	}, []string{"event"})
+
+	p2pQueueDrops = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "factomd_p2p_queue_dropped_total",
+		Help: "Items dropped from full p2p queues, by queue and priority",
+	}, []string{"queue", "priority"})
 )
 
 var registered = false
@@ -126,5 +141,8 @@ func RegisterPrometheus() {
 
 	// Connections
 	prometheus.MustRegister(p2pConnectionCommonInit)
+	prometheus.MustRegister(p2pCompressionBytesSaved)
+	prometheus.MustRegister(p2pGossip)
+	prometheus.MustRegister(p2pQueueDrops)
 
 }
@@ -5,9 +5,11 @@
 package p2p
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"math/rand"
-	"strconv"
+	"net"
 	"strings"
 	"time"
 )
@@ -16,11 +18,11 @@ import (
 
 type Peer struct {
 	QualityScore int32     // 0 is neutral quality, negative is a bad peer.
-	Address      string    // Must be in form of x.x.x.x
+	Address      string    // IPv4 (x.x.x.x) or IPv6 address, without brackets, or a host name
 	Port         string    // Must be in form of xxxx
 	NodeID       uint64    // a nonce to distinguish multiple nodes behind one IP address
 	Hash         string    // This is more of a connection ID than hash right now.
-	Location     uint32    // IP address as an int.
+	Location     uint32    // IPv4 address as an int, or the first 32 bits of an IPv6 address
 	Network      NetworkID // The network this peer reference lives on.
 	Type         uint8
 	Connections  int                  // Number of successful connections.
@@ -34,7 +36,7 @@ const ( // iota is reset to 0
 )
 
 func (p *Peer) Init(address string, port string, quality int32, peerType uint8, connections int) *Peer {
-	p.Address = address
+	p.Address = CanonicalAddress(address)
 	p.Port = port
 	p.QualityScore = quality
 	p.generatePeerHash()
@@ -49,52 +51,74 @@ func (p *Peer) generatePeerHash() {
 	p.Hash = fmt.Sprintf("%s:%s %x", p.Address, p.Port, rand.Int63())
 }
 
+// AddressPort returns the address and port to dial, with an IPv6 address in
+// brackets
 func (p *Peer) AddressPort() string {
-	return p.Address + ":" + p.Port
+	return net.JoinHostPort(p.Address, p.Port)
 }
 
 func (p *Peer) PeerIdent() string {
-	return p.Hash[0:12] + "-" + p.Address + ":" + p.Port
+	return p.Hash[0:12] + "-" + p.AddressPort()
 }
 
 func (p *Peer) PeerFixedIdent() string {
-	address := fmt.Sprintf("%16s", p.Address)
+	address := p.Address
+	if strings.Contains(address, ":") {
+		address = "[" + address + "]"
+	}
+	address = fmt.Sprintf("%16s", address)
 	return p.Hash[0:12] + "-" + address + ":" + p.Port
 }
 
-// TODO Hadn't considered IPV6 address support.
-// TODO Need to audit all the net code to check IPv6 addresses
-// Here's an IPv6 conversion:
-// Ref: http://stackoverflow.com/questions/23297141/golang-net-ip-to-ipv6-from-mysql-as-decimal39-0-conversion
-// func ipv6ToInt(IPv6Addr net.IP) *big.Int {
-//     IPv6Int := big.NewInt(0)
-//     IPv6Int.SetBytes(IPv6Addr)
-//     return IPv6Int
-// }
-// Problem is we're working wiht string addresses, may never have made a connection.
-// TODO - we might have a DNS address, not iP address and need to resolve it!
-// locationFromAddress converts the peers address into a uint32 "location" numeric
+// CanonicalAddress returns an IP address in its usual form, so that one
+// address is always written the same way.  Brackets around an IPv6 address
+// are removed, and an IPv4 address mapped to IPv6 becomes the IPv4 address.
+// Anything that isn't an IP address is returned as it was.
+func CanonicalAddress(address string) string {
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	if ip := net.ParseIP(address); nil != ip {
+		return ip.String()
+	}
+	return address
+}
+
+// SplitAddressPort splits host:port, or [host]:port for an IPv6 address, and
+// returns the canonical address
+func SplitAddressPort(addressPort string) (address string, port string, err error) {
+	address, port, err = net.SplitHostPort(addressPort)
+	if nil != err {
+		return "", "", err
+	}
+	if "" == address || "" == port {
+		return "", "", fmt.Errorf("%s needs both an address and a port", addressPort)
+	}
+	return CanonicalAddress(address), port, nil
+}
+
+// LocationFromAddress converts the peers address into a uint32 "location".  An
+// IPv4 address is the location, and an IPv6 address uses its first 32 bits,
+// the part that is allocated to a network.  Host names that aren't resolved
+// yet have location 0.
 func (p *Peer) LocationFromAddress() (location uint32) {
-	location = 0
-	// Split the IPv4 octets
-	octets := strings.Split(p.Address, ".")
-	if 4 == len(octets) {
-		// Turn into uint32
-		b0, _ := strconv.Atoi(octets[0])
-		b1, _ := strconv.Atoi(octets[1])
-		b2, _ := strconv.Atoi(octets[2])
-		b3, _ := strconv.Atoi(octets[3])
-		location += uint32(b0) << 24
-		location += uint32(b1) << 16
-		location += uint32(b2) << 8
-		location += uint32(b3)
-		verbose("peer", "Peer: %s with octets: %+v has Location: %d", p.Hash, octets, location)
-	} else {
-		silence("peer", "len(octets) != 4 \n Invalid Peer Address: %v", octets)
+	ip := net.ParseIP(p.Address)
+	switch {
+	case nil == ip:
+		silence("peer", "Invalid Peer Address: %v", p.Address)
+	case nil != ip.To4():
+		location = binary.BigEndian.Uint32(ip.To4())
+	default:
+		location = binary.BigEndian.Uint32(ip.To16()[:4])
 	}
+	verbose("peer", "Peer: %s with address: %s has Location: %d", p.Hash, p.Address, location)
 	return location
 }
 
+// ipBytes returns the address in its 16 byte form, which sorts IPv4 addresses
+// together and in order, or nil if it isn't an IP address
+func (p *Peer) ipBytes() []byte {
+	return net.ParseIP(p.Address).To16()
+}
+
 // merit increases a peers reputation
 func (p *Peer) merit() {
 	if 2147483000 > p.QualityScore {
@@ -132,5 +156,5 @@ func (p PeerDistanceSort) Swap(i, j int) {
 	p[i], p[j] = p[j], p[i]
 }
 func (p PeerDistanceSort) Less(i, j int) bool {
-	return p[i].Location < p[j].Location
+	return bytes.Compare(p[i].ipBytes(), p[j].ipBytes()) < 0
 }
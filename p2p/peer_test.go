@@ -0,0 +1,94 @@
+package p2p_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	. "github.com/FactomProject/factomd/p2p"
+)
+
+func TestSplitAddressPort(t *testing.T) {
+	tests := []struct {
+		in, address, port string
+	}{
+		{"1.2.3.4:8108", "1.2.3.4", "8108"},
+		{"[2001:DB8:0:0::1]:8108", "2001:db8::1", "8108"},
+		{"[::ffff:1.2.3.4]:8108", "1.2.3.4", "8108"},
+		{"localhost:8110", "localhost", "8110"},
+	}
+	for _, test := range tests {
+		address, port, err := SplitAddressPort(test.in)
+		if err != nil || address != test.address || port != test.port {
+			t.Errorf("%s split to %s %s %v", test.in, address, port, err)
+		}
+	}
+	for _, bad := range []string{"2001:db8::1:8108", "1.2.3.4", "1.2.3.4:", ":8108"} {
+		if _, _, err := SplitAddressPort(bad); err == nil {
+			t.Errorf("%s was accepted", bad)
+		}
+	}
+}
+
+func TestPeerIPv6(t *testing.T) {
+	peer := new(Peer).Init("[2001:db8::1]", "8108", 0, RegularPeer, 0)
+	if peer.Address != "2001:db8::1" || peer.AddressPort() != "[2001:db8::1]:8108" {
+		t.Errorf("Peer is %s, dials %s", peer.Address, peer.AddressPort())
+	}
+	if peer.Location != 0x20010db8 {
+		t.Errorf("IPv6 location is %x", peer.Location)
+	}
+	if v4 := new(Peer).Init("1.2.3.4", "8108", 0, RegularPeer, 0); v4.Location != 0x01020304 || v4.AddressPort() != "1.2.3.4:8108" {
+		t.Errorf("IPv4 location is %x, dials %s", v4.Location, v4.AddressPort())
+	}
+
+	peers := []Peer{}
+	for _, address := range []string{"2001:db8::2", "10.0.0.1", "2001:db8::1", "9.0.0.1"} {
+		peers = append(peers, *new(Peer).Init(address, "8108", 0, RegularPeer, 0))
+	}
+	sort.Sort(PeerDistanceSort(peers))
+	for i, address := range []string{"9.0.0.1", "10.0.0.1", "2001:db8::1", "2001:db8::2"} {
+		if peers[i].Address != address {
+			t.Errorf("Peer %d is %s, expected %s", i, peers[i].Address, address)
+		}
+	}
+}
+
+func TestLoadPeersIPv6(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	peersFile := filepath.Join(dir, "peers.json")
+
+	peer := new(Peer).Init("2001:0DB8:0000::0001", "8108", 0, RegularPeer, 0)
+	peer.Address = "2001:0DB8:0000::0001"
+	peer.Location = 0
+	peer.LastContact = time.Now()
+	data, _ := json.Marshal(map[string]Peer{"[2001:0DB8:0000::0001]:8108": *peer})
+	if err := ioutil.WriteFile(peersFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := new(Discovery).Init(peersFile, "")
+	d.LoadPeers()
+	peers := d.GetOutgoingPeers()
+	if len(peers) != 1 || peers[0].Address != "2001:db8::1" || peers[0].Location != 0x20010db8 {
+		t.Fatalf("Loaded %+v", peers)
+	}
+
+	d.SavePeers()
+	saved := map[string]Peer{}
+	data, _ = ioutil.ReadFile(peersFile)
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved["[2001:db8::1]:8108"]; !ok {
+		t.Errorf("Saved %s", data)
+	}
+}
@@ -18,7 +18,8 @@ import (
 // This file contains the global variables and utility functions for the p2p network operation.  The global variables and constants can be tweaked here.
 
 // BlockFreeChannelSend will remove things from the queue to make room for new messages if the queue is full.
-// This prevents channel blocking on full.
+// This prevents channel blocking on full.  The controller and connections use PriorityQueues instead, which
+// drop the least important messages first and count what they drop, see queue.go.
 //		Returns: The number of elements cleared from the channel to make room
 func BlockFreeChannelSend(channel chan interface{}, message interface{}) int {
 	removed := 0
@@ -80,9 +81,15 @@ var (
 
 const (
 	// ProtocolVersion is the latest version this package supports
-	ProtocolVersion uint16 = 8
+	ProtocolVersion uint16 = 11
 	// ProtocolVersionMinimum is the earliest version this package supports
 	ProtocolVersionMinimum uint16 = 8
+	// ProtocolVersionBinary is the first version that can send parcels as binary frames
+	ProtocolVersionBinary uint16 = 9
+	// ProtocolVersionCompression is the first version that can read compressed binary frames
+	ProtocolVersionCompression uint16 = 10
+	// ProtocolVersionGossip is the first version that understands Inventory and GetData parcels
+	ProtocolVersionGossip uint16 = 11
 )
 
 // NetworkIdentifier represents the P2P network we are participating in (eg: test, nmain, etc.)
@@ -0,0 +1,306 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The queues between the application, the controller and the connections
+// are PriorityQueues rather than channels.  Each item has a Priority.  Items
+// come out highest priority first, so consensus messages get ahead of commits
+// and of large missing data responses.  When a queue is full, producers that
+// can wait get backpressure (SendWait), and otherwise the queue makes room by
+// dropping the oldest item of its lowest priority.  Control items always get
+// in, as they may be the command that shuts a connection down.  Drops are counted by
+// priority, so overload shows up in the metrics instead of going unnoticed.
+
+// Priority is the class of an item in a PriorityQueue.  Lower values go first.
+type Priority uint8
+
+const (
+	PriorityControl   Priority = iota // Connection commands and network parcels (ping, peer requests)
+	PriorityConsensus                 // Acks, EOMs, directory block signatures and the like
+	PriorityNormal                    // Commits, reveals, transactions, and anything not classified
+	PriorityData                      // Missing data and DBState responses
+	numPriorities
+)
+
+var priorityStrings = map[Priority]string{
+	PriorityControl:   "control",
+	PriorityConsensus: "consensus",
+	PriorityNormal:    "normal",
+	PriorityData:      "data",
+}
+
+func (p Priority) String() string {
+	if s, ok := priorityStrings[p]; ok {
+		return s
+	}
+	return fmt.Sprintf("priority-%d", p)
+}
+
+var (
+	// BackpressureTimeout is how long SendWait waits for room before it drops
+	BackpressureTimeout = time.Second
+
+	// starvationLimit is how many items we take ahead of a waiting lower
+	// priority before we let one of those through
+	starvationLimit = 16
+
+	appTypePriorities      = map[string]Priority{}
+	appTypePrioritiesMutex sync.RWMutex
+)
+
+// SetAppTypePriority sets the priority of application messages with the
+// AppType.  Unknown AppTypes are PriorityNormal.
+func SetAppTypePriority(appType string, priority Priority) {
+	appTypePrioritiesMutex.Lock()
+	defer appTypePrioritiesMutex.Unlock()
+	appTypePriorities[appType] = priority
+}
+
+// AppTypePriority returns the priority of application messages with the
+// AppType
+func AppTypePriority(appType string) Priority {
+	appTypePrioritiesMutex.RLock()
+	defer appTypePrioritiesMutex.RUnlock()
+	if priority, ok := appTypePriorities[appType]; ok {
+		return priority
+	}
+	return PriorityNormal
+}
+
+// ParcelPriority returns the priority of a parcel.  Application messages go
+// by their AppType; the network's own parcels are PriorityControl.
+func ParcelPriority(parcel *Parcel) Priority {
+	switch parcel.Header.Type {
+	case TypeMessage, TypeMessagePart:
+		return AppTypePriority(parcel.Header.AppType)
+	default:
+		return PriorityControl
+	}
+}
+
+// itemPriority returns the priority of something put on the controller and
+// connection queues
+func itemPriority(item interface{}) Priority {
+	switch item := item.(type) {
+	case ConnectionParcel:
+		return ParcelPriority(&item.Parcel)
+	case Parcel:
+		return ParcelPriority(&item)
+	default:
+		return PriorityControl
+	}
+}
+
+// enqueue sends an item to one of the controller or connection queues
+func enqueue(q *PriorityQueue, item interface{}) int {
+	return q.Send(item, itemPriority(item))
+}
+
+// PriorityQueue is a bounded queue of items in priority classes.  It is safe
+// to use from any goroutine.
+type PriorityQueue struct {
+	name     string
+	capacity int
+	mutex    sync.Mutex
+	classes  [numPriorities][]interface{}
+	size     int
+	skipped  int                   // Items taken while a lower priority waited
+	drops    [numPriorities]uint64 // Items dropped, by priority
+	ready    chan struct{}         // Has a value when there may be items to receive
+	space    chan struct{}         // Has a value when there may be room to send
+}
+
+// NewPriorityQueue makes a queue holding up to capacity items.  The name
+// labels its metrics.
+func NewPriorityQueue(name string, capacity int) *PriorityQueue {
+	q := new(PriorityQueue)
+	q.name = name
+	q.capacity = capacity
+	q.ready = make(chan struct{}, 1)
+	q.space = make(chan struct{}, 1)
+	return q
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// Send adds the item without blocking.  If the queue is full, it drops the
+// oldest item of the lowest priority below the item's, or if there is none,
+// the item itself.  A PriorityControl item is never the one dropped; it
+// takes the place of the oldest control item instead.  It returns the number
+// of items dropped, 0 or 1.
+func (q *PriorityQueue) Send(item interface{}, priority Priority) int {
+	if priority >= numPriorities {
+		priority = numPriorities - 1
+	}
+	q.mutex.Lock()
+	dropped := 0
+	if q.size >= q.capacity {
+		dropped = 1
+		switch {
+		case q.dropBelow(priority):
+		case PriorityControl == priority:
+			q.dropOldest(priority)
+		default:
+			q.drop(priority)
+			q.mutex.Unlock()
+			return dropped
+		}
+	}
+	q.classes[priority] = append(q.classes[priority], item)
+	q.size++
+	q.mutex.Unlock()
+	signal(q.ready)
+	return dropped
+}
+
+// SendWait adds the item, waiting up to timeout for room in a full queue
+// before dropping like Send.  Producers that can afford to wait use this, so a
+// slow consumer slows them down instead of losing messages.  It returns the
+// number of items dropped, 0 or 1.
+func (q *PriorityQueue) SendWait(item interface{}, priority Priority, timeout time.Duration) int {
+	q.WaitForRoom(timeout)
+	return q.Send(item, priority)
+}
+
+// WaitForRoom waits up to timeout for room in a full queue, and returns false
+// if it is still full.  A producer that can't block where it sends, like a
+// connection's runloop, has whoever feeds it wait here instead.
+func (q *PriorityQueue) WaitForRoom(timeout time.Duration) bool {
+	var timer <-chan time.Time
+	for !q.hasRoom() {
+		if nil == timer {
+			timer = time.After(timeout)
+		}
+		select {
+		case <-q.space:
+		case <-timer:
+			return false
+		}
+	}
+	return true
+}
+
+func (q *PriorityQueue) hasRoom() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.size < q.capacity
+}
+
+// dropBelow drops the oldest item of the lowest priority below the given
+// one, and returns false if there isn't one.  Called with the mutex held.
+func (q *PriorityQueue) dropBelow(priority Priority) bool {
+	for p := numPriorities - 1; p > priority; p-- {
+		if q.dropOldest(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropOldest drops the oldest item of the priority, and returns false if
+// there isn't one.  Called with the mutex held.
+func (q *PriorityQueue) dropOldest(priority Priority) bool {
+	if 0 == len(q.classes[priority]) {
+		return false
+	}
+	q.classes[priority][0] = nil
+	q.classes[priority] = q.classes[priority][1:]
+	q.size--
+	q.drop(priority)
+	return true
+}
+
+// drop counts a dropped item.  Called with the mutex held.
+func (q *PriorityQueue) drop(priority Priority) {
+	q.drops[priority]++
+	p2pQueueDrops.WithLabelValues(q.name, priority.String()).Inc()
+	if 1 == q.drops[priority]%1000 {
+		significant("queue", "PriorityQueue %s is full, dropped %d %s items so far", q.name, q.drops[priority], priority)
+	}
+}
+
+// Receive removes the next item without blocking.  That is the oldest item of
+// the highest priority, except that a lower priority gets an item through
+// every so often, so it isn't starved.
+func (q *PriorityQueue) Receive() (interface{}, bool) {
+	q.mutex.Lock()
+	if 0 == q.size {
+		q.mutex.Unlock()
+		return nil, false
+	}
+	first := Priority(0)
+	for 0 == len(q.classes[first]) {
+		first++
+	}
+	next := first
+	if q.size > len(q.classes[first]) {
+		q.skipped++
+		if q.skipped > starvationLimit {
+			q.skipped = 0
+			next++
+			for 0 == len(q.classes[next]) {
+				next++
+			}
+		}
+	} else {
+		q.skipped = 0
+	}
+	item := q.classes[next][0]
+	q.classes[next][0] = nil
+	q.classes[next] = q.classes[next][1:]
+	q.size--
+	remaining := q.size
+	q.mutex.Unlock()
+
+	signal(q.space)
+	if 0 < remaining {
+		signal(q.ready)
+	}
+	return item, true
+}
+
+// Next removes the next item, waiting for one if the queue is empty.
+func (q *PriorityQueue) Next() interface{} {
+	for {
+		if item, ok := q.Receive(); ok {
+			return item
+		}
+		<-q.ready
+	}
+}
+
+// Len returns the number of items in the queue
+func (q *PriorityQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.size
+}
+
+// Cap returns the number of items the queue holds
+func (q *PriorityQueue) Cap() int {
+	return q.capacity
+}
+
+// Drops returns the number of items dropped, by priority name
+func (q *PriorityQueue) Drops() map[string]uint64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	drops := map[string]uint64{}
+	for p := Priority(0); p < numPriorities; p++ {
+		drops[p.String()] = q.drops[p]
+	}
+	return drops
+}
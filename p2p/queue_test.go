@@ -0,0 +1,146 @@
+package p2p_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/FactomProject/factomd/p2p"
+)
+
+func TestPriorityQueueOrder(t *testing.T) {
+	q := NewPriorityQueue("test", 100)
+	q.Send("commit", PriorityNormal)
+	q.Send("dbstate", PriorityData)
+	q.Send("ack", PriorityConsensus)
+	q.Send("ping", PriorityControl)
+	q.Send("eom", PriorityConsensus)
+	if q.Len() != 5 {
+		t.Errorf("Queue has %d items", q.Len())
+	}
+	for _, want := range []string{"ping", "ack", "eom", "commit", "dbstate"} {
+		item, ok := q.Receive()
+		if !ok || item != want {
+			t.Errorf("Got %v, expected %v", item, want)
+		}
+	}
+	if _, ok := q.Receive(); ok {
+		t.Errorf("Empty queue gave an item")
+	}
+}
+
+func TestPriorityQueueDrops(t *testing.T) {
+	q := NewPriorityQueue("test", 3)
+	q.Send("dbstate 1", PriorityData)
+	q.Send("dbstate 2", PriorityData)
+	q.Send("commit", PriorityNormal)
+	// Full, so the oldest lower priority item makes room
+	if dropped := q.Send("ack", PriorityConsensus); dropped != 1 {
+		t.Errorf("Ack dropped %d", dropped)
+	}
+	// Nothing is lower than a dbstate, so it is the one dropped
+	q.Send("dbstate 3", PriorityData)
+	drops := q.Drops()
+	if drops["data"] != 2 || drops["consensus"] != 0 || drops["normal"] != 0 {
+		t.Errorf("Wrong drops %v", drops)
+	}
+	for _, want := range []string{"ack", "commit", "dbstate 2"} {
+		if item, _ := q.Receive(); item != want {
+			t.Errorf("Got %v, expected %v", item, want)
+		}
+	}
+}
+
+func TestPriorityQueueControlAdmitted(t *testing.T) {
+	q := NewPriorityQueue("test", 2)
+	q.Send("ping 1", PriorityControl)
+	q.Send("ping 2", PriorityControl)
+	// A control item is never the one dropped, even with nothing below it
+	if dropped := q.Send("closed", PriorityControl); dropped != 1 {
+		t.Errorf("Closed dropped %d", dropped)
+	}
+	if drops := q.Drops(); drops["control"] != 1 {
+		t.Errorf("Wrong drops %v", drops)
+	}
+	for _, want := range []string{"ping 2", "closed"} {
+		if item, _ := q.Receive(); item != want {
+			t.Errorf("Got %v, expected %v", item, want)
+		}
+	}
+}
+
+func TestPriorityQueueStarvation(t *testing.T) {
+	q := NewPriorityQueue("test", 1000)
+	q.Send("dbstate", PriorityData)
+	for i := 0; i < 100; i++ {
+		q.Send(i, PriorityConsensus)
+	}
+	for i := 0; i < 100; i++ {
+		if item, _ := q.Receive(); item == "dbstate" {
+			if i < 10 {
+				t.Errorf("Data got ahead after %d items", i)
+			}
+			return
+		}
+	}
+	t.Errorf("Data was starved")
+}
+
+func TestPriorityQueueBackpressure(t *testing.T) {
+	q := NewPriorityQueue("test", 2)
+	q.Send(1, PriorityNormal)
+	q.Send(2, PriorityNormal)
+
+	// The producer waits for the consumer rather than dropping
+	done := make(chan int)
+	go func() {
+		done <- q.SendWait(3, PriorityNormal, 10*time.Second)
+	}()
+	select {
+	case <-done:
+		t.Fatalf("SendWait didn't wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if item := q.Next(); item != 1 {
+		t.Errorf("Got %v", item)
+	}
+	if dropped := <-done; dropped != 0 {
+		t.Errorf("SendWait dropped %d", dropped)
+	}
+
+	// And gives up after the timeout
+	if dropped := q.SendWait(4, PriorityNormal, 10*time.Millisecond); dropped != 1 {
+		t.Errorf("SendWait on a full queue dropped %d", dropped)
+	}
+	for _, want := range []int{2, 3} {
+		if item := q.Next(); item != want {
+			t.Errorf("Got %v, expected %v", item, want)
+		}
+	}
+
+	// Next waits for an item
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		q.Send(5, PriorityControl)
+	}()
+	if item := q.Next(); item != 5 {
+		t.Errorf("Got %v", item)
+	}
+}
+
+func TestParcelPriority(t *testing.T) {
+	SetAppTypePriority("250", PriorityConsensus)
+	p := NewParcel(TestNet, []byte{1})
+	p.Header.Type = TypeMessage
+	p.Header.AppType = "250"
+	if ParcelPriority(p) != PriorityConsensus {
+		t.Errorf("Wrong priority %v", ParcelPriority(p))
+	}
+	p.Header.AppType = "251"
+	if ParcelPriority(p) != PriorityNormal {
+		t.Errorf("Unknown AppType has priority %v", ParcelPriority(p))
+	}
+	p.Header.Type = TypePing
+	if ParcelPriority(p) != PriorityControl {
+		t.Errorf("Ping has priority %v", ParcelPriority(p))
+	}
+}
@@ -0,0 +1,405 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Peer reputation.  Connections report what each peer does as PeerEvents.
+// The scoring policies turn each event into a change to the peer's score, and
+// a peer whose score falls to the ban score is banned.  Bans are by address,
+// expire, and are saved to their own file so they survive a restart.  The
+// QualityScore on Peer is still used for choosing peers; this is about
+// keeping misbehaving ones away.  Good behaviour only builds a peer's score up
+// to MaxPeerScore, so a long lived peer can't bank enough credit to never be
+// banned, and exempt peers (the special and persistent ones we always dial)
+// are never banned on their score.
+
+// PeerEvent is something a peer did that counts toward its reputation
+type PeerEvent uint8
+
+const (
+	EventInvalidMessage PeerEvent = iota // Sent a parcel that failed validation, or that we panicked on
+	EventTimeout                         // Timed out on a dial or a write
+	EventUsefulData                      // Sent an application message
+)
+
+var peerEventStrings = map[PeerEvent]string{
+	EventInvalidMessage: "invalid",
+	EventTimeout:        "timeout",
+	EventUsefulData:     "useful",
+}
+
+func (e PeerEvent) String() string {
+	if s, ok := peerEventStrings[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("event-%d", e)
+}
+
+// ParsePeerEvent parses the name of a PeerEvent
+func ParsePeerEvent(s string) (PeerEvent, error) {
+	for e, name := range peerEventStrings {
+		if name == s {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown peer event %q, must be invalid, timeout or useful", s)
+}
+
+const (
+	DefaultBanScore    int32 = -1000          // Peers whose score falls to this are banned
+	DefaultBanDuration       = time.Hour * 24 // How long a ban lasts if not told otherwise
+	MaxPeerScore       int32 = 100            // The most good behaviour can build a peer's score up to
+	maxPeerRecords           = 10000          // We forget idle peers past this many records
+	peerRecordIdle           = time.Hour      // How long a peer is idle before we may forget it
+)
+
+// PeerRecord is what we know about how a peer has behaved
+type PeerRecord struct {
+	Address         string
+	Score           int32
+	InvalidMessages uint32
+	Timeouts        uint32
+	UsefulData      uint32
+	LastEvent       time.Time
+}
+
+// PeerBan keeps a peer's address away until it expires
+type PeerBan struct {
+	Address string
+	Reason  string
+	Until   time.Time
+}
+
+// ScoringPolicy decides how much an event changes a peer's score.  Each
+// policy sees the record after its counters are updated, and the changes of
+// all the policies are added up.
+type ScoringPolicy interface {
+	Score(record *PeerRecord, event PeerEvent) int32
+}
+
+// WeightPolicy scores each event with a fixed weight
+type WeightPolicy map[PeerEvent]int32
+
+func (w WeightPolicy) Score(record *PeerRecord, event PeerEvent) int32 {
+	return w[event]
+}
+
+// DefaultWeights is the WeightPolicy used unless configured otherwise
+func DefaultWeights() WeightPolicy {
+	return WeightPolicy{
+		EventInvalidMessage: -20,
+		EventTimeout:        -5,
+		EventUsefulData:     1,
+	}
+}
+
+// ParseWeightPolicy makes a WeightPolicy from the defaults and config lines of
+// the form event:weight, eg "invalid:-50"
+func ParseWeightPolicy(lines []string) (WeightPolicy, error) {
+	w := DefaultWeights()
+	for _, line := range lines {
+		parts := strings.Split(strings.TrimSpace(line), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("peer scoring %q must be event:weight", line)
+		}
+		event, err := ParsePeerEvent(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		weight, err := strconv.ParseInt(parts[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("peer scoring %q has a bad weight", line)
+		}
+		w[event] = int32(weight)
+	}
+	return w, nil
+}
+
+// Reputation tracks peer records and bans.  It is safe to use from any
+// goroutine.
+type Reputation struct {
+	mutex       sync.Mutex
+	saveMutex   sync.Mutex // Orders writes of the bans file, which happen outside mutex
+	policies    []ScoringPolicy
+	banScore    int32
+	banDuration time.Duration
+	records     map[string]*PeerRecord
+	bans        map[string]PeerBan
+	exempt      map[string]bool
+	bansFile    string
+}
+
+// PeerReputation is the reputation used by the connections and the
+// controller.  Controller.Init replaces it with the configured one.
+var PeerReputation = NewReputation("", DefaultBanScore, DefaultBanDuration, DefaultWeights())
+
+// NewReputation makes a Reputation that saves its bans to bansFile, if not
+// empty.  A zero banScore or banDuration gets the default.
+func NewReputation(bansFile string, banScore int32, banDuration time.Duration, policies ...ScoringPolicy) *Reputation {
+	r := new(Reputation)
+	r.policies = policies
+	r.banScore = banScore
+	if 0 == r.banScore {
+		r.banScore = DefaultBanScore
+	}
+	r.banDuration = banDuration
+	if 0 == r.banDuration {
+		r.banDuration = DefaultBanDuration
+	}
+	r.records = map[string]*PeerRecord{}
+	r.bans = map[string]PeerBan{}
+	r.exempt = map[string]bool{}
+	r.bansFile = bansFile
+	return r
+}
+
+// reputationAddress returns the key a peer's record, ban and exemption are
+// kept under: its canonical address, without a port if given one
+func reputationAddress(address string) string {
+	if host, _, err := net.SplitHostPort(address); nil == err {
+		address = host
+	}
+	return CanonicalAddress(address)
+}
+
+// bansFileFor returns the file bans are saved in, next to the peers file
+func bansFileFor(peersFile string) string {
+	if "" == peersFile {
+		return ""
+	}
+	return strings.TrimSuffix(peersFile, filepath.Ext(peersFile)) + "-bans.json"
+}
+
+// AddPolicy adds a scoring policy after the existing ones
+func (r *Reputation) AddPolicy(policy ScoringPolicy) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.policies = append(r.policies, policy)
+}
+
+// Exempt keeps the address from being banned on its score.  The controller
+// exempts the special and persistent peers it always dials.
+func (r *Reputation) Exempt(address string) {
+	address = reputationAddress(address)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.exempt[address] = true
+}
+
+// Record counts an event for the peer at the address, and returns true if it
+// got the peer banned.
+func (r *Reputation) Record(address string, event PeerEvent) bool {
+	address = reputationAddress(address)
+	banned := r.record(address, event)
+	if banned {
+		r.saveBans()
+	}
+	return banned
+}
+
+func (r *Reputation) record(address string, event PeerEvent) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	record, ok := r.records[address]
+	if !ok {
+		r.forgetIdle()
+		record = &PeerRecord{Address: address}
+		r.records[address] = record
+	}
+	switch event {
+	case EventInvalidMessage:
+		record.InvalidMessages++
+	case EventTimeout:
+		record.Timeouts++
+	case EventUsefulData:
+		record.UsefulData++
+	}
+	record.LastEvent = time.Now()
+	for _, policy := range r.policies {
+		record.Score += policy.Score(record, event)
+	}
+	if record.Score > MaxPeerScore {
+		record.Score = MaxPeerScore
+	}
+	if record.Score > r.banScore || r.exempt[address] || r.banned(address) {
+		return false
+	}
+	r.ban(address, fmt.Sprintf("score %d after %s", record.Score, event), r.banDuration)
+	// Start over once the ban is done
+	record.Score = 0
+	return true
+}
+
+// forgetIdle drops the records of idle peers when there are too many
+func (r *Reputation) forgetIdle() {
+	if len(r.records) < maxPeerRecords {
+		return
+	}
+	for address, record := range r.records {
+		if time.Since(record.LastEvent) > peerRecordIdle {
+			delete(r.records, address)
+		}
+	}
+}
+
+// Ban bans the address.  A zero duration gets the configured ban duration.
+func (r *Reputation) Ban(address string, reason string, duration time.Duration) {
+	address = reputationAddress(address)
+	r.mutex.Lock()
+	if 0 >= duration {
+		duration = r.banDuration
+	}
+	r.ban(address, reason, duration)
+	r.mutex.Unlock()
+	r.saveBans()
+}
+
+// ban adds the ban.  Called with the mutex held, so the caller saves the bans
+// once it lets go.
+func (r *Reputation) ban(address string, reason string, duration time.Duration) {
+	significant("reputation", "Banning %s for %s: %s", address, duration, reason)
+	r.bans[address] = PeerBan{Address: address, Reason: reason, Until: time.Now().Add(duration)}
+}
+
+// Unban lifts a ban, and returns false if the address wasn't banned.
+func (r *Reputation) Unban(address string) bool {
+	address = reputationAddress(address)
+	r.mutex.Lock()
+	_, present := r.bans[address]
+	if present {
+		delete(r.bans, address)
+		if record, ok := r.records[address]; ok {
+			record.Score = 0
+		}
+	}
+	r.mutex.Unlock()
+	if present {
+		r.saveBans()
+	}
+	return present
+}
+
+// IsBanned returns true if the address is banned
+func (r *Reputation) IsBanned(address string) bool {
+	address = reputationAddress(address)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.banned(address)
+}
+
+func (r *Reputation) banned(address string) bool {
+	ban, present := r.bans[address]
+	if present && time.Now().After(ban.Until) {
+		delete(r.bans, address)
+		return false
+	}
+	return present
+}
+
+// Bans returns the bans that haven't expired, sorted by address
+func (r *Reputation) Bans() []PeerBan {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	bans := []PeerBan{}
+	for address, ban := range r.bans {
+		if r.banned(address) {
+			bans = append(bans, ban)
+		}
+	}
+	sort.Sort(peerBanSort(bans))
+	return bans
+}
+
+// Records returns the peer records, sorted by address
+func (r *Reputation) Records() []PeerRecord {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	records := []PeerRecord{}
+	for _, record := range r.records {
+		records = append(records, *record)
+	}
+	sort.Sort(peerRecordSort(records))
+	return records
+}
+
+// LoadBans reads the saved bans, dropping any that have expired.  A missing
+// file is not an error.
+func (r *Reputation) LoadBans() error {
+	if "" == r.bansFile {
+		return nil
+	}
+	data, err := ioutil.ReadFile(r.bansFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if nil != err {
+		return err
+	}
+	var bans []PeerBan
+	if err := json.Unmarshal(data, &bans); nil != err {
+		return fmt.Errorf("reading %s: %v", r.bansFile, err)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, ban := range bans {
+		if time.Now().Before(ban.Until) {
+			r.bans[ban.Address] = ban
+		}
+	}
+	return nil
+}
+
+// saveBans writes the bans out.  Called without the mutex held, so the file
+// write doesn't hold up Record.  The copy is taken under saveMutex, so the
+// last write always has the latest bans.
+func (r *Reputation) saveBans() {
+	if "" == r.bansFile {
+		return
+	}
+	r.saveMutex.Lock()
+	defer r.saveMutex.Unlock()
+	r.mutex.Lock()
+	bans := []PeerBan{}
+	for _, ban := range r.bans {
+		bans = append(bans, ban)
+	}
+	r.mutex.Unlock()
+	sort.Sort(peerBanSort(bans))
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if nil == err {
+		err = ioutil.WriteFile(r.bansFile, data, 0600)
+	}
+	if nil != err {
+		logerror("reputation", "Reputation.saveBans() File write error on file: %s, Error: %+v", r.bansFile, err)
+	}
+}
+
+// sort.Sort interface implementation
+type peerBanSort []PeerBan
+
+func (p peerBanSort) Len() int           { return len(p) }
+func (p peerBanSort) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p peerBanSort) Less(i, j int) bool { return p[i].Address < p[j].Address }
+
+// sort.Sort interface implementation
+type peerRecordSort []PeerRecord
+
+func (p peerRecordSort) Len() int           { return len(p) }
+func (p peerRecordSort) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p peerRecordSort) Less(i, j int) bool { return p[i].Address < p[j].Address }
@@ -0,0 +1,177 @@
+package p2p_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/FactomProject/factomd/p2p"
+)
+
+func TestParseWeightPolicy(t *testing.T) {
+	w, err := ParseWeightPolicy([]string{"invalid:-50", " useful:2 "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w[EventInvalidMessage] != -50 || w[EventUsefulData] != 2 || w[EventTimeout] != DefaultWeights()[EventTimeout] {
+		t.Errorf("Wrong weights %v", w)
+	}
+	for _, bad := range []string{"invalid", "slow:-1", "invalid:x", "invalid:-1:2"} {
+		if _, err := ParseWeightPolicy([]string{bad}); err == nil {
+			t.Errorf("Bad scoring %q was accepted", bad)
+		}
+	}
+}
+
+func TestReputationBan(t *testing.T) {
+	r := NewReputation("", -100, time.Hour, DefaultWeights())
+	// Useful data keeps a peer ahead of the odd invalid message
+	for i := 0; i < 40; i++ {
+		r.Record("10.0.0.1", EventUsefulData)
+	}
+	for i := 0; i < 6; i++ {
+		if r.Record("10.0.0.1", EventInvalidMessage) {
+			t.Fatalf("Peer banned after %d invalid messages", i+1)
+		}
+	}
+	// The seventh takes the score to -100
+	if !r.Record("10.0.0.1", EventInvalidMessage) || !r.IsBanned("10.0.0.1") {
+		t.Errorf("Peer isn't banned")
+	}
+	if r.IsBanned("10.0.0.2") {
+		t.Errorf("Other peer is banned")
+	}
+
+	records := r.Records()
+	if len(records) != 1 || records[0].InvalidMessages != 7 || records[0].UsefulData != 40 {
+		t.Errorf("Wrong records %+v", records)
+	}
+	bans := r.Bans()
+	if len(bans) != 1 || bans[0].Address != "10.0.0.1" || time.Until(bans[0].Until) > time.Hour {
+		t.Errorf("Wrong bans %+v", bans)
+	}
+
+	if !r.Unban("10.0.0.1") || r.IsBanned("10.0.0.1") {
+		t.Errorf("Peer wasn't unbanned")
+	}
+	if r.Unban("10.0.0.1") {
+		t.Errorf("Peer was unbanned twice")
+	}
+
+	r.Ban("10.0.0.3", "testing", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if r.IsBanned("10.0.0.3") || len(r.Bans()) != 0 {
+		t.Errorf("Ban didn't expire")
+	}
+}
+
+func TestReputationScoreCap(t *testing.T) {
+	r := NewReputation("", -100, time.Hour, DefaultWeights())
+	// However much useful data a peer sends, it can't bank more than
+	// MaxPeerScore against its invalid messages
+	for i := 0; i < 10000; i++ {
+		r.Record("10.0.0.1", EventUsefulData)
+	}
+	if records := r.Records(); records[0].Score != MaxPeerScore {
+		t.Errorf("Score %d isn't capped at %d", records[0].Score, MaxPeerScore)
+	}
+	banned := false
+	for i := 0; i < 11 && !banned; i++ {
+		banned = r.Record("10.0.0.1", EventInvalidMessage)
+	}
+	if !banned {
+		t.Errorf("Peer isn't banned after 11 invalid messages")
+	}
+}
+
+func TestReputationExempt(t *testing.T) {
+	r := NewReputation("", -100, time.Hour, DefaultWeights())
+	r.Exempt("10.0.0.1")
+	for i := 0; i < 100; i++ {
+		if r.Record("10.0.0.1", EventTimeout) {
+			t.Fatalf("Exempt peer banned after %d timeouts", i+1)
+		}
+	}
+	if r.IsBanned("10.0.0.1") {
+		t.Errorf("Exempt peer is banned")
+	}
+}
+
+func TestReputationAddressForms(t *testing.T) {
+	r := NewReputation("", -10, time.Hour, DefaultWeights())
+	r.Exempt("[::1]")
+	// Records are kept under the same address as exemptions and bans,
+	// whatever form the address comes in
+	for _, address := range []string{"0:0::1", "[::1]:8108", "::1"} {
+		if r.Record(address, EventInvalidMessage) {
+			t.Errorf("Exempt peer banned through %s", address)
+		}
+	}
+	if records := r.Records(); len(records) != 1 || records[0].Address != "::1" {
+		t.Errorf("Wrong records %+v", records)
+	}
+	if !r.Record("10.0.0.2:8108", EventInvalidMessage) || !r.IsBanned("10.0.0.2") {
+		t.Errorf("Peer given with a port wasn't banned")
+	}
+}
+
+// timeoutPolicy bans a peer for its third timeout, whatever its score
+type timeoutPolicy struct{}
+
+func (timeoutPolicy) Score(record *PeerRecord, event PeerEvent) int32 {
+	if record.Timeouts >= 3 {
+		return DefaultBanScore - record.Score
+	}
+	return 0
+}
+
+func TestReputationPolicies(t *testing.T) {
+	r := NewReputation("", 0, 0, WeightPolicy{EventUsefulData: 1})
+	r.AddPolicy(timeoutPolicy{})
+	for i := 0; i < 100; i++ {
+		r.Record("10.0.0.1", EventUsefulData)
+	}
+	r.Record("10.0.0.1", EventTimeout)
+	if r.Record("10.0.0.1", EventTimeout) {
+		t.Errorf("Banned after two timeouts")
+	}
+	if !r.Record("10.0.0.1", EventTimeout) {
+		t.Errorf("Not banned after three timeouts")
+	}
+	if bans := r.Bans(); len(bans) != 1 || time.Until(bans[0].Until) < DefaultBanDuration-time.Minute {
+		t.Errorf("Wrong default ban %+v", bans)
+	}
+}
+
+func TestReputationSavedBans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "peers-bans.json")
+
+	r := NewReputation(file, 0, time.Hour)
+	r.Ban("10.0.0.1", "testing", 0)
+	r.Ban("10.0.0.2", "testing", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	loaded := NewReputation(file, 0, time.Hour)
+	if err := loaded.LoadBans(); err != nil {
+		t.Fatal(err)
+	}
+	bans := loaded.Bans()
+	if len(bans) != 1 || bans[0].Address != "10.0.0.1" || bans[0].Reason != "testing" {
+		t.Errorf("Wrong bans loaded %+v", bans)
+	}
+
+	if err := NewReputation(filepath.Join(dir, "missing.json"), 0, 0).LoadBans(); err != nil {
+		t.Errorf("Missing bans file gave %v", err)
+	}
+	ioutil.WriteFile(file, []byte("not json"), 0600)
+	if err := NewReputation(file, 0, 0).LoadBans(); err == nil {
+		t.Errorf("Corrupt bans file was loaded")
+	}
+}
@@ -0,0 +1,412 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/ed25519"
+	"github.com/FactomProject/factomd/common/primitives"
+	"golang.org/x/crypto/curve25519"
+)
+
+// Connections can be encrypted and authenticated by the keys of the nodes.
+// The node that dials sends a hello, and the node that was dialed answers
+// with one of its own:
+//
+//   magic (8 bytes) + ephemeral curve25519 key (32 bytes) + node key (32 bytes)
+//
+// The dialed node adds its signature of the handshake, then the dialing node
+// sends its signature.  Both sides derive a key for each direction from the
+// shared secret and the handshake, and everything after that is sent in AES-GCM
+// records of
+//
+//   length of the sealed data (4 bytes, big endian) + sealed data
+//
+// A node that doesn't know about encryption doesn't answer with a hello, so
+// the dialing node can dial it again without encryption, unless encryption is
+// required or trusted node keys are set.  The dialed node sees that the first bytes aren't the magic, and
+// reads them as the usual gob stream.
+
+type EncryptionMode int
+
+const (
+	EncryptionDisabled EncryptionMode = iota // Plain connections, as before encryption
+	EncryptionOptional                       // Encrypt when the peer can, plain connections for legacy peers
+	EncryptionRequired                       // Only encrypted connections
+)
+
+var encryptionModeNames = map[EncryptionMode]string{
+	EncryptionDisabled: "disabled",
+	EncryptionOptional: "optional",
+	EncryptionRequired: "required",
+}
+
+func (m EncryptionMode) String() string {
+	if name, ok := encryptionModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("EncryptionMode(%d)", int(m))
+}
+
+// ParseEncryptionMode reads disabled, optional or required.  An empty string
+// is disabled.
+func ParseEncryptionMode(s string) (EncryptionMode, error) {
+	if s == "" {
+		return EncryptionDisabled, nil
+	}
+	for m, name := range encryptionModeNames {
+		if strings.EqualFold(s, name) {
+			return m, nil
+		}
+	}
+	return EncryptionDisabled, fmt.Errorf("Unknown p2p encryption mode %q, use disabled, optional or required", s)
+}
+
+// Global encryption settings, set by the controller's Init
+var (
+	Encryption      = EncryptionDisabled
+	NodeKey         *primitives.PrivateKey // Key the node signs handshakes with
+	TrustedNodeKeys map[[32]byte]bool      // If not empty, peers must be encrypted and have one of these keys
+)
+
+var (
+	secureMagic              = []byte("FCTSEC01")
+	HandshakeTimeout         = time.Second * 10
+	MaxConcurrentHandshakes  = 32      // Most accepted connections in the handshake at once
+	maxSecureRecord          = 1 << 16 // Most plaintext in a record
+	secureHelloSize          = len(secureMagic) + 64
+	ErrNotSecure             = errors.New("peer did not answer the encrypted handshake")
+	errBadHandshakeSig       = errors.New("bad signature in encrypted handshake")
+	errUntrustedNodeKey      = errors.New("peer's node key is not trusted")
+	secureHandshakeContext   = []byte("factomd p2p handshake")
+	secureKeyContextDialer   = []byte("dialer to listener")
+	secureKeyContextListener = []byte("listener to dialer")
+)
+
+// SetTrustedNodeKeys sets the node keys encrypted peers must have.  Keys are
+// hex.  No keys means any node key is accepted.
+func SetTrustedNodeKeys(keys []string) error {
+	trusted := map[[32]byte]bool{}
+	for _, k := range keys {
+		b, err := hex.DecodeString(k)
+		if err != nil || len(b) != 32 {
+			return fmt.Errorf("Bad trusted p2p node key %q", k)
+		}
+		var key [32]byte
+		copy(key[:], b)
+		trusted[key] = true
+	}
+	TrustedNodeKeys = trusted
+	return nil
+}
+
+// PlaintextFallbackAllowed returns true if a peer that doesn't answer the
+// encrypted handshake may connect without encryption.  That is only when
+// encryption is optional and no trusted node keys are set, as a plaintext peer
+// can't show it has a trusted key.
+func PlaintextFallbackAllowed() bool {
+	return EncryptionOptional == Encryption && len(TrustedNodeKeys) == 0
+}
+
+var nodeKeyMutex sync.Mutex
+
+func nodeKey() *primitives.PrivateKey {
+	nodeKeyMutex.Lock()
+	defer nodeKeyMutex.Unlock()
+	if NodeKey == nil {
+		// Without a configured key, connections are still encrypted, but the
+		// peers can't tell who we are
+		NodeKey = primitives.RandomPrivateKey()
+	}
+	return NodeKey
+}
+
+type secureHello struct {
+	ephemeral [32]byte
+	nodeKey   [32]byte
+}
+
+func newEphemeralKey() (private, public [32]byte, err error) {
+	_, err = io.ReadFull(rand.Reader, private[:])
+	if err != nil {
+		return
+	}
+	curve25519.ScalarBaseMult(&public, &private)
+	return
+}
+
+func writeHello(conn net.Conn, ephemeral [32]byte) error {
+	b := make([]byte, 0, secureHelloSize)
+	b = append(b, secureMagic...)
+	b = append(b, ephemeral[:]...)
+	b = append(b, nodeKey().Pub[:]...)
+	_, err := conn.Write(b)
+	return err
+}
+
+// readHelloRest reads the hello after its magic
+func readHelloRest(conn net.Conn) (*secureHello, error) {
+	b := make([]byte, 64)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return nil, err
+	}
+	h := new(secureHello)
+	copy(h.ephemeral[:], b[:32])
+	copy(h.nodeKey[:], b[32:])
+	if len(TrustedNodeKeys) > 0 && !TrustedNodeKeys[h.nodeKey] {
+		return nil, errUntrustedNodeKey
+	}
+	return h, nil
+}
+
+// handshakeTranscript is what both sides sign, and derive their keys from
+func handshakeTranscript(dialer, listener *secureHello) []byte {
+	t := make([]byte, 0, len(secureHandshakeContext)+132)
+	t = append(t, secureHandshakeContext...)
+	network := make([]byte, 4)
+	binary.BigEndian.PutUint32(network, uint32(CurrentNetwork))
+	t = append(t, network...)
+	t = append(t, dialer.ephemeral[:]...)
+	t = append(t, dialer.nodeKey[:]...)
+	t = append(t, listener.ephemeral[:]...)
+	t = append(t, listener.nodeKey[:]...)
+	return t
+}
+
+func signTranscript(conn net.Conn, transcript []byte, role []byte) error {
+	sig := ed25519.Sign(nodeKey().Key, append(transcript, role...))
+	_, err := conn.Write(sig[:])
+	return err
+}
+
+func verifyTranscript(conn net.Conn, transcript []byte, role []byte, key [32]byte) error {
+	var sig [ed25519.SignatureSize]byte
+	if _, err := io.ReadFull(conn, sig[:]); err != nil {
+		return err
+	}
+	if !ed25519.Verify(&key, append(transcript, role...), &sig) {
+		return errBadHandshakeSig
+	}
+	return nil
+}
+
+func newSecureAEAD(shared [32]byte, transcript []byte, direction []byte) (cipher.AEAD, error) {
+	h := sha256.New()
+	h.Write(shared[:])
+	h.Write(transcript)
+	h.Write(direction)
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newSecureConn(conn net.Conn, private [32]byte, dialer, listener *secureHello, isDialer bool) (*SecureConn, error) {
+	var shared, peerEphemeral [32]byte
+	peerEphemeral = listener.ephemeral
+	if !isDialer {
+		peerEphemeral = dialer.ephemeral
+	}
+	curve25519.ScalarMult(&shared, &private, &peerEphemeral)
+
+	transcript := handshakeTranscript(dialer, listener)
+	toListener, err := newSecureAEAD(shared, transcript, secureKeyContextDialer)
+	if err != nil {
+		return nil, err
+	}
+	toDialer, err := newSecureAEAD(shared, transcript, secureKeyContextListener)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(SecureConn)
+	s.Conn = conn
+	if isDialer {
+		s.sealer, s.opener = toListener, toDialer
+		s.PeerKey = listener.nodeKey
+	} else {
+		s.sealer, s.opener = toDialer, toListener
+		s.PeerKey = dialer.nodeKey
+	}
+	return s, nil
+}
+
+// SecureDial runs the handshake on a connection we dialed.  It returns
+// ErrNotSecure if the peer doesn't do encryption.
+func SecureDial(conn net.Conn) (*SecureConn, error) {
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	private, public, err := newEphemeralKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeHello(conn, public); err != nil {
+		// Dropped by a legacy peer before we could say hello
+		return nil, ErrNotSecure
+	}
+	dialer := &secureHello{ephemeral: public, nodeKey: nodeKey().Pub.Fixed()}
+
+	magic := make([]byte, len(secureMagic))
+	if _, err := io.ReadFull(conn, magic); err != nil || !bytes.Equal(magic, secureMagic) {
+		// Closed on us, timed out or sent gobs: a legacy peer
+		return nil, ErrNotSecure
+	}
+	listener, err := readHelloRest(conn)
+	if err != nil {
+		return nil, err
+	}
+	transcript := handshakeTranscript(dialer, listener)
+	if err := verifyTranscript(conn, transcript, secureKeyContextListener, listener.nodeKey); err != nil {
+		return nil, err
+	}
+	if err := signTranscript(conn, transcript, secureKeyContextDialer); err != nil {
+		return nil, err
+	}
+	return newSecureConn(conn, private, dialer, listener, true)
+}
+
+// SecureAccept runs the handshake on a connection we accepted.  If the peer
+// doesn't start one, the connection is returned as it is, with the bytes read
+// to find that out put back.
+func SecureAccept(conn net.Conn) (net.Conn, bool, error) {
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	magic := make([]byte, len(secureMagic))
+	n, err := io.ReadFull(conn, magic)
+	if err != nil || !bytes.Equal(magic, secureMagic) {
+		if n == 0 && err != nil {
+			return nil, false, err
+		}
+		return &prefixedConn{Conn: conn, prefix: magic[:n]}, false, nil
+	}
+
+	dialer, err := readHelloRest(conn)
+	if err != nil {
+		return nil, false, err
+	}
+	private, public, err := newEphemeralKey()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := writeHello(conn, public); err != nil {
+		return nil, false, err
+	}
+	listener := &secureHello{ephemeral: public, nodeKey: nodeKey().Pub.Fixed()}
+	transcript := handshakeTranscript(dialer, listener)
+	if err := signTranscript(conn, transcript, secureKeyContextListener); err != nil {
+		return nil, false, err
+	}
+	if err := verifyTranscript(conn, transcript, secureKeyContextDialer, dialer.nodeKey); err != nil {
+		return nil, false, err
+	}
+	s, err := newSecureConn(conn, private, dialer, listener, false)
+	if err != nil {
+		return nil, false, err
+	}
+	return s, true, nil
+}
+
+// SecureConn encrypts everything written to the connection, and decrypts
+// everything read from it.
+type SecureConn struct {
+	net.Conn
+	PeerKey [32]byte // Node key of the peer
+
+	sealer     cipher.AEAD
+	sendNonce  uint64
+	writeMutex sync.Mutex
+
+	opener    cipher.AEAD
+	recvNonce uint64
+	readBuf   []byte
+}
+
+func secureNonce(counter uint64, size int) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce[size-8:], counter)
+	return nonce
+}
+
+func (s *SecureConn) Write(b []byte) (int, error) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	written := 0
+	for written < len(b) {
+		end := written + maxSecureRecord
+		if end > len(b) {
+			end = len(b)
+		}
+		sealed := s.sealer.Seal(nil, secureNonce(s.sendNonce, s.sealer.NonceSize()), b[written:end], nil)
+		s.sendNonce++
+		record := make([]byte, 4, 4+len(sealed))
+		binary.BigEndian.PutUint32(record, uint32(len(sealed)))
+		record = append(record, sealed...)
+		if _, err := s.Conn.Write(record); err != nil {
+			return written, err
+		}
+		written = end
+	}
+	return written, nil
+}
+
+func (s *SecureConn) Read(b []byte) (int, error) {
+	if len(s.readBuf) == 0 {
+		var l [4]byte
+		if _, err := io.ReadFull(s.Conn, l[:]); err != nil {
+			return 0, err
+		}
+		size := binary.BigEndian.Uint32(l[:])
+		if size > uint32(maxSecureRecord+s.opener.Overhead()) {
+			return 0, fmt.Errorf("encrypted record too large - %d bytes", size)
+		}
+		sealed := make([]byte, size)
+		if _, err := io.ReadFull(s.Conn, sealed); err != nil {
+			return 0, err
+		}
+		plain, err := s.opener.Open(sealed[:0], secureNonce(s.recvNonce, s.opener.NonceSize()), sealed, nil)
+		if err != nil {
+			return 0, err
+		}
+		s.recvNonce++
+		s.readBuf = plain
+	}
+	n := copy(b, s.readBuf)
+	s.readBuf = s.readBuf[n:]
+	return n, nil
+}
+
+// prefixedConn gives back the bytes read while looking for a handshake before
+// reading more from the connection.
+type prefixedConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (p *prefixedConn) Read(b []byte) (int, error) {
+	if len(p.prefix) > 0 {
+		n := copy(b, p.prefix)
+		p.prefix = p.prefix[n:]
+		return n, nil
+	}
+	return p.Conn.Read(b)
+}
@@ -0,0 +1,200 @@
+package p2p_test
+
+import (
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/FactomProject/factomd/common/primitives"
+	. "github.com/FactomProject/factomd/p2p"
+)
+
+func TestParseEncryptionMode(t *testing.T) {
+	for _, m := range []EncryptionMode{EncryptionDisabled, EncryptionOptional, EncryptionRequired} {
+		p, err := ParseEncryptionMode(m.String())
+		if err != nil {
+			t.Error(err)
+		}
+		if p != m {
+			t.Errorf("Mode %v parsed as %v", m, p)
+		}
+	}
+	if m, err := ParseEncryptionMode(""); err != nil || m != EncryptionDisabled {
+		t.Errorf("Empty mode isn't disabled")
+	}
+	if _, err := ParseEncryptionMode("always"); err == nil {
+		t.Errorf("Unknown mode was accepted")
+	}
+}
+
+type acceptResult struct {
+	conn      net.Conn
+	encrypted bool
+	err       error
+}
+
+func secureAcceptAsync(conn net.Conn) chan acceptResult {
+	done := make(chan acceptResult, 1)
+	go func() {
+		c, encrypted, err := SecureAccept(conn)
+		done <- acceptResult{c, encrypted, err}
+	}()
+	return done
+}
+
+func TestSecureConnection(t *testing.T) {
+	NodeKey = primitives.RandomPrivateKey()
+	SetTrustedNodeKeys(nil)
+
+	dialer, listener := net.Pipe()
+	defer dialer.Close()
+	defer listener.Close()
+
+	accepted := secureAcceptAsync(listener)
+	dialed, err := SecureDial(dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := <-accepted
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	if !result.encrypted {
+		t.Fatal("Accepted connection isn't encrypted")
+	}
+	if dialed.PeerKey != NodeKey.Pub.Fixed() {
+		t.Errorf("Wrong peer key %x", dialed.PeerKey)
+	}
+
+	// Send parcels both ways, one big enough to take more than one record
+	big := make([]byte, 200000)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	parcels := []*Parcel{NewParcel(TestNet, []byte("Hello")), NewParcel(TestNet, big)}
+
+	go func() {
+		encoder := gob.NewEncoder(dialed)
+		for _, p := range parcels {
+			encoder.Encode(p)
+		}
+	}()
+	decoder := gob.NewDecoder(result.conn)
+	for i, p := range parcels {
+		var got Parcel
+		if err := decoder.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Payload) != string(p.Payload) {
+			t.Errorf("Parcel %d changed on the way", i)
+		}
+	}
+
+	go func() {
+		gob.NewEncoder(result.conn).Encode(parcels[0])
+	}()
+	var got Parcel
+	if err := gob.NewDecoder(dialed).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Payload) != "Hello" {
+		t.Errorf("Parcel changed on the way back")
+	}
+}
+
+func TestSecureLegacyPeers(t *testing.T) {
+	NodeKey = primitives.RandomPrivateKey()
+	SetTrustedNodeKeys(nil)
+
+	// A legacy listener sends its peer request and drops us when it can't
+	// decode our hello
+	dialer, listener := net.Pipe()
+	go func(listener net.Conn) {
+		go io.Copy(ioutil.Discard, listener)
+		gob.NewEncoder(listener).Encode(NewParcel(TestNet, []byte("Peer Request")))
+		listener.Close()
+	}(listener)
+	_, err := SecureDial(dialer)
+	if err != ErrNotSecure {
+		t.Errorf("Dialing a legacy peer gave %v", err)
+	}
+	dialer.Close()
+
+	// A legacy dialer just sends gobs, which must still be readable
+	dialer, listener = net.Pipe()
+	defer dialer.Close()
+	defer listener.Close()
+	accepted := secureAcceptAsync(listener)
+	go gob.NewEncoder(dialer).Encode(NewParcel(TestNet, []byte("Peer Request")))
+	result := <-accepted
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	if result.encrypted {
+		t.Fatal("Legacy connection is encrypted")
+	}
+	var got Parcel
+	if err := gob.NewDecoder(result.conn).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Payload) != "Peer Request" {
+		t.Errorf("Legacy parcel changed on the way")
+	}
+}
+
+func TestSecureUntrustedPeer(t *testing.T) {
+	NodeKey = primitives.RandomPrivateKey()
+	other := primitives.RandomPrivateKey()
+	err := SetTrustedNodeKeys([]string{other.PublicKeyString()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrustedNodeKeys(nil)
+
+	dialer, listener := net.Pipe()
+	defer dialer.Close()
+	defer listener.Close()
+
+	accepted := secureAcceptAsync(listener)
+	go func() {
+		SecureDial(dialer)
+		dialer.Close()
+	}()
+	result := <-accepted
+	if result.err == nil {
+		t.Errorf("Peer with an untrusted key was accepted")
+	}
+
+	if err := SetTrustedNodeKeys([]string{"1234"}); err == nil {
+		t.Errorf("Bad trusted key was accepted")
+	}
+}
+
+func TestPlaintextFallbackAllowed(t *testing.T) {
+	defer func(mode EncryptionMode) { Encryption = mode }(Encryption)
+	defer SetTrustedNodeKeys(nil)
+
+	SetTrustedNodeKeys(nil)
+	for mode, allowed := range map[EncryptionMode]bool{
+		EncryptionDisabled: false, // Nothing to fall back from
+		EncryptionOptional: true,
+		EncryptionRequired: false,
+	} {
+		Encryption = mode
+		if PlaintextFallbackAllowed() != allowed {
+			t.Errorf("Plaintext fallback allowed is %v with encryption %v", !allowed, mode)
+		}
+	}
+
+	// A plaintext peer can't show it has a trusted key
+	Encryption = EncryptionOptional
+	err := SetTrustedNodeKeys([]string{primitives.RandomPrivateKey().PublicKeyString()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if PlaintextFallbackAllowed() {
+		t.Errorf("Plaintext fallback allowed with trusted node keys")
+	}
+}
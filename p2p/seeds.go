@@ -0,0 +1,277 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package p2p
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/ed25519"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// Seeds are where a node finds its first peers.  The seed URL in the config
+// can list several sources, separated by commas or spaces, which are tried
+// in order until one gives us peers:
+//
+//   http://... or https://...  a seed list, one host:port per line
+//   dns://name or dns://name:port  the TXT records of name, each a line of a
+//     seed list, and then the A and AAAA records of name, at the port given
+//     or else our own listen port
+//
+// A seed list can be signed by adding the lines
+//
+//   network: <network ID in hex, eg feedbeef>
+//   expires: <RFC 3339 time, eg 2018-01-01T00:00:00Z>
+//   signature: <hex ed25519 signature>
+//
+// The signature covers "factomd seed list\n", the network and expires lines
+// as above, and the host:port lines, sorted and joined by newlines, so neither
+// the order of the lines nor the order of DNS records matters.  The network
+// and expiry stop a list signed for one network, or one signed long ago, being
+// served in place of the current one.  Lines starting with # are comments.  If
+// any seed keys are configured, a source has to give a list signed by one of
+// them, for our network and not expired, or it is skipped for the next one.  A
+// and AAAA records can't be signed, so they are only used without seed keys.
+
+// SeedKeys are the keys seed lists must be signed with, if not empty.  Set by
+// the controller's Init.
+var SeedKeys [][ed25519.PublicKeySize]byte
+
+var (
+	SeedTimeout      = time.Second * 30 // How long we wait on an HTTP seed
+	seedSignContext  = []byte("factomd seed list\n")
+	seedSignaturePre = "signature:"
+	seedNetworkPre   = "network:"
+	seedExpiresPre   = "expires:"
+	maxSeedListSize  = int64(1 << 20)
+)
+
+// SeedResolver looks up the DNS records of DNS seeds
+type SeedResolver interface {
+	LookupTXT(name string) ([]string, error)
+	LookupHost(host string) ([]string, error)
+}
+
+type netResolver struct{}
+
+func (netResolver) LookupTXT(name string) ([]string, error)  { return net.LookupTXT(name) }
+func (netResolver) LookupHost(host string) ([]string, error) { return net.LookupHost(host) }
+
+// DNSResolver is the resolver DNS seeds are looked up with.  Tests replace it
+// with a stand-in.
+var DNSResolver SeedResolver = netResolver{}
+
+// SetSeedKeys sets the keys seed lists must be signed with.  Keys are hex.  No
+// keys means unsigned seed lists are accepted.
+func SetSeedKeys(keys []string) error {
+	seedKeys := [][ed25519.PublicKeySize]byte{}
+	for _, k := range keys {
+		b, err := hex.DecodeString(k)
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return fmt.Errorf("Bad p2p seed key %q", k)
+		}
+		var key [ed25519.PublicKeySize]byte
+		copy(key[:], b)
+		seedKeys = append(seedKeys, key)
+	}
+	SeedKeys = seedKeys
+	return nil
+}
+
+// SignSeedList returns a seed list of the peers for the network, signed with
+// the key, that nodes accept until it expires
+func SignSeedList(peers []string, network NetworkID, expires time.Time, key *primitives.PrivateKey) string {
+	peers = canonicalSeedPeers(peers)
+	header := seedListHeader(network, expires)
+	sig := ed25519.Sign(key.Key, seedSignedData(header, peers))
+	return header + strings.Join(peers, "\n") + "\n" + seedSignaturePre + " " + hex.EncodeToString(sig[:]) + "\n"
+}
+
+// FetchSeeds gets peers (host:port) from the first of the seed sources that
+// gives any, and returns the source they came from.
+func FetchSeeds(sources string) ([]string, string, error) {
+	var errs []string
+	for _, source := range strings.FieldsFunc(sources, func(r rune) bool { return r == ',' || r == ' ' }) {
+		peers, err := fetchSeedSource(source)
+		if err == nil && len(peers) == 0 {
+			err = fmt.Errorf("no peers")
+		}
+		if err != nil {
+			note("discovery", "FetchSeeds() skipping seed %s: %v", source, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+		return peers, source, nil
+	}
+	if len(errs) == 0 {
+		return nil, "", fmt.Errorf("no seed sources")
+	}
+	return nil, "", fmt.Errorf("no seed source gave peers (%s)", strings.Join(errs, "; "))
+}
+
+func fetchSeedSource(source string) ([]string, error) {
+	switch {
+	case strings.HasPrefix(source, "dns://"):
+		return fetchDNSSeed(strings.TrimPrefix(source, "dns://"))
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		return fetchHTTPSeed(source)
+	default:
+		return nil, fmt.Errorf("unknown kind of seed")
+	}
+}
+
+func fetchHTTPSeed(url string) ([]string, error) {
+	client := http.Client{Timeout: SeedTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP status %s", resp.Status)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxSeedListSize))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return parseSeedList(lines)
+}
+
+func fetchDNSSeed(name string) ([]string, error) {
+	port := NetworkListenPort
+	if host, p, err := net.SplitHostPort(name); err == nil {
+		name, port = host, p
+	}
+	txt, txtErr := DNSResolver.LookupTXT(name)
+	if txtErr == nil && len(txt) > 0 {
+		peers, err := parseSeedList(txt)
+		if err != nil || len(peers) > 0 {
+			return peers, err
+		}
+	}
+	if len(SeedKeys) > 0 {
+		return nil, fmt.Errorf("no signed TXT records (%v)", txtErr)
+	}
+	addresses, err := DNSResolver.LookupHost(name)
+	if err != nil {
+		return nil, err
+	}
+	peers := []string{}
+	for _, address := range addresses {
+		peers = append(peers, net.JoinHostPort(address, port))
+	}
+	return peers, nil
+}
+
+// parseSeedList reads the lines of a seed list, and checks the signature if
+// we have seed keys.  A list for another network, or that has expired, is
+// refused whether signed or not.
+func parseSeedList(lines []string) ([]string, error) {
+	peers := []string{}
+	var sig []byte
+	var network *NetworkID
+	var expires *time.Time
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, seedNetworkPre):
+			n, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, seedNetworkPre)), 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("bad seed list network")
+			}
+			id := NetworkID(n)
+			network = &id
+		case strings.HasPrefix(line, seedExpiresPre):
+			t, err := time.Parse(time.RFC3339, strings.TrimSpace(strings.TrimPrefix(line, seedExpiresPre)))
+			if err != nil {
+				return nil, fmt.Errorf("bad seed list expiry")
+			}
+			expires = &t
+		case strings.HasPrefix(line, seedSignaturePre):
+			s, err := hex.DecodeString(strings.TrimSpace(strings.TrimPrefix(line, seedSignaturePre)))
+			if err != nil || len(s) != ed25519.SignatureSize {
+				return nil, fmt.Errorf("bad seed list signature")
+			}
+			sig = s
+		default:
+			if _, _, err := net.SplitHostPort(line); err != nil {
+				note("discovery", "parseSeedList() skipping %q: %v", line, err)
+				continue
+			}
+			peers = append(peers, line)
+		}
+	}
+	peers = canonicalSeedPeers(peers)
+	if network != nil && *network != CurrentNetwork {
+		return nil, fmt.Errorf("seed list is for network %08x, not %08x", uint32(*network), uint32(CurrentNetwork))
+	}
+	if expires != nil && time.Now().After(*expires) {
+		return nil, fmt.Errorf("seed list expired at %s", expires.Format(time.RFC3339))
+	}
+	if len(SeedKeys) == 0 {
+		return peers, nil
+	}
+	if sig == nil {
+		return nil, fmt.Errorf("seed list is not signed")
+	}
+	if network == nil || expires == nil {
+		return nil, fmt.Errorf("signed seed list has no network or expiry")
+	}
+	if !verifySeedList(seedListHeader(*network, *expires), peers, sig) {
+		return nil, fmt.Errorf("seed list signature is not from a seed key")
+	}
+	return peers, nil
+}
+
+func verifySeedList(header string, peers []string, sig []byte) bool {
+	var signature [ed25519.SignatureSize]byte
+	copy(signature[:], sig)
+	data := seedSignedData(header, peers)
+	for i := range SeedKeys {
+		if ed25519.Verify(&SeedKeys[i], data, &signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalSeedPeers returns the peers trimmed, without duplicates, and sorted
+func canonicalSeedPeers(peers []string) []string {
+	unique := map[string]bool{}
+	canonical := []string{}
+	for _, peer := range peers {
+		peer = strings.TrimSpace(peer)
+		if peer != "" && !unique[peer] {
+			unique[peer] = true
+			canonical = append(canonical, peer)
+		}
+	}
+	sort.Strings(canonical)
+	return canonical
+}
+
+// seedListHeader returns the network and expires lines of a signed seed list
+func seedListHeader(network NetworkID, expires time.Time) string {
+	return fmt.Sprintf("%s %08x\n%s %s\n", seedNetworkPre, uint32(network), seedExpiresPre, expires.UTC().Format(time.RFC3339))
+}
+
+func seedSignedData(header string, peers []string) []byte {
+	data := append(append([]byte{}, seedSignContext...), header...)
+	return append(data, strings.Join(peers, "\n")...)
+}
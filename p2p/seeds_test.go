@@ -0,0 +1,126 @@
+package p2p_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factomd/common/primitives"
+	. "github.com/FactomProject/factomd/p2p"
+)
+
+// testResolver stands in for DNS
+type testResolver struct {
+	txt   map[string][]string
+	hosts map[string][]string
+}
+
+func (r testResolver) LookupTXT(name string) ([]string, error) {
+	if txt, ok := r.txt[name]; ok {
+		return txt, nil
+	}
+	return nil, fmt.Errorf("no such host %s", name)
+}
+
+func (r testResolver) LookupHost(host string) ([]string, error) {
+	if hosts, ok := r.hosts[host]; ok {
+		return hosts, nil
+	}
+	return nil, fmt.Errorf("no such host %s", host)
+}
+
+func seedServer(lists map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list, ok := lists[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, list)
+	}))
+}
+
+func TestFetchSeeds(t *testing.T) {
+	defer SetSeedKeys(nil)
+	key := primitives.RandomPrivateKey()
+	seeds := []string{"5.5.5.5:8108", "4.4.4.4:8108"}
+	signed := SignSeedList(seeds, CurrentNetwork, time.Now().Add(time.Hour), key)
+	tampered := strings.Replace(signed, "5.5.5.5", "6.6.6.6", 1)
+	expired := SignSeedList(seeds, CurrentNetwork, time.Now().Add(-time.Hour), key)
+	otherNetwork := SignSeedList(seeds, CurrentNetwork+1, time.Now().Add(time.Hour), key)
+	// The network and expiry are signed too
+	extended := strings.Replace(expired, fmt.Sprint(time.Now().Year()), fmt.Sprint(time.Now().Year()+1), 1)
+	server := seedServer(map[string]string{
+		"/plain":    "# a comment\n1.1.1.1:8108\n\n2.2.2.2:8108\n",
+		"/signed":   signed,
+		"/tampered": tampered,
+		"/expired":  expired,
+		"/other":    otherNetwork,
+		"/extended": extended,
+	})
+	defer server.Close()
+	DNSResolver = testResolver{
+		txt: map[string][]string{
+			"signed.seed": strings.Split(strings.TrimSpace(signed), "\n"),
+		},
+		hosts: map[string][]string{
+			"hosts.seed":  {"7.7.7.7", "::1"},
+			"signed.seed": {"8.8.8.8"},
+		},
+	}
+
+	tests := []struct {
+		keys    []string
+		sources string
+		peers   []string
+		source  string
+	}{
+		{nil, server.URL + "/plain", []string{"1.1.1.1:8108", "2.2.2.2:8108"}, server.URL + "/plain"},
+		{nil, server.URL + "/missing, dns://hosts.seed:9000", []string{"7.7.7.7:9000", "[::1]:9000"}, "dns://hosts.seed:9000"},
+		{nil, "dns://signed.seed", []string{"4.4.4.4:8108", "5.5.5.5:8108"}, "dns://signed.seed"},
+		// With a seed key, unsigned, badly signed and A record sources are skipped
+		{[]string{key.PublicKeyString()}, server.URL + "/plain " + server.URL + "/tampered dns://hosts.seed " + server.URL + "/signed",
+			[]string{"4.4.4.4:8108", "5.5.5.5:8108"}, server.URL + "/signed"},
+		{[]string{key.PublicKeyString()}, "dns://signed.seed", []string{"4.4.4.4:8108", "5.5.5.5:8108"}, "dns://signed.seed"},
+		{[]string{key.PublicKeyString()}, server.URL + "/plain", nil, ""},
+		{[]string{primitives.RandomPrivateKey().PublicKeyString()}, server.URL + "/signed", nil, ""},
+		// Old lists and lists for other networks are skipped, signed or not
+		{[]string{key.PublicKeyString()}, server.URL + "/expired", nil, ""},
+		{nil, server.URL + "/expired", nil, ""},
+		{[]string{key.PublicKeyString()}, server.URL + "/other", nil, ""},
+		{[]string{key.PublicKeyString()}, server.URL + "/extended", nil, ""},
+	}
+	for i, test := range tests {
+		if err := SetSeedKeys(test.keys); err != nil {
+			t.Fatal(err)
+		}
+		peers, source, err := FetchSeeds(test.sources)
+		if test.peers == nil {
+			if err == nil {
+				t.Errorf("%d: expected an error, got %v from %s", i, peers, source)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(peers, test.peers) || source != test.source {
+			t.Errorf("%d: got %v from %s, expected %v from %s", i, peers, source, test.peers, test.source)
+		}
+	}
+}
+
+func TestSetSeedKeys(t *testing.T) {
+	defer SetSeedKeys(nil)
+	if err := SetSeedKeys([]string{"abcd"}); err == nil {
+		t.Errorf("Short seed key accepted")
+	}
+	if err := SetSeedKeys([]string{primitives.RandomPrivateKey().PublicKeyString()}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/FactomProject/factomd/database/databaseOverlay"
+	. "github.com/FactomProject/factomd/receipts"
+)
+
+func main() {
+	trusted := flag.String("trusted", "", "File of trusted directory block KeyMRs, one per line")
+	anchors := flag.String("anchors", "", "File of anchor records, one per line, to check the directory blocks against")
+	signed := flag.Bool("signed", false, "Require receipts to carry an anchor record signed by a Factom anchor key")
+	quiet := flag.Bool("q", false, "Only print the receipts that fail")
+	flag.Usage = func() {
+		fmt.Println("Usage:")
+		fmt.Println("ReceiptVerifier [-trusted file] [-anchors file] [-signed] [-q] receipt.json|directory...")
+		fmt.Println("Verifies receipts without a database.  Directories are searched for .json and .block files.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	options := new(VerifyOptions)
+	if *trusted != "" {
+		err := readOptions(*trusted, options.ReadTrustedKeyMRs)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *anchors != "" {
+		err := readOptions(*anchors, options.ReadAnchorRecords)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *signed {
+		options.AnchorKeys = databaseOverlay.AnchorSigPublicKeys
+	}
+
+	files, err := receiptFiles(flag.Args())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err == nil {
+			err = VerifyReceiptString(string(data), options)
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %v: %v\n", file, err)
+		} else if !*quiet {
+			fmt.Printf("OK   %v\n", file)
+		}
+	}
+	fmt.Printf("%v receipts, %v failed\n", len(files), failed)
+	if failed > 0 {
+		os.Exit(2)
+	}
+}
+
+func readOptions(name string, read func(io.Reader) error) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = read(file)
+	if err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+	return nil
+}
+
+// receiptFiles returns the files named, and the receipt files in the
+// directories named
+func receiptFiles(args []string) ([]string, error) {
+	files := []string{}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && (strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".block")) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
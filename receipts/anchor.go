@@ -0,0 +1,227 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package receipts
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/FactomProject/factomd/anchor"
+	"github.com/FactomProject/factomd/common/entryBlock"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/database/databaseOverlay"
+)
+
+// ReceiptAnchor extends a receipt from the directory block to the Bitcoin or
+// Ethereum transaction anchoring it.  Entry is the anchor chain entry holding
+// the anchor record, signature included, so the record can be checked against
+// the anchor signing keys.  MerkleBranch goes from the DirectoryBlockKeyMR to
+// the WindowMR when the record anchors a window of directory blocks, and is
+// empty when the record anchors the directory block KeyMR itself.
+type ReceiptAnchor struct {
+	Entry        string                   `json:"entry"` // Hex of the marshalled anchor chain entry
+	MerkleBranch []*primitives.MerkleNode `json:"merklebranch,omitempty"`
+}
+
+// AnchorEntry returns the anchor chain entry of the receipt anchor
+func (a *ReceiptAnchor) AnchorEntry() (*entryBlock.Entry, error) {
+	data, err := hex.DecodeString(a.Entry)
+	if err != nil {
+		return nil, fmt.Errorf("Anchor entry is not hex: %v", err)
+	}
+	entry := entryBlock.NewEntry()
+	err = entry.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	if entry.GetChainID().String() != databaseOverlay.AnchorBlockID {
+		return nil, fmt.Errorf("Anchor entry is in chain %v, not the anchor chain", entry.GetChainID())
+	}
+	return entry, nil
+}
+
+// AnchorRecord returns the anchor record in the receipt anchor's entry
+func (a *ReceiptAnchor) AnchorRecord() (*anchor.AnchorRecord, error) {
+	entry, err := a.AnchorEntry()
+	if err != nil {
+		return nil, err
+	}
+	return anchor.UnmarshalAnchorRecord(entry.GetContent())
+}
+
+// ValidateSignature checks the anchor record is signed by one of the keys
+func (a *ReceiptAnchor) ValidateSignature(publicKeys []interfaces.Verifier) error {
+	entry, err := a.AnchorEntry()
+	if err != nil {
+		return err
+	}
+	_, valid, err := anchor.UnmarshalAndValidateAnchorEntryAnyVersion(entry, publicKeys)
+	if err != nil {
+		return err
+	}
+	if valid == false {
+		return fmt.Errorf("Anchor record is not signed by an anchor key")
+	}
+	return nil
+}
+
+func (a *ReceiptAnchor) IsSameAs(b *ReceiptAnchor) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Entry != b.Entry || len(a.MerkleBranch) != len(b.MerkleBranch) {
+		return false
+	}
+	for i := range a.MerkleBranch {
+		if !sameHash(a.MerkleBranch[i].Left, b.MerkleBranch[i].Left) ||
+			!sameHash(a.MerkleBranch[i].Right, b.MerkleBranch[i].Right) ||
+			!sameHash(a.MerkleBranch[i].Top, b.MerkleBranch[i].Top) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameHash(a, b *primitives.Hash) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.IsSameAs(b)
+}
+
+// validateAnchor checks the anchor segment of the receipt: that the anchor
+// branch goes from the directory block to the anchored root, that the record
+// has an anchor transaction, and that the Bitcoin hashes of the receipt are
+// those in the record
+func (e *Receipt) validateAnchor() error {
+	if e.Anchor == nil {
+		return nil
+	}
+	ar, err := e.Anchor.AnchorRecord()
+	if err != nil {
+		return err
+	}
+	root, err := primitives.NewShaHashFromStr(ar.AnchoredMR())
+	if err != nil {
+		return err
+	}
+	top, err := e.anchoredMR()
+	if err != nil {
+		return err
+	}
+	if !top.IsSameAs(root) {
+		return fmt.Errorf("Anchor MerkleBranch ends at %v, not the anchored %v", top, root)
+	}
+	if ar.Bitcoin == nil && ar.Ethereum == nil {
+		return fmt.Errorf("Anchor record has no anchor transaction")
+	}
+	if e.BitcoinTransactionHash != nil && !e.BitcoinTransactionHash.IsZero() {
+		if ar.Bitcoin == nil || e.BitcoinTransactionHash.String() != ar.Bitcoin.TXID {
+			return fmt.Errorf("BitcoinTransactionHash %v is not in the anchor record", e.BitcoinTransactionHash)
+		}
+	}
+	if e.BitcoinBlockHash != nil && !e.BitcoinBlockHash.IsZero() {
+		if ar.Bitcoin == nil || e.BitcoinBlockHash.String() != ar.Bitcoin.BlockHash {
+			return fmt.Errorf("BitcoinBlockHash %v is not in the anchor record", e.BitcoinBlockHash)
+		}
+	}
+	return nil
+}
+
+// anchoredMR returns what the anchor of the receipt's directory block commits
+// to, by hashing up the anchor branch from the directory block KeyMR
+func (e *Receipt) anchoredMR() (interfaces.IHash, error) {
+	if e.Anchor == nil {
+		return e.DirectoryBlockKeyMR, nil
+	}
+	top, err := hashUpBranch(e.DirectoryBlockKeyMR, e.Anchor.MerkleBranch)
+	if err != nil {
+		return nil, fmt.Errorf("Anchor %v", err)
+	}
+	return top, nil
+}
+
+// trimAnchor trims the anchor branch as TrimReceipt trims the receipt's
+func (e *Receipt) trimAnchor() {
+	if e.Anchor == nil || e.DirectoryBlockKeyMR == nil {
+		return
+	}
+	var hash interfaces.IHash = e.DirectoryBlockKeyMR
+	for _, node := range e.Anchor.MerkleBranch {
+		if hash.IsSameAs(node.Left) {
+			node.Left = nil
+		} else if hash.IsSameAs(node.Right) {
+			node.Right = nil
+		}
+		hash = node.Top
+		node.Top = nil
+	}
+}
+
+// hashUpBranch hashes up a full or trimmed Merkle branch from a hash, checking
+// each node holds the hash below it, and returns the top
+func hashUpBranch(hash interfaces.IHash, branch []*primitives.MerkleNode) (interfaces.IHash, error) {
+	for i, node := range branch {
+		var left, right interfaces.IHash = node.Left, node.Right
+		switch {
+		case node.Left == nil && node.Right == nil:
+			return nil, fmt.Errorf("Node %v/%v has two nil sides", i, len(branch))
+		case node.Left == nil:
+			left = hash
+		case node.Right == nil:
+			right = hash
+		case !node.Left.IsSameAs(hash) && !node.Right.IsSameAs(hash):
+			return nil, fmt.Errorf("Node %v/%v does not hold %v", i, len(branch), hash)
+		}
+		hash = primitives.HashMerkleBranches(left, right)
+		if node.Top != nil && !node.Top.IsSameAs(hash) {
+			return nil, fmt.Errorf("Derived top %v is not the same as saved top in node %v/%v", hash, i, len(branch))
+		}
+	}
+	return hash, nil
+}
+
+// addAnchor adds the anchor of the directory block to the receipt, if we have
+// one
+func addAnchor(dbo interfaces.DBOverlaySimple, receipt *Receipt) error {
+	entry, err := dbo.FetchAnchorEntryByKeyMR(receipt.DirectoryBlockKeyMR)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+	ar, err := anchor.UnmarshalAnchorRecord(entry.GetContent())
+	if err != nil {
+		return err
+	}
+	data, err := entry.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	receipt.Anchor = new(ReceiptAnchor)
+	receipt.Anchor.Entry = hex.EncodeToString(data)
+	if ar.IsWindow() == false {
+		return nil
+	}
+
+	keyMRs := []interfaces.IHash{}
+	for height := ar.DBHeightMin; height <= ar.DBHeight; height++ {
+		keyMR, err := dbo.FetchDBKeyMRByHeight(height)
+		if err != nil {
+			return err
+		}
+		if keyMR == nil {
+			return fmt.Errorf("Directory block %v of the anchor window not found", height)
+		}
+		keyMRs = append(keyMRs, keyMR)
+	}
+	receipt.Anchor.MerkleBranch = anchor.WindowMerkleBranch(keyMRs, receipt.DirectoryBlockKeyMR, true)
+	if receipt.Anchor.MerkleBranch == nil {
+		return fmt.Errorf("DirectoryBlockKeyMR %v is not in the anchor window", receipt.DirectoryBlockKeyMR)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package receipts_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/FactomProject/factomd/anchor"
+	"github.com/FactomProject/factomd/common/directoryBlock"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/database/databaseOverlay"
+	. "github.com/FactomProject/factomd/receipts"
+	. "github.com/FactomProject/factomd/testHelper"
+)
+
+func TestAnchorReceipts(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+	blocks := CreateFullTestBlockSet()
+	options := new(VerifyOptions)
+	options.AnchorKeys = databaseOverlay.AnchorSigPublicKeys
+	// The last two directory blocks are not anchored yet
+	for _, block := range blocks[:len(blocks)-2] {
+		for _, entry := range block.Entries {
+			for _, create := range []func(interfaces.DBOverlaySimple, interfaces.IHash) (*Receipt, error){CreateFullReceipt, CreateMinimalReceipt} {
+				receipt, err := create(dbo, entry.DatabasePrimaryIndex())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if receipt.Anchor == nil {
+					t.Fatalf("Receipt for %v has no anchor", entry.DatabasePrimaryIndex())
+				}
+				ar, err := receipt.Anchor.AnchorRecord()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ar.KeyMR != receipt.DirectoryBlockKeyMR.String() {
+					t.Errorf("Anchor record is for %v, not %v", ar.KeyMR, receipt.DirectoryBlockKeyMR)
+				}
+				if ar.Bitcoin.TXID != receipt.BitcoinTransactionHash.String() {
+					t.Errorf("Anchor record has TXID %v, not %v", ar.Bitcoin.TXID, receipt.BitcoinTransactionHash)
+				}
+				if err = VerifyReceiptString(receipt.CustomMarshalString(), options); err != nil {
+					t.Error(err)
+				}
+			}
+		}
+	}
+}
+
+func TestAnchorReceiptTampered(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+	blocks := CreateFullTestBlockSet()
+	other, err := CreateFullReceipt(dbo, blocks[1].Entries[0].DatabasePrimaryIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := blocks[0].Entries[0]
+
+	tamper := []func(*Receipt){
+		func(r *Receipt) { r.Anchor.Entry = other.Anchor.Entry },
+		func(r *Receipt) { r.Anchor.Entry = "00" },
+		func(r *Receipt) {
+			node := new(primitives.MerkleNode)
+			node.Right = primitives.Sha([]byte("other")).(*primitives.Hash)
+			r.Anchor.MerkleBranch = append(r.Anchor.MerkleBranch, node)
+		},
+		func(r *Receipt) { r.BitcoinTransactionHash = primitives.Sha([]byte("other")).(*primitives.Hash) },
+		func(r *Receipt) { r.BitcoinBlockHash = primitives.Sha([]byte("other")).(*primitives.Hash) },
+		func(r *Receipt) {
+			e, _ := r.Anchor.AnchorEntry()
+			e.ChainID = primitives.Sha([]byte("other"))
+			data, _ := e.MarshalBinary()
+			r.Anchor.Entry = hex.EncodeToString(data)
+		},
+	}
+	for i, f := range tamper {
+		receipt, err := CreateFullReceipt(dbo, entry.DatabasePrimaryIndex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		f(receipt)
+		if receipt.Validate() == nil {
+			t.Errorf("Tampered receipt %v validated", i)
+		}
+	}
+
+	receipt, err := CreateFullReceipt(dbo, entry.DatabasePrimaryIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := new(VerifyOptions)
+	options.AnchorKeys = []interfaces.Verifier{primitives.RandomPrivateKey().Pub}
+	if VerifyReceipt(receipt, options) == nil {
+		t.Error("Anchor record verified against another key")
+	}
+	receipt.Anchor = nil
+	options.AnchorKeys = databaseOverlay.AnchorSigPublicKeys
+	if VerifyReceipt(receipt, options) == nil {
+		t.Error("Receipt without an anchor verified against the anchor keys")
+	}
+}
+
+func TestWindowAnchorReceipts(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+	blocks := CreateFullTestBlockSet()
+	window := []*directoryBlock.DirectoryBlock{}
+	for _, block := range blocks[len(blocks)-3:] {
+		window = append(window, block.DBlock)
+	}
+	anchorEntry := CreateTestWindowAnchorEntry(window)
+	err := dbo.InsertEntry(anchorEntry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ar, err := anchor.UnmarshalAnchorRecord(anchorEntry.GetContent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := new(VerifyOptions)
+	options.AnchorKeys = databaseOverlay.AnchorSigPublicKeys
+	options.AnchorRecords = []*anchor.AnchorRecord{ar}
+	for _, block := range blocks[len(blocks)-3:] {
+		for _, entry := range block.Entries {
+			for _, create := range []func(interfaces.DBOverlaySimple, interfaces.IHash) (*Receipt, error){CreateFullReceipt, CreateMinimalReceipt} {
+				receipt, err := create(dbo, entry.DatabasePrimaryIndex())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if receipt.Anchor == nil || len(receipt.Anchor.MerkleBranch) == 0 {
+					t.Fatalf("Receipt for %v has no window branch", entry.DatabasePrimaryIndex())
+				}
+				if err = VerifyReceiptString(receipt.CustomMarshalString(), options); err != nil {
+					t.Error(err)
+				}
+			}
+		}
+	}
+
+	receipt, err := CreateFullReceipt(dbo, blocks[len(blocks)-1].Entries[0].DatabasePrimaryIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt.Anchor.MerkleBranch[0].Left = primitives.Sha([]byte("other")).(*primitives.Hash)
+	if receipt.Validate() == nil {
+		t.Error("Receipt with a tampered window branch validated")
+	}
+	receipt.Anchor.MerkleBranch = nil
+	if receipt.Validate() == nil {
+		t.Error("Receipt without its window branch validated")
+	}
+}
@@ -5,28 +5,100 @@
 package receipts
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 
 	"github.com/FactomProject/factomd/common/directoryBlock/dbInfo"
+	"github.com/FactomProject/factomd/common/entryCreditBlock"
+	"github.com/FactomProject/factomd/common/factoid"
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/primitives"
 )
 
+// Receipt types.  An entry receipt proves an entry is in an entry block, a
+// factoid receipt that a transaction is in a factoid block, and an entry
+// credit receipt that a commit or balance increase is in an entry credit
+// block.  All of them go on to prove the block is in a directory block.
+const (
+	ReceiptTypeEntry       = "entry"
+	ReceiptTypeFactoid     = "factoid"
+	ReceiptTypeEntryCredit = "entrycredit"
+)
+
+// A Receipt proves that an entry or transaction is in the blockchain.  For
+// factoid and entry credit receipts, Entry is the transaction.  The entry
+// credit block body is hashed flat rather than in a Merkle tree, so an entry
+// credit receipt carries the whole block, and its MerkleBranch starts at the
+// header hash of the block.  Anchor, if we know the anchor of the directory
+// block, goes on from the directory block to the anchor transaction.
 type Receipt struct {
+	Type                   string                   `json:"type,omitempty"` // Entry if empty
 	Entry                  *JSON                    `json:"entry,omitempty"`
 	MerkleBranch           []*primitives.MerkleNode `json:"merklebranch,omitempty"`
 	EntryBlockKeyMR        *primitives.Hash         `json:"entryblockkeymr,omitempty"`
+	FactoidBlockKeyMR      *primitives.Hash         `json:"factoidblockkeymr,omitempty"`
+	EntryCreditBlock       string                   `json:"entrycreditblock,omitempty"` // Hex of the marshalled block
 	DirectoryBlockKeyMR    *primitives.Hash         `json:"directoryblockkeymr,omitempty"`
 	BitcoinTransactionHash *primitives.Hash         `json:"bitcointransactionhash,omitempty"`
 	BitcoinBlockHash       *primitives.Hash         `json:"bitcoinblockhash,omitempty"`
+	Anchor                 *ReceiptAnchor           `json:"anchor,omitempty"`
+}
+
+// GetType returns the type of the receipt
+func (e *Receipt) GetType() string {
+	if e.Type == "" {
+		return ReceiptTypeEntry
+	}
+	return e.Type
+}
+
+// branchStart returns the hash the Merkle branch starts from.  That is the
+// entry or transaction hash, except for entry credit receipts, where it is the
+// header hash of the entry credit block once the block is found to hold the
+// transaction.
+func (e *Receipt) branchStart() (interfaces.IHash, error) {
+	hash, err := primitives.NewShaHashFromStr(e.Entry.EntryHash)
+	if err != nil {
+		return nil, err
+	}
+	if e.GetType() != ReceiptTypeEntryCredit {
+		return hash, nil
+	}
+	data, err := hex.DecodeString(e.EntryCreditBlock)
+	if err != nil {
+		return nil, fmt.Errorf("EntryCreditBlock is not hex: %v", err)
+	}
+	ecBlock, err := entryCreditBlock.UnmarshalECBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	if ecBlock.GetEntryByHash(hash) == nil {
+		return nil, fmt.Errorf("EntryCreditBlock does not hold transaction %v", hash)
+	}
+	return ecBlock.HeaderHash()
+}
+
+// blockHash returns the hash of the block holding the entry or transaction,
+// which the Merkle branch has to pass through, and its name
+func (e *Receipt) blockHash() (interfaces.IHash, string) {
+	switch e.GetType() {
+	case ReceiptTypeFactoid:
+		return e.FactoidBlockKeyMR, "FactoidBlockKeyMR"
+	case ReceiptTypeEntryCredit:
+		return nil, "EntryCreditBlock"
+	}
+	return e.EntryBlockKeyMR, "EntryBlockKeyMR"
 }
 
 func (e *Receipt) TrimReceipt() {
 	if e == nil {
 		return
 	}
-	entry, _ := primitives.NewShaHashFromStr(e.Entry.EntryHash)
+	entry, err := e.branchStart()
+	if err != nil {
+		return
+	}
 	for i := range e.MerkleBranch {
 		if entry.IsSameAs(e.MerkleBranch[i].Left) {
 			e.MerkleBranch[i].Left = nil
@@ -38,6 +110,7 @@ func (e *Receipt) TrimReceipt() {
 		entry = e.MerkleBranch[i].Top
 		e.MerkleBranch[i].Top = nil
 	}
+	e.trimAnchor()
 }
 
 func (e *Receipt) Validate() error {
@@ -50,23 +123,38 @@ func (e *Receipt) Validate() error {
 	if e.MerkleBranch == nil {
 		return fmt.Errorf("Receipt has no MerkleBranch")
 	}
-	if e.EntryBlockKeyMR == nil {
-		return fmt.Errorf("Receipt has no EntryBlockKeyMR")
+	switch e.GetType() {
+	case ReceiptTypeEntry:
+		if e.EntryBlockKeyMR == nil {
+			return fmt.Errorf("Receipt has no EntryBlockKeyMR")
+		}
+	case ReceiptTypeFactoid:
+		if e.FactoidBlockKeyMR == nil {
+			return fmt.Errorf("Receipt has no FactoidBlockKeyMR")
+		}
+	case ReceiptTypeEntryCredit:
+		if e.EntryCreditBlock == "" {
+			return fmt.Errorf("Receipt has no EntryCreditBlock")
+		}
+	default:
+		return fmt.Errorf("Receipt has unknown type %v", e.Type)
 	}
 	if e.DirectoryBlockKeyMR == nil {
 		return fmt.Errorf("Receipt has no DirectoryBlockKeyMR")
 	}
-	entryHash, err := primitives.NewShaHashFromStr(e.Entry.EntryHash)
 	//TODO: validate entry hashes into EntryHash
-
+	entryHash, err := e.branchStart()
 	if err != nil {
 		return err
 	}
+	blockHash, blockName := e.blockHash()
+
 	var left interfaces.IHash
 	var right interfaces.IHash
 	var currentEntry interfaces.IHash
 	currentEntry = entryHash
-	eBlockFound := false
+	// The entry credit block is where the branch starts
+	blockFound := blockHash == nil
 	dBlockFound := false
 	for i, node := range e.MerkleBranch {
 		if node.Left == nil {
@@ -92,8 +180,8 @@ func (e *Receipt) Validate() error {
 				return fmt.Errorf("Derived top %v is not the same as saved top in node %v/%v", top, i, len(e.MerkleBranch))
 			}
 		}
-		if top.IsSameAs(e.EntryBlockKeyMR) == true {
-			eBlockFound = true
+		if blockHash != nil && top.IsSameAs(blockHash) == true {
+			blockFound = true
 		}
 		if top.IsSameAs(e.DirectoryBlockKeyMR) == true {
 			dBlockFound = true
@@ -101,15 +189,15 @@ func (e *Receipt) Validate() error {
 		currentEntry = top
 	}
 
-	if eBlockFound == false {
-		return fmt.Errorf("EntryBlockKeyMR not found in branch")
+	if blockFound == false {
+		return fmt.Errorf("%v not found in branch", blockName)
 	}
 
 	if dBlockFound == false {
 		return fmt.Errorf("DirectoryBlockKeyMR not found in branch")
 	}
 
-	return nil
+	return e.validateAnchor()
 }
 
 func (e *Receipt) IsSameAs(r *Receipt) bool {
@@ -172,6 +260,20 @@ func (e *Receipt) IsSameAs(r *Receipt) bool {
 		}
 	}
 
+	if e.GetType() != r.GetType() || e.EntryCreditBlock != r.EntryCreditBlock {
+		return false
+	}
+
+	if e.FactoidBlockKeyMR == nil {
+		if r.FactoidBlockKeyMR != nil {
+			return false
+		}
+	} else {
+		if e.FactoidBlockKeyMR.IsSameAs(r.FactoidBlockKeyMR) == false {
+			return false
+		}
+	}
+
 	if e.DirectoryBlockKeyMR == nil {
 		if r.DirectoryBlockKeyMR != nil {
 			return false
@@ -202,6 +304,10 @@ func (e *Receipt) IsSameAs(r *Receipt) bool {
 		}
 	}
 
+	if e.Anchor.IsSameAs(r.Anchor) == false {
+		return false
+	}
+
 	return true
 }
 
@@ -332,45 +438,167 @@ func CreateReceipt(dbo interfaces.DBOverlaySimple, entryID interfaces.IHash) (*R
 	//str, _ := eBlock.JSONString()
 	//fmt.Printf("eBlock - %v\n\n", str)
 
-	//DBlock
+	err = addDirectoryBlock(dbo, receipt, hash)
+	if err != nil {
+		return nil, err
+	}
 
-	hash, err = dbo.FetchIncludedIn(hash)
+	return receipt, nil
+}
+
+// CreateReceiptByType creates a full receipt of the given type, for the hash of
+// an entry, or of a factoid or entry credit transaction
+func CreateReceiptByType(dbo interfaces.DBOverlaySimple, receiptType string, hash interfaces.IHash) (*Receipt, error) {
+	switch receiptType {
+	case "", ReceiptTypeEntry:
+		return CreateReceipt(dbo, hash)
+	case ReceiptTypeFactoid:
+		return CreateFactoidReceipt(dbo, hash)
+	case ReceiptTypeEntryCredit:
+		return CreateEntryCreditReceipt(dbo, hash)
+	}
+	return nil, fmt.Errorf("Unknown receipt type %v", receiptType)
+}
+
+// CreateFactoidReceipt creates a full receipt for a factoid transaction, by its
+// transaction ID or its full hash
+func CreateFactoidReceipt(dbo interfaces.DBOverlaySimple, txID interfaces.IHash) (*Receipt, error) {
+	hash, err := dbo.FetchIncludedIn(txID)
 	if err != nil {
 		return nil, err
 	}
 
 	if hash == nil {
-		return nil, fmt.Errorf("Block containing EBlock not found")
+		return nil, fmt.Errorf("Block containing transaction not found")
 	}
 
-	dBlock, err := dbo.FetchDBlock(hash)
+	fBlock, err := dbo.FetchFBlock(hash)
 	if err != nil {
 		return nil, err
 	}
 
-	if dBlock == nil {
-		return nil, fmt.Errorf("DBlock not found")
+	if fBlock == nil {
+		return nil, fmt.Errorf("FBlock not found")
 	}
 
-	//str, _ = dBlock.JSONString()
-	//fmt.Printf("dBlock - %v\n\n", str)
+	tx := fBlock.GetTransactionByHash(txID)
+	if tx == nil {
+		return nil, fmt.Errorf("Transaction not found in FBlock")
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
 
-	entries = dBlock.GetEntryHashesForBranch()
-	//fmt.Printf("dBlock entries - %v\n\n", entries)
+	receipt := new(Receipt)
+	receipt.Type = ReceiptTypeFactoid
+	receipt.Entry = new(JSON)
+	receipt.Entry.Raw = hex.EncodeToString(raw)
+	receipt.Entry.EntryHash = tx.GetHash().String()
 
-	//merkleTree := primitives.BuildMerkleTreeStore(entries)
-	//fmt.Printf("dBlock merkleTree - %v\n\n", merkleTree)
+	hash = fBlock.GetKeyMR()
+	receipt.FactoidBlockKeyMR = hash.(*primitives.Hash)
 
-	branch = primitives.BuildMerkleBranchForEntryHash(entries, receipt.EntryBlockKeyMR, true)
-	blockNode = new(primitives.MerkleNode)
-	left, err = dBlock.HeaderHash()
+	branch := primitives.BuildMerkleBranchForEntryHash(factoid.BodyLeafHashes(fBlock), tx.GetHash(), true)
+	header, err := fBlock.MarshalHeader()
 	if err != nil {
 		return nil, err
 	}
+	blockNode := new(primitives.MerkleNode)
+	blockNode.Left = primitives.Sha(header).(*primitives.Hash)
+	blockNode.Right = fBlock.GetBodyMR().(*primitives.Hash)
+	blockNode.Top = hash.(*primitives.Hash)
+	branch = append(branch, blockNode)
+	receipt.MerkleBranch = append(receipt.MerkleBranch, branch...)
+
+	err = addDirectoryBlock(dbo, receipt, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// CreateEntryCreditReceipt creates a full receipt for an entry credit
+// transaction, by its transaction ID or its hash
+func CreateEntryCreditReceipt(dbo interfaces.DBOverlaySimple, txID interfaces.IHash) (*Receipt, error) {
+	hash, err := dbo.FetchIncludedIn(txID)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash == nil {
+		return nil, fmt.Errorf("Block containing transaction not found")
+	}
+
+	ecBlock, err := dbo.FetchECBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if ecBlock == nil {
+		return nil, fmt.Errorf("ECBlock not found")
+	}
+
+	tx := ecBlock.GetEntryByHash(txID)
+	if tx == nil {
+		return nil, fmt.Errorf("Transaction not found in ECBlock")
+	}
+	data, err := ecBlock.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := new(Receipt)
+	receipt.Type = ReceiptTypeEntryCredit
+	receipt.Entry = new(JSON)
+	receipt.Entry.EntryHash = tx.Hash().String()
+	receipt.EntryCreditBlock = hex.EncodeToString(data)
+
+	hash, err = ecBlock.HeaderHash()
+	if err != nil {
+		return nil, err
+	}
+
+	err = addDirectoryBlock(dbo, receipt, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// addDirectoryBlock adds the Merkle branch from a block to the directory block
+// holding it, and the anchor of the directory block if we know it
+func addDirectoryBlock(dbo interfaces.DBOverlaySimple, receipt *Receipt, blockHash interfaces.IHash) error {
+	hash, err := dbo.FetchIncludedIn(blockHash)
+	if err != nil {
+		return err
+	}
+
+	if hash == nil {
+		return fmt.Errorf("Block containing %v not found", blockHash)
+	}
+
+	dBlock, err := dbo.FetchDBlock(hash)
+	if err != nil {
+		return err
+	}
+
+	if dBlock == nil {
+		return fmt.Errorf("DBlock not found")
+	}
+
+	entries := dBlock.GetEntryHashesForBranch()
+	branch := primitives.BuildMerkleBranchForEntryHash(entries, blockHash, true)
+	blockNode := new(primitives.MerkleNode)
+	left, err := dBlock.HeaderHash()
+	if err != nil {
+		return err
+	}
 	blockNode.Left = left.(*primitives.Hash)
 	blockNode.Right = dBlock.BodyKeyMR().(*primitives.Hash)
 	blockNode.Top = hash.(*primitives.Hash)
-	//fmt.Printf("dBlock blockNode - %v\n\n", blockNode)
 	branch = append(branch, blockNode)
 	receipt.MerkleBranch = append(receipt.MerkleBranch, branch...)
 
@@ -381,7 +609,7 @@ func CreateReceipt(dbo interfaces.DBOverlaySimple, entryID interfaces.IHash) (*R
 
 	dirBlockInfo, err := dbo.FetchDirBlockInfoByKeyMR(hash)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if dirBlockInfo != nil {
@@ -391,7 +619,7 @@ func CreateReceipt(dbo interfaces.DBOverlaySimple, entryID interfaces.IHash) (*R
 		receipt.BitcoinBlockHash = dbi.BTCBlockHash.(*primitives.Hash)
 	}
 
-	return receipt, nil
+	return addAnchor(dbo, receipt)
 }
 
 func VerifyFullReceipt(dbo interfaces.DBOverlaySimple, receiptStr string) error {
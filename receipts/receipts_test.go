@@ -5,6 +5,7 @@
 package receipts_test
 
 import (
+	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/primitives"
 	. "github.com/FactomProject/factomd/receipts"
 	. "github.com/FactomProject/factomd/testHelper"
@@ -96,3 +97,69 @@ func TestDecodeReceiptString(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestFactoidReceipts(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+	blocks := CreateFullTestBlockSet()
+	for _, block := range blocks[:len(blocks)-2] {
+		for _, tx := range block.FBlock.GetTransactions() {
+			for _, hash := range []interfaces.IHash{tx.GetSigHash(), tx.GetHash()} {
+				receipt, err := CreateReceiptByType(dbo, ReceiptTypeFactoid, hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if receipt.FactoidBlockKeyMR.IsSameAs(block.FBlock.GetKeyMR()) == false {
+					t.Errorf("Receipt has FactoidBlockKeyMR %v, not %v", receipt.FactoidBlockKeyMR, block.FBlock.GetKeyMR())
+				}
+				if err = VerifyFullReceipt(dbo, receipt.CustomMarshalString()); err != nil {
+					t.Error(err)
+				}
+				if err = VerifyReceipt(receipt, nil); err != nil {
+					t.Error(err)
+				}
+
+				receipt.TrimReceipt()
+				if err = VerifyMinimalReceipt(dbo, receipt.CustomMarshalString()); err != nil {
+					t.Error(err)
+				}
+			}
+		}
+	}
+}
+
+func TestEntryCreditReceipts(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+	blocks := CreateFullTestBlockSet()
+	for _, block := range blocks[:len(blocks)-2] {
+		for _, hash := range block.ECBlock.GetEntryHashes() {
+			receipt, err := CreateReceiptByType(dbo, ReceiptTypeEntryCredit, hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = VerifyFullReceipt(dbo, receipt.CustomMarshalString()); err != nil {
+				t.Error(err)
+			}
+			if err = VerifyReceipt(receipt, nil); err != nil {
+				t.Error(err)
+			}
+
+			receipt.TrimReceipt()
+			if err = VerifyMinimalReceipt(dbo, receipt.CustomMarshalString()); err != nil {
+				t.Error(err)
+			}
+
+			receipt.Entry.EntryHash = primitives.Sha([]byte("other")).String()
+			if receipt.Validate() == nil {
+				t.Error("Receipt for a transaction not in the EntryCreditBlock validated")
+			}
+		}
+	}
+}
+
+func TestCreateReceiptByTypeUnknown(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+	_, err := CreateReceiptByType(dbo, "admin", primitives.Sha([]byte("other")))
+	if err == nil {
+		t.Error("Unknown receipt type created a receipt")
+	}
+}
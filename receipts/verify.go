@@ -0,0 +1,252 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package receipts
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/FactomProject/factomd/anchor"
+	"github.com/FactomProject/factomd/common/entryBlock"
+	"github.com/FactomProject/factomd/common/factoid"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// The functions here verify a receipt on its own, without a database, so that
+// anyone holding a receipt can check it without running factomd.  A receipt
+// is checked by hashing up its Merkle branch, full or trimmed, from the entry
+// or transaction through its block to the directory block KeyMR.  What the directory
+// block KeyMR is then trusted against is up to the VerifyOptions.
+
+// VerifyOptions are what a receipt's directory block is checked against.  A nil
+// or empty VerifyOptions only checks the receipt's own Merkle branch.
+type VerifyOptions struct {
+	// TrustedKeyMRs are directory block KeyMRs known to be in the blockchain.
+	// If there are any, the receipt's directory block has to be one of them.
+	TrustedKeyMRs map[string]bool
+	// AnchorRecords are anchor records read from the anchor chain.  If there
+	// are any, the receipt's directory block has to have one, and the Bitcoin
+	// transaction and block in the receipt, if any, have to match it.
+	AnchorRecords []*anchor.AnchorRecord
+	// AnchorKeys are the keys anchor records are signed with.  If there are
+	// any, the anchor record carried in the receipt has to be signed by one.
+	AnchorKeys []interfaces.Verifier
+}
+
+// AddTrustedKeyMR adds a directory block KeyMR to those trusted
+func (o *VerifyOptions) AddTrustedKeyMR(keyMR interfaces.IHash) {
+	if o.TrustedKeyMRs == nil {
+		o.TrustedKeyMRs = map[string]bool{}
+	}
+	o.TrustedKeyMRs[keyMR.String()] = true
+}
+
+// ReadTrustedKeyMRs reads directory block KeyMRs in hex, one a line, to trust.
+// Blank lines and lines starting with # are skipped.
+func (o *VerifyOptions) ReadTrustedKeyMRs(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		keyMR, err := primitives.NewShaHashFromStr(text)
+		if err != nil {
+			return fmt.Errorf("line %v: %v", line, err)
+		}
+		o.AddTrustedKeyMR(keyMR)
+	}
+	return scanner.Err()
+}
+
+// ReadAnchorRecords reads anchor records, one a line, as they are in the
+// content of anchor chain entries.  A signature after the record is ignored,
+// so only read records from a source you trust.
+func (o *VerifyOptions) ReadAnchorRecords(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		ar, err := anchor.UnmarshalAnchorRecord([]byte(text))
+		if err != nil {
+			return fmt.Errorf("line %v: %v", line, err)
+		}
+		o.AnchorRecords = append(o.AnchorRecords, ar)
+	}
+	return scanner.Err()
+}
+
+// VerifyReceipt checks a full or minimal receipt without a database
+func VerifyReceipt(receipt *Receipt, options *VerifyOptions) error {
+	err := receipt.Validate()
+	if err != nil {
+		return err
+	}
+	err = receipt.verifyEntry()
+	if err != nil {
+		return err
+	}
+	err = receipt.verifyBranch()
+	if err != nil {
+		return err
+	}
+	if options == nil {
+		return nil
+	}
+	if len(options.TrustedKeyMRs) > 0 && !options.TrustedKeyMRs[receipt.DirectoryBlockKeyMR.String()] {
+		return fmt.Errorf("DirectoryBlockKeyMR %v is not trusted", receipt.DirectoryBlockKeyMR)
+	}
+	if len(options.AnchorKeys) > 0 {
+		if receipt.Anchor == nil {
+			return fmt.Errorf("Receipt has no anchor")
+		}
+		err = receipt.Anchor.ValidateSignature(options.AnchorKeys)
+		if err != nil {
+			return err
+		}
+	}
+	if len(options.AnchorRecords) > 0 {
+		return receipt.verifyAnchor(options.AnchorRecords)
+	}
+	return nil
+}
+
+// VerifyReceiptString checks a receipt in JSON without a database
+func VerifyReceiptString(receiptStr string, options *VerifyOptions) error {
+	receipt, err := DecodeReceiptJSON([]byte(receiptStr))
+	if err != nil {
+		return err
+	}
+	return VerifyReceipt(receipt, options)
+}
+
+// DecodeReceiptJSON decodes a receipt, as saved by Save or as returned by the
+// receipt API calls, with or without the JSON-RPC wrapping
+func DecodeReceiptJSON(data []byte) (*Receipt, error) {
+	wrapped := struct {
+		Result *struct {
+			Receipt *Receipt `json:"receipt"`
+		} `json:"result"`
+		Receipt *Receipt `json:"receipt"`
+	}{}
+	err := json.Unmarshal(data, &wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if wrapped.Result != nil && wrapped.Result.Receipt != nil {
+		return wrapped.Result.Receipt, nil
+	}
+	if wrapped.Receipt != nil {
+		return wrapped.Receipt, nil
+	}
+	return DecodeReceiptString(string(data))
+}
+
+// verifyEntry checks that the raw entry or factoid transaction, if the receipt
+// has it, hashes to the entry hash
+func (e *Receipt) verifyEntry() error {
+	if e.Entry.Raw == "" {
+		return nil
+	}
+	raw, err := hex.DecodeString(e.Entry.Raw)
+	if err != nil {
+		return fmt.Errorf("Receipt raw entry is not hex: %v", err)
+	}
+	var hash interfaces.IHash
+	switch e.GetType() {
+	case ReceiptTypeEntry:
+		entry := entryBlock.NewEntry()
+		err = entry.UnmarshalBinary(raw)
+		hash = entry.GetHash()
+	case ReceiptTypeFactoid:
+		tx := new(factoid.Transaction)
+		err = tx.UnmarshalBinary(raw)
+		hash = tx.GetHash()
+	default:
+		return fmt.Errorf("Receipt of type %v has a raw entry", e.GetType())
+	}
+	if err != nil {
+		return fmt.Errorf("Receipt raw entry does not unmarshal: %v", err)
+	}
+	if hash.String() != e.Entry.EntryHash {
+		return fmt.Errorf("Receipt raw entry hashes to %v, not %v", hash, e.Entry.EntryHash)
+	}
+	return nil
+}
+
+// verifyBranch hashes up the Merkle branch, and checks that each node holds the
+// hash below it, and that the branch passes through the block holding the
+// entry or transaction and ends at the directory block
+func (e *Receipt) verifyBranch() error {
+	hash, err := e.branchStart()
+	if err != nil {
+		return err
+	}
+	blockHash, blockName := e.blockHash()
+	blockFound := blockHash == nil
+	for i, node := range e.MerkleBranch {
+		var left, right interfaces.IHash = node.Left, node.Right
+		switch {
+		case node.Left == nil && node.Right == nil:
+			return fmt.Errorf("Node %v/%v has two nil sides", i, len(e.MerkleBranch))
+		case node.Left == nil:
+			left = hash
+		case node.Right == nil:
+			right = hash
+		case !node.Left.IsSameAs(hash) && !node.Right.IsSameAs(hash):
+			return fmt.Errorf("Node %v/%v does not hold %v", i, len(e.MerkleBranch), hash)
+		}
+		hash = primitives.HashMerkleBranches(left, right)
+		if node.Top != nil && !node.Top.IsSameAs(hash) {
+			return fmt.Errorf("Derived top %v is not the same as saved top in node %v/%v", hash, i, len(e.MerkleBranch))
+		}
+		if blockHash != nil && hash.IsSameAs(blockHash) {
+			blockFound = true
+		}
+		if hash.IsSameAs(e.DirectoryBlockKeyMR) && i != len(e.MerkleBranch)-1 {
+			return fmt.Errorf("MerkleBranch goes on past the DirectoryBlockKeyMR")
+		}
+	}
+	if !blockFound {
+		return fmt.Errorf("%v not found in branch", blockName)
+	}
+	if !hash.IsSameAs(e.DirectoryBlockKeyMR) {
+		return fmt.Errorf("MerkleBranch ends at %v, not the DirectoryBlockKeyMR", hash)
+	}
+	return nil
+}
+
+// verifyAnchor checks the receipt's directory block against the anchor record
+// for it, or for the window holding it
+func (e *Receipt) verifyAnchor(ars []*anchor.AnchorRecord) error {
+	anchored, err := e.anchoredMR()
+	if err != nil {
+		return err
+	}
+	for _, ar := range ars {
+		if ar.AnchoredMR() != anchored.String() && ar.KeyMR != e.DirectoryBlockKeyMR.String() {
+			continue
+		}
+		if ar.Bitcoin == nil {
+			return fmt.Errorf("Anchor record for %v has no Bitcoin anchor", ar.KeyMR)
+		}
+		if e.BitcoinTransactionHash != nil && !e.BitcoinTransactionHash.IsZero() && e.BitcoinTransactionHash.String() != ar.Bitcoin.TXID {
+			return fmt.Errorf("BitcoinTransactionHash %v is not the anchor's %v", e.BitcoinTransactionHash, ar.Bitcoin.TXID)
+		}
+		if e.BitcoinBlockHash != nil && !e.BitcoinBlockHash.IsZero() && e.BitcoinBlockHash.String() != ar.Bitcoin.BlockHash {
+			return fmt.Errorf("BitcoinBlockHash %v is not the anchor's %v", e.BitcoinBlockHash, ar.Bitcoin.BlockHash)
+		}
+		return nil
+	}
+	return fmt.Errorf("No anchor record for DirectoryBlockKeyMR %v", e.DirectoryBlockKeyMR)
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package receipts_test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/factomd/anchor"
+	"github.com/FactomProject/factomd/common/primitives"
+	. "github.com/FactomProject/factomd/receipts"
+	. "github.com/FactomProject/factomd/testHelper"
+)
+
+func TestVerifyReceipt(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+	blocks := CreateFullTestBlockSet()
+	for _, block := range blocks[:len(blocks)-2] {
+		for _, entry := range block.Entries {
+			receipt, err := CreateFullReceipt(dbo, entry.DatabasePrimaryIndex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = VerifyReceiptString(receipt.CustomMarshalString(), nil)
+			if err != nil {
+				t.Error(err)
+			}
+
+			raw, _ := entry.MarshalBinary()
+			receipt.Entry.Raw = hex.EncodeToString(raw)
+			receipt.TrimReceipt()
+			err = VerifyReceipt(receipt, nil)
+			if err != nil {
+				t.Error(err)
+			}
+		}
+	}
+}
+
+func TestVerifyReceiptTampered(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+	entry := CreateFullTestBlockSet()[0].Entries[0]
+
+	tamper := []func(*Receipt){
+		func(r *Receipt) { r.Entry.EntryHash = primitives.Sha([]byte("other")).String() },
+		func(r *Receipt) { r.Entry.Raw = "00" },
+		func(r *Receipt) { r.MerkleBranch[0].Left = primitives.Sha([]byte("other")).(*primitives.Hash) },
+		func(r *Receipt) { r.MerkleBranch[0].Right = primitives.Sha([]byte("other")).(*primitives.Hash) },
+		func(r *Receipt) { r.MerkleBranch = r.MerkleBranch[:len(r.MerkleBranch)-1] },
+		func(r *Receipt) { r.DirectoryBlockKeyMR = primitives.Sha([]byte("other")).(*primitives.Hash) },
+	}
+	for i, f := range tamper {
+		receipt, err := CreateFullReceipt(dbo, entry.DatabasePrimaryIndex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		f(receipt)
+		if VerifyReceipt(receipt, nil) == nil {
+			t.Errorf("Tampered receipt %v verified", i)
+		}
+	}
+}
+
+func TestVerifyReceiptOptions(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+	entry := CreateFullTestBlockSet()[0].Entries[0]
+	receipt, err := CreateFullReceipt(dbo, entry.DatabasePrimaryIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := new(VerifyOptions)
+	err = options.ReadTrustedKeyMRs(strings.NewReader("# trusted\n" + primitives.Sha([]byte("other")).String() + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyReceipt(receipt, options) == nil {
+		t.Error("Receipt verified against KeyMRs without its own")
+	}
+	options.AddTrustedKeyMR(receipt.DirectoryBlockKeyMR)
+	if err = VerifyReceipt(receipt, options); err != nil {
+		t.Error(err)
+	}
+
+	ar := new(anchor.AnchorRecord)
+	ar.KeyMR = receipt.DirectoryBlockKeyMR.String()
+	ar.Bitcoin = new(anchor.BitcoinStruct)
+	ar.Bitcoin.TXID = receipt.BitcoinTransactionHash.String()
+	ar.Bitcoin.BlockHash = receipt.BitcoinBlockHash.String()
+	data, _ := ar.Marshal()
+	options = new(VerifyOptions)
+	if err = options.ReadAnchorRecords(strings.NewReader(string(data) + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyReceipt(receipt, options); err != nil {
+		t.Error(err)
+	}
+	receipt.BitcoinTransactionHash = primitives.Sha([]byte("other")).(*primitives.Hash)
+	if VerifyReceipt(receipt, options) == nil {
+		t.Error("Receipt verified against another anchor transaction")
+	}
+}
+
+func TestDecodeReceiptJSON(t *testing.T) {
+	dbo := CreateAndPopulateTestDatabaseOverlay()
+	entry := CreateFullTestBlockSet()[0].Entries[0]
+	receipt, err := CreateFullReceipt(dbo, entry.DatabasePrimaryIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := receipt.CustomMarshalString()
+	for _, s := range []string{
+		str,
+		fmt.Sprintf(`{"receipt":%v}`, str),
+		fmt.Sprintf(`{"jsonrpc":"2.0","id":0,"result":{"receipt":%v}}`, str),
+	} {
+		decoded, err := DecodeReceiptJSON([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !decoded.IsSameAs(receipt) {
+			t.Errorf("Decoded receipt differs from %v", s)
+		}
+	}
+}
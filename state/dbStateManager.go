@@ -22,6 +22,7 @@ import (
 	"github.com/FactomProject/factomd/common/primitives"
 	"github.com/FactomProject/factomd/database/databaseOverlay"
 	"github.com/FactomProject/factomd/log"
+	"github.com/FactomProject/factomd/wsapi"
 )
 
 var _ = hex.EncodeToString
@@ -34,6 +35,10 @@ type DBState struct {
 
 	SaveStruct *SaveState
 
+	// The balances after the block, saved with it when it is at a checkpoint
+	// height and balance checkpoints are on
+	BalanceCheckpoint *databaseOverlay.BalanceCheckpoint
+
 	DBHash interfaces.IHash
 	ABHash interfaces.IHash
 	FBHash interfaces.IHash
@@ -1088,6 +1093,10 @@ func (list *DBStateList) ProcessBlocks(d *DBState) (progress bool) {
 
 	list.State.Balancehash = fs.GetBalanceHash(false)
 
+	if list.State.BalanceCheckpoints && ht%databaseOverlay.BalanceCheckpointInterval == 0 {
+		d.BalanceCheckpoint = list.State.balanceCheckpoint(ht)
+	}
+
 	// Make the current exchange rate whatever we had in the previous block.
 	// UNLESS there was a FER entry processed during this block  changeheight will be left at 1 on a change block
 	if list.State.FERChangeHeight == 1 {
@@ -1183,6 +1192,27 @@ func (list *DBStateList) SignDB(d *DBState) (process bool) {
 
 var nowish int64 = time.Now().Unix()
 
+// balanceCheckpoint copies the permanent balances, which are those after the
+// block at the height once it is processed
+func (s *State) balanceCheckpoint(dbheight uint32) *databaseOverlay.BalanceCheckpoint {
+	c := databaseOverlay.NewBalanceCheckpoint()
+	c.DBHeight = dbheight
+
+	s.FactoidBalancesPMutex.Lock()
+	for k, v := range s.FactoidBalancesP {
+		c.FactoidBalances[k] = v
+	}
+	s.FactoidBalancesPMutex.Unlock()
+
+	s.ECBalancesPMutex.Lock()
+	for k, v := range s.ECBalancesP {
+		c.ECBalances[k] = v
+	}
+	s.ECBalancesPMutex.Unlock()
+
+	return c
+}
+
 func (list *DBStateList) SaveDBStateToDB(d *DBState) (progress bool) {
 	dbheight := int(d.DirectoryBlock.GetHeader().GetDBHeight())
 	// Take the height, and some function of the identity chain, and use that to decide to trim.  That
@@ -1266,6 +1296,9 @@ func (list *DBStateList) SaveDBStateToDB(d *DBState) (progress bool) {
 		}
 	}
 
+	// Entry blocks saved, so subscribers can be told about them
+	var savedEBlocks []interfaces.IEntryBlock
+
 	// Info from DBState
 	if len(d.EntryBlocks) > 0 {
 		for _, eb := range d.EntryBlocks {
@@ -1278,6 +1311,7 @@ func (list *DBStateList) SaveDBStateToDB(d *DBState) (progress bool) {
 				if err := list.State.DB.ProcessEBlockMultiBatch(eb, true); err != nil {
 					panic(err.Error())
 				}
+				savedEBlocks = append(savedEBlocks, eb)
 			} else {
 				list.State.Logf("error", "Error saving eblock from dbstate, eblock not allowed")
 			}
@@ -1305,6 +1339,7 @@ func (list *DBStateList) SaveDBStateToDB(d *DBState) (progress bool) {
 				if err := list.State.DB.ProcessEBlockMultiBatch(eb, true); err != nil {
 					panic(err.Error())
 				}
+				savedEBlocks = append(savedEBlocks, eb)
 
 				for _, e := range eb.GetBody().GetEBEntries() {
 					if _, ok := allowedEntries[e.Fixed()]; ok {
@@ -1334,6 +1369,17 @@ func (list *DBStateList) SaveDBStateToDB(d *DBState) (progress bool) {
 		panic(err.Error())
 	}
 
+	// Checkpoint the balances now and then, so looking up the balances at a
+	// past height only replays the blocks since the checkpoint before it
+	if c := d.BalanceCheckpoint; c != nil {
+		if err := list.State.DB.SaveBalanceCheckpoint(c.DBHeight, c.FactoidBalances, c.ECBalances); err != nil {
+			list.State.Logf("error", "Error saving the balance checkpoint at %d: %v", dbheight, err)
+		}
+		d.BalanceCheckpoint = nil
+	}
+
+	wsapi.PublishSavedBlocks(list.State.FactomNodeName, d.DirectoryBlock, d.FactoidBlock, savedEBlocks)
+
 	// Not activated.  Set to true if you want extra checking of the data saved to the database.
 	if false {
 		good := true
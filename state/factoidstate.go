@@ -386,6 +386,18 @@ func (fs *FactoidState) ProcessEndOfBlock(state interfaces.IState) {
 // Returns an error message about what is wrong with the transaction if it is
 // invalid, otherwise you are good to go.
 func (fs *FactoidState) Validate(index int, trans interfaces.ITransaction) error {
+	for _, rcd := range trans.GetRCDs() {
+		if _, ok := rcd.(*factoid.RCD_2); ok {
+			activation := constants.RCD2ActivationHeight(fs.State.GetNetworkID())
+			if fs.DBHeight < activation {
+				if activation == constants.RCD_2_NOT_SCHEDULED {
+					return fmt.Errorf("Multisig inputs are not yet valid on this network")
+				}
+				return fmt.Errorf("Multisig inputs are not valid before block %d", activation)
+			}
+		}
+	}
+
 	var sums = make(map[[32]byte]uint64, 10)  // Look at the sum of an address's inputs
 	for _, input := range trans.GetInputs() { //    to a transaction.
 		bal, err := factoid.ValidateAmounts(sums[input.GetAddress().Fixed()], input.GetAmount())
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/FactomProject/factomd/common/constants"
@@ -291,6 +292,30 @@ func TestUpdateTransactionWithNegativeBalance(t *testing.T) {
 	}
 }
 
+func TestValidateRCD2ActivationHeight(t *testing.T) {
+	s := testHelper.CreateAndPopulateTestState()
+	fs := s.FactoidState
+
+	ft := new(factoid.Transaction)
+	ft.AddRCD(new(factoid.RCD_2))
+
+	s.NetworkNumber = constants.NETWORK_MAIN
+	err := fs.Validate(0, ft)
+	if err == nil || !strings.Contains(err.Error(), "Multisig") {
+		t.Errorf("Multisig inputs should not be valid on the main network, got %v", err)
+	}
+
+	s.NetworkNumber = constants.NETWORK_LOCAL
+	err = fs.Validate(0, ft)
+	if err != nil && strings.Contains(err.Error(), "Multisig") {
+		t.Errorf("Multisig inputs should be valid on the local network, got %v", err)
+	}
+
+	if constants.RCD2ActivationHeight(constants.TEST_NETWORK_ID) != 0 {
+		t.Error("Multisig inputs should be valid at any height on the test network")
+	}
+}
+
 /*
 func TestUpdateECTransaction(t *testing.T) {
 	fs.SetFactoshisPerEC(1)
@@ -90,6 +90,7 @@ func markFault(pl *ProcessList, vmIndex int, faultReason int) {
 		// and keep track of the ProcessList height it has faulted at
 		vm.WhenFaulted = now
 		vm.FaultFlag = faultReason
+		ConsensusFaults.WithLabelValues(pl.State.FactomNodeName, faultReasonName(faultReason)).Inc()
 	}
 
 	c := pl.State.CurrentMinute
@@ -1,6 +1,10 @@
 package state
 
 import (
+	"strconv"
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -114,6 +118,12 @@ var (
 		Help: "Instrumenting the netoutmsg queue ",
 	}, []string{"message"})
 
+	StateQueueWaitTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "factomd_state_queue_wait_seconds",
+		Help:    "Time messages wait in the inmsg and API queues, by scheduling class",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"queue", "class"})
+
 	// MsgQueue chan
 	TotalMsgQueueInputs = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "factomd_state_msgqueue_total_inputs",
@@ -261,8 +271,52 @@ var (
 		Name: "factomd_state_execute_msg_time",
 		Help: "Time spent in executeMsg",
 	})
+
+	// Consensus, labeled by node so the simulated nodes of one process are
+	// kept apart
+	ConsensusVMHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "factomd_state_consensus_vm_height",
+		Help: "Process list height of each VM at the leader height",
+	}, []string{"node", "vm"})
+	ConsensusMinuteDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "factomd_state_consensus_minute_seconds",
+		Help:    "Time spent in each minute of a block",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 10),
+	}, []string{"node", "minute"})
+	ConsensusEOMLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "factomd_state_consensus_eom_latency_seconds",
+		Help:    "Time from the start of a minute to processing each leader's EOM",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"node", "leader"})
+	ConsensusDBSigLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "factomd_state_consensus_dbsig_latency_seconds",
+		Help:    "Time from the start of a block to processing each leader's DBSig",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"node", "leader"})
+	ConsensusFaults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "factomd_state_consensus_faults_total",
+		Help: "Tally of VMs marked faulted, by reason",
+	}, []string{"node", "reason"})
+	HoldingQueueAge = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "factomd_state_holding_queue_age_seconds",
+		Help:    "Age of the messages in Holding, sampled each time Holding is reviewed",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 14),
+	}, []string{"node", "message"})
 )
 
+// Reasons a VM is faulted, as passed to markFault
+var faultReasonNames = map[int]string{
+	0: "eom_missing",
+	1: "negotiation",
+}
+
+func faultReasonName(faultReason int) string {
+	if name, ok := faultReasonNames[faultReason]; ok {
+		return name
+	}
+	return "unknown"
+}
+
 var registered bool = false
 
 // RegisterPrometheus registers the variables to be exposed. This can only be run once, hence the
@@ -304,6 +358,7 @@ func RegisterPrometheus() {
 	prometheus.MustRegister(CurrentMessageQueueApiGeneralVec)
 	prometheus.MustRegister(TotalMessageQueueApiGeneralVec)
 	prometheus.MustRegister(TotalMessageQueueNetOutMsgGeneralVec)
+	prometheus.MustRegister(StateQueueWaitTime)
 
 	// MsgQueue chan
 	prometheus.MustRegister(TotalMsgQueueInputs)
@@ -353,4 +408,30 @@ func RegisterPrometheus() {
 	prometheus.MustRegister(TotalEmptyLoopTime)
 	prometheus.MustRegister(TotalAckLoopTime)
 	prometheus.MustRegister(TotalExecuteMsgTime)
+
+	// Consensus
+	prometheus.MustRegister(ConsensusVMHeight)
+	prometheus.MustRegister(ConsensusMinuteDuration)
+	prometheus.MustRegister(ConsensusEOMLatency)
+	prometheus.MustRegister(ConsensusDBSigLatency)
+	prometheus.MustRegister(ConsensusFaults)
+	prometheus.MustRegister(HoldingQueueAge)
+}
+
+// observeLatency records how long after the start of the current minute a
+// leader's EOM or DBSig was processed.  The start of minute 0 is the start of
+// the block.  Nothing is recorded while syncing, when there is no start time.
+func (s *State) observeLatency(latency *prometheus.HistogramVec, leader interfaces.IHash) {
+	if s.CurrentMinuteStartTime == 0 || leader == nil {
+		return
+	}
+	spent := time.Now().UnixNano() - s.CurrentMinuteStartTime
+	latency.WithLabelValues(s.FactomNodeName, leader.String()).Observe(float64(spent) / 1e9)
+}
+
+// ObserveVMHeight records the process list height of a VM at the leader height.
+// It is called when the height of the VM changes, not on every pass over the
+// process list.
+func (s *State) ObserveVMHeight(vmIndex int, height int) {
+	ConsensusVMHeight.WithLabelValues(s.FactomNodeName, strconv.Itoa(vmIndex)).Set(float64(height))
 }
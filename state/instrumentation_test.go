@@ -0,0 +1,103 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/common/primitives"
+	. "github.com/FactomProject/factomd/state"
+	"github.com/FactomProject/factomd/testHelper"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// readMetric returns the current value of a single metric of a vector
+func readMetric(t *testing.T, m prometheus.Metric) *dto.Metric {
+	out := new(dto.Metric)
+	if err := m.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestObserveVMHeight(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	state.FactomNodeName = "TestObserveVMHeight"
+
+	state.ObserveVMHeight(0, 7)
+	state.ObserveVMHeight(2, 3)
+
+	if v := readMetric(t, ConsensusVMHeight.WithLabelValues(state.FactomNodeName, "0")).GetGauge().GetValue(); v != 7 {
+		t.Errorf("Expected a height of 7 for vm 0, found %v", v)
+	}
+	if v := readMetric(t, ConsensusVMHeight.WithLabelValues(state.FactomNodeName, "2")).GetGauge().GetValue(); v != 3 {
+		t.Errorf("Expected a height of 3 for vm 2, found %v", v)
+	}
+
+	// Labels are per node
+	other := testHelper.CreateEmptyTestState()
+	other.FactomNodeName = "TestObserveVMHeightOther"
+	other.ObserveVMHeight(0, 1)
+	if v := readMetric(t, ConsensusVMHeight.WithLabelValues(state.FactomNodeName, "0")).GetGauge().GetValue(); v != 7 {
+		t.Errorf("Another node changed the height of vm 0 to %v", v)
+	}
+}
+
+func TestConsensusFaultMetrics(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	state.FactomNodeName = "TestConsensusFaultMetrics"
+	state.IgnoreMissing = false
+	state.Leader = false
+	state.FaultTimeout = 1
+
+	pl := NewProcessList(state, nil, 1)
+	pl.AddFedServer(primitives.NewHash([]byte("one")))
+	pl.AddFedServer(primitives.NewHash([]byte("two")))
+
+	negotiation := ConsensusFaults.WithLabelValues(state.FactomNodeName, "negotiation")
+	before := readMetric(t, negotiation).GetCounter().GetValue()
+
+	// A VM faulted long ago without a negotiation faults the next VM
+	pl.VMs[1].WhenFaulted = time.Now().Unix() - 100
+	FaultCheck(pl)
+
+	if pl.VMs[0].WhenFaulted == 0 {
+		t.Fatal("Expected vm 0 to be faulted")
+	}
+	if v := readMetric(t, negotiation).GetCounter().GetValue(); v != before+1 {
+		t.Errorf("Expected %v negotiation faults, found %v", before+1, v)
+	}
+
+	// Faulting a VM that is already faulted is not counted again
+	FaultCheck(pl)
+	if v := readMetric(t, negotiation).GetCounter().GetValue(); v != before+1 {
+		t.Errorf("Expected %v negotiation faults after a second check, found %v", before+1, v)
+	}
+}
+
+func TestHoldingQueueAgeMetric(t *testing.T) {
+	state := testHelper.CreateAndPopulateTestState()
+	state.FactomNodeName = "TestHoldingQueueAgeMetric"
+
+	eom := new(messages.EOM)
+	eom.Timestamp = primitives.NewTimestampFromMilliseconds(uint64(time.Now().UnixNano()/1e6 - 5000))
+	eom.ChainID = primitives.NewZeroHash()
+	state.Holding[eom.GetMsgHash().Fixed()] = eom
+	state.ResendHolding = primitives.NewTimestampFromMilliseconds(0)
+	state.XReview = nil
+
+	state.ReviewHolding()
+
+	h := readMetric(t, HoldingQueueAge.WithLabelValues(state.FactomNodeName, messages.MessageName(eom.Type()))).GetHistogram()
+	if h.GetSampleCount() != 1 {
+		t.Fatalf("Expected 1 sample, found %d", h.GetSampleCount())
+	}
+	if h.GetSampleSum() < 5 {
+		t.Errorf("Expected an age of at least 5 seconds, found %v", h.GetSampleSum())
+	}
+}
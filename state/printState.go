@@ -45,12 +45,16 @@ func PrintState(state *State) {
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "CloneDBType", state.CloneDBType)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "ExportData", state.ExportData)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "ExportDataSubpath", state.ExportDataSubpath)
+	str = fmt.Sprintf("%s %35s = %+v\n", str, "AddressIndex", state.AddressIndex)
+	str = fmt.Sprintf("%s %35s = %+v\n", str, "ExtIDIndex", state.ExtIDIndex)
+	str = fmt.Sprintf("%s %35s = %+v\n", str, "BalanceCheckpoints", state.BalanceCheckpoints)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "LocalServerPrivKey", state.LocalServerPrivKey)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "DirectoryBlockInSeconds", state.DirectoryBlockInSeconds)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "PortNumber", state.PortNumber)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "DropRate", state.DropRate)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "Delay", state.Delay)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "ControlPanelPort", state.ControlPanelPort)
+	str = fmt.Sprintf("%s %35s = %+v\n", str, "MetricsPort", state.MetricsPort)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "ControlPanelSetting", state.ControlPanelSetting)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "ControlPanelChannel", state.ControlPanelChannel)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "ControlPanelDataRequest", state.ControlPanelDataRequest)
@@ -65,6 +69,13 @@ func PrintState(state *State) {
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "LocalNetworkPort", state.LocalNetworkPort)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "LocalSeedURL", state.LocalSeedURL)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "LocalSpecialPeers", state.LocalSpecialPeers)
+	str = fmt.Sprintf("%s %35s = %+v\n", str, "P2PEncryption", state.P2PEncryption)
+	str = fmt.Sprintf("%s %35s = %+v\n", str, "P2PTrustedNodeKeys", state.P2PTrustedNodeKeys)
+	str = fmt.Sprintf("%s %35s = %+v\n", str, "P2PSeedKeys", state.P2PSeedKeys)
+	str = fmt.Sprintf("%s %35s = %+v\n", str, "P2PBroadcast", state.P2PBroadcast)
+	str = fmt.Sprintf("%s %35s = %+v\n", str, "PeerBanDuration", state.PeerBanDuration)
+	str = fmt.Sprintf("%s %35s = %+v\n", str, "PeerBanScore", state.PeerBanScore)
+	str = fmt.Sprintf("%s %35s = %+v\n", str, "PeerScoring", state.PeerScoring)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "CustomNetworkID", state.CustomNetworkID)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "IdentityChainID", state.IdentityChainID)
 	str = fmt.Sprintf("%s %35s = %+v\n", str, "Identities", state.Identities)
@@ -0,0 +1,231 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factomd/common/constants"
+	"github.com/FactomProject/factomd/common/interfaces"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The inmsg and API queues are PriorityMSGQueues.  A plain FIFO lets a flood
+// of commits from the API hold up the EOMs and DBSigs behind them long enough
+// to fault the leaders, so each message type belongs to a class, and the
+// classes are served by weighted round robin.  Every class with messages
+// waiting gets at least its weight out of each round, so a busy class slows
+// the others down but never starves them.  The time each message waits is
+// recorded by queue and class in factomd_state_queue_wait_seconds.
+
+// MsgClass is the scheduling class of a message in a PriorityMSGQueue
+type MsgClass int
+
+const (
+	MsgClassConsensus   MsgClass = iota // EOMs, acks, DBSigs, faults and heartbeats
+	MsgClassSync                        // Missing messages and data, and DBStates
+	MsgClassTransaction                 // Commits, reveals and factoid transactions
+	MsgClassOther                       // Anything not classified
+	numMsgClasses
+)
+
+var msgClassStrings = map[MsgClass]string{
+	MsgClassConsensus:   "consensus",
+	MsgClassSync:        "sync",
+	MsgClassTransaction: "transaction",
+	MsgClassOther:       "other",
+}
+
+func (c MsgClass) String() string {
+	if s, ok := msgClassStrings[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("class-%d", c)
+}
+
+// msgClasses maps message types to their class.  Types not listed are
+// MsgClassOther.
+var msgClasses = map[byte]MsgClass{
+	constants.EOM_MSG:                       MsgClassConsensus,
+	constants.ACK_MSG:                       MsgClassConsensus,
+	constants.FED_SERVER_FAULT_MSG:          MsgClassConsensus,
+	constants.FULL_SERVER_FAULT_MSG:         MsgClassConsensus,
+	constants.DIRECTORY_BLOCK_SIGNATURE_MSG: MsgClassConsensus,
+	constants.HEARTBEAT_MSG:                 MsgClassConsensus,
+
+	constants.MISSING_MSG:          MsgClassSync,
+	constants.MISSING_MSG_RESPONSE: MsgClassSync,
+	constants.MISSING_DATA:         MsgClassSync,
+	constants.DATA_RESPONSE:        MsgClassSync,
+	constants.DBSTATE_MSG:          MsgClassSync,
+	constants.DBSTATE_MISSING_MSG:  MsgClassSync,
+
+	constants.COMMIT_CHAIN_MSG:        MsgClassTransaction,
+	constants.COMMIT_ENTRY_MSG:        MsgClassTransaction,
+	constants.REVEAL_ENTRY_MSG:        MsgClassTransaction,
+	constants.FACTOID_TRANSACTION_MSG: MsgClassTransaction,
+}
+
+// msgClassWeights is how many messages of each class may be taken in a round
+// of the weighted round robin, while other classes have messages waiting
+var msgClassWeights = [numMsgClasses]int{
+	MsgClassConsensus:   8,
+	MsgClassSync:        4,
+	MsgClassTransaction: 2,
+	MsgClassOther:       1,
+}
+
+// MsgTypeClass returns the class of a message type
+func MsgTypeClass(msgType byte) MsgClass {
+	if class, ok := msgClasses[msgType]; ok {
+		return class
+	}
+	return MsgClassOther
+}
+
+func msgClass(msg interfaces.IMsg) MsgClass {
+	if msg == nil {
+		return MsgClassOther
+	}
+	return MsgTypeClass(msg.Type())
+}
+
+type queuedMsg struct {
+	msg      interfaces.IMsg
+	enqueued time.Time
+}
+
+// PriorityMSGQueue is a bounded IQueue that schedules messages by class.
+// Enqueue blocks while the queue is full, as it would on a channel.
+type PriorityMSGQueue struct {
+	name     string
+	capacity int
+	total    *prometheus.GaugeVec // Messages enqueued, by type
+	current  *prometheus.GaugeVec // Messages in the queue, by type
+
+	mutex    sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	classes  [numMsgClasses][]queuedMsg
+	size     int
+	credits  [numMsgClasses]int // What each class has left of its weight this round
+}
+
+var _ interfaces.IQueue = (*PriorityMSGQueue)(nil)
+
+// NewPriorityMSGQueue makes a queue holding up to capacity messages.  The name
+// labels its wait times, and the message counts go to the total and current
+// vecs, either of which may be nil.
+func NewPriorityMSGQueue(name string, capacity int, total, current *prometheus.GaugeVec) *PriorityMSGQueue {
+	q := new(PriorityMSGQueue)
+	q.name = name
+	q.capacity = capacity
+	q.total = total
+	q.current = current
+	q.notEmpty = sync.NewCond(&q.mutex)
+	q.notFull = sync.NewCond(&q.mutex)
+	q.credits = msgClassWeights
+	return q
+}
+
+// Length returns the number of messages in the queue
+func (q *PriorityMSGQueue) Length() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.size
+}
+
+// Cap returns the number of messages the queue holds
+func (q *PriorityMSGQueue) Cap() int {
+	return q.capacity
+}
+
+// ClassLength returns the number of messages of a class in the queue
+func (q *PriorityMSGQueue) ClassLength(class MsgClass) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.classes[class])
+}
+
+// Enqueue adds a message, waiting for room if the queue is full
+func (q *PriorityMSGQueue) Enqueue(m interfaces.IMsg) {
+	measureMessage(q.total, m, true)
+	measureMessage(q.current, m, true)
+
+	class := msgClass(m)
+	q.mutex.Lock()
+	for q.size >= q.capacity {
+		q.notFull.Wait()
+	}
+	q.classes[class] = append(q.classes[class], queuedMsg{msg: m, enqueued: time.Now()})
+	q.size++
+	q.mutex.Unlock()
+	q.notEmpty.Signal()
+}
+
+// Dequeue removes the next message.  Returns nil if nothing in queue
+func (q *PriorityMSGQueue) Dequeue() interfaces.IMsg {
+	q.mutex.Lock()
+	if q.size == 0 {
+		q.mutex.Unlock()
+		return nil
+	}
+	return q.next()
+}
+
+// BlockingDequeue will block until it retrieves from queue
+func (q *PriorityMSGQueue) BlockingDequeue() interfaces.IMsg {
+	q.mutex.Lock()
+	for q.size == 0 {
+		q.notEmpty.Wait()
+	}
+	return q.next()
+}
+
+// next takes the message from the first class, in priority order, with both
+// messages and credit left.  When no class with messages has credit, the round
+// is over and every class gets its weight again.  Called with the mutex held,
+// and releases it.
+func (q *PriorityMSGQueue) next() interfaces.IMsg {
+	class := q.nextClass()
+	if class == numMsgClasses {
+		q.credits = msgClassWeights
+		class = q.nextClass()
+	}
+	item := q.classes[class][0]
+	q.classes[class][0] = queuedMsg{}
+	q.classes[class] = q.classes[class][1:]
+	q.credits[class]--
+	q.size--
+	q.mutex.Unlock()
+	q.notFull.Signal()
+
+	measureMessage(q.current, item.msg, false)
+	StateQueueWaitTime.WithLabelValues(q.name, class.String()).Observe(time.Since(item.enqueued).Seconds())
+	return item.msg
+}
+
+// nextClass returns numMsgClasses if no class has both messages and credit
+func (q *PriorityMSGQueue) nextClass() MsgClass {
+	for class := MsgClass(0); class < numMsgClasses; class++ {
+		if len(q.classes[class]) > 0 && q.credits[class] > 0 {
+			return class
+		}
+	}
+	return numMsgClasses
+}
+
+func (q *PriorityMSGQueue) String() string {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	str := fmt.Sprintf("%s %d/%d", q.name, q.size, q.capacity)
+	for class := MsgClass(0); class < numMsgClasses; class++ {
+		str = fmt.Sprintf("%s %s:%d", str, class, len(q.classes[class]))
+	}
+	return str
+}
@@ -0,0 +1,111 @@
+package state_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factomd/common/constants"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/messages"
+	. "github.com/FactomProject/factomd/state"
+)
+
+func TestMsgTypeClass(t *testing.T) {
+	classes := map[byte]MsgClass{
+		constants.EOM_MSG:                       MsgClassConsensus,
+		constants.DIRECTORY_BLOCK_SIGNATURE_MSG: MsgClassConsensus,
+		constants.DBSTATE_MSG:                   MsgClassSync,
+		constants.COMMIT_ENTRY_MSG:              MsgClassTransaction,
+		constants.BOUNCE_MSG:                    MsgClassOther,
+	}
+	for msgType, class := range classes {
+		if MsgTypeClass(msgType) != class {
+			t.Errorf("Type %d has class %s, expected %s", msgType, MsgTypeClass(msgType), class)
+		}
+	}
+}
+
+func TestPriorityMSGQueueOrder(t *testing.T) {
+	q := NewPriorityMSGQueue("test", 100, nil, nil)
+	for i := 0; i < 5; i++ {
+		q.Enqueue(new(messages.CommitEntryMsg))
+	}
+	q.Enqueue(new(messages.EOM))
+	q.Enqueue(new(messages.DBStateMsg))
+	q.Enqueue(new(messages.DirectoryBlockSignature))
+	if q.Length() != 8 || q.ClassLength(MsgClassTransaction) != 5 {
+		t.Errorf("Queue is %s", q)
+	}
+
+	// Consensus, then sync, then the commits that were queued first
+	expected := []byte{
+		constants.EOM_MSG,
+		constants.DIRECTORY_BLOCK_SIGNATURE_MSG,
+		constants.DBSTATE_MSG,
+		constants.COMMIT_ENTRY_MSG,
+	}
+	for _, msgType := range expected {
+		if m := q.Dequeue(); m == nil || m.Type() != msgType {
+			t.Errorf("Got %v, expected type %d", m, msgType)
+		}
+	}
+	for q.Length() > 0 {
+		q.Dequeue()
+	}
+	if q.Dequeue() != nil {
+		t.Errorf("Empty queue gave a message")
+	}
+}
+
+func TestPriorityMSGQueueFairness(t *testing.T) {
+	q := NewPriorityMSGQueue("test", 1000, nil, nil)
+	for i := 0; i < 10; i++ {
+		q.Enqueue(new(messages.CommitEntryMsg))
+	}
+	for i := 0; i < 200; i++ {
+		q.Enqueue(new(messages.EOM))
+	}
+
+	// A flood of consensus messages still lets commits through
+	commits := 0
+	for i := 0; i < 100; i++ {
+		if q.Dequeue().Type() == constants.COMMIT_ENTRY_MSG {
+			commits++
+		}
+	}
+	if commits < 10 {
+		t.Errorf("Only %d commits out of the first 100 messages", commits)
+	}
+}
+
+func TestPriorityMSGQueueBlocking(t *testing.T) {
+	q := NewPriorityMSGQueue("test", 1, nil, nil)
+	var _ interfaces.IQueue = q
+
+	got := make(chan interfaces.IMsg)
+	go func() {
+		got <- q.BlockingDequeue()
+	}()
+	q.Enqueue(new(messages.EOM))
+	if m := <-got; m == nil || m.Type() != constants.EOM_MSG {
+		t.Errorf("BlockingDequeue got %v", m)
+	}
+
+	// Enqueue waits for room
+	q.Enqueue(new(messages.EOM))
+	done := make(chan bool)
+	go func() {
+		q.Enqueue(new(messages.DBStateMsg))
+		done <- true
+	}()
+	select {
+	case <-done:
+		t.Fatalf("Enqueue on a full queue didn't wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.Dequeue()
+	<-done
+	if m := q.Dequeue(); m == nil || m.Type() != constants.DBSTATE_MSG {
+		t.Errorf("Got %v", m)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/FactomProject/factomd/common/messages"
 	"github.com/FactomProject/factomd/common/primitives"
 	//"github.com/FactomProject/factomd/database/databaseOverlay"
+	"github.com/FactomProject/factomd/wsapi"
 )
 
 var _ = fmt.Print
@@ -741,6 +742,7 @@ func (p *ProcessList) Process(state *State) (progress bool) {
 			p.Ask(i, vm.Height, 20, 2)
 		}
 
+		height := vm.Height
 	VMListLoop:
 		for j := vm.Height; j < len(vm.List); j++ {
 			if vm.List[j] == nil {
@@ -817,6 +819,9 @@ func (p *ProcessList) Process(state *State) (progress bool) {
 				break VMListLoop
 			}
 		}
+		if vm.Height != height && p.DBHeight == state.LLeaderHeight {
+			state.ObserveVMHeight(i, vm.Height)
+		}
 	}
 	return
 }
@@ -1020,6 +1025,8 @@ func (p *ProcessList) AddToProcessList(ack *messages.Ack, m interfaces.IMsg) {
 	p.AddOldMsgs(m)
 	p.OldAcks[m.GetMsgHash().Fixed()] = ack
 
+	wsapi.PublishAck(p.State.FactomNodeName, p.DBHeight, m)
+
 	if p.State.SuperVerboseMessages {
 		fmt.Printf("SVM Added To PL: %s / %s\n", m.String(), ack.String())
 		/*thisString := ""
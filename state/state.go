@@ -24,10 +24,12 @@ import (
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/messages"
 	"github.com/FactomProject/factomd/common/primitives"
-	"github.com/FactomProject/factomd/database/boltdb"
+	"github.com/FactomProject/factomd/database"
+	_ "github.com/FactomProject/factomd/database/boltdb"
 	"github.com/FactomProject/factomd/database/databaseOverlay"
-	"github.com/FactomProject/factomd/database/leveldb"
-	"github.com/FactomProject/factomd/database/mapdb"
+	_ "github.com/FactomProject/factomd/database/leveldb"
+	_ "github.com/FactomProject/factomd/database/lsmdb"
+	_ "github.com/FactomProject/factomd/database/mapdb"
 	"github.com/FactomProject/factomd/p2p"
 	"github.com/FactomProject/factomd/util"
 	"github.com/FactomProject/factomd/wsapi"
@@ -51,19 +53,22 @@ type State struct {
 	Salt             interfaces.IHash
 	Cfg              interfaces.IFactomConfig
 
-	Prefix            string
-	FactomNodeName    string
-	FactomdVersion    int
-	LogPath           string
-	LdbPath           string
-	BoltDBPath        string
-	LogLevel          string
-	ConsoleLogLevel   string
-	NodeMode          string
-	DBType            string
-	CloneDBType       string
-	ExportData        bool
-	ExportDataSubpath string
+	Prefix             string
+	FactomNodeName     string
+	FactomdVersion     int
+	LogPath            string
+	LdbPath            string
+	BoltDBPath         string
+	LogLevel           string
+	ConsoleLogLevel    string
+	NodeMode           string
+	DBType             string
+	CloneDBType        string
+	ExportData         bool
+	ExportDataSubpath  string
+	AddressIndex       bool
+	ExtIDIndex         bool
+	BalanceCheckpoints bool
 
 	LogBits int64 // Bit zero is for logging the Directory Block on DBSig [5]
 
@@ -82,6 +87,8 @@ type State struct {
 	ControlPanelChannel     chan DisplayState
 	ControlPanelDataRequest bool // If true, update Display state
 
+	MetricsPort int // Port serving the Prometheus metrics, 0 if off
+
 	// Network Configuration
 	Network                 string
 	MainNetworkPort         string
@@ -97,6 +104,13 @@ type State struct {
 	CustomNetworkID         []byte
 	CustomBootstrapIdentity string
 	CustomBootstrapKey      string
+	P2PEncryption           string        // disabled, optional or required
+	P2PTrustedNodeKeys      []string      // Node keys encrypted peers must have, any if empty
+	P2PSeedKeys             []string      // Keys seed lists must be signed with, unsigned lists are fine if empty
+	P2PBroadcast            string        // flood or gossip
+	PeerBanDuration         time.Duration // How long misbehaving peers are banned
+	PeerBanScore            int32         // Peers whose reputation falls to this are banned
+	PeerScoring             []string      // Weights of peer events, as event:weight
 
 	IdentityChainID      interfaces.IHash // If this node has an identity, this is it
 	Identities           []*Identity      // Identities of all servers in management chain
@@ -146,8 +160,8 @@ type State struct {
 	MaxTimeOffset          interfaces.Timestamp
 	networkOutMsgQueue     NetOutMsgQueue
 	networkInvalidMsgQueue chan interfaces.IMsg
-	inMsgQueue             InMsgMSGQueue
-	apiQueue               APIMSGQueue
+	inMsgQueue             *PriorityMSGQueue
+	apiQueue               *PriorityMSGQueue
 	ackQueue               chan interfaces.IMsg
 	msgQueue               chan interfaces.IMsg
 
@@ -401,6 +415,9 @@ func (s *State) Clone(cloneNumber int) interfaces.IState {
 	newState.DBType = s.CloneDBType
 	newState.ExportData = s.ExportData
 	newState.ExportDataSubpath = s.ExportDataSubpath + "sim-" + number
+	newState.AddressIndex = s.AddressIndex
+	newState.ExtIDIndex = s.ExtIDIndex
+	newState.BalanceCheckpoints = s.BalanceCheckpoints
 	newState.Network = s.Network
 	newState.MainNetworkPort = s.MainNetworkPort
 	newState.PeersFile = s.PeersFile
@@ -412,6 +429,13 @@ func (s *State) Clone(cloneNumber int) interfaces.IState {
 	newState.LocalNetworkPort = s.LocalNetworkPort
 	newState.LocalSeedURL = s.LocalSeedURL
 	newState.LocalSpecialPeers = s.LocalSpecialPeers
+	newState.P2PEncryption = s.P2PEncryption
+	newState.P2PTrustedNodeKeys = s.P2PTrustedNodeKeys
+	newState.P2PSeedKeys = s.P2PSeedKeys
+	newState.P2PBroadcast = s.P2PBroadcast
+	newState.PeerBanDuration = s.PeerBanDuration
+	newState.PeerBanScore = s.PeerBanScore
+	newState.PeerScoring = s.PeerScoring
 	newState.StartDelayLimit = s.StartDelayLimit
 	newState.CustomNetworkID = s.CustomNetworkID
 
@@ -420,6 +444,7 @@ func (s *State) Clone(cloneNumber int) interfaces.IState {
 
 	newState.ControlPanelPort = s.ControlPanelPort
 	newState.ControlPanelSetting = s.ControlPanelSetting
+	newState.MetricsPort = s.MetricsPort
 
 	newState.Identities = s.Identities
 	newState.Authorities = s.Authorities
@@ -458,15 +483,9 @@ func (s *State) Clone(cloneNumber int) interfaces.IState {
 	newState.factomdTLSCertFile = s.factomdTLSCertFile
 	newState.FactomdLocations = s.FactomdLocations
 
-	switch newState.DBType {
-	case "LDB":
-		newState.StateSaverStruct.FastBoot = s.StateSaverStruct.FastBoot
-		newState.StateSaverStruct.FastBootLocation = newState.LdbPath
-		break
-	case "Bolt":
+	if engine, ok := database.GetEngine(newState.DBType); ok && engine.FileName != "" {
 		newState.StateSaverStruct.FastBoot = s.StateSaverStruct.FastBoot
-		newState.StateSaverStruct.FastBootLocation = newState.BoltDBPath
-		break
+		newState.StateSaverStruct.FastBootLocation = newState.databaseDir(newState.DBType)
 	}
 
 	return newState
@@ -632,6 +651,9 @@ func (s *State) LoadConfig(filename string, networkFlag string) {
 		s.DBType = cfg.App.DBType
 		s.ExportData = cfg.App.ExportData // bool
 		s.ExportDataSubpath = cfg.App.ExportDataSubpath
+		s.AddressIndex = cfg.App.AddressIndex
+		s.ExtIDIndex = cfg.App.ExtIDIndex
+		s.BalanceCheckpoints = cfg.App.BalanceCheckpoints
 		s.MainNetworkPort = cfg.App.MainNetworkPort
 		s.PeersFile = cfg.App.PeersFile
 		s.MainSeedURL = cfg.App.MainSeedURL
@@ -644,11 +666,22 @@ func (s *State) LoadConfig(filename string, networkFlag string) {
 		s.LocalNetworkPort = cfg.App.LocalNetworkPort
 		s.LocalSeedURL = cfg.App.LocalSeedURL
 		s.LocalSpecialPeers = cfg.App.LocalSpecialPeers
+		s.P2PEncryption = cfg.App.P2PEncryption
+		s.P2PTrustedNodeKeys = cfg.App.P2PTrustedNodeKeys
+		s.P2PSeedKeys = cfg.App.P2PSeedKeys
+		s.P2PBroadcast = cfg.App.P2PBroadcast
+		s.PeerBanDuration = time.Duration(cfg.Peer.BanDuration)
+		if s.PeerBanDuration < time.Second {
+			s.PeerBanDuration = time.Second
+		}
+		s.PeerBanScore = cfg.Peer.BanScore
+		s.PeerScoring = cfg.Peer.Scoring
 		s.LocalServerPrivKey = cfg.App.LocalServerPrivKey
 		s.FactoshisPerEC = cfg.App.ExchangeRate
 		s.DirectoryBlockInSeconds = cfg.App.DirectoryBlockInSeconds
 		s.PortNumber = cfg.App.PortNumber
 		s.ControlPanelPort = cfg.App.ControlPanelPort
+		s.MetricsPort = cfg.App.MetricsPort
 		s.RpcUser = cfg.App.FactomdRpcUser
 		s.RpcPass = cfg.App.FactomdRpcPass
 		s.StateSaverStruct.FastBoot = cfg.App.FastBoot
@@ -779,9 +812,10 @@ func (s *State) Init() {
 	s.TimeOffset = new(primitives.Timestamp)                   //interfaces.Timestamp(int64(rand.Int63() % int64(time.Microsecond*10)))
 	s.networkInvalidMsgQueue = make(chan interfaces.IMsg, 100) //incoming message queue from the network messages
 	s.InvalidMessages = make(map[[32]byte]interfaces.IMsg, 0)
-	s.networkOutMsgQueue = NewNetOutMsgQueue(1000)      //Messages to be broadcast to the network
-	s.inMsgQueue = NewInMsgQueue(10000)                 //incoming message queue for factom application messages
-	s.apiQueue = NewAPIQueue(100)                       //incoming message queue from the API
+	s.networkOutMsgQueue = NewNetOutMsgQueue(1000) //Messages to be broadcast to the network
+	//incoming message queues for factom application messages and from the API, scheduled by message type
+	s.inMsgQueue = NewPriorityMSGQueue("inmsg", 10000, TotalMessageQueueInMsgGeneralVec, CurrentMessageQueueInMsgGeneralVec)
+	s.apiQueue = NewPriorityMSGQueue("api", 100, TotalMessageQueueApiGeneralVec, CurrentMessageQueueApiGeneralVec)
 	s.ackQueue = make(chan interfaces.IMsg, 100)        //queue of Leadership messages
 	s.msgQueue = make(chan interfaces.IMsg, 400)        //queue of Follower messages
 	s.ShutdownChan = make(chan int, 1)                  //Channel to gracefully shut down.
@@ -840,27 +874,58 @@ func (s *State) Init() {
 	}
 
 	//Database
-	switch s.DBType {
-	case "LDB":
-		if err := s.InitLevelDB(); err != nil {
-			panic(fmt.Sprintf("Error initializing the database: %v", err))
-		}
-	case "Bolt":
-		if err := s.InitBoltDB(); err != nil {
-			panic(fmt.Sprintf("Error initializing the database: %v", err))
-		}
-	case "Map":
-		if err := s.InitMapDB(); err != nil {
-			panic(fmt.Sprintf("Error initializing the database: %v", err))
-		}
-	default:
-		panic("No Database type specified")
+	if err := s.InitDB(); err != nil {
+		panic(fmt.Sprintf("Error initializing the database: %v", err))
 	}
 
 	if s.ExportData {
 		s.DB.SetExportData(s.ExportDataSubpath)
 	}
 
+	if s.AddressIndex {
+		s.DB.SetAddressIndex()
+		// Indexing an existing database can take a while, so it is done
+		// alongside everything else
+		db := s.DB
+		go func() {
+			if err := db.BackfillAddressIndex(); err != nil {
+				s.Println("Error building the address index:", err)
+			}
+		}()
+	}
+
+	if s.ExtIDIndex {
+		s.DB.SetExtIDIndex()
+		// Entries saved from now on are indexed as they are saved, so the
+		// entries already in the database are indexed alongside them
+		db := s.DB
+		go func() {
+			if err := db.BackfillExtIDIndex(); err != nil {
+				s.Println("Error building the ExtID index:", err)
+			}
+		}()
+	}
+
+	if s.BalanceCheckpoints {
+		// Checkpoints from now on are saved with their blocks, so the ones
+		// missing below are saved alongside them
+		db := s.DB
+		go func() {
+			if err := db.BackfillBalanceCheckpoints(); err != nil {
+				s.Println("Error saving the balance checkpoints:", err)
+			}
+		}()
+	}
+
+	// Receipts reach the anchors of old blocks once a database from before
+	// the index of anchor entries has it built
+	db := s.DB
+	go func() {
+		if err := db.BackfillAnchorEntryIndex(); err != nil {
+			s.Println("Error building the anchor entry index:", err)
+		}
+	}()
+
 	//Network
 	switch s.Network {
 	case "MAIN":
@@ -2096,53 +2161,56 @@ func (s *State) GetMatryoshka(dbheight uint32) interfaces.IHash {
 	return nil
 }
 
-func (s *State) InitLevelDB() error {
-	if s.DB != nil {
-		return nil
-	}
-
-	path := s.LdbPath + "/" + s.Network + "/" + "factoid_level.db"
-
-	s.Println("Database:", path)
+// InitDB opens the database with the storage engine registered under DBType
+func (s *State) InitDB() error {
+	return s.initDB(s.DBType)
+}
 
-	dbase, err := leveldb.NewLevelDB(path, false)
+func (s *State) InitLevelDB() error {
+	return s.initDB("LDB")
+}
 
-	if err != nil || dbase == nil {
-		dbase, err = leveldb.NewLevelDB(path, true)
-		if err != nil {
-			return err
-		}
-	}
+func (s *State) InitBoltDB() error {
+	return s.initDB("Bolt")
+}
 
-	s.DB = databaseOverlay.NewOverlay(dbase)
-	return nil
+func (s *State) InitMapDB() error {
+	return s.initDB("Map")
 }
 
-func (s *State) InitBoltDB() error {
+func (s *State) initDB(dbType string) error {
 	if s.DB != nil {
 		return nil
 	}
 
-	path := s.BoltDBPath + "/" + s.Network + "/"
+	engine, ok := database.GetEngine(dbType)
+	if ok == false {
+		return fmt.Errorf("%s is not a valid database type.  Expect one of %s", dbType, strings.Join(database.EngineNames(), ", "))
+	}
 
-	s.Println("Database Path for", s.FactomNodeName, "is", path)
-	os.MkdirAll(path, 0777)
+	path := ""
+	if engine.FileName != "" {
+		dir := s.databaseDir(dbType) + "/" + s.Network + "/"
+		os.MkdirAll(dir, 0777)
+		path = dir + engine.FileName
+		s.Println("Database Path for", s.FactomNodeName, "is", path)
+	}
 
-	dbase := new(boltdb.BoltDB)
-	dbase.Init(nil, path+"FactomBolt.db")
+	dbase, err := engine.Open(path)
+	if err != nil {
+		return err
+	}
 	s.DB = databaseOverlay.NewOverlay(dbase)
 	return nil
 }
 
-func (s *State) InitMapDB() error {
-	if s.DB != nil {
-		return nil
+// databaseDir returns the directory a database of the type is kept in.  Bolt
+// has a setting of its own, the other engines are kept in the LevelDB one.
+func (s *State) databaseDir(dbType string) string {
+	if dbType == "Bolt" {
+		return s.BoltDBPath
 	}
-
-	dbase := new(mapdb.MapDB)
-	dbase.Init(nil)
-	s.DB = databaseOverlay.NewOverlay(dbase)
-	return nil
+	return s.LdbPath
 }
 
 func (s *State) String() string {
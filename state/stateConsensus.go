@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"hash"
+	"strconv"
 	"time"
 
 	"github.com/FactomProject/factomd/common/constants"
@@ -295,6 +296,8 @@ func (s *State) ReviewHolding() {
 	saved := s.GetHighestSavedBlk()
 
 	for k, v := range s.Holding {
+		age := now.GetTimeMilli() - v.GetTimestamp().GetTimeMilli()
+		HoldingQueueAge.WithLabelValues(s.FactomNodeName, messages.MessageName(v.Type())).Observe(float64(age) / 1e3)
 
 		if int(highest)-int(saved) > 1000 {
 			TotalHoldingQueueOutputs.Inc()
@@ -1388,6 +1391,7 @@ func (s *State) ProcessEOM(dbheight uint32, msg interfaces.IMsg) bool {
 		//fmt.Println(fmt.Sprintf("EOM PROCESS: %10s vm %2d Process Once: !e.Processed(%v) EOM: %s", s.FactomNodeName, e.VMIndex, e.Processed, e.String()))
 		vm.LeaderMinute++
 		s.EOMProcessed++
+		s.observeLatency(ConsensusEOMLatency, e.ChainID)
 		//fmt.Println(fmt.Sprintf("EOM PROCESS: %10s vm %2d EOMProcessed++ (%2d)", s.FactomNodeName, e.VMIndex, s.EOMProcessed))
 		vm.Synced = true
 		markNoFault(pl, msg.GetVMIndex())
@@ -1426,6 +1430,10 @@ func (s *State) ProcessEOM(dbheight uint32, msg interfaces.IMsg) bool {
 			s.CurrentMinute = int(e.Minute)
 		}
 
+		if s.CurrentMinuteStartTime > 0 {
+			spent := time.Now().UnixNano() - s.CurrentMinuteStartTime
+			ConsensusMinuteDuration.WithLabelValues(s.FactomNodeName, strconv.Itoa(s.CurrentMinute)).Observe(float64(spent) / 1e9)
+		}
 		s.CurrentMinute++
 		s.CurrentMinuteStartTime = time.Now().UnixNano()
 
@@ -1665,6 +1673,7 @@ func (s *State) ProcessDBSig(dbheight uint32, msg interfaces.IMsg) bool {
 		s.AddDBSig(dbheight, dbs.ServerIdentityChainID, dbs.DBSignature)
 
 		s.DBSigProcessed++
+		s.observeLatency(ConsensusDBSigLatency, dbs.ServerIdentityChainID)
 		//fmt.Println(fmt.Sprintf("Process DBSig %10s vm %2v DBSigProcessed++ (%2d)", s.FactomNodeName, dbs.VMIndex, s.DBSigProcessed))
 		vm.Synced = true
 	}
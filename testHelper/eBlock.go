@@ -222,3 +222,42 @@ func CreateTestAnchorEnry(dBlock *directoryBlock.DirectoryBlock) *entryBlock.Ent
 
 	return answer
 }
+
+// CreateTestWindowAnchorEntry creates an anchor entry for a window of
+// consecutive directory blocks
+func CreateTestWindowAnchorEntry(dBlocks []*directoryBlock.DirectoryBlock) *entryBlock.Entry {
+	answer := entryBlock.NewEntry()
+
+	answer.ChainID = GetAnchorChainID()
+	answer.Version = 0
+
+	window := []interfaces.IDirectoryBlock{}
+	for _, dBlock := range dBlocks {
+		window = append(window, dBlock)
+	}
+	ar, err := anchor.CreateAnchorRecordFromDBlocks(window)
+	if err != nil {
+		panic(err)
+	}
+	height := ar.DBHeight
+	ar.Bitcoin = new(anchor.BitcoinStruct)
+	ar.Bitcoin.Address = "1HLoD9E4SDFFPDiYfNYnkBLQ85Y51J3Zb1"
+	ar.Bitcoin.TXID = fmt.Sprintf("%x", IntToByteSlice(int(height)))
+	ar.Bitcoin.BlockHeight = int32(height)
+	ar.Bitcoin.BlockHash = fmt.Sprintf("%x", IntToByteSlice(255-int(height)))
+	ar.Bitcoin.Offset = int32(height % 10)
+
+	hex, eIDs, err := ar.MarshalAndSignV2(NewPrimitivesPrivateKey(0))
+	if err != nil {
+		panic(err)
+	}
+	answer.Content = primitives.ByteSlice{Bytes: hex}
+	bs := primitives.ByteSlice{}
+	err = bs.UnmarshalBinary(eIDs)
+	if err != nil {
+		panic(err)
+	}
+	answer.ExtIDs = []primitives.ByteSlice{bs}
+
+	return answer
+}
@@ -14,11 +14,29 @@ import (
 
 var _ = fmt.Print
 
+// Duration is a time.Duration that is read from the config file in the form
+// time.ParseDuration takes, eg 30m or 24h
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
 type FactomdConfig struct {
 	App struct {
 		PortNumber                             int
 		HomeDir                                string
 		ControlPanelPort                       int
+		MetricsPort                            int
 		ControlPanelFilesPath                  string
 		ControlPanelSetting                    string
 		DBType                                 string
@@ -28,6 +46,9 @@ type FactomdConfig struct {
 		DirectoryBlockInSeconds                int
 		ExportData                             bool
 		ExportDataSubpath                      string
+		AddressIndex                           bool
+		ExtIDIndex                             bool
+		BalanceCheckpoints                     bool
 		FastBoot                               bool
 		FastBootLocation                       string
 		NodeMode                               string
@@ -55,22 +76,33 @@ type FactomdConfig struct {
 		LocalSpecialPeers       string
 		CustomBootstrapIdentity string
 		CustomBootstrapKey      string
+		P2PEncryption           string
+		P2PTrustedNodeKeys      []string
+		P2PSeedKeys             []string
+		P2PBroadcast            string
 		FactomdTlsEnabled       bool
 		FactomdTlsPrivateKey    string
 		FactomdTlsPublicCert    string
 		FactomdRpcUser          string
 		FactomdRpcPass          string
+		FactomdRpcUsers         []string
+		FactomdApiKeys          []string
+		FactomdApiMethodRoles   []string
+		ApiRateLimits           []string
+		ApiMaxBatchSize         int
 
 		ChangeAcksHeight uint32
 	}
 	Peer struct {
-		AddPeers     []string      `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
-		ConnectPeers []string      `long:"connect" description:"Connect only to the specified peers at startup"`
-		Listeners    []string      `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 8108, testnet: 18108)"`
-		MaxPeers     int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
-		BanDuration  time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
-		TestNet      bool          `long:"testnet" description:"Use the test network"`
-		SimNet       bool          `long:"simnet" description:"Use the simulation test network"`
+		AddPeers     []string `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
+		ConnectPeers []string `long:"connect" description:"Connect only to the specified peers at startup"`
+		Listeners    []string `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 8108, testnet: 18108)"`
+		MaxPeers     int      `long:"maxpeers" description:"Max number of inbound and outbound peers"`
+		BanDuration  Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
+		BanScore     int32    `long:"banscore" description:"Peers whose reputation score falls to this are banned"`
+		Scoring      []string `long:"scoring" description:"Score of a peer event, as event:weight"`
+		TestNet      bool     `long:"testnet" description:"Use the test network"`
+		SimNet       bool     `long:"simnet" description:"Use the simulation test network"`
 	}
 	Log struct {
 		LogPath         string
@@ -108,7 +140,9 @@ HomeDir                               = ""
 ; --------------- ControlPanel disabled | readonly | readwrite
 ControlPanelSetting                   = readonly
 ControlPanelPort                      = 8090
-; --------------- DBType: LDB | Bolt | Map
+; --------------- MetricsPort: port serving the Prometheus metrics on /metrics, 0 turns it off
+MetricsPort                           = 9876
+; --------------- DBType: LDB | Bolt | Map | LSM
 DBType                                = "LDB"
 LdbPath                               = "database/ldb"
 BoltDBPath                            = "database/bolt"
@@ -116,6 +150,12 @@ DataStorePath                         = "data/export"
 DirectoryBlockInSeconds               = 6
 ExportData                            = false
 ExportDataSubpath                     = "database/export/"
+; --------------- AddressIndex: keep the transaction history of every address, for the address-transactions API
+AddressIndex                          = false
+; --------------- ExtIDIndex: index the ExtIDs of every entry, for the search-entries API and the control panel's extid: search
+ExtIDIndex                            = false
+; --------------- BalanceCheckpoints: save every balance every 1000 blocks, so the balances-at-height API only replays the blocks since
+BalanceCheckpoints                    = false
 FastBoot                              = true
 FastBootLocation                      = ""
 ; --------------- Network: MAIN | TEST | LOCAL
@@ -130,6 +170,19 @@ TestSpecialPeers     = ""
 LocalNetworkPort     = 8110
 LocalSeedURL         = "https://raw.githubusercontent.com/FactomProject/factomproject.github.io/master/seed/localseed.txt"
 LocalSpecialPeers    = ""
+; --------------- P2PEncryption: disabled | optional | required
+; optional encrypts connections to peers that can, and falls back to plain connections for older peers.
+; Handshakes are signed with LocalServerPrivKey.  If any P2PTrustedNodeKeys are given (the LocalServerPublicKey
+; of the peers, one per line), encrypted peers must have one of them.
+P2PEncryption        = disabled
+; P2PTrustedNodeKeys   = cc1985cdfae4e32b5a454dfda8ce5e1361558482684f3367649c3ad852c8e31a
+; --------------- Seed URLs can list several sources, tried in order: http(s):// seed lists, or dns://name[:port]
+; (TXT records holding seed list lines, then A/AAAA records).  If any P2PSeedKeys are given, one per line,
+; seed lists must be signed by one of them, and sources without a valid signature are skipped.
+; P2PSeedKeys          = cc1985cdfae4e32b5a454dfda8ce5e1361558482684f3367649c3ad852c8e31a
+; --------------- P2PBroadcast: flood | gossip
+; gossip announces large messages by hash to peers that can fetch them, instead of sending every peer the message.
+P2PBroadcast         = flood
 CustomBootstrapIdentity     = 38bab1455b7bd7e5efd15c53c777c79d0c988e9210f1da49a99d95b3a6417be9
 CustomBootstrapKey          = cc1985cdfae4e32b5a454dfda8ce5e1361558482684f3367649c3ad852c8e31a
 ; --------------- NodeMode: FULL | SERVER ----------------
@@ -154,9 +207,37 @@ FactomdTlsPublicCert                  = "/full/path/to/factomdAPIpub.cert"
 FactomdRpcUser                        = ""
 FactomdRpcPass                        = ""
 
+; More API users and keys, each with a role: public, operator (read only debug API) or admin (all of the API).
+; FactomdRpcUser is an admin.  Users log in with HTTP basic auth, keys are sent as "Authorization: Bearer <key>".
+; Once any user or key is set, requests without credentials only get the public role, unless FactomdRpcUser is
+; set, in which case they are refused.  Repeat a line to add more.
+; FactomdRpcUsers                     = "user:password:role"
+; FactomdApiKeys                      = "key:role"
+; The role a method needs can be changed from the default (public for v2, operator for debug, admin for the
+; debug methods that change the node).
+; FactomdApiMethodRoles               = "debug/holding-queue:admin"
+; Requests per second each client (API user or key, or else IP address) can make, by class of method:
+; submit (commits, reveals and transactions), data (raw data, receipts and range or index queries), debug
+; and general (everything else).  Each line is class:rate or class:rate:burst.  Classes without a line
+; aren't limited.  Repeat a line to limit more classes.
+; ApiRateLimits                       = "submit:10:50"
+; The most requests a JSON-RPC batch sent to /v2 or /debug can have
+ApiMaxBatchSize                       = 100
+
 ; Specifying when to change ACKs for switching leader servers
 ChangeAcksHeight                      = 0
 
+; ------------------------------------------------------------------------------
+; Peer reputation.  Peers are scored on what they send us, and banned for BanDuration
+; (eg 30m or 24h, minimum 1 second) when their score falls to BanScore.  Bans are kept
+; next to the peers file.  Scoring lines change the score of an event, as event:weight,
+; with events invalid (-20), timeout (-5) and useful (1).
+; ------------------------------------------------------------------------------
+[Peer]
+BanDuration                           = 24h
+BanScore                              = -1000
+; Scoring                             = invalid:-50
+
 ; ------------------------------------------------------------------------------
 ; logLevel - allowed values are: debug, info, notice, warning, error, critical, alert, emergency and none
 ; ConsoleLogLevel - allowed values are: debug, standard
@@ -199,6 +280,7 @@ func (s *FactomdConfig) String() string {
 	out.WriteString(fmt.Sprintf("\n    PortNumber              %v", s.App.PortNumber))
 	out.WriteString(fmt.Sprintf("\n    HomeDir                 %v", s.App.HomeDir))
 	out.WriteString(fmt.Sprintf("\n    ControlPanelPort        %v", s.App.ControlPanelPort))
+	out.WriteString(fmt.Sprintf("\n    MetricsPort             %v", s.App.MetricsPort))
 	out.WriteString(fmt.Sprintf("\n    ControlPanelFilesPath   %v", s.App.ControlPanelFilesPath))
 	out.WriteString(fmt.Sprintf("\n    ControlPanelSetting     %v", s.App.ControlPanelSetting))
 	out.WriteString(fmt.Sprintf("\n    DBType                  %v", s.App.DBType))
@@ -208,6 +290,9 @@ func (s *FactomdConfig) String() string {
 	out.WriteString(fmt.Sprintf("\n    DirectoryBlockInSeconds %v", s.App.DirectoryBlockInSeconds))
 	out.WriteString(fmt.Sprintf("\n    ExportData              %v", s.App.ExportData))
 	out.WriteString(fmt.Sprintf("\n    ExportDataSubpath       %v", s.App.ExportDataSubpath))
+	out.WriteString(fmt.Sprintf("\n    AddressIndex            %v", s.App.AddressIndex))
+	out.WriteString(fmt.Sprintf("\n    ExtIDIndex              %v", s.App.ExtIDIndex))
+	out.WriteString(fmt.Sprintf("\n    BalanceCheckpoints      %v", s.App.BalanceCheckpoints))
 	out.WriteString(fmt.Sprintf("\n    Network                 %v", s.App.Network))
 	out.WriteString(fmt.Sprintf("\n    MainNetworkPort         %v", s.App.MainNetworkPort))
 	out.WriteString(fmt.Sprintf("\n    PeersFile               %v", s.App.PeersFile))
@@ -221,6 +306,10 @@ func (s *FactomdConfig) String() string {
 	out.WriteString(fmt.Sprintf("\n    LocalSpecialPeers       %v", s.App.LocalSpecialPeers))
 	out.WriteString(fmt.Sprintf("\n    CustomBootstrapIdentity %v", s.App.CustomBootstrapIdentity))
 	out.WriteString(fmt.Sprintf("\n    CustomBootstrapKey      %v", s.App.CustomBootstrapKey))
+	out.WriteString(fmt.Sprintf("\n    P2PEncryption           %v", s.App.P2PEncryption))
+	out.WriteString(fmt.Sprintf("\n    P2PTrustedNodeKeys      %v", s.App.P2PTrustedNodeKeys))
+	out.WriteString(fmt.Sprintf("\n    P2PSeedKeys             %v", s.App.P2PSeedKeys))
+	out.WriteString(fmt.Sprintf("\n    P2PBroadcast            %v", s.App.P2PBroadcast))
 	out.WriteString(fmt.Sprintf("\n    NodeMode                %v", s.App.NodeMode))
 	out.WriteString(fmt.Sprintf("\n    IdentityChainID         %v", s.App.IdentityChainID))
 	out.WriteString(fmt.Sprintf("\n    LocalServerPrivKey      %v", s.App.LocalServerPrivKey))
@@ -233,8 +322,18 @@ func (s *FactomdConfig) String() string {
 	out.WriteString(fmt.Sprintf("\n    FactomdTlsPublicCert     %v", s.App.FactomdTlsPublicCert))
 	out.WriteString(fmt.Sprintf("\n    FactomdRpcUser          	%v", s.App.FactomdRpcUser))
 	out.WriteString(fmt.Sprintf("\n    FactomdRpcPass          	%v", s.App.FactomdRpcPass))
+	out.WriteString(fmt.Sprintf("\n    FactomdRpcUsers          %v users", len(s.App.FactomdRpcUsers)))
+	out.WriteString(fmt.Sprintf("\n    FactomdApiKeys           %v keys", len(s.App.FactomdApiKeys)))
+	out.WriteString(fmt.Sprintf("\n    FactomdApiMethodRoles    %v", s.App.FactomdApiMethodRoles))
+	out.WriteString(fmt.Sprintf("\n    ApiRateLimits            %v", s.App.ApiRateLimits))
+	out.WriteString(fmt.Sprintf("\n    ApiMaxBatchSize          %v", s.App.ApiMaxBatchSize))
 	out.WriteString(fmt.Sprintf("\n    ChangeAcksHeight         %v", s.App.ChangeAcksHeight))
 
+	out.WriteString(fmt.Sprintf("\n  Peer"))
+	out.WriteString(fmt.Sprintf("\n    BanDuration             %v", s.Peer.BanDuration))
+	out.WriteString(fmt.Sprintf("\n    BanScore                %v", s.Peer.BanScore))
+	out.WriteString(fmt.Sprintf("\n    Scoring                 %v", s.Peer.Scoring))
+
 	out.WriteString(fmt.Sprintf("\n  Log"))
 	out.WriteString(fmt.Sprintf("\n    LogPath                 %v", s.Log.LogPath))
 	out.WriteString(fmt.Sprintf("\n    LogLevel                %v", s.Log.LogLevel))
@@ -0,0 +1,311 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package wsapi
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/util"
+)
+
+// APIRole is what an API client is allowed to do.  Each role can do
+// everything the ones below it can.
+type APIRole int
+
+const (
+	// Public API calls
+	RolePublic APIRole = iota
+	// Debug API calls that only read the state of the node
+	RoleOperator
+	// Debug API calls that change the node
+	RoleAdmin
+)
+
+var roleNames = map[APIRole]string{
+	RolePublic:   "public",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func (r APIRole) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("role(%d)", int(r))
+}
+
+func ParseAPIRole(s string) (APIRole, error) {
+	for r, name := range roleNames {
+		if strings.EqualFold(s, name) {
+			return r, nil
+		}
+	}
+	return RolePublic, fmt.Errorf("Unknown API role %q", s)
+}
+
+// Debug methods that change the node.  They need the admin role by default,
+// and every call to them is audited.
+var mutatingDebugMethods = map[string]bool{
+	"set-delay":            true,
+	"set-drop-rate":        true,
+	"reload-configuration": true,
+	"ban-peer":             true,
+	"unban-peer":           true,
+}
+
+// The API endpoints methods are checked for
+const (
+	EndpointV2    = "v2"
+	EndpointDebug = "debug"
+)
+
+// DefaultMethodRole returns the role a method needs unless the config says
+// otherwise.
+func DefaultMethodRole(endpoint, method string) APIRole {
+	if endpoint != EndpointDebug {
+		return RolePublic
+	}
+	if mutatingDebugMethods[method] {
+		return RoleAdmin
+	}
+	return RoleOperator
+}
+
+type apiCredential struct {
+	name string
+	role APIRole
+	// Hash of the Authorization header the client sends, so headers are
+	// compared in constant time
+	authHash []byte
+}
+
+// AccessControl holds the users and API keys that may use the API, and the
+// roles methods need.
+//
+// With no users or keys configured the API is open, and every client is an
+// admin, as it was before roles.  The FactomdRpcUser from the config or the
+// command line is an admin.  If it is set, every request must be
+// authenticated; otherwise requests without credentials get the public role.
+type AccessControl struct {
+	credentials []*apiCredential
+	methodRoles map[string]APIRole
+	open        bool
+	anonymous   bool
+}
+
+// APIUser is who made a request
+type APIUser struct {
+	Name string
+	Role APIRole
+}
+
+// NewAccessControl builds the access control from the RPC user of the state
+// and the FactomdRpcUsers, FactomdApiKeys and FactomdApiMethodRoles of its
+// config.
+func NewAccessControl(state interfaces.IState) (*AccessControl, error) {
+	ac := new(AccessControl)
+	ac.methodRoles = map[string]APIRole{}
+
+	if state.GetRpcUser() != "" {
+		h := sha256.New()
+		h.Write(httpBasicAuth(state.GetRpcUser(), state.GetRpcPass()))
+		ac.add(state.GetRpcUser(), RoleAdmin, h.Sum(nil))
+	} else {
+		ac.anonymous = true
+	}
+
+	if cfg, ok := state.GetCfg().(*util.FactomdConfig); ok && cfg != nil {
+		for _, u := range cfg.App.FactomdRpcUsers {
+			// user:password:role, the password may hold colons
+			first := strings.Index(u, ":")
+			last := strings.LastIndex(u, ":")
+			if first < 1 || first == last {
+				return nil, fmt.Errorf("FactomdRpcUsers entry must be user:password:role")
+			}
+			role, err := ParseAPIRole(u[last+1:])
+			if err != nil {
+				return nil, err
+			}
+			h := sha256.New()
+			h.Write(httpBasicAuth(u[:first], u[first+1:last]))
+			ac.add(u[:first], role, h.Sum(nil))
+		}
+
+		for i, k := range cfg.App.FactomdApiKeys {
+			// key:role
+			idx := strings.LastIndex(k, ":")
+			if idx < 1 {
+				return nil, fmt.Errorf("FactomdApiKeys entry %d must be key:role", i)
+			}
+			role, err := ParseAPIRole(k[idx+1:])
+			if err != nil {
+				return nil, err
+			}
+			h := sha256.New()
+			h.Write([]byte("Bearer " + k[:idx]))
+			ac.add(fmt.Sprintf("apikey-%d", i), role, h.Sum(nil))
+		}
+
+		for _, m := range cfg.App.FactomdApiMethodRoles {
+			// endpoint/method:role
+			idx := strings.LastIndex(m, ":")
+			if idx < 1 || !(strings.HasPrefix(m, EndpointV2+"/") || strings.HasPrefix(m, EndpointDebug+"/")) {
+				return nil, fmt.Errorf("FactomdApiMethodRoles entry %q must be v2/method:role or debug/method:role", m)
+			}
+			role, err := ParseAPIRole(m[idx+1:])
+			if err != nil {
+				return nil, err
+			}
+			ac.methodRoles[m[:idx]] = role
+		}
+	}
+
+	ac.open = len(ac.credentials) == 0
+	return ac, nil
+}
+
+func (ac *AccessControl) add(name string, role APIRole, authHash []byte) {
+	c := new(apiCredential)
+	c.name = name
+	c.role = role
+	c.authHash = authHash
+	ac.credentials = append(ac.credentials, c)
+}
+
+// Authenticate returns who made the request, or an error if the request has
+// no valid credentials and needs them.
+func (ac *AccessControl) Authenticate(r *http.Request) (*APIUser, error) {
+	if ac.open {
+		return &APIUser{Name: "anonymous", Role: RoleAdmin}, nil
+	}
+
+	authhdr := r.Header["Authorization"]
+	if len(authhdr) == 0 {
+		if ac.anonymous {
+			return &APIUser{Name: "anonymous", Role: RolePublic}, nil
+		}
+		return nil, errors.New("no auth")
+	}
+
+	h := sha256.New()
+	h.Write([]byte(authhdr[0]))
+	presented := h.Sum(nil)
+
+	// Check all of them, so the time taken doesn't tell which one matched
+	var found *apiCredential
+	for _, c := range ac.credentials {
+		if subtle.ConstantTimeCompare(presented, c.authHash) == 1 && found == nil {
+			found = c
+		}
+	}
+	if found == nil {
+		return nil, errors.New("bad auth")
+	}
+	return &APIUser{Name: found.name, Role: found.role}, nil
+}
+
+// Allowed returns true if the role may call the method of the endpoint.
+func (ac *AccessControl) Allowed(endpoint, method string, role APIRole) bool {
+	need, ok := ac.methodRoles[endpoint+"/"+method]
+	if !ok {
+		need = DefaultMethodRole(endpoint, method)
+	}
+	return role >= need
+}
+
+// The access control of each API server, by port
+var accessControls = map[int]*AccessControl{}
+var accessControlsMutex sync.Mutex
+
+// SetAccessControl (re)builds the access control of the state's API server
+// from its config.
+func SetAccessControl(state interfaces.IState) error {
+	ac, err := NewAccessControl(state)
+	if err != nil {
+		return err
+	}
+	accessControlsMutex.Lock()
+	accessControls[state.GetPort()] = ac
+	accessControlsMutex.Unlock()
+	return nil
+}
+
+func getAccessControl(state interfaces.IState) (*AccessControl, error) {
+	accessControlsMutex.Lock()
+	ac := accessControls[state.GetPort()]
+	accessControlsMutex.Unlock()
+	if ac != nil {
+		return ac, nil
+	}
+	err := SetAccessControl(state)
+	if err != nil {
+		return nil, err
+	}
+	return getAccessControl(state)
+}
+
+func authenticateRequest(state interfaces.IState, r *http.Request) (*APIUser, error) {
+	ac, err := getAccessControl(state)
+	if err != nil {
+		return nil, err
+	}
+	return ac.Authenticate(r)
+}
+
+func methodAllowed(state interfaces.IState, endpoint, method string, user *APIUser) bool {
+	ac, err := getAccessControl(state)
+	if err != nil {
+		return false
+	}
+	return ac.Allowed(endpoint, method, user.Role)
+}
+
+// auditDebugCall logs a call to a debug method that changes the node.
+func auditDebugCall(user *APIUser, remoteAddr string, j *primitives.JSON2Request, jsonError *primitives.JSONError) {
+	result := "ok"
+	if jsonError != nil {
+		result = jsonError.Message
+	}
+	auditDebug(user.Name, user.Role.String(), remoteAddr, j.Method, j.Params, result)
+}
+
+// auditDebugDenied logs a call to a debug method that was refused, either
+// because the user may not make it or because of the rate limit.
+func auditDebugDenied(user *APIUser, remoteAddr string, j *primitives.JSON2Request, jsonError *primitives.JSONError) {
+	auditDebug(user.Name, user.Role.String(), remoteAddr, j.Method, j.Params, "denied: "+jsonError.Message)
+}
+
+// auditDebugUnauthenticated logs a request to the debug API that had no valid
+// credentials.  The method is read from the body when it can be.
+func auditDebugUnauthenticated(r *http.Request) {
+	method := "unknown"
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err == nil {
+		if isBatchRequest(body) {
+			method = "batch"
+		} else if j, err := primitives.ParseJSON2Request(string(body)); err == nil {
+			method = j.Method
+		}
+	}
+	auditDebug("unauthenticated", "none", r.RemoteAddr, method, nil, "denied: unauthorized")
+}
+
+func auditDebug(user, role, remoteAddr, method string, params interface{}, result string) {
+	msg := fmt.Sprintf("Debug API audit: user=%s role=%s remote=%s method=%s params=%v result=%s",
+		user, role, remoteAddr, method, params, result)
+	if rpcLog != nil {
+		rpcLog.Notice(msg)
+	}
+}
@@ -0,0 +1,178 @@
+package wsapi_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/FactomProject/factomd/testHelper"
+	"github.com/FactomProject/factomd/util"
+	. "github.com/FactomProject/factomd/wsapi"
+)
+
+func newAuthRequest(t *testing.T, user, pass, key string) *http.Request {
+	r, err := http.NewRequest("POST", "http://localhost:8088/debug", nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if user != "" {
+		r.SetBasicAuth(user, pass)
+	}
+	if key != "" {
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+	return r
+}
+
+func TestParseAPIRole(t *testing.T) {
+	for _, r := range []APIRole{RolePublic, RoleOperator, RoleAdmin} {
+		p, err := ParseAPIRole(r.String())
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		if p != r {
+			t.Errorf("Role %v parsed as %v", r, p)
+		}
+	}
+	_, err := ParseAPIRole("root")
+	if err == nil {
+		t.Errorf("Unknown role was accepted")
+	}
+}
+
+func TestAccessControlOpen(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	state.RpcUser = ""
+	state.Cfg = new(util.FactomdConfig)
+
+	ac, err := NewAccessControl(state)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	user, err := ac.Authenticate(newAuthRequest(t, "", "", ""))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if user.Role != RoleAdmin {
+		t.Errorf("Open API gave role %v", user.Role)
+	}
+}
+
+func TestAccessControlRoles(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	state.RpcUser = ""
+	cfg := new(util.FactomdConfig)
+	cfg.App.FactomdRpcUsers = []string{"op:pass:word:operator", "boss:secret:admin"}
+	cfg.App.FactomdApiKeys = []string{"abcdef:operator"}
+	state.Cfg = cfg
+
+	ac, err := NewAccessControl(state)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	type check struct {
+		user, pass, key string
+		role            APIRole
+		fails           bool
+	}
+	checks := []check{
+		{"", "", "", RolePublic, false},
+		{"op", "pass:word", "", RoleOperator, false},
+		{"boss", "secret", "", RoleAdmin, false},
+		{"", "", "abcdef", RoleOperator, false},
+		{"op", "secret", "", 0, true},
+		{"", "", "abcdeg", 0, true},
+	}
+	for i, c := range checks {
+		user, err := ac.Authenticate(newAuthRequest(t, c.user, c.pass, c.key))
+		if c.fails {
+			if err == nil {
+				t.Errorf("Check %v: bad credentials were accepted", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Check %v: %v", i, err)
+			continue
+		}
+		if user.Role != c.role {
+			t.Errorf("Check %v: wrong role %v, expected %v", i, user.Role, c.role)
+		}
+	}
+
+	if !ac.Allowed(EndpointV2, "heights", RolePublic) {
+		t.Errorf("Public role can't call the v2 API")
+	}
+	if ac.Allowed(EndpointDebug, "holding-queue", RolePublic) {
+		t.Errorf("Public role can call the debug API")
+	}
+	if !ac.Allowed(EndpointDebug, "holding-queue", RoleOperator) {
+		t.Errorf("Operator role can't read the debug API")
+	}
+	for _, m := range []string{"set-delay", "set-drop-rate", "reload-configuration"} {
+		if ac.Allowed(EndpointDebug, m, RoleOperator) {
+			t.Errorf("Operator role can call %v", m)
+		}
+		if !ac.Allowed(EndpointDebug, m, RoleAdmin) {
+			t.Errorf("Admin role can't call %v", m)
+		}
+	}
+
+	cfg.App.FactomdApiMethodRoles = []string{"debug/holding-queue:admin", "v2/factoid-submit:operator"}
+	ac, err = NewAccessControl(state)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if ac.Allowed(EndpointDebug, "holding-queue", RoleOperator) {
+		t.Errorf("Method role override ignored")
+	}
+	if ac.Allowed(EndpointV2, "factoid-submit", RolePublic) {
+		t.Errorf("Method role override ignored")
+	}
+	if !ac.Allowed(EndpointV2, "heights", RolePublic) {
+		t.Errorf("Method role override changed another method")
+	}
+}
+
+func TestAccessControlRpcUser(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	state.RpcUser = "user"
+	state.RpcPass = "pass"
+	cfg := new(util.FactomdConfig)
+	cfg.App.FactomdRpcUsers = []string{"op:pass:operator"}
+	state.Cfg = cfg
+
+	ac, err := NewAccessControl(state)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	_, err = ac.Authenticate(newAuthRequest(t, "", "", ""))
+	if err == nil {
+		t.Errorf("Request without credentials was accepted")
+	}
+	user, err := ac.Authenticate(newAuthRequest(t, "user", "pass", ""))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if user.Role != RoleAdmin {
+		t.Errorf("RPC user has role %v", user.Role)
+	}
+}
+
+func TestAccessControlBadConfig(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	state.RpcUser = ""
+
+	bad := []*util.FactomdConfig{new(util.FactomdConfig), new(util.FactomdConfig), new(util.FactomdConfig), new(util.FactomdConfig)}
+	bad[0].App.FactomdRpcUsers = []string{"nopassword"}
+	bad[1].App.FactomdRpcUsers = []string{"user:pass:root"}
+	bad[2].App.FactomdApiKeys = []string{"keywithoutrole"}
+	bad[3].App.FactomdApiMethodRoles = []string{"holding-queue:admin"}
+	for i, cfg := range bad {
+		state.Cfg = cfg
+		_, err := NewAccessControl(state)
+		if err == nil {
+			t.Errorf("Bad config %v was accepted", i)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package wsapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/util"
+	"github.com/FactomProject/web"
+)
+
+// The most requests in a batch, unless the config says otherwise
+const DefaultMaxBatchSize = 100
+
+// The most requests of a batch that run at once
+const MaxBatchWorkers = 8
+
+// apiCall makes one call of an endpoint for a user
+type apiCall func(state interfaces.IState, r *http.Request, user *APIUser, j *primitives.JSON2Request) (*primitives.JSON2Response, *primitives.JSONError)
+
+// isBatchRequest returns true if the body is a JSON array, which is how
+// JSON-RPC 2.0 batches requests.
+func isBatchRequest(body []byte) bool {
+	body = bytes.TrimLeft(body, " \t\r\n")
+	return len(body) > 0 && body[0] == '['
+}
+
+func maxBatchSize(state interfaces.IState) int {
+	if cfg, ok := state.GetCfg().(*util.FactomdConfig); ok && cfg != nil && cfg.App.ApiMaxBatchSize > 0 {
+		return cfg.App.ApiMaxBatchSize
+	}
+	return DefaultMaxBatchSize
+}
+
+// handleBatch makes the calls of a batch, a few at a time, and writes their
+// responses in the order of the requests.  Each call is checked and rate
+// limited like a request of its own.  Notifications, requests without an id,
+// are made but get no response, and a batch of only notifications gets no
+// body at all.
+func handleBatch(ctx *web.Context, state interfaces.IState, user *APIUser, body []byte, call apiCall) {
+	var requests []json.RawMessage
+	err := json.Unmarshal(body, &requests)
+	if err != nil || len(requests) == 0 {
+		HandleV2Error(ctx, nil, NewInvalidRequestError())
+		return
+	}
+	max := maxBatchSize(state)
+	if len(requests) > max {
+		HandleV2Error(ctx, nil, NewBatchTooLargeError(max))
+		return
+	}
+
+	responses := make([]*primitives.JSON2Response, len(requests))
+	workers := make(chan struct{}, MaxBatchWorkers)
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		wg.Add(1)
+		go func(i int, request json.RawMessage) {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			responses[i] = batchCall(state, ctx.Request, user, request, call)
+		}(i, request)
+	}
+	wg.Wait()
+
+	answered := []*primitives.JSON2Response{}
+	for _, resp := range responses {
+		if resp != nil {
+			answered = append(answered, resp)
+		}
+	}
+	if len(answered) == 0 {
+		return
+	}
+	b, err := json.Marshal(answered)
+	if err != nil {
+		HandleV2Error(ctx, nil, NewInternalError())
+		return
+	}
+	ctx.Write(b)
+}
+
+// batchCall makes one call of a batch, and returns its response, or nil if it
+// was a notification
+func batchCall(state interfaces.IState, r *http.Request, user *APIUser, request json.RawMessage, call apiCall) *primitives.JSON2Response {
+	j, err := primitives.ParseJSON2Request(string(request))
+	if err != nil {
+		resp := primitives.NewJSON2Response()
+		resp.Error = NewInvalidRequestError()
+		return resp
+	}
+
+	resp, jsonError := call(state, r, user, j)
+	if isNotification(request) {
+		return nil
+	}
+	if jsonError != nil {
+		resp = primitives.NewJSON2Response()
+		resp.ID = j.ID
+		resp.Error = jsonError
+	}
+	return resp
+}
+
+// isNotification returns true if the request has no id member.  A request
+// with an id of null is still answered.
+func isNotification(request json.RawMessage) bool {
+	var members map[string]json.RawMessage
+	if json.Unmarshal(request, &members) != nil {
+		return false
+	}
+	_, hasID := members["id"]
+	return !hasID
+}
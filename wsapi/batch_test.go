@@ -0,0 +1,132 @@
+package wsapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/state"
+	"github.com/FactomProject/factomd/testHelper"
+	"github.com/FactomProject/factomd/util"
+	. "github.com/FactomProject/factomd/wsapi"
+	"github.com/FactomProject/web"
+)
+
+func postV2(t *testing.T, context *web.Context, body string) {
+	testHelper.ClearContextResponseWriter(context)
+	r, err := http.NewRequest("POST", "http://localhost:8088/v2", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	r.RemoteAddr = "127.0.0.1:12345"
+	context.Request = r
+	HandleV2(context)
+}
+
+func TestHandleV2Batch(t *testing.T) {
+	context := testHelper.CreateWebContext()
+	s := context.Server.Env["state"].(*state.State)
+	s.Cfg = new(util.FactomdConfig)
+
+	postV2(t, context, `[
+		{"jsonrpc": "2.0", "id": 1, "method": "heights"},
+		{"jsonrpc": "2.0", "id": 2, "method": "properties"},
+		{"jsonrpc": "1.0", "id": 3, "method": "heights"},
+		{"jsonrpc": "2.0", "id": 4, "method": "no-such-method"},
+		{"jsonrpc": "2.0", "id": "five", "method": "heights"}
+	]`)
+
+	responses := []*primitives.JSON2Response{}
+	err := json.Unmarshal([]byte(testHelper.GetBody(context)), &responses)
+	if err != nil {
+		t.Fatalf("%v - %v", err, testHelper.GetBody(context))
+	}
+	if len(responses) != 5 {
+		t.Fatalf("Got %v responses, expected 5", len(responses))
+	}
+
+	ids := []interface{}{float64(1), float64(2), nil, float64(4), "five"}
+	for i, r := range responses {
+		if r.ID != ids[i] {
+			t.Errorf("Response %v has ID %v, expected %v", i, r.ID, ids[i])
+		}
+	}
+	for _, i := range []int{0, 1, 4} {
+		if responses[i].Error != nil || responses[i].Result == nil {
+			t.Errorf("Response %v failed - %v", i, responses[i].Error)
+		}
+	}
+	if responses[2].Error == nil || responses[2].Error.Code != NewInvalidRequestError().Code {
+		t.Errorf("Invalid request didn't fail - %v", responses[2].Error)
+	}
+	if responses[3].Error == nil || responses[3].Error.Code != NewMethodNotFoundError().Code {
+		t.Errorf("Unknown method didn't fail - %v", responses[3].Error)
+	}
+}
+
+func TestHandleV2BatchNotifications(t *testing.T) {
+	context := testHelper.CreateWebContext()
+	s := context.Server.Env["state"].(*state.State)
+	s.Cfg = new(util.FactomdConfig)
+
+	// Notifications get no response, but a null id is still answered
+	postV2(t, context, `[
+		{"jsonrpc": "2.0", "method": "heights"},
+		{"jsonrpc": "2.0", "id": 1, "method": "heights"},
+		{"jsonrpc": "2.0", "id": null, "method": "properties"},
+		{"jsonrpc": "2.0", "method": "no-such-method"}
+	]`)
+	responses := []*primitives.JSON2Response{}
+	err := json.Unmarshal([]byte(testHelper.GetBody(context)), &responses)
+	if err != nil {
+		t.Fatalf("%v - %v", err, testHelper.GetBody(context))
+	}
+	if len(responses) != 2 || responses[0].ID != float64(1) || responses[1].ID != nil {
+		t.Errorf("Wrong responses %v", testHelper.GetBody(context))
+	}
+
+	// A batch of only notifications gets no body
+	postV2(t, context, `[
+		{"jsonrpc": "2.0", "method": "heights"},
+		{"jsonrpc": "2.0", "method": "properties"}
+	]`)
+	if body := testHelper.GetBody(context); body != "" {
+		t.Errorf("Batch of notifications got %v", body)
+	}
+}
+
+func TestHandleV2BatchLimits(t *testing.T) {
+	context := testHelper.CreateWebContext()
+	s := context.Server.Env["state"].(*state.State)
+	cfg := new(util.FactomdConfig)
+	cfg.App.ApiMaxBatchSize = 2
+	s.Cfg = cfg
+
+	for _, body := range []string{`[]`, `[1, 2`} {
+		postV2(t, context, body)
+		resp := new(primitives.JSON2Response)
+		err := json.Unmarshal([]byte(testHelper.GetBody(context)), resp)
+		if err != nil {
+			t.Fatalf("%v - %v", err, testHelper.GetBody(context))
+		}
+		if resp.Error == nil || resp.Error.Code != NewInvalidRequestError().Code {
+			t.Errorf("Bad batch %v was accepted", body)
+		}
+	}
+
+	postV2(t, context, `[
+		{"jsonrpc": "2.0", "id": 1, "method": "heights"},
+		{"jsonrpc": "2.0", "id": 2, "method": "heights"},
+		{"jsonrpc": "2.0", "id": 3, "method": "heights"}
+	]`)
+	resp := new(primitives.JSON2Response)
+	err := json.Unmarshal([]byte(testHelper.GetBody(context)), resp)
+	if err != nil {
+		t.Fatalf("%v - %v", err, testHelper.GetBody(context))
+	}
+	if resp.Error == nil || resp.Error.Code != NewBatchTooLargeError(2).Code {
+		t.Errorf("Batch over the limit was accepted")
+	}
+}
@@ -10,9 +10,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/p2p"
 	"github.com/FactomProject/factomd/util"
 	"github.com/FactomProject/web"
 )
@@ -22,13 +24,15 @@ func HandleDebug(ctx *web.Context) {
 	state := ctx.Server.Env["state"].(interfaces.IState)
 	ServersMutex.Unlock()
 
-	if err := checkAuthHeader(state, ctx.Request); err != nil {
+	user, err := authenticateRequest(state, ctx.Request)
+	if err != nil {
 		remoteIP := ""
 		remoteIP += strings.Split(ctx.Request.RemoteAddr, ":")[0]
 		fmt.Printf(
 			"Unauthorized V2 API client connection attempt from %s\n",
 			remoteIP,
 		)
+		auditDebugUnauthenticated(ctx.Request)
 		ctx.ResponseWriter.Header().Add(
 			"WWW-Authenticate",
 			`Basic realm="factomd RPC"`,
@@ -48,13 +52,18 @@ func HandleDebug(ctx *web.Context) {
 		return
 	}
 
+	if isBatchRequest(body) {
+		handleBatch(ctx, state, user, body, callDebug)
+		return
+	}
+
 	j, err := primitives.ParseJSON2Request(string(body))
 	if err != nil {
 		HandleV2Error(ctx, nil, NewInvalidRequestError())
 		return
 	}
 
-	jsonResp, jsonError := HandleDebugRequest(state, j)
+	jsonResp, jsonError := callDebug(state, ctx.Request, user, j)
 
 	if jsonError != nil {
 		HandleV2Error(ctx, j, jsonError)
@@ -64,6 +73,36 @@ func HandleDebug(ctx *web.Context) {
 	ctx.Write([]byte(jsonResp.String()))
 }
 
+// callDebug makes a debug API call for the user, if the user may make it.
+func callDebug(state interfaces.IState, r *http.Request, user *APIUser, j *primitives.JSON2Request) (*primitives.JSON2Response, *primitives.JSONError) {
+	if !methodAllowed(state, EndpointDebug, j.Method, user) {
+		jsonError := NewMethodNotAllowedError()
+		auditDebugDenied(user, r.RemoteAddr, j, jsonError)
+		return nil, jsonError
+	}
+	if rateLimited(state, r, user, EndpointDebug, j.Method) {
+		jsonError := NewRateLimitedError()
+		auditDebugDenied(user, r.RemoteAddr, j, jsonError)
+		return nil, jsonError
+	}
+
+	jsonResp, jsonError := HandleDebugRequest(state, j)
+
+	if mutatingDebugMethods[j.Method] {
+		auditDebugCall(user, r.RemoteAddr, j, jsonError)
+	}
+	if j.Method == "reload-configuration" && jsonError == nil {
+		// Pick up any change to the users and roles
+		if err := SetAccessControl(state); err != nil {
+			fmt.Printf("Keeping the API users and roles, the new ones can't be used: %v\n", err)
+		}
+		if err := SetRateLimiter(state); err != nil {
+			fmt.Printf("Keeping the API rate limits, the new ones can't be used: %v\n", err)
+		}
+	}
+	return jsonResp, jsonError
+}
+
 func HandleDebugRequest(
 	state interfaces.IState,
 	j *primitives.JSON2Request,
@@ -123,6 +162,15 @@ func HandleDebugRequest(
 	case "reload-configuration":
 		resp, jsonError = HandleReloadConfig(state, params)
 		break
+	case "peer-reputation":
+		resp, jsonError = HandlePeerReputation(state, params)
+		break
+	case "ban-peer":
+		resp, jsonError = HandleBanPeer(state, params)
+		break
+	case "unban-peer":
+		resp, jsonError = HandleUnbanPeer(state, params)
+		break
 	default:
 		jsonError = NewMethodNotFoundError()
 		break
@@ -405,6 +453,83 @@ func HandleReloadConfig(
 	return state.GetCfg(), nil
 }
 
+func HandlePeerReputation(
+	state interfaces.IState,
+	params interface{},
+) (
+	interface{},
+	*primitives.JSONError,
+) {
+	type ret struct {
+		Peers []p2p.PeerRecord
+		Bans  []p2p.PeerBan
+	}
+	r := new(ret)
+	r.Peers = p2p.PeerReputation.Records()
+	r.Bans = p2p.PeerReputation.Bans()
+	return r, nil
+}
+
+func HandleBanPeer(
+	state interfaces.IState,
+	params interface{},
+) (
+	interface{},
+	*primitives.JSONError,
+) {
+	ban := new(BanPeerRequest)
+	err := MapToObject(params, ban)
+	if err != nil || ban.Address == "" {
+		return nil, NewInvalidParamsError()
+	}
+	var duration time.Duration
+	if ban.Duration != "" {
+		duration, err = time.ParseDuration(ban.Duration)
+		if err != nil || duration <= 0 {
+			return nil, NewInvalidParamsError()
+		}
+	}
+	reason := ban.Reason
+	if reason == "" {
+		reason = "banned through the debug API"
+	}
+
+	p2p.PeerReputation.Ban(ban.Address, reason, duration)
+	return HandlePeerReputation(state, params)
+}
+
+func HandleUnbanPeer(
+	state interfaces.IState,
+	params interface{},
+) (
+	interface{},
+	*primitives.JSONError,
+) {
+	type ret struct {
+		Unbanned bool
+	}
+	r := new(ret)
+
+	unban := new(UnbanPeerRequest)
+	err := MapToObject(params, unban)
+	if err != nil || unban.Address == "" {
+		return nil, NewInvalidParamsError()
+	}
+
+	r.Unbanned = p2p.PeerReputation.Unban(unban.Address)
+	return r, nil
+}
+
+type BanPeerRequest struct {
+	Address  string `json:"address"`
+	Duration string `json:"duration"` // eg 30m, the configured ban duration if empty
+	Reason   string `json:"reason"`
+}
+
+type UnbanPeerRequest struct {
+	Address string `json:"address"`
+}
+
 type SetDelayRequest struct {
 	Delay int64 `json:"delay"`
 }
@@ -0,0 +1,54 @@
+package wsapi_test
+
+import (
+	"testing"
+
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/p2p"
+	"github.com/FactomProject/factomd/testHelper"
+	. "github.com/FactomProject/factomd/wsapi"
+)
+
+func TestHandleDebugPeerBans(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	p2p.PeerReputation = p2p.NewReputation("", 0, 0, p2p.DefaultWeights())
+
+	call := func(method string, params interface{}) (*primitives.JSON2Response, *primitives.JSONError) {
+		j := primitives.NewJSON2Request(method, 1, params)
+		return HandleDebugRequest(state, j)
+	}
+
+	_, jErr := call("ban-peer", map[string]interface{}{"address": "10.0.0.1", "duration": "1h", "reason": "spam"})
+	if jErr != nil {
+		t.Fatalf("ban-peer failed - %v", jErr)
+	}
+	if !p2p.PeerReputation.IsBanned("10.0.0.1") {
+		t.Errorf("Peer wasn't banned")
+	}
+	if bans := p2p.PeerReputation.Bans(); len(bans) != 1 || bans[0].Reason != "spam" {
+		t.Errorf("Wrong bans %+v", bans)
+	}
+	for _, params := range []interface{}{
+		map[string]interface{}{"duration": "1h"},
+		map[string]interface{}{"address": "10.0.0.2", "duration": "soon"},
+	} {
+		if _, jErr := call("ban-peer", params); jErr == nil {
+			t.Errorf("ban-peer with %v was accepted", params)
+		}
+	}
+
+	if _, jErr := call("peer-reputation", nil); jErr != nil {
+		t.Errorf("peer-reputation failed - %v", jErr)
+	}
+
+	resp, jErr := call("unban-peer", map[string]interface{}{"address": "10.0.0.1"})
+	if jErr != nil {
+		t.Fatalf("unban-peer failed - %v", jErr)
+	}
+	if p2p.PeerReputation.IsBanned("10.0.0.1") {
+		t.Errorf("Peer wasn't unbanned")
+	}
+	if str, _ := primitives.EncodeJSONString(resp.Result); str != `{"Unbanned":true}` {
+		t.Errorf("Wrong unban-peer result %v", str)
+	}
+}
@@ -5,6 +5,8 @@
 package wsapi
 
 import (
+	"fmt"
+
 	"github.com/FactomProject/factomd/common/primitives"
 )
 
@@ -97,3 +99,12 @@ func NewReceiptError() *primitives.JSONError {
 func NewRepeatCommitError(data interface{}) *primitives.JSONError {
 	return primitives.NewJSONError(-32011, "Repeated Commit", data)
 }
+func NewMethodNotAllowedError() *primitives.JSONError {
+	return primitives.NewJSONError(-32012, "Method not allowed", "The API user's role may not call this method")
+}
+func NewRateLimitedError() *primitives.JSONError {
+	return primitives.NewJSONError(-32013, "Rate limit exceeded", "Too many requests, try again later")
+}
+func NewBatchTooLargeError(max int) *primitives.JSONError {
+	return primitives.NewJSONError(-32014, "Batch too large", fmt.Sprintf("A batch can have at most %d requests", max))
+}
@@ -155,6 +155,26 @@ var (
 		Help: "Time it takes to compelete a ablockbyheight",
 	})
 
+	HandleV2APICallBlocksByHeightRange = prometheus.NewSummary(prometheus.SummaryOpts{
+		Name: "factomd_wsapi_v2_api_call_blocksbyheightrange_ns",
+		Help: "Time it takes to compelete a blocksbyheightrange",
+	})
+
+	HandleV2APICallAddressTransactions = prometheus.NewSummary(prometheus.SummaryOpts{
+		Name: "factomd_wsapi_v2_api_call_addresstransactions_ns",
+		Help: "Time it takes to compelete an addresstransactions",
+	})
+
+	HandleV2APICallBalanceAtHeight = prometheus.NewSummary(prometheus.SummaryOpts{
+		Name: "factomd_wsapi_v2_api_call_balanceatheight_ns",
+		Help: "Time it takes to compelete a balanceatheight",
+	})
+
+	HandleV2APICallSearchEntries = prometheus.NewSummary(prometheus.SummaryOpts{
+		Name: "factomd_wsapi_v2_api_call_searchentries_ns",
+		Help: "Time it takes to compelete a searchentries",
+	})
+
 	HandleV2APICallAuthorities = prometheus.NewSummary(prometheus.SummaryOpts{
 		Name: "factomd_wsapi_v2_api_call_auths_ns",
 		Help: "Time it takes to compelete an auths ",
@@ -164,6 +184,11 @@ var (
 		Name: "factomd_wsapi_v2_api_call_tpsrate_ns",
 		Help: "Time it takes to compelete a tpsrate",
 	})
+
+	RateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "factomd_wsapi_rate_limited_count",
+		Help: "Number of API requests refused by the rate limiter, by method class",
+	}, []string{"class"})
 )
 
 var registered = false
@@ -205,6 +230,11 @@ func RegisterPrometheus() {
 	prometheus.MustRegister(HandleV2APICallECBlockByHeight)
 	prometheus.MustRegister(HandleV2APICallFblockByHeight)
 	prometheus.MustRegister(HandleV2APICallABlockByHeight)
+	prometheus.MustRegister(HandleV2APICallBlocksByHeightRange)
+	prometheus.MustRegister(HandleV2APICallAddressTransactions)
+	prometheus.MustRegister(HandleV2APICallBalanceAtHeight)
+	prometheus.MustRegister(HandleV2APICallSearchEntries)
 	prometheus.MustRegister(HandleV2APICallAuthorities)
 	prometheus.MustRegister(HandleV2APICallTpsRate)
+	prometheus.MustRegister(RateLimitRejections)
 }
@@ -0,0 +1,264 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package wsapi
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/util"
+)
+
+// Classes of API methods that are rate limited together
+const (
+	RateClassSubmit  = "submit"
+	RateClassData    = "data"
+	RateClassDebug   = "debug"
+	RateClassGeneral = "general"
+)
+
+// Methods that put messages into the node, by v2 and v1 name
+var submitMethods = map[string]bool{
+	"commit-chain":     true,
+	"commit-entry":     true,
+	"reveal-chain":     true,
+	"reveal-entry":     true,
+	"factoid-submit":   true,
+	"send-raw-message": true,
+}
+
+// Methods that read a lot of the database, by v2 and v1 name
+var dataMethods = map[string]bool{
+	"raw-data":                 true,
+	"get-raw-data":             true,
+	"receipt":                  true,
+	"get-receipt":              true,
+	"dblocks-by-height-range":  true,
+	"ecblocks-by-height-range": true,
+	"fblocks-by-height-range":  true,
+	"ablocks-by-height-range":  true,
+	"address-transactions":     true,
+	"balance-at-height":        true,
+	"search-entries":           true,
+}
+
+// MethodRateClass returns the class a method is rate limited in.
+func MethodRateClass(endpoint, method string) string {
+	switch {
+	case endpoint == EndpointDebug:
+		return RateClassDebug
+	case submitMethods[method]:
+		return RateClassSubmit
+	case dataMethods[method]:
+		return RateClassData
+	}
+	return RateClassGeneral
+}
+
+// Buckets are dropped once there are more than this many, those full again
+// first and then the least recently used, so clients that went away don't use
+// up memory
+const maxRateBuckets = 10000
+
+type RateLimit struct {
+	// Requests per second
+	Rate float64
+	// Requests that can be made at once
+	Burst float64
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter gives every client a token bucket for each class of methods
+// with a limit.  Classes without a limit aren't limited.
+type RateLimiter struct {
+	limits  map[string]*RateLimit
+	buckets map[string]*tokenBucket
+	mutex   sync.Mutex
+}
+
+// NewRateLimiter builds the rate limiter from the ApiRateLimits of the
+// state's config.  Each one is class:rate[:burst], the rate in requests per
+// second.  The burst defaults to one second worth of requests.
+func NewRateLimiter(state interfaces.IState) (*RateLimiter, error) {
+	rl := new(RateLimiter)
+	rl.limits = map[string]*RateLimit{}
+	rl.buckets = map[string]*tokenBucket{}
+
+	cfg, ok := state.GetCfg().(*util.FactomdConfig)
+	if !ok || cfg == nil {
+		return rl, nil
+	}
+	for _, l := range cfg.App.ApiRateLimits {
+		parts := strings.Split(l, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("ApiRateLimits entry %q must be class:rate or class:rate:burst", l)
+		}
+		switch parts[0] {
+		case RateClassSubmit, RateClassData, RateClassDebug, RateClassGeneral:
+		default:
+			return nil, fmt.Errorf("Unknown API rate limit class %q", parts[0])
+		}
+		limit := new(RateLimit)
+		rate, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("Bad rate in ApiRateLimits entry %q", l)
+		}
+		limit.Rate = rate
+		limit.Burst = math.Max(1, math.Ceil(rate))
+		if len(parts) == 3 {
+			burst, err := strconv.ParseFloat(parts[2], 64)
+			if err != nil || burst < 1 {
+				return nil, fmt.Errorf("Bad burst in ApiRateLimits entry %q", l)
+			}
+			limit.Burst = burst
+		}
+		rl.limits[parts[0]] = limit
+	}
+	return rl, nil
+}
+
+// Allow takes a token from the client's bucket for the class, and returns
+// false if there wasn't one.
+func (rl *RateLimiter) Allow(client, class string) bool {
+	limit := rl.limits[class]
+	if limit == nil {
+		return true
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := time.Now()
+	key := class + "/" + client
+	b := rl.buckets[key]
+	if b == nil {
+		if len(rl.buckets) >= maxRateBuckets {
+			rl.prune(now)
+		}
+		b = &tokenBucket{tokens: limit.Burst, last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(limit.Burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune drops the buckets that have filled up again.  If that doesn't make
+// room, it drops the least recently used tenth of the buckets, so a churn of
+// clients can't grow the map past maxRateBuckets.
+func (rl *RateLimiter) prune(now time.Time) {
+	for key, b := range rl.buckets {
+		limit := rl.limits[key[:strings.Index(key, "/")]]
+		if limit == nil || b.tokens+now.Sub(b.last).Seconds()*limit.Rate >= limit.Burst {
+			delete(rl.buckets, key)
+		}
+	}
+	if len(rl.buckets) < maxRateBuckets {
+		return
+	}
+	keys := make(bucketsByLast, 0, len(rl.buckets))
+	for key, b := range rl.buckets {
+		keys = append(keys, bucketKey{key, b.last})
+	}
+	sort.Sort(keys)
+	for _, k := range keys[:len(keys)-maxRateBuckets*9/10] {
+		delete(rl.buckets, k.key)
+	}
+}
+
+// Clients returns the number of client buckets the limiter holds
+func (rl *RateLimiter) Clients() int {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	return len(rl.buckets)
+}
+
+type bucketKey struct {
+	key  string
+	last time.Time
+}
+
+// sort.Sort interface implementation, least recently used first
+type bucketsByLast []bucketKey
+
+func (b bucketsByLast) Len() int           { return len(b) }
+func (b bucketsByLast) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b bucketsByLast) Less(i, j int) bool { return b[i].last.Before(b[j].last) }
+
+// The rate limiter of each API server, by port
+var rateLimiters = map[int]*RateLimiter{}
+var rateLimitersMutex sync.Mutex
+
+// SetRateLimiter (re)builds the rate limiter of the state's API server from
+// its config.  The buckets start full again.
+func SetRateLimiter(state interfaces.IState) error {
+	rl, err := NewRateLimiter(state)
+	if err != nil {
+		return err
+	}
+	rateLimitersMutex.Lock()
+	rateLimiters[state.GetPort()] = rl
+	rateLimitersMutex.Unlock()
+	return nil
+}
+
+func getRateLimiter(state interfaces.IState) (*RateLimiter, error) {
+	rateLimitersMutex.Lock()
+	rl := rateLimiters[state.GetPort()]
+	rateLimitersMutex.Unlock()
+	if rl != nil {
+		return rl, nil
+	}
+	err := SetRateLimiter(state)
+	if err != nil {
+		return nil, err
+	}
+	return getRateLimiter(state)
+}
+
+// rateLimitClient returns who a request is counted against: the API user or
+// key it authenticated as, or its IP address.
+func rateLimitClient(r *http.Request, user *APIUser) string {
+	if user != nil && user.Name != "anonymous" {
+		return "user:" + user.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimited returns true, and counts the rejection, if the client has made
+// too many requests of the method's class.
+func rateLimited(state interfaces.IState, r *http.Request, user *APIUser, endpoint, method string) bool {
+	rl, err := getRateLimiter(state)
+	if err != nil {
+		return false
+	}
+	class := MethodRateClass(endpoint, method)
+	if rl.Allow(rateLimitClient(r, user), class) {
+		return false
+	}
+	RateLimitRejections.WithLabelValues(class).Inc()
+	return true
+}
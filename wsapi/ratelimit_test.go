@@ -0,0 +1,108 @@
+package wsapi_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/factomd/testHelper"
+	"github.com/FactomProject/factomd/util"
+	. "github.com/FactomProject/factomd/wsapi"
+)
+
+func TestMethodRateClass(t *testing.T) {
+	classes := map[string]string{
+		"commit-entry":   RateClassSubmit,
+		"reveal-entry":   RateClassSubmit,
+		"factoid-submit": RateClassSubmit,
+		"raw-data":       RateClassData,
+		"get-raw-data":   RateClassData,
+		"search-entries": RateClassData,
+		"heights":        RateClassGeneral,
+		"properties":     RateClassGeneral,
+	}
+	for method, class := range classes {
+		if c := MethodRateClass(EndpointV2, method); c != class {
+			t.Errorf("%v is in class %v, expected %v", method, c, class)
+		}
+	}
+	if c := MethodRateClass(EndpointDebug, "holding-queue"); c != RateClassDebug {
+		t.Errorf("Debug method is in class %v", c)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	cfg := new(util.FactomdConfig)
+	cfg.App.ApiRateLimits = []string{"submit:0.001:3", "data:1000:1"}
+	state.Cfg = cfg
+
+	rl, err := NewRateLimiter(state)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if !rl.Allow("ip:1.2.3.4", RateClassSubmit) {
+			t.Errorf("Request %v within the burst was refused", i)
+		}
+	}
+	if rl.Allow("ip:1.2.3.4", RateClassSubmit) {
+		t.Errorf("Request over the burst was allowed")
+	}
+	if !rl.Allow("ip:5.6.7.8", RateClassSubmit) {
+		t.Errorf("Another client was limited")
+	}
+	for i := 0; i < 100; i++ {
+		if !rl.Allow("ip:1.2.3.4", RateClassGeneral) {
+			t.Fatalf("Class without a limit was limited")
+		}
+	}
+
+	if !rl.Allow("ip:1.2.3.4", RateClassData) {
+		t.Errorf("First request was refused")
+	}
+	if rl.Allow("ip:1.2.3.4", RateClassData) {
+		t.Errorf("Request over the burst was allowed")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if !rl.Allow("ip:1.2.3.4", RateClassData) {
+		t.Errorf("Bucket didn't refill")
+	}
+}
+
+func TestRateLimiterChurn(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	cfg := new(util.FactomdConfig)
+	cfg.App.ApiRateLimits = []string{"submit:0.001:1"}
+	state.Cfg = cfg
+
+	rl, err := NewRateLimiter(state)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// Every client empties its bucket, so none fill up again, and the
+	// least recently used go instead
+	for i := 0; i < 25000; i++ {
+		rl.Allow(fmt.Sprintf("ip:%v", i), RateClassSubmit)
+	}
+	if n := rl.Clients(); n > 10000 {
+		t.Errorf("Rate limiter holds %v clients", n)
+	}
+	if rl.Allow("ip:24999", RateClassSubmit) {
+		t.Errorf("Recent client's bucket was dropped")
+	}
+}
+
+func TestRateLimiterBadConfig(t *testing.T) {
+	state := testHelper.CreateEmptyTestState()
+	for _, l := range []string{"submit", "everything:10", "submit:0", "submit:ten", "submit:10:0", "submit:1:2:3"} {
+		cfg := new(util.FactomdConfig)
+		cfg.App.ApiRateLimits = []string{l}
+		state.Cfg = cfg
+		_, err := NewRateLimiter(state)
+		if err == nil {
+			t.Errorf("Bad rate limit %q was accepted", l)
+		}
+	}
+}
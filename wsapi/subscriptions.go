@@ -0,0 +1,401 @@
+// Copyright 2017 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package wsapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/messages"
+	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/web"
+)
+
+// Subscriptions stream events to clients as server-sent events on
+// /v2/subscribe.  A client picks the topics it wants with one or more topic
+// parameters, each optionally followed by a filter:
+//
+//   /v2/subscribe?topic=dblock
+//   /v2/subscribe?topic=entry:<chainid>
+//   /v2/subscribe?topic=factoid-transaction:<FA or EC address>
+//   /v2/subscribe?topic=ack:<entry hash, txid or message hash>
+//
+// Without a filter, every event of the topic is sent.  Events are fed by the
+// state as it saves directory blocks and as it adds acks to the process list.
+
+const (
+	SubscribeTopicDBlock             = "dblock"
+	SubscribeTopicEntry              = "entry"
+	SubscribeTopicFactoidTransaction = "factoid-transaction"
+	SubscribeTopicAck                = "ack"
+
+	// Maximum number of clients streaming events at once.
+	MaxSubscribers = 100
+	// Events queued for a client before it is considered too slow and dropped.
+	SubscriberQueueSize = 1000
+	// How often an idle stream gets a comment, so proxies keep it open.
+	SubscriberKeepAlive = 30 * time.Second
+)
+
+type SubscriptionEvent struct {
+	Topic string      `json:"topic"`
+	Data  interface{} `json:"data"`
+
+	node string   // Name of the node the event comes from
+	keys []string // What topic filters match this event
+}
+
+type DBlockEvent struct {
+	Height    uint32 `json:"height"`
+	KeyMR     string `json:"keymr"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type EntryEvent struct {
+	ChainID     string `json:"chainid"`
+	EntryHash   string `json:"entryhash"`
+	EBlockKeyMR string `json:"eblockkeymr"`
+	Height      uint32 `json:"dbheight"`
+}
+
+type FactoidTransactionEvent struct {
+	TxID      string   `json:"txid"`
+	Height    uint32   `json:"dbheight"`
+	Inputs    []string `json:"inputs"`
+	Outputs   []string `json:"outputs"`
+	ECOutputs []string `json:"outecs"`
+}
+
+type AckEvent struct {
+	Hash      string `json:"hash"`
+	EntryHash string `json:"entryhash,omitempty"`
+	TxID      string `json:"txid,omitempty"`
+	Status    string `json:"status"`
+	Height    uint32 `json:"dbheight"`
+}
+
+type Subscriber struct {
+	node    string
+	topics  map[string]map[string]bool // topic -> filters; empty means everything
+	events  chan *SubscriptionEvent
+	dropped bool
+}
+
+// Events is where the subscriber receives its events.  It is closed when the
+// subscriber is dropped or unsubscribed.
+func (s *Subscriber) Events() <-chan *SubscriptionEvent {
+	return s.events
+}
+
+func (s *Subscriber) wants(e *SubscriptionEvent) bool {
+	if s.node != e.node {
+		return false
+	}
+	filters, ok := s.topics[e.Topic]
+	if !ok {
+		return false
+	}
+	if len(filters) == 0 {
+		return true
+	}
+	for _, k := range e.keys {
+		if filters[k] {
+			return true
+		}
+	}
+	return false
+}
+
+type SubscriptionHub struct {
+	mutex       sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+}
+
+var Subscriptions = NewSubscriptionHub()
+
+func NewSubscriptionHub() *SubscriptionHub {
+	h := new(SubscriptionHub)
+	h.subscribers = make(map[*Subscriber]struct{})
+	return h
+}
+
+// Subscribe registers a new subscriber to events of the given node.  topics
+// maps each topic to the filters wanted for it.
+func (h *SubscriptionHub) Subscribe(node string, topics map[string]map[string]bool) (*Subscriber, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.subscribers) >= MaxSubscribers {
+		return nil, fmt.Errorf("Too many subscribers")
+	}
+	s := new(Subscriber)
+	s.node = node
+	s.topics = topics
+	s.events = make(chan *SubscriptionEvent, SubscriberQueueSize)
+	h.subscribers[s] = struct{}{}
+	return s, nil
+}
+
+func (h *SubscriptionHub) Unsubscribe(s *Subscriber) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		if !s.dropped {
+			close(s.events)
+		}
+	}
+}
+
+// Active is true if anyone is listening.  Publishers use it to avoid building
+// events nobody will read.
+func (h *SubscriptionHub) Active() bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.subscribers) > 0
+}
+
+// Publish hands the events to the interested subscribers.  It never blocks;
+// a subscriber that can't keep up is disconnected.
+func (h *SubscriptionHub) Publish(events ...*SubscriptionEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for s := range h.subscribers {
+		for _, e := range events {
+			if s.dropped || !s.wants(e) {
+				continue
+			}
+			select {
+			case s.events <- e:
+			default:
+				s.dropped = true
+				close(s.events)
+			}
+		}
+	}
+}
+
+// PublishSavedBlocks is called by the state once the blocks for a directory
+// block height have been written to the database.
+func PublishSavedBlocks(node string, dblock interfaces.IDirectoryBlock, fblock interfaces.IFBlock, eblocks []interfaces.IEntryBlock) {
+	if !Subscriptions.Active() || dblock == nil {
+		return
+	}
+	height := dblock.GetDatabaseHeight()
+
+	var events []*SubscriptionEvent
+
+	d := new(DBlockEvent)
+	d.Height = height
+	d.KeyMR = dblock.GetKeyMR().String()
+	d.Timestamp = dblock.GetTimestamp().GetTimeSeconds()
+	events = append(events, newSubscriptionEvent(node, SubscribeTopicDBlock, d))
+
+	for _, eb := range eblocks {
+		keymr, err := eb.KeyMR()
+		if err != nil {
+			continue
+		}
+		chainID := eb.GetChainID().String()
+		for _, h := range eb.GetEntryHashes() {
+			if h.IsMinuteMarker() {
+				continue
+			}
+			e := new(EntryEvent)
+			e.ChainID = chainID
+			e.EntryHash = h.String()
+			e.EBlockKeyMR = keymr.String()
+			e.Height = height
+			events = append(events, newSubscriptionEvent(node, SubscribeTopicEntry, e, chainID))
+
+			a := new(AckEvent)
+			a.Hash = h.String()
+			a.EntryHash = h.String()
+			a.Status = AckStatusDBlockConfirmed
+			a.Height = height
+			events = append(events, newSubscriptionEvent(node, SubscribeTopicAck, a, a.Hash))
+		}
+	}
+
+	if fblock != nil {
+		for _, tx := range fblock.GetTransactions() {
+			t := new(FactoidTransactionEvent)
+			t.TxID = tx.GetSigHash().String()
+			t.Height = height
+			var keys []string
+			for _, in := range tx.GetInputs() {
+				adr := primitives.ConvertFctAddressToUserStr(in.GetAddress())
+				t.Inputs = append(t.Inputs, adr)
+				keys = append(keys, adr)
+			}
+			for _, out := range tx.GetOutputs() {
+				adr := primitives.ConvertFctAddressToUserStr(out.GetAddress())
+				t.Outputs = append(t.Outputs, adr)
+				keys = append(keys, adr)
+			}
+			for _, out := range tx.GetECOutputs() {
+				adr := primitives.ConvertECAddressToUserStr(out.GetAddress())
+				t.ECOutputs = append(t.ECOutputs, adr)
+				keys = append(keys, adr)
+			}
+			events = append(events, newSubscriptionEvent(node, SubscribeTopicFactoidTransaction, t, keys...))
+
+			a := new(AckEvent)
+			a.Hash = t.TxID
+			a.TxID = t.TxID
+			a.Status = AckStatusDBlockConfirmed
+			a.Height = height
+			events = append(events, newSubscriptionEvent(node, SubscribeTopicAck, a, a.Hash))
+		}
+	}
+
+	Subscriptions.Publish(events...)
+}
+
+// PublishAck is called by the state when a message is acknowledged and added
+// to the process list.  Only messages a client could be waiting on (commits,
+// reveals and factoid transactions) are published.
+func PublishAck(node string, dbheight uint32, msg interfaces.IMsg) {
+	if !Subscriptions.Active() || msg == nil {
+		return
+	}
+
+	a := new(AckEvent)
+	a.Hash = msg.GetMsgHash().String()
+	a.Status = AckStatusACK
+	a.Height = dbheight
+
+	switch m := msg.(type) {
+	case *messages.RevealEntryMsg:
+		a.EntryHash = m.Entry.GetHash().String()
+	case *messages.CommitEntryMsg:
+		a.EntryHash = m.CommitEntry.EntryHash.String()
+	case *messages.CommitChainMsg:
+		a.EntryHash = m.CommitChain.EntryHash.String()
+	case *messages.FactoidTransaction:
+		a.TxID = m.Transaction.GetSigHash().String()
+	default:
+		return
+	}
+
+	keys := []string{a.Hash}
+	if a.EntryHash != "" {
+		keys = append(keys, a.EntryHash)
+	}
+	if a.TxID != "" {
+		keys = append(keys, a.TxID)
+	}
+	Subscriptions.Publish(newSubscriptionEvent(node, SubscribeTopicAck, a, keys...))
+}
+
+func newSubscriptionEvent(node, topic string, data interface{}, keys ...string) *SubscriptionEvent {
+	e := new(SubscriptionEvent)
+	e.Topic = topic
+	e.Data = data
+	e.node = node
+	e.keys = keys
+	return e
+}
+
+// ParseSubscriptionTopics reads the topic parameters of a subscribe request.
+func ParseSubscriptionTopics(params []string) (map[string]map[string]bool, error) {
+	topics := make(map[string]map[string]bool)
+	for _, p := range params {
+		parts := strings.SplitN(p, ":", 2)
+		switch parts[0] {
+		case SubscribeTopicDBlock, SubscribeTopicEntry, SubscribeTopicFactoidTransaction, SubscribeTopicAck:
+		default:
+			return nil, fmt.Errorf("Unknown topic %q", parts[0])
+		}
+		filters, ok := topics[parts[0]]
+		if !ok {
+			filters = make(map[string]bool)
+			topics[parts[0]] = filters
+		}
+		if len(parts) == 2 && parts[1] != "" {
+			filters[parts[1]] = true
+		}
+	}
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("No topic given")
+	}
+	return topics, nil
+}
+
+func HandleSubscribe(ctx *web.Context) {
+	ServersMutex.Lock()
+	state := ctx.Server.Env["state"].(interfaces.IState)
+	ServersMutex.Unlock()
+
+	if err := checkAuthHeader(state, ctx.Request); err != nil {
+		remoteIP := ""
+		remoteIP += strings.Split(ctx.Request.RemoteAddr, ":")[0]
+		fmt.Printf("Unauthorized subscription attempt from %s\n", remoteIP)
+		ctx.ResponseWriter.Header().Add("WWW-Authenticate", `Basic realm="factomd RPC"`)
+		http.Error(ctx.ResponseWriter, "401 Unauthorized.", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := ctx.ResponseWriter.(http.Flusher)
+	if !ok {
+		http.Error(ctx.ResponseWriter, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	topics, err := ParseSubscriptionTopics(ctx.Request.URL.Query()["topic"])
+	if err != nil {
+		http.Error(ctx.ResponseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sub, err := Subscriptions.Subscribe(state.GetFactomNodeName(), topics)
+	if err != nil {
+		http.Error(ctx.ResponseWriter, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer Subscriptions.Unsubscribe(sub)
+
+	ctx.SetHeader("Content-Type", "text/event-stream", true)
+	ctx.SetHeader("Cache-Control", "no-cache", true)
+	ctx.SetHeader("Connection", "keep-alive", true)
+	ctx.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(SubscriberKeepAlive)
+	defer keepAlive.Stop()
+
+	done := ctx.Request.Context().Done()
+	for {
+		select {
+		case <-done:
+			return
+		case <-keepAlive.C:
+			if _, err := ctx.Write([]byte(": keepalive\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e, ok := <-sub.events:
+			if !ok {
+				// We were too slow, and got dropped.
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err := ctx.Write([]byte(fmt.Sprintf("event: %s\ndata: %s\n\n", e.Topic, data))); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package wsapi_test
+
+import (
+	"testing"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/testHelper"
+	. "github.com/FactomProject/factomd/wsapi"
+)
+
+func TestParseSubscriptionTopics(t *testing.T) {
+	topics, err := ParseSubscriptionTopics([]string{"dblock", "entry:abc", "entry:def", "ack:"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(topics) != 3 {
+		t.Errorf("Wrong number of topics - %v", len(topics))
+	}
+	if len(topics[SubscribeTopicDBlock]) != 0 || len(topics[SubscribeTopicAck]) != 0 {
+		t.Errorf("Unexpected filters - %v", topics)
+	}
+	if !topics[SubscribeTopicEntry]["abc"] || !topics[SubscribeTopicEntry]["def"] {
+		t.Errorf("Missing entry filters - %v", topics[SubscribeTopicEntry])
+	}
+
+	_, err = ParseSubscriptionTopics([]string{"blocks"})
+	if err == nil {
+		t.Errorf("Unknown topic was accepted")
+	}
+	_, err = ParseSubscriptionTopics(nil)
+	if err == nil {
+		t.Errorf("Empty topic list was accepted")
+	}
+}
+
+func TestSubscriptionHub(t *testing.T) {
+	blockSet := testHelper.CreateTestBlockSet(nil)
+	eblocks := []interfaces.IEntryBlock{blockSet.EBlock, blockSet.AnchorEBlock}
+	chainID := blockSet.EBlock.GetChainID().String()
+
+	all, err := Subscriptions.Subscribe("node0", map[string]map[string]bool{SubscribeTopicDBlock: {}})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	entries, err := Subscriptions.Subscribe("node0", map[string]map[string]bool{SubscribeTopicEntry: {chainID: true}})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	other, err := Subscriptions.Subscribe("node1", map[string]map[string]bool{SubscribeTopicDBlock: {}})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	PublishSavedBlocks("node0", blockSet.DBlock, blockSet.FBlock, eblocks)
+
+	Subscriptions.Unsubscribe(all)
+	Subscriptions.Unsubscribe(entries)
+	Subscriptions.Unsubscribe(other)
+	if Subscriptions.Active() {
+		t.Errorf("Hub still active after everyone unsubscribed")
+	}
+
+	cnt := 0
+	for e := range all.Events() {
+		d, ok := e.Data.(*DBlockEvent)
+		if !ok {
+			t.Errorf("Wrong event data - %T", e.Data)
+			continue
+		}
+		if d.Height != blockSet.DBlock.GetDatabaseHeight() {
+			t.Errorf("Wrong height - %v vs %v", d.Height, blockSet.DBlock.GetDatabaseHeight())
+		}
+		cnt++
+	}
+	if cnt != 1 {
+		t.Errorf("Expected 1 dblock event, got %v", cnt)
+	}
+
+	cnt = 0
+	for e := range entries.Events() {
+		d, ok := e.Data.(*EntryEvent)
+		if !ok {
+			t.Errorf("Wrong event data - %T", e.Data)
+			continue
+		}
+		if d.ChainID != chainID {
+			t.Errorf("Event for unwanted chain %v", d.ChainID)
+		}
+		cnt++
+	}
+	want := 0
+	for _, h := range blockSet.EBlock.GetEntryHashes() {
+		if !h.IsMinuteMarker() {
+			want++
+		}
+	}
+	if cnt != want {
+		t.Errorf("Expected %v entry events, got %v", want, cnt)
+	}
+
+	for e := range other.Events() {
+		t.Errorf("Got event from another node - %v", e.Topic)
+	}
+}
@@ -5,12 +5,9 @@
 package wsapi
 
 import (
-	"crypto/sha256"
-	"crypto/subtle"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -45,11 +42,12 @@ func Start(state interfaces.IState) {
 		Servers = make(map[int]*web.Server)
 	}
 
-	rpcUser := state.GetRpcUser()
-	rpcPass := state.GetRpcPass()
-	h := sha256.New()
-	h.Write(httpBasicAuth(rpcUser, rpcPass))
-	state.SetRpcAuthHash(h.Sum(nil)) //set this in the beginning to prevent timing attacks
+	if err := SetAccessControl(state); err != nil {
+		panic(fmt.Sprintf("could not set up API access control with error: %v", err))
+	}
+	if err := SetRateLimiter(state); err != nil {
+		panic(fmt.Sprintf("could not set up API rate limits with error: %v", err))
+	}
 
 	if Servers[state.GetPort()] == nil {
 		server = web.NewServer()
@@ -85,6 +83,7 @@ func Start(state interfaces.IState) {
 
 		server.Post("/v2", HandleV2)
 		server.Get("/v2", HandleV2)
+		server.Get("/v2/subscribe/?", HandleSubscribe)
 
 		// start the debugging api if we are not on the main network
 		if state.GetNetworkName() != "MAIN" {
@@ -846,32 +845,16 @@ func httpBasicAuth(username, password string) []byte {
 	return output
 }
 
+// checkAuthHeader makes sure the request comes from a known API user, or
+// that the API lets anyone in.  The role of the user is checked per method.
 func checkAuthHeader(state interfaces.IState, r *http.Request) error {
-	if "" == state.GetRpcUser() {
-		//no username was specified in the config file or command line, meaning factomd API is open access
-		return nil
-	}
-
-	authhdr := r.Header["Authorization"]
-	if len(authhdr) == 0 {
-		return errors.New("no auth")
-	}
-
-	correctAuth := state.GetRpcAuthHash()
-
-	h := sha256.New()
-	h.Write([]byte(authhdr[0]))
-	presentedPassHash := h.Sum(nil)
-
-	cmp := subtle.ConstantTimeCompare(presentedPassHash, correctAuth) //compare hashes because ConstantTimeCompare takes a constant time based on the slice size.  hashing gives a constant slice size.
-	if cmp != 1 {
-		return errors.New("bad auth")
-	}
-	return nil
+	_, err := authenticateRequest(state, r)
+	return err
 }
 
 func checkHttpPasswordOkV1(state interfaces.IState, ctx *web.Context) bool {
-	if err := checkAuthHeader(state, ctx.Request); err != nil {
+	user, err := authenticateRequest(state, ctx.Request)
+	if err != nil {
 		remoteIP := ""
 		remoteIP += strings.Split(ctx.Request.RemoteAddr, ":")[0]
 		fmt.Printf("Unauthorized V1 API client connection attempt from %s\n", remoteIP)
@@ -879,6 +862,17 @@ func checkHttpPasswordOkV1(state interfaces.IState, ctx *web.Context) bool {
 		http.Error(ctx.ResponseWriter, "401 Unauthorized.", http.StatusUnauthorized)
 		return false
 	}
+	if ctx.Request != nil && ctx.Request.URL != nil {
+		// The v1 method is the first part of the path after /v1/
+		method := ""
+		if parts := strings.Split(ctx.Request.URL.Path, "/"); len(parts) > 2 {
+			method = parts[2]
+		}
+		if rateLimited(state, ctx.Request, user, EndpointV2, method) {
+			http.Error(ctx.ResponseWriter, "429 Too Many Requests.", http.StatusTooManyRequests)
+			return false
+		}
+	}
 	return true
 }
 
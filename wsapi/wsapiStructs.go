@@ -231,6 +231,48 @@ type BlockHeightResponse struct {
 	RawData string   `json:"rawdata,omitempty"`
 }
 
+type BalanceAtHeightResponse struct {
+	Balance int64 `json:"balance"`
+	Height  int64 `json:"height"`
+}
+
+type AddressTransactionsResponse struct {
+	Transactions []AddressTransactionResponse `json:"transactions"`
+	Total        int64                        `json:"total"`
+	// Where the next page starts, if there are more
+	NextStart int64 `json:"nextstart,omitempty"`
+}
+
+type AddressTransactionResponse struct {
+	TxID     string `json:"txid"`
+	DBHeight int64  `json:"dbheight"`
+}
+
+type SearchEntriesResponse struct {
+	Entries []SearchEntriesMatch `json:"entries"`
+	// Pass it back to get the next page, empty once the search is done
+	NextCursor string `json:"nextcursor,omitempty"`
+}
+
+type SearchEntriesMatch struct {
+	ChainID   string `json:"chainid"`
+	EntryHash string `json:"entryhash"`
+}
+
+type BlockHeightRangeResponse struct {
+	Blocks []*BlockHeightRangeItem `json:"blocks"`
+	// Pass it back to get the next page, empty once the range is done
+	NextCursor string `json:"nextcursor,omitempty"`
+}
+
+type BlockHeightRangeItem struct {
+	Height int64 `json:"height"`
+	// Same as what the single height call returns
+	Block   interface{} `json:"block"`
+	EBlocks []*JStruct  `json:"eblocks,omitempty"`
+	Entries []*JStruct  `json:"entries,omitempty"`
+}
+
 //Requests
 
 type AddressRequest struct {
@@ -241,6 +283,33 @@ type HeightRequest struct {
 	Height int64 `json:"height"`
 }
 
+type BalanceAtHeightRequest struct {
+	Address string `json:"address"`
+	Height  int64  `json:"height"`
+}
+
+type AddressTransactionsRequest struct {
+	Address string `json:"address"`
+	Start   int64  `json:"start"`
+	Count   int64  `json:"count"`
+}
+
+type SearchEntriesRequest struct {
+	// Hex encoded ExtID prefix
+	ExtID   string `json:"extid"`
+	ChainID string `json:"chainid,omitempty"`
+	Cursor  string `json:"cursor,omitempty"`
+	Count   int64  `json:"count"`
+}
+
+type HeightRangeRequest struct {
+	Start          int64  `json:"start"`
+	Count          int64  `json:"count"`
+	Cursor         string `json:"cursor,omitempty"`
+	IncludeEBlocks bool   `json:"includeeblocks,omitempty"`
+	IncludeEntries bool   `json:"includeentries,omitempty"`
+}
+
 type ChainIDRequest struct {
 	ChainID string `json:"chainid"`
 }
@@ -253,6 +322,13 @@ type HashRequest struct {
 	Hash string `json:"hash"`
 }
 
+// ReceiptRequest asks for a receipt of an entry, the default, or of a factoid
+// or entrycredit transaction
+type ReceiptRequest struct {
+	Hash string `json:"hash"`
+	Type string `json:"type,omitempty"`
+}
+
 type KeyMRRequest struct {
 	KeyMR string `json:"keymr"`
 }
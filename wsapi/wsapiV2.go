@@ -5,6 +5,7 @@
 package wsapi
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -21,6 +22,7 @@ import (
 	"github.com/FactomProject/factomd/common/interfaces"
 	"github.com/FactomProject/factomd/common/messages"
 	"github.com/FactomProject/factomd/common/primitives"
+	"github.com/FactomProject/factomd/database/databaseOverlay"
 	"github.com/FactomProject/factomd/receipts"
 	"github.com/FactomProject/web"
 )
@@ -34,7 +36,8 @@ func HandleV2(ctx *web.Context) {
 	state := ctx.Server.Env["state"].(interfaces.IState)
 	ServersMutex.Unlock()
 
-	if err := checkAuthHeader(state, ctx.Request); err != nil {
+	user, err := authenticateRequest(state, ctx.Request)
+	if err != nil {
 		remoteIP := ""
 		remoteIP += strings.Split(ctx.Request.RemoteAddr, ":")[0]
 		fmt.Printf("Unauthorized V2 API client connection attempt from %s\n", remoteIP)
@@ -50,13 +53,18 @@ func HandleV2(ctx *web.Context) {
 		return
 	}
 
+	if isBatchRequest(body) {
+		handleBatch(ctx, state, user, body, callV2)
+		return
+	}
+
 	j, err := primitives.ParseJSON2Request(string(body))
 	if err != nil {
 		HandleV2Error(ctx, nil, NewInvalidRequestError())
 		return
 	}
 
-	jsonResp, jsonError := HandleV2Request(state, j)
+	jsonResp, jsonError := callV2(state, ctx.Request, user, j)
 
 	if jsonError != nil {
 		HandleV2Error(ctx, j, jsonError)
@@ -66,6 +74,17 @@ func HandleV2(ctx *web.Context) {
 	ctx.Write([]byte(jsonResp.String()))
 }
 
+// callV2 makes a v2 API call for the user, if the user may make it.
+func callV2(state interfaces.IState, r *http.Request, user *APIUser, j *primitives.JSON2Request) (*primitives.JSON2Response, *primitives.JSONError) {
+	if !methodAllowed(state, EndpointV2, j.Method, user) {
+		return nil, NewMethodNotAllowedError()
+	}
+	if rateLimited(state, r, user, EndpointV2, j.Method) {
+		return nil, NewRateLimitedError()
+	}
+	return HandleV2Request(state, j)
+}
+
 func HandleV2Request(state interfaces.IState, j *primitives.JSON2Request) (*primitives.JSON2Response, *primitives.JSONError) {
 	var resp interface{}
 	var jsonError *primitives.JSONError
@@ -164,6 +183,27 @@ func HandleV2Request(state interfaces.IState, j *primitives.JSON2Request) (*prim
 	case "ablock-by-height":
 		resp, jsonError = HandleV2ABlockByHeight(state, params)
 		break
+	case "dblocks-by-height-range":
+		resp, jsonError = HandleV2BlocksByHeightRange(state, params, "d")
+		break
+	case "ecblocks-by-height-range":
+		resp, jsonError = HandleV2BlocksByHeightRange(state, params, "ec")
+		break
+	case "fblocks-by-height-range":
+		resp, jsonError = HandleV2BlocksByHeightRange(state, params, "f")
+		break
+	case "ablocks-by-height-range":
+		resp, jsonError = HandleV2BlocksByHeightRange(state, params, "a")
+		break
+	case "address-transactions":
+		resp, jsonError = HandleV2AddressTransactions(state, params)
+		break
+	case "balance-at-height":
+		resp, jsonError = HandleV2BalanceAtHeight(state, params)
+		break
+	case "search-entries":
+		resp, jsonError = HandleV2SearchEntries(state, params)
+		break
 	case "authorities":
 		resp, jsonError = HandleAuthorities(state, params)
 	case "tps-rate":
@@ -206,6 +246,10 @@ func HandleV2DBlockByHeight(state interfaces.IState, params interface{}) (interf
 		return nil, NewBlockNotFoundError()
 	}
 
+	return dBlockToResp(block)
+}
+
+func dBlockToResp(block interfaces.IDirectoryBlock) (interface{}, *primitives.JSONError) {
 	raw, err := block.MarshalBinary()
 	if err != nil {
 		return nil, NewInternalError()
@@ -483,6 +527,187 @@ func aBlockToResp(block interfaces.IAdminBlock) (interface{}, *primitives.JSONEr
 	return resp, nil
 }
 
+// Most blocks returned by one range call.  Pages with entries are smaller, as
+// a single block set can hold thousands of them.
+const (
+	MaxHeightRangeCount        = 100
+	MaxHeightRangeEntriesCount = 10
+)
+
+type blockSetFetcher interface {
+	FetchBlockSetByHeight(dbheight uint32) (*databaseOverlay.BlockSet, error)
+	FetchBlockSetByHeightWithEntries(dbheight uint32) (*databaseOverlay.BlockSet, error)
+}
+
+// HandleV2BlocksByHeightRange returns the blocks of the given type ("d", "ec",
+// "f" or "a") for count heights from start, a page at a time.  A page that
+// doesn't finish the range comes with a cursor to pass back for the next one.
+func HandleV2BlocksByHeightRange(state interfaces.IState, params interface{}, blockType string) (interface{}, *primitives.JSONError) {
+	n := time.Now()
+	defer HandleV2APICallBlocksByHeightRange.Observe(float64(time.Since(n).Nanoseconds()))
+
+	rangeRequest := new(HeightRangeRequest)
+	err := MapToObject(params, rangeRequest)
+	if err != nil {
+		return nil, NewInvalidParamsError()
+	}
+
+	start, end := rangeRequest.Start, rangeRequest.Start+rangeRequest.Count
+	if rangeRequest.Cursor != "" {
+		start, end, err = decodeHeightRangeCursor(rangeRequest.Cursor)
+		if err != nil {
+			return nil, NewCustomInvalidParamsError("Invalid cursor")
+		}
+	}
+	if start < 0 || end <= start {
+		return nil, NewCustomInvalidParamsError("Invalid height range")
+	}
+
+	pageEnd := end
+	max := int64(MaxHeightRangeCount)
+	if rangeRequest.IncludeEntries {
+		max = MaxHeightRangeEntriesCount
+	}
+	if pageEnd-start > max {
+		pageEnd = start + max
+	}
+
+	dbase := state.GetAndLockDB()
+	defer state.UnlockDB()
+
+	fetcher, ok := dbase.(blockSetFetcher)
+	if !ok {
+		return nil, NewInternalDatabaseError()
+	}
+
+	keyMRs, err := dbase.FetchDBlockHeightRange(start, pageEnd)
+	if err != nil {
+		return nil, NewInternalDatabaseError()
+	}
+	// A cursor can point just past the top of the chain, which ends the range
+	if len(keyMRs) == 0 && rangeRequest.Cursor == "" {
+		return nil, NewBlockNotFoundError()
+	}
+
+	resp := new(BlockHeightRangeResponse)
+	resp.Blocks = []*BlockHeightRangeItem{}
+	for i := range keyMRs {
+		height := start + int64(i)
+
+		var bs *databaseOverlay.BlockSet
+		if rangeRequest.IncludeEntries {
+			bs, err = fetcher.FetchBlockSetByHeightWithEntries(uint32(height))
+		} else {
+			bs, err = fetcher.FetchBlockSetByHeight(uint32(height))
+		}
+		if err != nil {
+			return nil, NewInternalDatabaseError()
+		}
+		if bs == nil {
+			return nil, NewBlockNotFoundError()
+		}
+
+		item, jerr := blockSetToRangeItem(bs, blockType, rangeRequest.IncludeEBlocks, rangeRequest.IncludeEntries)
+		if jerr != nil {
+			return nil, jerr
+		}
+		item.Height = height
+		resp.Blocks = append(resp.Blocks, item)
+	}
+
+	// Stop early once we hit the top of the chain
+	if pageEnd < end && int64(len(keyMRs)) == pageEnd-start {
+		resp.NextCursor = encodeHeightRangeCursor(pageEnd, end)
+	}
+
+	return resp, nil
+}
+
+func blockSetToRangeItem(bs *databaseOverlay.BlockSet, blockType string, eblocks, entries bool) (*BlockHeightRangeItem, *primitives.JSONError) {
+	item := new(BlockHeightRangeItem)
+
+	var jerr *primitives.JSONError
+	switch blockType {
+	case "d":
+		item.Block, jerr = dBlockToResp(bs.DBlock)
+	case "ec":
+		if bs.ECBlock == nil {
+			return nil, NewBlockNotFoundError()
+		}
+		item.Block, jerr = ECBlockToResp(bs.ECBlock)
+	case "f":
+		if bs.FBlock == nil {
+			return nil, NewBlockNotFoundError()
+		}
+		item.Block, jerr = fBlockToResp(bs.FBlock)
+	case "a":
+		if bs.ABlock == nil {
+			return nil, NewBlockNotFoundError()
+		}
+		item.Block, jerr = aBlockToResp(bs.ABlock)
+	default:
+		return nil, NewInternalError()
+	}
+	if jerr != nil {
+		return nil, jerr
+	}
+
+	if eblocks {
+		for _, eb := range bs.EBlocks {
+			if eb == nil {
+				continue
+			}
+			b, err := ObjectToJStruct(eb)
+			if err != nil {
+				return nil, NewInternalError()
+			}
+			item.EBlocks = append(item.EBlocks, b)
+		}
+	}
+	if entries {
+		for _, e := range bs.Entries {
+			if e == nil {
+				continue
+			}
+			b, err := ObjectToJStruct(e)
+			if err != nil {
+				return nil, NewInternalError()
+			}
+			item.Entries = append(item.Entries, b)
+		}
+	}
+
+	return item, nil
+}
+
+// The cursor holds the next height to fetch and the end of the range.
+func encodeHeightRangeCursor(next, end int64) string {
+	buf := new(primitives.Buffer)
+	buf.PushInt64(next)
+	buf.PushInt64(end)
+	return hex.EncodeToString(buf.DeepCopyBytes())
+}
+
+func decodeHeightRangeCursor(cursor string) (int64, int64, error) {
+	data, err := hex.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, err
+	}
+	buf := primitives.NewBuffer(data)
+	next, err := buf.PopInt64()
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := buf.PopInt64()
+	if err != nil {
+		return 0, 0, err
+	}
+	if buf.Len() != 0 {
+		return 0, 0, fmt.Errorf("%v bytes left over in cursor", buf.Len())
+	}
+	return next, end, nil
+}
+
 func HandleV2Error(ctx *web.Context, j *primitives.JSON2Request, err *primitives.JSONError) {
 	resp := primitives.NewJSON2Response()
 	if j != nil {
@@ -730,21 +955,27 @@ func HandleV2Receipt(state interfaces.IState, params interface{}) (interface{},
 	n := time.Now()
 	defer HandleV2APICallReceipt.Observe(float64(time.Since(n).Nanoseconds()))
 
-	hashkey := new(HashRequest)
-	err := MapToObject(params, hashkey)
+	request := new(ReceiptRequest)
+	err := MapToObject(params, request)
 	if err != nil {
 		return nil, NewInvalidParamsError()
 	}
 
-	h, err := primitives.HexToHash(hashkey.Hash)
+	h, err := primitives.HexToHash(request.Hash)
 	if err != nil {
 		return nil, NewInvalidHashError()
 	}
 
+	switch request.Type {
+	case "", receipts.ReceiptTypeEntry, receipts.ReceiptTypeFactoid, receipts.ReceiptTypeEntryCredit:
+	default:
+		return nil, NewInvalidParamsError()
+	}
+
 	dbase := state.GetAndLockDB()
 	defer state.UnlockDB()
 
-	receipt, err := receipts.CreateFullReceipt(dbase, h)
+	receipt, err := receipts.CreateReceiptByType(dbase, request.Type, h)
 	if err != nil {
 		return nil, NewReceiptError()
 	}
@@ -1084,6 +1315,198 @@ func HandleV2FactoidBalance(state interfaces.IState, params interface{}) (interf
 	return resp, nil
 }
 
+// Most transactions returned by one address-transactions call
+const MaxAddressTransactionsCount = 100
+
+type addressTransactionFetcher interface {
+	FetchAddressTransactions(address interfaces.IHash, start, limit uint32) ([]*databaseOverlay.AddressTransaction, uint32, error)
+}
+
+// HandleV2AddressTransactions lists the transactions that touched an FCT or
+// EC address, oldest first, a page at a time.  It needs the address index to
+// be enabled in the config.
+func HandleV2AddressTransactions(state interfaces.IState, params interface{}) (interface{}, *primitives.JSONError) {
+	n := time.Now()
+	defer HandleV2APICallAddressTransactions.Observe(float64(time.Since(n).Nanoseconds()))
+
+	req := new(AddressTransactionsRequest)
+	err := MapToObject(params, req)
+	if err != nil {
+		return nil, NewInvalidParamsError()
+	}
+	if req.Start < 0 || req.Count < 0 {
+		return nil, NewInvalidParamsError()
+	}
+	if req.Count == 0 || req.Count > MaxAddressTransactionsCount {
+		req.Count = MaxAddressTransactionsCount
+	}
+
+	var adr []byte
+	if primitives.ValidateFUserStr(req.Address) || primitives.ValidateECUserStr(req.Address) {
+		adr = primitives.ConvertUserStrToAddress(req.Address)
+	} else {
+		adr, err = hex.DecodeString(req.Address)
+		if err != nil {
+			return nil, NewInvalidAddressError()
+		}
+	}
+	if len(adr) != constants.HASH_LENGTH {
+		return nil, NewInvalidAddressError()
+	}
+
+	dbase := state.GetAndLockDB()
+	defer state.UnlockDB()
+
+	fetcher, ok := dbase.(addressTransactionFetcher)
+	if !ok {
+		return nil, NewInternalDatabaseError()
+	}
+
+	txs, total, err := fetcher.FetchAddressTransactions(primitives.NewHash(adr), uint32(req.Start), uint32(req.Count))
+	if err != nil {
+		return nil, NewCustomInternalError(err.Error())
+	}
+
+	resp := new(AddressTransactionsResponse)
+	resp.Transactions = []AddressTransactionResponse{}
+	for _, tx := range txs {
+		t := AddressTransactionResponse{}
+		t.TxID = tx.TxID.String()
+		t.DBHeight = int64(tx.DBHeight)
+		resp.Transactions = append(resp.Transactions, t)
+	}
+	resp.Total = int64(total)
+	if req.Start+int64(len(txs)) < resp.Total {
+		resp.NextStart = req.Start + int64(len(txs))
+	}
+
+	return resp, nil
+}
+
+type balanceHistoryFetcher interface {
+	FetchBalancesAtHeight(dbheight uint32) (*databaseOverlay.BalanceCheckpoint, error)
+}
+
+// HandleV2BalanceAtHeight returns the balance an FCT or EC address had once
+// the given directory block height was processed.
+func HandleV2BalanceAtHeight(state interfaces.IState, params interface{}) (interface{}, *primitives.JSONError) {
+	n := time.Now()
+	defer HandleV2APICallBalanceAtHeight.Observe(float64(time.Since(n).Nanoseconds()))
+
+	req := new(BalanceAtHeightRequest)
+	err := MapToObject(params, req)
+	if err != nil {
+		return nil, NewInvalidParamsError()
+	}
+	if req.Height < 0 || req.Height > int64(state.GetHighestSavedBlk()) {
+		return nil, NewBlockNotFoundError()
+	}
+
+	isFactoid := primitives.ValidateFUserStr(req.Address)
+	if !isFactoid && !primitives.ValidateECUserStr(req.Address) {
+		return nil, NewInvalidAddressError()
+	}
+	var adr [32]byte
+	copy(adr[:], primitives.ConvertUserStrToAddress(req.Address))
+
+	dbase := state.GetAndLockDB()
+	defer state.UnlockDB()
+
+	fetcher, ok := dbase.(balanceHistoryFetcher)
+	if !ok {
+		return nil, NewInternalDatabaseError()
+	}
+
+	balances, err := fetcher.FetchBalancesAtHeight(uint32(req.Height))
+	if err != nil {
+		return nil, NewCustomInternalError(err.Error())
+	}
+
+	resp := new(BalanceAtHeightResponse)
+	resp.Height = req.Height
+	if isFactoid {
+		resp.Balance = balances.FactoidBalances[adr]
+	} else {
+		resp.Balance = balances.ECBalances[adr]
+	}
+	return resp, nil
+}
+
+// Most entries returned by one search-entries call
+const MaxSearchEntriesCount = 100
+
+type extIDSearcher interface {
+	SearchEntriesByExtID(prefix []byte, chainID interfaces.IHash, cursor []byte, limit uint32) ([]*databaseOverlay.ExtIDMatch, []byte, error)
+}
+
+// HandleV2SearchEntries finds the entries with an ExtID starting with the
+// given prefix, optionally only in one chain, a page at a time.  It needs the
+// ExtID index to be enabled in the config.
+func HandleV2SearchEntries(state interfaces.IState, params interface{}) (interface{}, *primitives.JSONError) {
+	n := time.Now()
+	defer HandleV2APICallSearchEntries.Observe(float64(time.Since(n).Nanoseconds()))
+
+	req := new(SearchEntriesRequest)
+	err := MapToObject(params, req)
+	if err != nil {
+		return nil, NewInvalidParamsError()
+	}
+	if req.Count < 0 {
+		return nil, NewInvalidParamsError()
+	}
+	if req.Count == 0 || req.Count > MaxSearchEntriesCount {
+		req.Count = MaxSearchEntriesCount
+	}
+
+	prefix, err := hex.DecodeString(req.ExtID)
+	if err != nil || len(prefix) < databaseOverlay.MinExtIDSearchPrefix {
+		return nil, NewCustomInvalidParamsError(fmt.Sprintf("ExtID prefix must be hex of at least %d bytes", databaseOverlay.MinExtIDSearchPrefix))
+	}
+
+	var cursor []byte
+	if req.Cursor != "" {
+		cursor, err = hex.DecodeString(req.Cursor)
+		if err != nil || !bytes.HasPrefix(cursor, prefix) {
+			return nil, NewCustomInvalidParamsError("Invalid cursor")
+		}
+	}
+
+	var chainID interfaces.IHash
+	if req.ChainID != "" {
+		chainID, err = primitives.HexToHash(req.ChainID)
+		if err != nil {
+			return nil, NewInvalidHashError()
+		}
+	}
+
+	dbase := state.GetAndLockDB()
+	defer state.UnlockDB()
+
+	searcher, ok := dbase.(extIDSearcher)
+	if !ok {
+		return nil, NewInternalDatabaseError()
+	}
+
+	matches, next, err := searcher.SearchEntriesByExtID(prefix, chainID, cursor, uint32(req.Count))
+	if err != nil {
+		return nil, NewCustomInternalError(err.Error())
+	}
+
+	resp := new(SearchEntriesResponse)
+	resp.Entries = []SearchEntriesMatch{}
+	for _, m := range matches {
+		e := SearchEntriesMatch{}
+		e.ChainID = m.ChainID.String()
+		e.EntryHash = m.EntryHash.String()
+		resp.Entries = append(resp.Entries, e)
+	}
+	if next != nil {
+		resp.NextCursor = hex.EncodeToString(next)
+	}
+
+	return resp, nil
+}
+
 func HandleV2Heights(state interfaces.IState, params interface{}) (interface{}, *primitives.JSONError) {
 	n := time.Now()
 	defer HandleV2APICallHeights.Observe(float64(time.Since(n).Nanoseconds()))
@@ -2,6 +2,7 @@ package wsapi_test
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -272,6 +273,35 @@ func TestHandleV2GetReceipt(t *testing.T) {
 	}
 }
 
+func TestHandleV2GetTransactionReceipts(t *testing.T) {
+	state := testHelper.CreateAndPopulateTestState()
+	block := testHelper.CreateFullTestBlockSet()[0]
+
+	requests := []*ReceiptRequest{
+		{Hash: block.FBlock.GetTransactions()[0].GetSigHash().String(), Type: receipts.ReceiptTypeFactoid},
+		{Hash: block.ECBlock.GetEntryHashes()[0].String(), Type: receipts.ReceiptTypeEntryCredit},
+	}
+	for _, request := range requests {
+		resp, jErr := HandleV2Receipt(state, request)
+		if jErr != nil {
+			t.Errorf("%v", jErr)
+			continue
+		}
+		receipt := resp.(*ReceiptResponse).Receipt
+		if receipt.GetType() != request.Type {
+			t.Errorf("Receipt type is %v, not %v", receipt.GetType(), request.Type)
+		}
+		if err := receipts.VerifyReceipt(receipt, nil); err != nil {
+			t.Error(err)
+		}
+	}
+
+	_, jErr := HandleV2Receipt(state, &ReceiptRequest{Hash: requests[0].Hash, Type: "admin"})
+	if jErr == nil {
+		t.Error("Receipt of an unknown type did not fail")
+	}
+}
+
 func TestHandleV2GetTranasction(t *testing.T) {
 	state := testHelper.CreateAndPopulateTestState()
 	blocks := testHelper.CreateFullTestBlockSet()
@@ -479,3 +509,240 @@ func Test_ecBlockToResp(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleV2BlocksByHeightRange(t *testing.T) {
+	state := testHelper.CreateAndPopulateTestState()
+
+	req := new(HeightRangeRequest)
+	req.Start = 0
+	req.Count = 3
+	resp, jerr := HandleV2BlocksByHeightRange(state, req, "f")
+	if jerr != nil {
+		t.Fatalf("%v", jerr)
+	}
+	r := resp.(*BlockHeightRangeResponse)
+	if len(r.Blocks) != 3 {
+		t.Errorf("Expected 3 blocks, got %v", len(r.Blocks))
+	}
+	if r.NextCursor != "" {
+		t.Errorf("Unexpected cursor %v", r.NextCursor)
+	}
+	for i, b := range r.Blocks {
+		if b.Height != int64(i) {
+			t.Errorf("Wrong height - %v vs %v", b.Height, i)
+		}
+		if b.Block.(*BlockHeightResponse).FBlock == nil {
+			t.Errorf("No fblock at height %v", i)
+		}
+	}
+
+	// Page through everything, entries included
+	req = new(HeightRangeRequest)
+	req.Start = 0
+	req.Count = int64(testHelper.BlockCount) + 100
+	req.IncludeEBlocks = true
+	req.IncludeEntries = true
+	heights := 0
+	entries := 0
+	for pages := 0; ; pages++ {
+		if pages > testHelper.BlockCount {
+			t.Fatalf("Paging does not end")
+		}
+		resp, jerr = HandleV2BlocksByHeightRange(state, req, "d")
+		if jerr != nil {
+			t.Fatalf("%v", jerr)
+		}
+		r = resp.(*BlockHeightRangeResponse)
+		if len(r.Blocks) > MaxHeightRangeEntriesCount {
+			t.Errorf("Page too big - %v", len(r.Blocks))
+		}
+		for _, b := range r.Blocks {
+			if b.Height != int64(heights) {
+				t.Errorf("Wrong height - %v vs %v", b.Height, heights)
+			}
+			heights++
+			entries += len(b.Entries)
+		}
+		if r.NextCursor == "" {
+			break
+		}
+		req.Cursor = r.NextCursor
+	}
+	if heights != testHelper.BlockCount {
+		t.Errorf("Expected %v heights, got %v", testHelper.BlockCount, heights)
+	}
+	if entries == 0 {
+		t.Errorf("No entries returned")
+	}
+
+	req = new(HeightRangeRequest)
+	req.Start = int64(testHelper.BlockCount) + 10
+	req.Count = 1
+	_, jerr = HandleV2BlocksByHeightRange(state, req, "a")
+	if jerr == nil {
+		t.Errorf("Range past the top of the chain was found")
+	}
+
+	req = new(HeightRangeRequest)
+	req.Cursor = "bad"
+	_, jerr = HandleV2BlocksByHeightRange(state, req, "a")
+	if jerr == nil {
+		t.Errorf("Bad cursor was accepted")
+	}
+}
+
+func TestHandleV2AddressTransactions(t *testing.T) {
+	state := testHelper.CreateAndPopulateTestState()
+
+	_, _, adr := testHelper.NewFactoidAddressStrings(0)
+	req := new(AddressTransactionsRequest)
+	req.Address = adr
+	_, jerr := HandleV2AddressTransactions(state, req)
+	if jerr == nil {
+		t.Errorf("Got address transactions without the index")
+	}
+
+	state.DB.SetAddressIndex()
+	err := state.DB.BackfillAddressIndex()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	req.Count = 1
+	resp, jerr := HandleV2AddressTransactions(state, req)
+	if jerr != nil {
+		t.Fatalf("%v", jerr)
+	}
+	r := resp.(*AddressTransactionsResponse)
+	if r.Total == 0 {
+		t.Fatalf("No transactions found for %v", adr)
+	}
+	if len(r.Transactions) != 1 {
+		t.Errorf("Expected 1 transaction, got %v", len(r.Transactions))
+	}
+	if r.Total > 1 && r.NextStart != 1 {
+		t.Errorf("Wrong next start - %v", r.NextStart)
+	}
+
+	req.Address = "bad"
+	_, jerr = HandleV2AddressTransactions(state, req)
+	if jerr == nil {
+		t.Errorf("Bad address was accepted")
+	}
+}
+
+func TestHandleV2BalanceAtHeight(t *testing.T) {
+	state := testHelper.CreatePopulateAndExecuteTestState()
+
+	_, _, adr := testHelper.NewFactoidAddressStrings(0)
+	req := new(BalanceAtHeightRequest)
+	req.Address = adr
+	req.Height = int64(state.GetHighestSavedBlk())
+	resp, jerr := HandleV2BalanceAtHeight(state, req)
+	if jerr != nil {
+		t.Fatalf("%v", jerr)
+	}
+	bal := resp.(*BalanceAtHeightResponse).Balance
+	expected := state.GetFactoidState().GetFactoidBalance(testHelper.NewFactoidAddress(0).Fixed())
+	if bal != expected || bal <= 0 {
+		t.Errorf("Invalid balance returned - %v vs %v", bal, expected)
+	}
+
+	req.Height = 0
+	resp, jerr = HandleV2BalanceAtHeight(state, req)
+	if jerr != nil {
+		t.Fatalf("%v", jerr)
+	}
+	if resp.(*BalanceAtHeightResponse).Balance > bal {
+		t.Errorf("Balance at 0 is more than the current one")
+	}
+
+	req.Height = int64(state.GetHighestSavedBlk()) + 1
+	_, jerr = HandleV2BalanceAtHeight(state, req)
+	if jerr == nil {
+		t.Errorf("Got a balance past the top of the chain")
+	}
+
+	req.Height = 0
+	req.Address = "bad"
+	_, jerr = HandleV2BalanceAtHeight(state, req)
+	if jerr == nil {
+		t.Errorf("Bad address was accepted")
+	}
+}
+
+func TestHandleV2SearchEntries(t *testing.T) {
+	state := testHelper.CreateAndPopulateTestState()
+
+	req := new(SearchEntriesRequest)
+	req.ExtID = hex.EncodeToString([]byte("ExtID"))
+	_, jerr := HandleV2SearchEntries(state, req)
+	if jerr == nil {
+		t.Errorf("Searched entries without the index")
+	}
+
+	state.DB.SetExtIDIndex()
+	err := state.DB.BackfillExtIDIndex()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Page through two at a time
+	req.Count = 2
+	found := map[string]bool{}
+	for {
+		resp, jerr := HandleV2SearchEntries(state, req)
+		if jerr != nil {
+			t.Fatalf("%v", jerr)
+		}
+		r := resp.(*SearchEntriesResponse)
+		if len(r.Entries) > 2 {
+			t.Errorf("Expected at most 2 entries, got %v", len(r.Entries))
+		}
+		for _, e := range r.Entries {
+			if e.ChainID != testHelper.GetChainID().String() {
+				t.Errorf("Entry %v from the wrong chain %v", e.EntryHash, e.ChainID)
+			}
+			if found[e.EntryHash] {
+				t.Errorf("Entry %v returned twice", e.EntryHash)
+			}
+			found[e.EntryHash] = true
+		}
+		if r.NextCursor == "" {
+			break
+		}
+		req.Cursor = r.NextCursor
+	}
+	if len(found) <= 2 {
+		t.Fatalf("Not enough entries found - %v", len(found))
+	}
+
+	req.Cursor = "not hex"
+	_, jerr = HandleV2SearchEntries(state, req)
+	if jerr == nil {
+		t.Errorf("Bad cursor was accepted")
+	}
+	req.Cursor = ""
+
+	req.ChainID = testHelper.GetAnchorChainID().String()
+	resp, jerr := HandleV2SearchEntries(state, req)
+	if jerr != nil {
+		t.Fatalf("%v", jerr)
+	}
+	if len(resp.(*SearchEntriesResponse).Entries) != 0 {
+		t.Errorf("Found entries in the wrong chain")
+	}
+
+	req.ChainID = ""
+	req.ExtID = "not hex"
+	_, jerr = HandleV2SearchEntries(state, req)
+	if jerr == nil {
+		t.Errorf("Bad ExtID was accepted")
+	}
+
+	req.ExtID = hex.EncodeToString([]byte("E"))
+	_, jerr = HandleV2SearchEntries(state, req)
+	if jerr == nil {
+		t.Errorf("Too short an ExtID was accepted")
+	}
+}